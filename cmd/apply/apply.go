@@ -0,0 +1,51 @@
+package apply
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/compression"
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+	"github.com/kiy7086/dtbotool/cmd/input"
+	"github.com/kiy7086/dtbotool/cmd/overlay"
+)
+
+// HandleApply 将一个或多个 overlay 依次应用到基础DTB并写出合并结果。
+// overlay 可以是单个 DTBO 文件，也可以是 DTBO 镜像及其条目选择器
+func HandleApply(base string, overlays []string, output string) error {
+	baseItem, err := input.LoadOne(base)
+	if err != nil {
+		return err
+	}
+	tree := baseItem.Tree.Clone()
+
+	applied := 0
+	for _, spec := range overlays {
+		items, err := input.Load(spec)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if !item.Tree.IsOverlay() {
+				return fmt.Errorf("%s 不是 overlay", item.Name)
+			}
+			if err := overlay.Apply(tree, item.Tree); err != nil {
+				return fmt.Errorf("应用 %s 失败: %v", item.Name, err)
+			}
+			fmt.Printf("已应用 overlay: %s\n", item.Name)
+			applied++
+		}
+	}
+
+	if output == "" {
+		name := compression.TrimExt(base)
+		output = strings.TrimSuffix(name, filepath.Ext(name)) + "_merged.dtb"
+	}
+	if err := fdt.WriteFile(output, tree); err != nil {
+		return err
+	}
+
+	fmt.Printf("已将 %d 个 overlay 应用到 %s，输出: %s\n", applied, baseItem.Name, output)
+	return nil
+}
@@ -0,0 +1,219 @@
+// Package binding 加载 dt-schema 格式的 YAML 绑定文件 (内核源码中的
+// Documentation/devicetree/bindings)，并按 compatible 校验设备树节点。
+//
+// 只实现绑定中常用的 JSON Schema 关键字: $ref、allOf/anyOf/oneOf、
+// if/then/else、properties、patternProperties、required、
+// additionalProperties、unevaluatedProperties、const、enum、pattern、
+// minimum/maximum、items、minItems/maxItems 和 contains。
+// types.yaml 中的类型定义是内置的，不需要 dt-schema 的核心绑定
+package binding
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/yaml"
+)
+
+// Schema 一个绑定文件
+type Schema struct {
+	ID          string // 规范化的 $id，如 /schemas/serial/serial.yaml
+	File        string // 相对于绑定目录的路径
+	Root        map[string]any
+	Compatibles []string // properties.compatible 中列出的所有字符串
+}
+
+// Set 绑定目录中的所有绑定
+type Set struct {
+	Schemas      []*Schema
+	byID         map[string]*Schema
+	byCompatible map[string][]*Schema
+	selectors    []*Schema // 使用 select 自定义匹配规则的绑定
+}
+
+// Load 递归加载目录中的 .yaml 绑定文件。无法解析的文件作为警告返回
+func Load(dir string) (*Set, []string, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取绑定目录失败: %v", err)
+	}
+	if !info.IsDir() {
+		return nil, nil, fmt.Errorf("'%s' 不是目录", dir)
+	}
+
+	s := &Set{
+		byID:         make(map[string]*Schema),
+		byCompatible: make(map[string][]*Schema),
+	}
+	var warnings []string
+	err = filepath.WalkDir(dir, func(file string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(file, ".yaml") {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, file)
+		rel = filepath.ToSlash(rel)
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		doc, err := yaml.Parse(data)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s: %v", rel, err))
+			return nil
+		}
+		root, ok := doc.(map[string]any)
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("%s: 不是映射", rel))
+			return nil
+		}
+		s.add(&Schema{File: rel, Root: root}, "/schemas/"+rel)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取绑定目录失败: %v", err)
+	}
+	if len(s.Schemas) == 0 {
+		return nil, warnings, fmt.Errorf("'%s' 中没有绑定文件", dir)
+	}
+	return s, warnings, nil
+}
+
+func (s *Set) add(sc *Schema, fileID string) {
+	sc.ID = fileID
+	if id, ok := sc.Root["$id"].(string); ok {
+		sc.ID = normalizeID(id)
+		s.byID[sc.ID] = sc
+	}
+	// 也允许按文件路径引用，兼容 $id 与位置不一致的绑定
+	if _, exists := s.byID[fileID]; !exists {
+		s.byID[fileID] = sc
+	}
+	s.Schemas = append(s.Schemas, sc)
+
+	switch sc.Root["select"].(type) {
+	case bool:
+		// select: false 表示只被其他绑定引用，select: true 是
+		// dt-schema 的核心绑定，都不直接匹配节点
+		return
+	case map[string]any:
+		s.selectors = append(s.selectors, sc)
+		return
+	}
+
+	if props, ok := sc.Root["properties"].(map[string]any); ok {
+		seen := make(map[string]bool)
+		collectStrings(props["compatible"], func(c string) {
+			if !seen[c] {
+				seen[c] = true
+				sc.Compatibles = append(sc.Compatibles, c)
+				s.byCompatible[c] = append(s.byCompatible[c], sc)
+			}
+		})
+	}
+}
+
+// normalizeID 去掉 $id 和 $ref 中的域名和片段
+func normalizeID(id string) string {
+	id, _, _ = strings.Cut(id, "#")
+	if i := strings.Index(id, "://"); i >= 0 {
+		id = id[i+3:]
+		if j := strings.IndexByte(id, '/'); j >= 0 {
+			id = id[j:]
+		}
+	}
+	return id
+}
+
+// collectStrings 收集 compatible 模式中 const、enum、items 等列出的字符串
+func collectStrings(v any, fn func(string)) {
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			switch k {
+			case "const":
+				if c, ok := v[k].(string); ok {
+					fn(c)
+				}
+			case "enum", "items", "oneOf", "anyOf", "allOf", "contains":
+				collectStrings(v[k], fn)
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if c, ok := item.(string); ok {
+				fn(c)
+			} else {
+				collectStrings(item, fn)
+			}
+		}
+	}
+}
+
+// Match 返回适用于 compatible 列表的绑定
+func (s *Set) Match(compatibles []string) []*Schema {
+	var matched []*Schema
+	seen := make(map[*Schema]bool)
+	for _, c := range compatibles {
+		for _, sc := range s.byCompatible[c] {
+			if !seen[sc] {
+				seen[sc] = true
+				matched = append(matched, sc)
+			}
+		}
+	}
+	return matched
+}
+
+// resolve 解析 $ref，返回引用的子模式及其所在的绑定
+func (s *Set) resolve(from *Schema, ref string) (any, *Schema, bool) {
+	file, pointer, _ := strings.Cut(ref, "#")
+	target := from
+	if file != "" {
+		id := normalizeID(file)
+		if !strings.HasPrefix(id, "/") {
+			id = path.Join(path.Dir(from.ID), id)
+		}
+		if target = s.byID[id]; target == nil {
+			return nil, nil, false
+		}
+	}
+
+	var v any = target.Root
+	for _, part := range strings.Split(strings.Trim(pointer, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, nil, false
+		}
+		if v, ok = m[part]; !ok {
+			return nil, nil, false
+		}
+	}
+	return v, target, true
+}
+
+// typesRef 返回指向 types.yaml 类型定义的引用中的类型名
+func typesRef(ref string) (string, bool) {
+	file, pointer, _ := strings.Cut(ref, "#")
+	if path.Base(normalizeID(file)) != "types.yaml" {
+		return "", false
+	}
+	name, ok := strings.CutPrefix(strings.TrimPrefix(pointer, "/"), "definitions/")
+	return name, ok
+}
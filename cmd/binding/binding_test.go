@@ -0,0 +1,252 @@
+package binding
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+	"github.com/kiy7086/dtbotool/cmd/internal/dtstest"
+)
+
+var testBindings = map[string]string{
+	"serial/serial.yaml": `# SPDX-License-Identifier: GPL-2.0
+%YAML 1.2
+---
+$id: http://devicetree.org/schemas/serial/serial.yaml#
+$schema: http://devicetree.org/meta-schemas/core.yaml#
+
+title: Serial common properties
+
+select: false
+
+properties:
+  current-speed:
+    $ref: /schemas/types.yaml#/definitions/uint32
+    enum: [ 9600, 115200 ]
+`,
+	"serial/vendor,uart.yaml": `$id: http://devicetree.org/schemas/serial/vendor,uart.yaml#
+title: Vendor UART
+
+allOf:
+  - $ref: serial.yaml#
+
+properties:
+  compatible:
+    const: vendor,uart
+  reg:
+    maxItems: 1
+  interrupts:
+    maxItems: 1
+  clock-names:
+    const: core
+  mode:
+    description: >
+      Operating
+      mode
+    $ref: /schemas/types.yaml#/definitions/string
+    enum:
+      - fast
+      - slow
+
+patternProperties:
+  "^pinmux-[0-9]+$":
+    $ref: /schemas/types.yaml#/definitions/uint32
+    maximum: 7
+
+required:
+  - compatible
+  - reg
+
+unevaluatedProperties: false
+`,
+	"timer/vendor,timer.yaml": `$id: http://devicetree.org/schemas/timer/vendor,timer.yaml#
+title: Vendor timer
+
+properties:
+  compatible:
+    items:
+      - const: vendor,timer
+  interrupts:
+    maxItems: 1
+
+required: [ compatible, interrupts ]
+
+additionalProperties: false
+`,
+	"broken.yaml": "properties: [\n",
+	"list.yaml":   "- a\n- b\n",
+}
+
+const testSource = `/dts-v1/;
+/ {
+	#address-cells = <1>;
+	#size-cells = <1>;
+	intc: intc { interrupt-controller; #interrupt-cells = <1>; };
+	serial@1000 {
+		compatible = "vendor,uart";
+		reg = <0x1000 0x100>;
+		interrupt-parent = <&intc>;
+		interrupts = <1>;
+		clock-names = "core";
+		current-speed = <115200>;
+		mode = "fast";
+		pinmux-0 = <3>;
+		status = "okay";
+	};
+	timer {
+		compatible = "vendor,timer";
+		interrupt-parent = <&intc>;
+		interrupts = <2>;
+	};
+	other { compatible = "vendor,other"; };
+};
+`
+
+func loadTestBindings(t *testing.T) *Set {
+	dir := t.TempDir()
+	for name, data := range testBindings {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	set, warnings, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 2 || !strings.HasPrefix(warnings[0], "broken.yaml: ") || warnings[1] != "list.yaml: 不是映射" {
+		t.Errorf("警告 = %q", warnings)
+	}
+	return set
+}
+
+func TestLoad(t *testing.T) {
+	set := loadTestBindings(t)
+	if len(set.Schemas) != 3 {
+		t.Fatalf("加载了 %d 个绑定, 期望 3", len(set.Schemas))
+	}
+
+	var files []string
+	for _, sc := range set.Match([]string{"vendor,timer", "vendor,uart", "vendor,serial"}) {
+		files = append(files, sc.File)
+	}
+	if want := []string{"timer/vendor,timer.yaml", "serial/vendor,uart.yaml"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("匹配的绑定 = %q, 期望 %q", files, want)
+	}
+	if len(set.Match([]string{"vendor,serial"})) != 0 {
+		t.Error("select: false 的绑定不应直接匹配节点")
+	}
+
+	uart := set.byID["/schemas/serial/vendor,uart.yaml"]
+	if uart == nil {
+		t.Fatal("没有按 $id 登记绑定")
+	}
+	if _, target, ok := set.resolve(uart, "serial.yaml#/properties/current-speed"); !ok || target.File != "serial/serial.yaml" {
+		t.Error("无法解析相对路径的 $ref")
+	}
+
+	if _, _, err := Load(t.TempDir()); err == nil {
+		t.Error("空目录应当报错")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	set := loadTestBindings(t)
+
+	r := set.Validate(dtstest.Compile(t, testSource))
+	if len(r.Issues) > 0 {
+		t.Errorf("意外的问题: %v", r.Issues)
+	}
+	if r.Checked != 2 || !reflect.DeepEqual(r.Unmatched, []string{"/other"}) {
+		t.Errorf("Checked = %d, Unmatched = %q", r.Checked, r.Unmatched)
+	}
+
+	tests := []struct {
+		name string
+		edit func(t *fdt.Tree)
+		want string
+	}{
+		{
+			name: "required",
+			edit: func(t *fdt.Tree) { t.Lookup("/serial@1000").RemoveProperty("reg") },
+			want: "缺少必需属性 reg",
+		},
+		{
+			name: "const",
+			edit: func(t *fdt.Tree) { t.Lookup("/serial@1000").SetProperty("clock-names", fdt.StringValue("bus")) },
+			want: `clock-names 的值 "bus" 应为 "core"`,
+		},
+		{
+			name: "enum",
+			edit: func(t *fdt.Tree) { t.Lookup("/serial@1000").SetProperty("mode", fdt.StringValue("medium")) },
+			want: `mode 的值 "medium"`,
+		},
+		{
+			name: "$ref 到其他绑定",
+			edit: func(t *fdt.Tree) { t.Lookup("/serial@1000").SetProperty("current-speed", fdt.U32Value(1)) },
+			want: "current-speed 的值 1",
+		},
+		{
+			name: "$ref 到 types.yaml",
+			edit: func(t *fdt.Tree) { t.Lookup("/serial@1000").SetProperty("mode", fdt.U32Value(1)) },
+			want: "mode 的类型应为 string",
+		},
+		{
+			name: "patternProperties",
+			edit: func(t *fdt.Tree) { t.Lookup("/serial@1000").SetProperty("pinmux-1", fdt.U32Value(9)) },
+			want: "pinmux-1 的值 9 超过最大值 7",
+		},
+		{
+			name: "unevaluatedProperties",
+			edit: func(t *fdt.Tree) { t.Lookup("/serial@1000").SetProperty("vendor,extra", nil) },
+			want: "未知属性 vendor,extra",
+		},
+		{
+			name: "additionalProperties",
+			edit: func(t *fdt.Tree) { t.Lookup("/timer").SetProperty("vendor,extra", nil) },
+			want: "未知属性 vendor,extra",
+		},
+		{
+			name: "items 中的 const",
+			edit: func(t *fdt.Tree) {
+				t.Lookup("/timer").SetProperty("compatible", fdt.StringValue("vendor,timer2", "vendor,timer"))
+			},
+			want: `compatible 的值 "vendor,timer2" 应为 "vendor,timer"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := dtstest.Compile(t, testSource)
+			tt.edit(tree)
+			r := set.Validate(tree)
+			found := false
+			for _, is := range r.Issues {
+				found = found || strings.Contains(is.Message, tt.want)
+			}
+			if !found {
+				t.Errorf("问题 = %v, 期望包含 %q", r.Issues, tt.want)
+			}
+		})
+	}
+}
+
+// TestValidateInterrupts 描述了 interrupts 的绑定同时允许 interrupt-parent 和 interrupts-extended
+func TestValidateInterrupts(t *testing.T) {
+	set := loadTestBindings(t)
+	tree := dtstest.Compile(t, testSource)
+	timer := tree.Lookup("/timer")
+	timer.RemoveProperty("interrupts")
+	timer.SetProperty("interrupts-extended", fdt.CellsValue(1, 2))
+
+	for _, is := range set.Validate(tree).Issues {
+		if strings.Contains(is.Message, "未知属性") {
+			t.Errorf("意外的问题: %v", is)
+		}
+	}
+}
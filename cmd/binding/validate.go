@@ -0,0 +1,625 @@
+package binding
+
+import (
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/decode"
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// Issue 一个校验问题
+type Issue struct {
+	Path    string // 节点路径
+	Schema  string // 绑定文件
+	Message string
+}
+
+// Report 一个设备树的校验结果
+type Report struct {
+	Issues    []Issue
+	Checked   int      // 匹配到绑定的节点数
+	Unmatched []string // 有 compatible 但没有匹配绑定的节点
+}
+
+// 所有节点都允许出现的属性，对应 dt-schema 自动添加的核心属性
+var commonProps = regexp.MustCompile(`^(status|secure-status|phandle|linux,phandle|pinctrl-names|pinctrl-[0-9]+|assigned-clocks|assigned-clock-rates|assigned-clock-parents|bootph-.*)$`)
+
+// 不参与校验的特殊节点
+var specialNodes = map[string]bool{
+	"__symbols__":      true,
+	"__fixups__":       true,
+	"__local_fixups__": true,
+}
+
+// Validate 按 compatible 找到每个节点的绑定并校验
+func (s *Set) Validate(t *fdt.Tree) *Report {
+	v := &validator{set: s, dec: decode.New(t), patterns: make(map[string]*regexp.Regexp)}
+	report := &Report{}
+
+	var walk func(n *fdt.Node)
+	walk = func(n *fdt.Node) {
+		if specialNodes[n.Name] {
+			return
+		}
+		if p := n.Property("compatible"); p != nil && p.IsStringList() {
+			schemas := v.match(n, p.Strings())
+			if len(schemas) == 0 {
+				report.Unmatched = append(report.Unmatched, n.Path())
+			} else {
+				report.Checked++
+			}
+			for _, sc := range schemas {
+				r := v.newResult(sc)
+				v.node(sc.Root, sc, n, r, 0)
+				report.Issues = append(report.Issues, r.issues...)
+			}
+		}
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(t.Root)
+
+	report.Issues = dedupe(report.Issues)
+	return report
+}
+
+func dedupe(issues []Issue) []Issue {
+	seen := make(map[Issue]bool)
+	out := issues[:0]
+	for _, is := range issues {
+		if !seen[is] {
+			seen[is] = true
+			out = append(out, is)
+		}
+	}
+	return out
+}
+
+type validator struct {
+	set      *Set
+	dec      *decode.Decoder
+	patterns map[string]*regexp.Regexp
+}
+
+// match 返回适用于节点的绑定，包括 select 条件成立的绑定
+func (v *validator) match(n *fdt.Node, compatibles []string) []*Schema {
+	schemas := v.set.Match(compatibles)
+	for _, sc := range v.set.selectors {
+		r := v.newResult(sc)
+		v.node(sc.Root["select"], sc, n, r, 0)
+		if len(r.issues) == 0 {
+			schemas = append(schemas, sc)
+		}
+	}
+	return schemas
+}
+
+// result 对一个节点应用模式的中间结果
+type result struct {
+	schema     *Schema
+	issues     []Issue
+	evaluated  map[string]bool // 已被某个子模式评估过的属性和子节点
+	unresolved bool            // 存在无法解析的 $ref，未知属性检查不可靠
+}
+
+func (v *validator) newResult(sc *Schema) *result {
+	return &result{schema: sc, evaluated: make(map[string]bool)}
+}
+
+func (r *result) errorf(n *fdt.Node, format string, args ...any) {
+	r.issues = append(r.issues, Issue{Path: n.Path(), Schema: r.schema.File, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) regexp(pattern string) *regexp.Regexp {
+	re, ok := v.patterns[pattern]
+	if !ok {
+		// Go 不支持的正则 (如前瞻) 编译失败时为 nil
+		re, _ = regexp.Compile(pattern)
+		v.patterns[pattern] = re
+	}
+	return re
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func list(v any) []any {
+	l, _ := v.([]any)
+	return l
+}
+
+// node 对节点应用模式
+func (v *validator) node(s any, owner *Schema, n *fdt.Node, r *result, depth int) {
+	m, ok := s.(map[string]any)
+	if !ok || depth > 32 {
+		if s == false {
+			r.errorf(n, "不允许出现该节点")
+		}
+		return
+	}
+
+	if ref, ok := m["$ref"].(string); ok {
+		if sub, o, ok := v.set.resolve(owner, ref); ok {
+			v.node(sub, o, n, r, depth+1)
+		} else if _, isType := typesRef(ref); !isType {
+			r.unresolved = true
+		}
+	}
+	for _, sub := range list(m["allOf"]) {
+		v.node(sub, owner, n, r, depth+1)
+	}
+	for _, kw := range []string{"anyOf", "oneOf"} {
+		if subs := list(m[kw]); len(subs) > 0 {
+			v.anyOf(kw, subs, n, r, func(sub any, br *result) {
+				v.node(sub, owner, n, br, depth+1)
+			})
+		}
+	}
+	if cond, ok := m["if"]; ok {
+		test := v.newResult(r.schema)
+		v.node(cond, owner, n, test, depth+1)
+		branch := m["then"]
+		if len(test.issues) > 0 {
+			branch = m["else"]
+		}
+		if branch != nil {
+			v.node(branch, owner, n, r, depth+1)
+		}
+	}
+
+	local := make(map[string]bool)
+	props, _ := m["properties"].(map[string]any)
+	for _, name := range sortedKeys(props) {
+		sub := props[name]
+		if name == "$nodename" {
+			v.value(sub, owner, nodeName(n), r, depth+1)
+			continue
+		}
+		local[name] = true
+		if p := n.Property(name); p != nil {
+			v.value(sub, owner, v.newValue(n, p, sub, owner), r, depth+1)
+		} else if c := child(n, name); c != nil {
+			v.child(sub, owner, c, r, depth+1)
+		}
+	}
+	// dt-schema 为描述了 interrupts 的模式自动加入 interrupt-parent 和 interrupts-extended
+	if _, ok := props["interrupts"]; ok {
+		local["interrupt-parent"] = true
+		local["interrupts-extended"] = true
+	}
+
+	patterns, _ := m["patternProperties"].(map[string]any)
+	for _, pattern := range sortedKeys(patterns) {
+		sub := patterns[pattern]
+		re := v.regexp(pattern)
+		if re == nil {
+			r.unresolved = true
+			continue
+		}
+		for _, p := range n.Properties {
+			if re.MatchString(p.Name) {
+				local[p.Name] = true
+				v.value(sub, owner, v.newValue(n, p, sub, owner), r, depth+1)
+			}
+		}
+		for _, c := range n.Children {
+			if re.MatchString(c.Name) {
+				local[c.Name] = true
+				v.child(sub, owner, c, r, depth+1)
+			}
+		}
+	}
+
+	for _, item := range list(m["required"]) {
+		if name, ok := item.(string); ok && n.Property(name) == nil && child(n, name) == nil {
+			r.errorf(n, "缺少必需属性 %s", name)
+		}
+	}
+	for _, kw := range []string{"dependencies", "dependentRequired"} {
+		deps, _ := m[kw].(map[string]any)
+		for _, name := range sortedKeys(deps) {
+			if n.Property(name) == nil {
+				continue
+			}
+			for _, item := range list(deps[name]) {
+				if dep, ok := item.(string); ok && n.Property(dep) == nil {
+					r.errorf(n, "属性 %s 需要同时存在 %s", name, dep)
+				}
+			}
+		}
+	}
+
+	if m["additionalProperties"] == false {
+		v.unknown(n, local, r)
+	}
+	for name := range local {
+		r.evaluated[name] = true
+	}
+	if m["unevaluatedProperties"] == false && !r.unresolved {
+		v.unknown(n, r.evaluated, r)
+	}
+}
+
+// unknown 报告没有被模式描述的属性和子节点
+func (v *validator) unknown(n *fdt.Node, known map[string]bool, r *result) {
+	for _, p := range n.Properties {
+		if !known[p.Name] && !commonProps.MatchString(p.Name) {
+			r.errorf(n, "未知属性 %s", p.Name)
+		}
+	}
+	for _, c := range n.Children {
+		if !known[c.Name] && !specialNodes[c.Name] {
+			r.errorf(n, "未知子节点 %s", c.Name)
+		}
+	}
+}
+
+// anyOf 至少一个分支成立时合并其结果，否则报告第一个分支的问题
+func (v *validator) anyOf(kw string, subs []any, n *fdt.Node, r *result, apply func(any, *result)) {
+	var first *result
+	for _, sub := range subs {
+		br := v.newResult(r.schema)
+		apply(sub, br)
+		if len(br.issues) == 0 {
+			for name := range br.evaluated {
+				r.evaluated[name] = true
+			}
+			r.unresolved = r.unresolved || br.unresolved
+			return
+		}
+		if first == nil {
+			first = br
+		}
+	}
+	r.errorf(n, "不满足 %s 中的任何一项 (%s)", kw, first.issues[0].Message)
+}
+
+func child(n *fdt.Node, name string) *fdt.Node {
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// child 对子节点应用模式，子节点的属性单独统计是否已评估
+func (v *validator) child(s any, owner *Schema, c *fdt.Node, r *result, depth int) {
+	if m, ok := s.(map[string]any); ok && m["type"] != nil && m["type"] != "object" {
+		r.errorf(c.Parent, "%s 应为属性而不是子节点", c.Name)
+		return
+	}
+	cr := v.newResult(r.schema)
+	v.node(s, owner, c, cr, depth)
+	r.issues = append(r.issues, cr.issues...)
+}
+
+// value 一个待校验的属性值
+type value struct {
+	node  *fdt.Node
+	name  string
+	raw   []byte
+	strs  []string // 按字符串列表解释的值，不是字符串列表时为 nil
+	nums  []uint64 // 按单元 (或 types.yaml 指定的宽度) 解释的数值
+	count int      // 条目数，-1 表示未知
+}
+
+func nodeName(n *fdt.Node) *value {
+	name := n.Name
+	if n.Parent == nil {
+		name = "/"
+	}
+	return &value{node: n, name: "$nodename", raw: []byte(name), strs: []string{name}, count: 1}
+}
+
+// typeOf 查找模式通过 $ref 指定的 types.yaml 类型
+func (v *validator) typeOf(s any, owner *Schema, depth int) string {
+	m, ok := s.(map[string]any)
+	if !ok || depth > 8 {
+		return ""
+	}
+	if ref, ok := m["$ref"].(string); ok {
+		if t, ok := typesRef(ref); ok {
+			return t
+		}
+		if sub, o, ok := v.set.resolve(owner, ref); ok {
+			if t := v.typeOf(sub, o, depth+1); t != "" {
+				return t
+			}
+		}
+	}
+	for _, sub := range list(m["allOf"]) {
+		if t := v.typeOf(sub, owner, depth+1); t != "" {
+			return t
+		}
+	}
+	if m["type"] == "boolean" {
+		return "flag"
+	}
+	return ""
+}
+
+// newValue 按类型解释属性值
+func (v *validator) newValue(n *fdt.Node, p *fdt.Property, s any, owner *Schema) *value {
+	val := &value{node: n, name: p.Name, raw: p.Value, count: -1}
+	typ := v.typeOf(s, owner, 0)
+
+	if strings.Contains(typ, "string") || typ == "" && p.IsStringList() {
+		if p.IsStringList() {
+			val.strs = p.Strings()
+			val.count = len(val.strs)
+		}
+		return val
+	}
+
+	width := 4
+	switch {
+	case strings.HasPrefix(typ, "uint8") || strings.HasPrefix(typ, "int8"):
+		width = 1
+	case strings.HasPrefix(typ, "uint16") || strings.HasPrefix(typ, "int16"):
+		width = 2
+	case strings.HasPrefix(typ, "uint64") || strings.HasPrefix(typ, "int64"):
+		width = 8
+	}
+	if len(p.Value)%width == 0 && !strings.HasSuffix(typ, "matrix") && typ != "phandle-array" {
+		for i := 0; i < len(p.Value); i += width {
+			var x uint64
+			switch width {
+			case 1:
+				x = uint64(p.Value[i])
+			case 2:
+				x = uint64(binary.BigEndian.Uint16(p.Value[i:]))
+			case 4:
+				x = uint64(binary.BigEndian.Uint32(p.Value[i:]))
+			case 8:
+				x = binary.BigEndian.Uint64(p.Value[i:])
+			}
+			val.nums = append(val.nums, x)
+		}
+		// 没有声明类型的单元数组 (如 reg、interrupts) 条目结构未知，
+		// 只有能按单元数解析时才检查条目数
+		if typ != "" {
+			val.count = len(val.nums)
+		}
+	}
+	if count, ok := v.dec.Count(n, p); ok {
+		val.nums = nil
+		val.count = count
+	}
+	return val
+}
+
+// 类型定义对应的值长度要求
+func checkType(typ string, val *value) bool {
+	switch {
+	case typ == "flag":
+		return len(val.raw) == 0
+	case strings.Contains(typ, "string"):
+		return val.strs != nil
+	case typ == "phandle" || typ == "uint32" || typ == "int32":
+		return len(val.raw) == 4
+	case typ == "uint64" || typ == "int64":
+		return len(val.raw) == 8
+	case typ == "uint8" || typ == "int8":
+		return len(val.raw) == 1
+	case typ == "uint16" || typ == "int16":
+		return len(val.raw) == 2
+	case strings.HasPrefix(typ, "uint8") || strings.HasPrefix(typ, "int8"):
+		return len(val.raw) > 0
+	case strings.HasPrefix(typ, "uint16") || strings.HasPrefix(typ, "int16"):
+		return len(val.raw) > 0 && len(val.raw)%2 == 0
+	case strings.HasPrefix(typ, "uint64") || strings.HasPrefix(typ, "int64"):
+		return len(val.raw) > 0 && len(val.raw)%8 == 0
+	case strings.HasPrefix(typ, "uint32") || strings.HasPrefix(typ, "int32") || strings.HasPrefix(typ, "phandle"):
+		return len(val.raw) > 0 && len(val.raw)%4 == 0
+	}
+	return true
+}
+
+// value 对属性值应用模式
+func (v *validator) value(s any, owner *Schema, val *value, r *result, depth int) {
+	m, ok := s.(map[string]any)
+	if !ok || depth > 32 {
+		if s == false {
+			r.errorf(val.node, "不允许出现属性 %s", val.name)
+		}
+		return
+	}
+
+	if ref, ok := m["$ref"].(string); ok {
+		if typ, isType := typesRef(ref); isType {
+			if !checkType(typ, val) {
+				r.errorf(val.node, "%s 的类型应为 %s", val.name, typ)
+				return
+			}
+		} else if sub, o, ok := v.set.resolve(owner, ref); ok {
+			v.value(sub, o, val, r, depth+1)
+		}
+	}
+	for _, sub := range list(m["allOf"]) {
+		v.value(sub, owner, val, r, depth+1)
+	}
+	for _, kw := range []string{"anyOf", "oneOf"} {
+		if subs := list(m[kw]); len(subs) > 0 {
+			v.anyOf(kw, subs, val.node, r, func(sub any, br *result) {
+				v.value(sub, owner, val, br, depth+1)
+			})
+		}
+	}
+
+	switch m["type"] {
+	case "boolean":
+		if len(val.raw) != 0 {
+			r.errorf(val.node, "%s 应为布尔属性 (无值)", val.name)
+		}
+	case "string":
+		if val.strs == nil {
+			r.errorf(val.node, "%s 应为字符串", val.name)
+		}
+	case "object":
+		r.errorf(val.node, "%s 应为子节点而不是属性", val.name)
+	}
+
+	if c, ok := m["const"]; ok {
+		v.each(val, r, func(x any) bool { return equal(x, c) }, func() string {
+			return fmt.Sprintf("应为 %s", format(c))
+		})
+	}
+	if enum := list(m["enum"]); len(enum) > 0 {
+		v.each(val, r, func(x any) bool {
+			for _, e := range enum {
+				if equal(x, e) {
+					return true
+				}
+			}
+			return false
+		}, func() string {
+			return fmt.Sprintf("不在允许的取值 %s 中", format(enum))
+		})
+	}
+	if pattern, ok := m["pattern"].(string); ok {
+		if re := v.regexp(pattern); re != nil && val.strs != nil {
+			for _, s := range val.strs {
+				if !re.MatchString(s) {
+					r.errorf(val.node, "%s 的值 \"%s\" 不匹配 %s", val.name, s, pattern)
+				}
+			}
+		}
+	}
+	if min, ok := number(m["minimum"]); ok {
+		for _, x := range val.nums {
+			if int64(x) < min {
+				r.errorf(val.node, "%s 的值 %d 小于最小值 %d", val.name, x, min)
+			}
+		}
+	}
+	if max, ok := number(m["maximum"]); ok {
+		for _, x := range val.nums {
+			if x > uint64(max) {
+				r.errorf(val.node, "%s 的值 %d 超过最大值 %d", val.name, x, max)
+			}
+		}
+	}
+
+	v.items(m, owner, val, r, depth)
+}
+
+// items 检查条目数、按位置的 items 和 contains
+func (v *validator) items(m map[string]any, owner *Schema, val *value, r *result, depth int) {
+	positional := list(m["items"])
+	minItems, hasMin := number(m["minItems"])
+	maxItems, hasMax := number(m["maxItems"])
+	// 与 dt-schema 一致，列表形式的 items 隐含条目数范围
+	if positional != nil {
+		if !hasMin {
+			minItems, hasMin = int64(len(positional)), true
+		}
+		if !hasMax && m["additionalItems"] == nil {
+			maxItems, hasMax = int64(len(positional)), true
+		}
+	}
+	if val.count >= 0 {
+		if hasMin && int64(val.count) < minItems {
+			r.errorf(val.node, "%s 有 %d 项，至少需要 %d 项", val.name, val.count, minItems)
+		}
+		if hasMax && int64(val.count) > maxItems {
+			r.errorf(val.node, "%s 有 %d 项，最多允许 %d 项", val.name, val.count, maxItems)
+		}
+	}
+
+	elems := val.elements()
+	for i, sub := range positional {
+		if i < len(elems) {
+			v.value(sub, owner, elems[i], r, depth+1)
+		}
+	}
+	if sub, ok := m["items"].(map[string]any); ok {
+		for _, e := range elems {
+			v.value(sub, owner, e, r, depth+1)
+		}
+	}
+	if sub, ok := m["contains"]; ok && len(elems) > 0 {
+		for _, e := range elems {
+			test := v.newResult(r.schema)
+			if v.value(sub, owner, e, test, depth+1); len(test.issues) == 0 {
+				return
+			}
+		}
+		r.errorf(val.node, "%s 中没有满足 contains 条件的项", val.name)
+	}
+}
+
+// elements 把值拆分为单个元素，条目结构未知时返回 nil
+func (val *value) elements() []*value {
+	var elems []*value
+	for _, s := range val.strs {
+		elems = append(elems, &value{node: val.node, name: val.name, raw: append([]byte(s), 0), strs: []string{s}, count: 1})
+	}
+	for _, x := range val.nums {
+		elems = append(elems, &value{node: val.node, name: val.name, raw: fdt.U32Value(uint32(x)), nums: []uint64{x}, count: 1})
+	}
+	return elems
+}
+
+// each 检查每个元素，值的结构未知时跳过
+func (v *validator) each(val *value, r *result, ok func(any) bool, msg func() string) {
+	var elems []any
+	for _, s := range val.strs {
+		elems = append(elems, s)
+	}
+	for _, x := range val.nums {
+		elems = append(elems, x)
+	}
+	for _, x := range elems {
+		if !ok(x) {
+			r.errorf(val.node, "%s 的值 %s %s", val.name, format(x), msg())
+		}
+	}
+}
+
+func number(v any) (int64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v, true
+	case uint64:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+func equal(x, y any) bool {
+	if n, ok := number(y); ok {
+		u, isNum := x.(uint64)
+		return isNum && (u == uint64(n) || int64(int32(uint32(u))) == n)
+	}
+	return fmt.Sprint(x) == fmt.Sprint(y)
+}
+
+func format(v any) string {
+	switch v := v.(type) {
+	case string:
+		return "\"" + v + "\""
+	case uint64:
+		return fmt.Sprintf("%d", v)
+	case []any:
+		parts := make([]string, len(v))
+		for i, x := range v {
+			parts[i] = format(x)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	}
+	return fmt.Sprint(v)
+}
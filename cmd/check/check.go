@@ -0,0 +1,76 @@
+package check
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/input"
+	"github.com/kiy7086/dtbotool/cmd/overlay"
+)
+
+// HandleCheck 检查 overlay 能否应用到基础DTB，并列出每个条目会修改的节点
+func HandleCheck(base string, overlays []string) error {
+	baseItem, err := input.LoadOne(base)
+	if err != nil {
+		return err
+	}
+
+	checked, errors := 0, 0
+	for _, spec := range overlays {
+		items, err := input.Load(spec)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			fmt.Printf("\n[%s]\n", item.Name)
+			checked++
+			if !item.Tree.IsOverlay() {
+				fmt.Printf("  错误: 不是 overlay\n")
+				errors++
+				continue
+			}
+
+			report := overlay.Check(baseItem.Tree, item.Tree)
+			printReport(report)
+			errors += len(report.Errors)
+		}
+	}
+
+	if errors > 0 {
+		return fmt.Errorf("检查了 %d 个 overlay，发现 %d 个错误", checked, errors)
+	}
+	fmt.Printf("\n检查了 %d 个 overlay，全部可以应用到 %s\n", checked, baseItem.Name)
+	return nil
+}
+
+func printReport(r *overlay.Report) {
+	for _, t := range r.Targets {
+		if t.Label != "" {
+			fmt.Printf("  片段: %s -> %s (&%s)\n", t.Fragment, t.Path, t.Label)
+		} else {
+			fmt.Printf("  片段: %s -> %s\n", t.Fragment, t.Path)
+		}
+	}
+
+	for _, c := range r.Changes {
+		if c.Added {
+			fmt.Printf("  新增节点: %s\n", c.Path)
+			continue
+		}
+		var parts []string
+		if len(c.Modified) > 0 {
+			parts = append(parts, "修改 "+strings.Join(c.Modified, ", "))
+		}
+		if len(c.New) > 0 {
+			parts = append(parts, "新增 "+strings.Join(c.New, ", "))
+		}
+		fmt.Printf("  修改节点: %s (%s)\n", c.Path, strings.Join(parts, "; "))
+	}
+
+	for _, w := range r.Warnings {
+		fmt.Printf("  警告: %s\n", w)
+	}
+	for _, e := range r.Errors {
+		fmt.Printf("  错误: %s\n", e)
+	}
+}
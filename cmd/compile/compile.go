@@ -4,17 +4,38 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/kiy7086/dtbotool/cmd/compression"
+	"github.com/kiy7086/dtbotool/cmd/detect"
+	"github.com/kiy7086/dtbotool/cmd/diag"
 	"github.com/kiy7086/dtbotool/cmd/dtb"
 	"github.com/kiy7086/dtbotool/cmd/dtbo"
+	"github.com/kiy7086/dtbotool/cmd/parallel"
+	"github.com/kiy7086/dtbotool/cmd/treefile"
 )
 
+// Options 编译选项
+type Options struct {
+	Compression compression.Type // DTBO镜像输出的压缩格式
+	Dtc         dtb.DtcOptions   // DTS 编译配置
+	Format      treefile.Format  // 源文件格式，Auto 表示按扩展名判断
+	Force       bool             // 忽略增量编译缓存
+	Jobs        int              // 编译和校验的并发数，不大于 0 时使用CPU数量
+
+	Report func(diag.Diagnostic) // 接收编译诊断，为 nil 时以文本输出
+}
+
+func (o Options) dtbOptions() dtb.CompileOptions {
+	return dtb.CompileOptions{Dtc: o.Dtc, Format: o.Format, Force: o.Force, Jobs: o.Jobs, Report: o.Report}
+}
+
 // HandleCompile 处理编译操作
-func HandleCompile(input, output string) error {
+func HandleCompile(input, output string, opts Options) error {
 	if _, err := os.Stat(input); os.IsNotExist(err) {
 		return fmt.Errorf("'%s' 不存在", input)
 	}
@@ -22,12 +43,12 @@ func HandleCompile(input, output string) error {
 	fmt.Printf("正在编译 %s ...\n", input)
 
 	if info, err := os.Stat(input); err == nil && info.IsDir() {
-		return handleDirCompile(input, output)
+		return handleDirCompile(input, output, opts)
 	}
-	return handleFileCompile(input, output)
+	return handleFileCompile(input, output, opts)
 }
 
-func handleDirCompile(input, output string) error {
+func handleDirCompile(input, output string, opts Options) error {
 	files, err := os.ReadDir(input)
 	if err != nil {
 		return fmt.Errorf("读取目录失败: %v", err)
@@ -35,7 +56,7 @@ func handleDirCompile(input, output string) error {
 
 	var dtsCount, dtbCount int
 	for _, file := range files {
-		if strings.HasSuffix(file.Name(), ".dts") {
+		if treefile.IsSource(file.Name()) {
 			dtsCount++
 		} else if strings.HasSuffix(file.Name(), ".dtb") {
 			dtbCount++
@@ -43,14 +64,14 @@ func handleDirCompile(input, output string) error {
 	}
 
 	if dtsCount > 0 {
-		return handleDtsCompile(input, output, dtsCount)
+		return handleDtsCompile(input, output, dtsCount, opts)
 	} else if dtbCount > 0 {
-		return handleDtbCompile(input, output)
+		return handleDtbCompile(input, output, opts)
 	}
 	return fmt.Errorf("目录中未找到 DTS 或 DTB 文件")
 }
 
-func handleDtsCompile(input, output string, dtsCount int) error {
+func handleDtsCompile(input, output string, dtsCount int, opts Options) error {
 	fmt.Printf("\n找到 %d 个 DTS 文件，请选择操作:\n", dtsCount)
 	fmt.Println("1. 编译为DTB文件")
 	fmt.Println("2. 编译并打包为DTBO镜像")
@@ -61,21 +82,21 @@ func handleDtsCompile(input, output string, dtsCount int) error {
 
 	switch choice {
 	case "1":
-		if err := dtb.CompileAllDtsInDir(input); err != nil {
-			return fmt.Errorf("编译失败: %v", err)
+		if err := dtb.CompileAllDtsInDir(input, opts.dtbOptions()); err != nil {
+			return fmt.Errorf("编译失败: %w", err)
 		}
 		fmt.Printf("已编译 %d 个 DTB 文件\n", dtsCount)
 		return nil
 
 	case "2":
-		return compileDtsToDtbo(input, output)
+		return compileDtsToDtbo(input, output, opts)
 
 	default:
 		return fmt.Errorf("操作已取消")
 	}
 }
 
-func compileDtsToDtbo(input, output string) error {
+func compileDtsToDtbo(input, output string, opts Options) error {
 	// 创建临时目录
 	tmpDir, err := os.MkdirTemp("", "dtbo_compile_*")
 	if err != nil {
@@ -84,8 +105,8 @@ func compileDtsToDtbo(input, output string) error {
 	defer os.RemoveAll(tmpDir)
 
 	// 编译到临时目录
-	if err := dtb.CompileAllDtsInDir(input, tmpDir); err != nil {
-		return fmt.Errorf("编译失败: %v", err)
+	if err := dtb.CompileAllDtsInDir(input, opts.dtbOptions(), tmpDir); err != nil {
+		return fmt.Errorf("编译失败: %w", err)
 	}
 
 	// 生成输出文件名
@@ -98,7 +119,12 @@ func compileDtsToDtbo(input, output string) error {
 		return fmt.Errorf("打包失败: %v", err)
 	}
 
-	if err := verifyDtboImage(output); err != nil {
+	if err := compression.CompressFile(output, opts.Compression); err != nil {
+		os.Remove(output)
+		return fmt.Errorf("压缩失败: %v", err)
+	}
+
+	if err := verifyDtboImage(output, opts.Jobs); err != nil {
 		os.Remove(output)
 		return fmt.Errorf("DTBO验证失败: %v", err)
 	}
@@ -107,7 +133,7 @@ func compileDtsToDtbo(input, output string) error {
 	return nil
 }
 
-func handleDtbCompile(input, output string) error {
+func handleDtbCompile(input, output string, opts Options) error {
 	if output == "" {
 		output = generateDtboFileName(input)
 	}
@@ -116,7 +142,12 @@ func handleDtbCompile(input, output string) error {
 		return fmt.Errorf("打包失败: %v", err)
 	}
 
-	if err := verifyDtboImage(output); err != nil {
+	if err := compression.CompressFile(output, opts.Compression); err != nil {
+		os.Remove(output)
+		return fmt.Errorf("压缩失败: %v", err)
+	}
+
+	if err := verifyDtboImage(output, opts.Jobs); err != nil {
 		os.Remove(output)
 		return fmt.Errorf("DTBO验证失败: %v", err)
 	}
@@ -125,17 +156,17 @@ func handleDtbCompile(input, output string) error {
 	return nil
 }
 
-func handleFileCompile(input, output string) error {
-	if !strings.HasSuffix(input, ".dts") {
-		return fmt.Errorf("不支持的文件类型，请使用 .dts 文件")
+func handleFileCompile(input, output string, opts Options) error {
+	if opts.Format == treefile.Auto && !treefile.IsSource(input) {
+		return fmt.Errorf("不支持的文件类型，请使用 .dts、.json 或 .yaml 文件")
 	}
 
 	if output == "" {
-		output = strings.TrimSuffix(input, ".dts") + ".dtb"
+		output = strings.TrimSuffix(input, filepath.Ext(input)) + ".dtb"
 	}
 
-	if err := dtb.CompileDts(input, output); err != nil {
-		return fmt.Errorf("编译失败: %v", err)
+	if err := dtb.CompileDts(input, output, opts.dtbOptions()); err != nil {
+		return fmt.Errorf("编译失败: %w", err)
 	}
 
 	return nil
@@ -157,14 +188,8 @@ func generateDtboFileName(input string) string {
 	return fmt.Sprintf("dtbo_%s_%s.img", timestamp, hashStr)
 }
 
-func verifyDtboImage(dtboFile string) error {
-	// 创建临时目录
-	tmpDir, err := os.MkdirTemp("", "dtbo_verify_*")
-	if err != nil {
-		return fmt.Errorf("创建临时目录失败: %v", err)
-	}
-	defer os.RemoveAll(tmpDir)
-
+// verifyDtboImage 校验打包后的DTBO镜像，并以 jobs 个并发对每个条目做结构化校验
+func verifyDtboImage(dtboFile string, jobs int) error {
 	// 验证文件大小
 	info, err := os.Stat(dtboFile)
 	if err != nil {
@@ -178,28 +203,40 @@ func verifyDtboImage(dtboFile string) error {
 	}
 
 	// 验证DTBO格式
-	if err := dtbo.UnpackDtbo(dtboFile, tmpDir); err != nil {
-		return fmt.Errorf("DTBO格式无效: %v", err)
+	data, _, err := detect.ReadFile(dtboFile)
+	if err != nil {
+		return err
 	}
-
-	// 验证解出的DTB文件
-	files, err := os.ReadDir(tmpDir)
+	entries, err := dtbo.ReadEntries(data)
 	if err != nil {
-		return fmt.Errorf("读取临时目录失败: %v", err)
+		return fmt.Errorf("DTBO格式无效: %v", err)
 	}
-
-	if len(files) == 0 {
+	if len(entries) == 0 {
 		return fmt.Errorf("DTBO文件中未包含DTB")
 	}
 
-	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".dtb") {
-			dtbPath := filepath.Join(tmpDir, file.Name())
-			if err := dtb.VerifyDtb(dtbPath); err != nil {
-				return fmt.Errorf("DTB文件 %s 验证失败: %v", file.Name(), err)
-			}
+	// 验证每个条目
+	errs := parallel.Run(jobs, len(entries), func(i int, w io.Writer) error {
+		e := entries[i]
+		result := dtb.Verify(e.Data)
+		for _, warning := range result.Warnings {
+			fmt.Fprintf(w, "警告: 条目 %d: %s\n", e.Index, warning)
 		}
+		if !result.Overlay {
+			fmt.Fprintf(w, "警告: 条目 %d 不是 overlay\n", e.Index)
+		}
+		return result.Err()
+	})
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("条目 %d: %v", entries[i].Index, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s", strings.Join(failed, "\n  "))
 	}
 
+	fmt.Printf("已验证 %d 个条目\n", len(entries))
 	return nil
 }
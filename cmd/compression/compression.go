@@ -0,0 +1,205 @@
+package compression
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Type 压缩格式
+type Type int
+
+const (
+	None Type = iota
+	Gzip
+	Bzip2
+	LZ4
+	LZ4Legacy
+)
+
+func (t Type) String() string {
+	switch t {
+	case Gzip:
+		return "gzip"
+	case Bzip2:
+		return "bzip2"
+	case LZ4:
+		return "lz4"
+	case LZ4Legacy:
+		return "lz4-legacy"
+	default:
+		return "none"
+	}
+}
+
+// ParseType 解析压缩格式名称，空字符串表示不压缩
+func ParseType(name string) (Type, error) {
+	switch strings.ToLower(name) {
+	case "", "none":
+		return None, nil
+	case "gz", "gzip":
+		return Gzip, nil
+	case "bz2", "bzip2":
+		return Bzip2, nil
+	case "lz4":
+		return LZ4, nil
+	case "lz4-legacy":
+		return LZ4Legacy, nil
+	}
+	return None, fmt.Errorf("未知的压缩格式: %s", name)
+}
+
+// Detect 根据魔数检测数据的压缩格式
+func Detect(data []byte) Type {
+	switch {
+	case len(data) >= 2 && data[0] == 0x1F && data[1] == 0x8B:
+		return Gzip
+	case len(data) >= 4 && data[0] == 'B' && data[1] == 'Z' && data[2] == 'h' && data[3] >= '1' && data[3] <= '9':
+		return Bzip2
+	case len(data) >= 4 && le32(data) == lz4FrameMagic:
+		return LZ4
+	case len(data) >= 4 && le32(data) == lz4LegacyMagic:
+		return LZ4Legacy
+	}
+	return None
+}
+
+// Decompress 检测并解压数据，未压缩的数据原样返回。
+// 压缩流之后的附加数据(如 Image.gz-dtb 末尾的DTB)会原样拼接在解压结果之后。
+func Decompress(data []byte) ([]byte, Type, error) {
+	t := Detect(data)
+	var out []byte
+	var err error
+
+	switch t {
+	case None:
+		return data, None, nil
+	case Gzip:
+		out, err = gunzip(data)
+	case Bzip2:
+		out, err = io.ReadAll(bzip2.NewReader(bytes.NewReader(data)))
+	case LZ4:
+		out, err = lz4DecompressFrames(data)
+	case LZ4Legacy:
+		out, err = lz4DecompressLegacy(data)
+	}
+
+	if err != nil {
+		return nil, t, fmt.Errorf("%s 解压失败: %v", t, err)
+	}
+	return out, t, nil
+}
+
+// gunzip 解压所有连续的gzip成员，并保留末尾的非gzip数据
+func gunzip(data []byte) ([]byte, error) {
+	var out []byte
+	for len(data) > 0 && Detect(data) == Gzip {
+		// bytes.Reader 实现了 io.ByteReader，gzip 不会预读超出当前成员的数据
+		r := bytes.NewReader(data)
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		zr.Multistream(false)
+
+		member, err := io.ReadAll(zr)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, member...)
+		data = data[len(data)-r.Len():]
+	}
+	return append(out, data...), nil
+}
+
+// Compress 按指定格式压缩数据
+func Compress(data []byte, t Type) ([]byte, error) {
+	switch t {
+	case None:
+		return data, nil
+	case Gzip:
+		var buf bytes.Buffer
+		zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case LZ4:
+		return lz4CompressFrame(data), nil
+	case LZ4Legacy:
+		return lz4CompressLegacy(data), nil
+	}
+	return nil, fmt.Errorf("不支持输出 %s 格式", t)
+}
+
+// CanCompress 判断是否支持输出该格式。bzip2 只能解压
+func CanCompress(t Type) bool {
+	return t != Bzip2
+}
+
+// ParseOutputType 解析用于输出的压缩格式名称，不支持输出的格式返回错误
+func ParseOutputType(name string) (Type, error) {
+	t, err := ParseType(name)
+	if err != nil {
+		return None, err
+	}
+	if !CanCompress(t) {
+		return None, fmt.Errorf("不支持输出 %s 格式", t)
+	}
+	return t, nil
+}
+
+// ReadFile 读取文件并透明解压
+func ReadFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	out, _, err := Decompress(data)
+	return out, err
+}
+
+// CompressFile 原地压缩文件
+func CompressFile(path string, t Type) error {
+	if t == None {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取文件失败: %v", err)
+	}
+
+	out, err := Compress(data, t)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, out, 0644); err != nil {
+		return fmt.Errorf("写入压缩文件失败: %v", err)
+	}
+
+	fmt.Printf("已使用 %s 压缩: %d -> %d 字节\n", t, len(data), len(out))
+	return nil
+}
+
+// TrimExt 去除文件名中的压缩扩展名
+func TrimExt(name string) string {
+	for _, ext := range []string{".gz", ".bz2", ".lz4"} {
+		if strings.EqualFold(filepath.Ext(name), ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	return name
+}
@@ -0,0 +1,144 @@
+package compression
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// testInputs 空数据、短数据、可压缩的数据和超过一个 LZ4 块的随机数据
+func testInputs() map[string][]byte {
+	rng := rand.New(rand.NewSource(1))
+	random := make([]byte, lz4LegacyBlockSize+1000)
+	rng.Read(random)
+
+	var text bytes.Buffer
+	for i := 0; text.Len() < 200000; i++ {
+		text.WriteString("compatible = \"vendor,board\"; reg = <0x")
+		text.WriteByte(byte('0' + i%10))
+		text.WriteString(">;\n")
+	}
+	return map[string][]byte{
+		"empty":  {},
+		"short":  []byte("abc"),
+		"zeros":  make([]byte, 100000),
+		"text":   text.Bytes(),
+		"random": random,
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for name, data := range testInputs() {
+		for _, typ := range []Type{Gzip, LZ4, LZ4Legacy} {
+			packed, err := Compress(data, typ)
+			if err != nil {
+				t.Fatalf("%s/%s: %v", name, typ, err)
+			}
+			out, got, err := Decompress(packed)
+			if err != nil {
+				t.Errorf("%s/%s: %v", name, typ, err)
+				continue
+			}
+			if got != typ {
+				t.Errorf("%s/%s: 检测为 %s", name, typ, got)
+			}
+			if !bytes.Equal(out, data) {
+				t.Errorf("%s/%s: 解压结果不同 (%d / %d 字节)", name, typ, len(out), len(data))
+			}
+		}
+	}
+}
+
+// TestTrailingData 压缩流之后的数据 (如内核镜像末尾的DTB) 原样保留
+func TestTrailingData(t *testing.T) {
+	data := testInputs()["text"]
+	dtb := []byte{0xd0, 0x0d, 0xfe, 0xed, 0, 0, 0, 0x10, 1, 2, 3, 4, 5, 6, 7, 8}
+
+	for _, typ := range []Type{Gzip, LZ4, LZ4Legacy} {
+		packed, _ := Compress(data, typ)
+		out, _, err := Decompress(append(packed, dtb...))
+		if err != nil {
+			t.Errorf("%s: %v", typ, err)
+			continue
+		}
+		if !bytes.Equal(out, append(append([]byte(nil), data...), dtb...)) {
+			t.Errorf("%s: 附加数据没有原样保留", typ)
+		}
+	}
+
+	// 内核在旧版LZ4流之后追加4字节的解压后大小
+	packed := lz4CompressLegacy(data)
+	packed = binary.LittleEndian.AppendUint32(packed, uint32(len(data)))
+	out, err := lz4DecompressLegacy(append(packed, dtb...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, append(append([]byte(nil), data...), dtb...)) {
+		t.Error("旧版LZ4: 解压后大小没有被跳过")
+	}
+}
+
+// TestLZ4Frames 连续的帧依次解压，可跳过帧被忽略
+func TestLZ4Frames(t *testing.T) {
+	skippable := binary.LittleEndian.AppendUint32(nil, lz4SkippableMagic|0x5)
+	skippable = binary.LittleEndian.AppendUint32(skippable, 3)
+	skippable = append(skippable, 'x', 'y', 'z')
+
+	var packed []byte
+	packed = append(packed, lz4CompressFrame([]byte("hello, "))...)
+	packed = append(packed, skippable...)
+	packed = append(packed, lz4CompressFrame([]byte("world"))...)
+	out, _, err := Decompress(packed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "hello, world" {
+		t.Errorf("解压结果 = %q", out)
+	}
+}
+
+func TestLZ4Errors(t *testing.T) {
+	packed := lz4CompressFrame(testInputs()["text"])
+
+	// 帧的任何截断都应当报错，而不是把剩余部分当作附加数据
+	for n := 4; n < len(packed); n++ {
+		if _, _, err := Decompress(packed[:n]); err == nil {
+			t.Fatalf("截断为 %d 字节时没有报错", n)
+		}
+	}
+
+	bad := append([]byte(nil), packed...)
+	bad[6] ^= 0xff
+	if _, _, err := Decompress(bad); err == nil || !strings.Contains(err.Error(), "帧头校验和不匹配") {
+		t.Errorf("错误 = %v", err)
+	}
+
+	// 匹配偏移指向输出之前的数据
+	block := []byte{0x10, 'a', 0x10, 0x00}
+	if _, err := lz4DecompressBlock(nil, block, 1<<16); err == nil {
+		t.Error("无效的匹配偏移没有报错")
+	}
+
+	gz, _ := Compress(testInputs()["text"], Gzip)
+	if _, _, err := Decompress(gz[:len(gz)/2]); err == nil {
+		t.Error("截断的gzip数据没有报错")
+	}
+}
+
+func TestParseOutputType(t *testing.T) {
+	for name, want := range map[string]Type{"": None, "gz": Gzip, "LZ4": LZ4, "lz4-legacy": LZ4Legacy} {
+		if got, err := ParseOutputType(name); err != nil || got != want {
+			t.Errorf("%q: %v, %v", name, got, err)
+		}
+	}
+	for _, name := range []string{"bzip2", "xz"} {
+		if _, err := ParseOutputType(name); err == nil {
+			t.Errorf("%q: 没有报错", name)
+		}
+	}
+	if _, err := Compress([]byte("x"), Bzip2); err == nil {
+		t.Error("压缩为 bzip2 没有报错")
+	}
+}
@@ -0,0 +1,390 @@
+package compression
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+const (
+	lz4FrameMagic     = 0x184D2204
+	lz4LegacyMagic    = 0x184C2102
+	lz4SkippableMagic = 0x184D2A50 // 低4位可为任意值
+
+	lz4LegacyBlockSize = 8 << 20
+	lz4FrameBlockSize  = 4 << 20
+
+	lz4MinMatch     = 4
+	lz4LastLiterals = 5
+	lz4MFLimit      = 12
+	lz4HashLog      = 16
+)
+
+func le32(b []byte) uint32 {
+	return binary.LittleEndian.Uint32(b)
+}
+
+// lz4DecompressFrames 解压一个或多个连续的LZ4帧，末尾的非LZ4数据原样保留
+func lz4DecompressFrames(data []byte) ([]byte, error) {
+	var out []byte
+	for len(data) >= 4 {
+		magic := le32(data)
+		if magic&0xFFFFFFF0 == lz4SkippableMagic {
+			if len(data) < 8 {
+				return nil, fmt.Errorf("可跳过帧被截断")
+			}
+			skip := 8 + int(le32(data[4:]))
+			if skip > len(data) {
+				return nil, fmt.Errorf("可跳过帧被截断")
+			}
+			data = data[skip:]
+			continue
+		}
+		if magic != lz4FrameMagic {
+			break
+		}
+
+		frame, n, err := lz4DecompressFrame(data)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, frame...)
+		data = data[n:]
+	}
+	return append(out, data...), nil
+}
+
+// lz4DecompressFrame 解压单个LZ4帧，返回解压数据和消耗的字节数
+func lz4DecompressFrame(data []byte) ([]byte, int, error) {
+	if len(data) < 7 {
+		return nil, 0, fmt.Errorf("帧头被截断")
+	}
+
+	flg, bd := data[4], data[5]
+	if flg>>6 != 1 {
+		return nil, 0, fmt.Errorf("不支持的帧版本: %d", flg>>6)
+	}
+	blockChecksum := flg&0x10 != 0
+	contentSize := flg&0x08 != 0
+	contentChecksum := flg&0x04 != 0
+	dictID := flg&0x01 != 0
+
+	descEnd := 6
+	if contentSize {
+		descEnd += 8
+	}
+	if dictID {
+		descEnd += 4
+	}
+	if len(data) < descEnd+1 {
+		return nil, 0, fmt.Errorf("帧头被截断")
+	}
+	if hc := byte(xxh32(data[4:descEnd], 0) >> 8); hc != data[descEnd] {
+		return nil, 0, fmt.Errorf("帧头校验和不匹配")
+	}
+
+	maxBlock := 1 << (8 + 2*int((bd>>4)&0x7))
+	pos := descEnd + 1
+	var out []byte
+
+	for {
+		if pos+4 > len(data) {
+			return nil, 0, fmt.Errorf("数据块被截断")
+		}
+		size := le32(data[pos:])
+		pos += 4
+		if size == 0 {
+			break
+		}
+
+		raw := size&0x80000000 != 0
+		size &= 0x7FFFFFFF
+		if pos+int(size) > len(data) {
+			return nil, 0, fmt.Errorf("数据块被截断")
+		}
+		block := data[pos : pos+int(size)]
+		pos += int(size)
+		if blockChecksum {
+			pos += 4
+		}
+
+		if raw {
+			out = append(out, block...)
+			continue
+		}
+		var err error
+		out, err = lz4DecompressBlock(out, block, maxBlock)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if contentChecksum {
+		if pos+4 > len(data) {
+			return nil, 0, fmt.Errorf("内容校验和被截断")
+		}
+		pos += 4
+	}
+	return out, pos, nil
+}
+
+// lz4DecompressLegacy 解压内核使用的旧版LZ4格式。内核镜像会在流末尾追加
+// 4字节的解压后大小，之后的数据(如 Image.lz4-dtb 末尾的DTB)原样保留
+func lz4DecompressLegacy(data []byte) ([]byte, error) {
+	var out []byte
+	pos := 4
+	for pos+4 <= len(data) {
+		size := int(le32(data[pos:]))
+		if uint32(size) == lz4LegacyMagic {
+			pos += 4
+			continue
+		}
+		// 块大小不可能超过最大块的压缩上限，否则已是流之后的数据
+		if size == 0 || size > lz4CompressBound(lz4LegacyBlockSize) || pos+4+size > len(data) {
+			break
+		}
+		pos += 4
+
+		var err error
+		out, err = lz4DecompressBlock(out, data[pos:pos+size], lz4LegacyBlockSize)
+		if err != nil {
+			return nil, err
+		}
+		pos += size
+	}
+
+	rest := data[min(pos, len(data)):]
+	if len(rest) >= 4 && int(le32(rest)) == len(out) {
+		rest = rest[4:]
+	}
+	return append(out, rest...), nil
+}
+
+// lz4CompressBound 压缩 n 字节数据时输出的最大长度
+func lz4CompressBound(n int) int {
+	return n + n/255 + 16
+}
+
+// lz4DecompressBlock 将一个LZ4块解压并追加到 dst
+func lz4DecompressBlock(dst, src []byte, maxSize int) ([]byte, error) {
+	base := len(dst)
+	i := 0
+	for i < len(src) {
+		token := src[i]
+		i++
+
+		litLen := int(token >> 4)
+		if litLen == 15 {
+			for {
+				if i >= len(src) {
+					return nil, fmt.Errorf("LZ4数据损坏")
+				}
+				b := src[i]
+				i++
+				litLen += int(b)
+				if b != 255 {
+					break
+				}
+			}
+		}
+		if i+litLen > len(src) {
+			return nil, fmt.Errorf("LZ4数据损坏")
+		}
+		dst = append(dst, src[i:i+litLen]...)
+		i += litLen
+
+		// 最后一个序列只有字面量
+		if i == len(src) {
+			break
+		}
+
+		if i+2 > len(src) {
+			return nil, fmt.Errorf("LZ4数据损坏")
+		}
+		offset := int(src[i]) | int(src[i+1])<<8
+		i += 2
+		if offset == 0 || offset > len(dst)-base {
+			return nil, fmt.Errorf("LZ4匹配偏移无效")
+		}
+
+		matchLen := int(token & 0xF)
+		if matchLen == 15 {
+			for {
+				if i >= len(src) {
+					return nil, fmt.Errorf("LZ4数据损坏")
+				}
+				b := src[i]
+				i++
+				matchLen += int(b)
+				if b != 255 {
+					break
+				}
+			}
+		}
+		matchLen += lz4MinMatch
+
+		// 匹配区域可能与输出重叠，需要逐字节复制
+		start := len(dst) - offset
+		for k := 0; k < matchLen; k++ {
+			dst = append(dst, dst[start+k])
+		}
+
+		if len(dst)-base > maxSize {
+			return nil, fmt.Errorf("LZ4块超出最大大小")
+		}
+	}
+	return dst, nil
+}
+
+// lz4CompressFrame 生成LZ4帧，块相互独立且不带校验和
+func lz4CompressFrame(data []byte) []byte {
+	out := binary.LittleEndian.AppendUint32(nil, lz4FrameMagic)
+
+	// FLG: 版本01，块独立；BD: 最大块4MB
+	desc := []byte{0x60, 0x70}
+	out = append(out, desc...)
+	out = append(out, byte(xxh32(desc, 0)>>8))
+
+	for len(data) > 0 {
+		n := min(len(data), lz4FrameBlockSize)
+		block := lz4CompressBlock(data[:n])
+		if len(block) >= n {
+			out = binary.LittleEndian.AppendUint32(out, uint32(n)|0x80000000)
+			out = append(out, data[:n]...)
+		} else {
+			out = binary.LittleEndian.AppendUint32(out, uint32(len(block)))
+			out = append(out, block...)
+		}
+		data = data[n:]
+	}
+
+	return binary.LittleEndian.AppendUint32(out, 0)
+}
+
+// lz4CompressLegacy 压缩为内核使用的旧版LZ4格式，每个块固定为压缩数据
+func lz4CompressLegacy(data []byte) []byte {
+	out := binary.LittleEndian.AppendUint32(nil, lz4LegacyMagic)
+	for len(data) > 0 {
+		n := min(len(data), lz4LegacyBlockSize)
+		block := lz4CompressBlock(data[:n])
+		out = binary.LittleEndian.AppendUint32(out, uint32(len(block)))
+		out = append(out, block...)
+		data = data[n:]
+	}
+	return out
+}
+
+// lz4CompressBlock 使用贪心哈希匹配压缩一个块
+func lz4CompressBlock(src []byte) []byte {
+	var dst []byte
+	var table [1 << lz4HashLog]int32
+	anchor := 0
+
+	for i := 0; i+lz4MFLimit < len(src); {
+		seq := le32(src[i:])
+		h := (seq * 2654435761) >> (32 - lz4HashLog)
+		ref := int(table[h]) - 1
+		table[h] = int32(i + 1)
+
+		if ref < 0 || i-ref > 0xFFFF || le32(src[ref:]) != seq {
+			i++
+			continue
+		}
+
+		matchLen := lz4MinMatch
+		for i+matchLen < len(src)-lz4LastLiterals && src[ref+matchLen] == src[i+matchLen] {
+			matchLen++
+		}
+
+		dst = lz4AppendSequence(dst, src[anchor:i], i-ref, matchLen)
+		i += matchLen
+		anchor = i
+	}
+
+	return lz4AppendSequence(dst, src[anchor:], 0, 0)
+}
+
+// lz4AppendSequence 写入一个序列，matchLen 为0时表示末尾的纯字面量序列
+func lz4AppendSequence(dst, literals []byte, offset, matchLen int) []byte {
+	litLen := len(literals)
+	token := byte(min(litLen, 15)) << 4
+	if matchLen > 0 {
+		token |= byte(min(matchLen-lz4MinMatch, 15))
+	}
+	dst = append(dst, token)
+	dst = lz4AppendLength(dst, litLen)
+	dst = append(dst, literals...)
+
+	if matchLen > 0 {
+		dst = append(dst, byte(offset), byte(offset>>8))
+		dst = lz4AppendLength(dst, matchLen-lz4MinMatch)
+	}
+	return dst
+}
+
+func lz4AppendLength(dst []byte, n int) []byte {
+	if n < 15 {
+		return dst
+	}
+	n -= 15
+	for n >= 255 {
+		dst = append(dst, 255)
+		n -= 255
+	}
+	return append(dst, byte(n))
+}
+
+const (
+	xxhPrime1 uint32 = 2654435761
+	xxhPrime2 uint32 = 2246822519
+	xxhPrime3 uint32 = 3266489917
+	xxhPrime4 uint32 = 668265263
+	xxhPrime5 uint32 = 374761393
+)
+
+// xxh32 计算 XXH32 哈希，LZ4帧头校验需要用到
+func xxh32(b []byte, seed uint32) uint32 {
+	n := len(b)
+	var h uint32
+
+	if n >= 16 {
+		v1 := seed + xxhPrime1 + xxhPrime2
+		v2 := seed + xxhPrime2
+		v3 := seed
+		v4 := seed - xxhPrime1
+		for len(b) >= 16 {
+			v1 = xxhRound(v1, le32(b[0:]))
+			v2 = xxhRound(v2, le32(b[4:]))
+			v3 = xxhRound(v3, le32(b[8:]))
+			v4 = xxhRound(v4, le32(b[12:]))
+			b = b[16:]
+		}
+		h = bits.RotateLeft32(v1, 1) + bits.RotateLeft32(v2, 7) +
+			bits.RotateLeft32(v3, 12) + bits.RotateLeft32(v4, 18)
+	} else {
+		h = seed + xxhPrime5
+	}
+
+	h += uint32(n)
+	for ; len(b) >= 4; b = b[4:] {
+		h += le32(b) * xxhPrime3
+		h = bits.RotateLeft32(h, 17) * xxhPrime4
+	}
+	for _, c := range b {
+		h += uint32(c) * xxhPrime5
+		h = bits.RotateLeft32(h, 11) * xxhPrime1
+	}
+
+	h ^= h >> 15
+	h *= xxhPrime2
+	h ^= h >> 13
+	h *= xxhPrime3
+	h ^= h >> 16
+	return h
+}
+
+func xxhRound(acc, input uint32) uint32 {
+	acc += input * xxhPrime2
+	acc = bits.RotateLeft32(acc, 13)
+	return acc * xxhPrime1
+}
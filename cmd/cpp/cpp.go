@@ -0,0 +1,345 @@
+package cpp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/diag"
+)
+
+const maxIncludeDepth = 64
+
+// Options 预处理选项
+type Options struct {
+	IncludeDirs []string                       // #include 的搜索路径
+	Defines     []string                       // 预定义宏，格式为 NAME 或 NAME=VALUE
+	Report      func(diag.Diagnostic)          // 接收 #warning 产生的警告，为 nil 时直接输出
+	Depend      func(path string, exists bool) // 接收 #include 读取的文件，以及在此之前查找过但不存在的路径
+}
+
+// Error 带位置信息的预处理错误
+type Error struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d: 错误: %s", e.File, e.Line, e.Msg)
+}
+
+// Diagnostic 返回错误对应的诊断信息
+func (e *Error) Diagnostic() diag.Diagnostic {
+	return diag.Diagnostic{File: e.File, Line: e.Line, Severity: diag.Error, Message: e.Msg}
+}
+
+type macro struct {
+	name     string
+	function bool
+	params   []string
+	variadic bool
+	body     []token
+}
+
+type cond struct {
+	active       bool // 当前分支是否生效
+	taken        bool // 是否已有分支生效
+	parentActive bool
+	sawElse      bool
+}
+
+type preprocessor struct {
+	opts   Options
+	macros map[string]*macro
+	out    strings.Builder
+	depth  int
+	file   string
+	line   int
+}
+
+// Preprocess 对DTS文件执行C预处理器子集，输出带行标记的源码
+func Preprocess(file string, opts Options) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件失败: %v", err)
+	}
+	return PreprocessSource(file, data, opts)
+}
+
+// PreprocessSource 预处理内存中的源码
+func PreprocessSource(file string, data []byte, opts Options) ([]byte, error) {
+	p := &preprocessor{opts: opts, macros: make(map[string]*macro)}
+	for _, def := range opts.Defines {
+		name, value, ok := strings.Cut(def, "=")
+		if !ok {
+			value = "1"
+		}
+		if err := p.define(name + " " + value); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.processFile(file, data); err != nil {
+		return nil, err
+	}
+	return []byte(p.out.String()), nil
+}
+
+func (p *preprocessor) errorf(format string, args ...any) error {
+	return &Error{File: p.file, Line: p.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *preprocessor) processFile(path string, data []byte) error {
+	if p.depth >= maxIncludeDepth {
+		return p.errorf("包含层级过深: %s", path)
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+
+	savedFile, savedLine := p.file, p.line
+	defer func() { p.file, p.line = savedFile, savedLine }()
+	p.file = path
+
+	fmt.Fprintf(&p.out, "# 1 %q\n", path)
+	lines := stripComments(data)
+	// 文件末尾的换行不构成新行
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var conds []*cond
+	active := func() bool {
+		return len(conds) == 0 || conds[len(conds)-1].active
+	}
+
+	for i := 0; i < len(lines); i++ {
+		p.line = i + 1
+		name, rest, ok := directive(lines[i])
+		if !ok {
+			if !active() {
+				p.out.WriteString("\n")
+				continue
+			}
+
+			// 函数式宏的参数可能跨越多行
+			text, extra := lines[i], 0
+			for {
+				atEnd := i+1 >= len(lines)
+				if !atEnd {
+					_, _, atEnd = directive(lines[i+1])
+				}
+				expanded, incomplete, err := p.expand(tokenize(text), nil, atEnd)
+				if err != nil {
+					return err
+				}
+				if incomplete {
+					i++
+					extra++
+					text += "\n" + lines[i]
+					continue
+				}
+				p.out.WriteString(strings.ReplaceAll(join(expanded), "\n", " "))
+				p.out.WriteString(strings.Repeat("\n", extra+1))
+				break
+			}
+			continue
+		}
+
+		switch name {
+		case "if", "ifdef", "ifndef":
+			c := &cond{parentActive: active()}
+			if c.parentActive {
+				val, err := p.condition(name, rest)
+				if err != nil {
+					return err
+				}
+				c.active, c.taken = val, val
+			}
+			conds = append(conds, c)
+
+		case "elif", "else":
+			if len(conds) == 0 {
+				return p.errorf("#%s 没有对应的 #if", name)
+			}
+			c := conds[len(conds)-1]
+			if c.sawElse {
+				return p.errorf("#%s 出现在 #else 之后", name)
+			}
+			switch {
+			case !c.parentActive || c.taken:
+				c.active = false
+			case name == "else":
+				c.active, c.taken = true, true
+			default:
+				val, err := p.condition("if", rest)
+				if err != nil {
+					return err
+				}
+				c.active, c.taken = val, val
+			}
+			c.sawElse = name == "else"
+
+		case "endif":
+			if len(conds) == 0 {
+				return p.errorf("#endif 没有对应的 #if")
+			}
+			conds = conds[:len(conds)-1]
+
+		default:
+			if !active() {
+				break
+			}
+			if err := p.directive(name, rest); err != nil {
+				return err
+			}
+			if name == "include" {
+				// 被包含文件输出之后，用行标记回到当前文件
+				fmt.Fprintf(&p.out, "# %d %q\n", i+2, path)
+				continue
+			}
+		}
+		p.out.WriteString("\n")
+	}
+
+	if len(conds) > 0 {
+		return p.errorf("#if 未结束")
+	}
+	return nil
+}
+
+// directive 识别预处理指令行。DTS中以 # 开头的属性名 (如 #address-cells) 不是指令
+func directive(line string) (string, string, bool) {
+	s := strings.TrimLeft(line, " \t")
+	if !strings.HasPrefix(s, "#") {
+		return "", "", false
+	}
+	s = strings.TrimLeft(s[1:], " \t")
+	i := 0
+	for i < len(s) && isIdentChar(s[i]) {
+		i++
+	}
+	name, rest := s[:i], s[i:]
+
+	switch name {
+	case "include", "define", "undef", "if", "ifdef", "ifndef", "elif", "else",
+		"endif", "error", "warning", "pragma":
+	default:
+		return "", "", false
+	}
+	if rest != "" && strings.IndexByte(" \t(\"<", rest[0]) < 0 {
+		return "", "", false
+	}
+	return name, strings.TrimSpace(rest), true
+}
+
+func (p *preprocessor) directive(name, rest string) error {
+	switch name {
+	case "define":
+		return p.define(rest)
+	case "undef":
+		delete(p.macros, strings.TrimSpace(rest))
+	case "include":
+		return p.include(rest)
+	case "error":
+		return p.errorf("#error %s", rest)
+	case "warning":
+		d := diag.Diagnostic{File: p.file, Line: p.line, Severity: diag.Warning, Message: strings.TrimSpace(rest)}
+		if p.opts.Report != nil {
+			p.opts.Report(d)
+		} else {
+			diag.Print(d)
+		}
+	case "pragma":
+		// 忽略
+	}
+	return nil
+}
+
+func (p *preprocessor) define(rest string) error {
+	rest = strings.TrimLeft(rest, " \t")
+	i := 0
+	for i < len(rest) && isIdentChar(rest[i]) {
+		i++
+	}
+	if i == 0 || !isIdentStart(rest[0]) {
+		return p.errorf("#define 之后需要宏名")
+	}
+	m := &macro{name: rest[:i]}
+	rest = rest[i:]
+
+	// 宏名之后紧跟括号才是函数式宏
+	if strings.HasPrefix(rest, "(") {
+		end := strings.IndexByte(rest, ')')
+		if end < 0 {
+			return p.errorf("宏 %s 的参数列表未结束", m.name)
+		}
+		m.function = true
+		for _, param := range strings.Split(rest[1:end], ",") {
+			param = strings.TrimSpace(param)
+			switch {
+			case param == "" && end == 1:
+			case param == "...":
+				m.variadic = true
+				m.params = append(m.params, "__VA_ARGS__")
+			case strings.HasSuffix(param, "..."):
+				m.variadic = true
+				m.params = append(m.params, strings.TrimSpace(strings.TrimSuffix(param, "...")))
+			case param == "":
+				return p.errorf("宏 %s 的参数为空", m.name)
+			default:
+				m.params = append(m.params, param)
+			}
+		}
+		rest = rest[end+1:]
+	}
+
+	m.body = trimSpace(tokenize(rest))
+	p.macros[m.name] = m
+	return nil
+}
+
+func (p *preprocessor) include(rest string) error {
+	var name string
+	var quoted bool
+	switch {
+	case strings.HasPrefix(rest, "\""):
+		end := strings.IndexByte(rest[1:], '"')
+		if end < 0 {
+			return p.errorf("#include 文件名未结束")
+		}
+		name, quoted = rest[1:end+1], true
+	case strings.HasPrefix(rest, "<"):
+		end := strings.IndexByte(rest, '>')
+		if end < 0 {
+			return p.errorf("#include 文件名未结束")
+		}
+		name = rest[1:end]
+	default:
+		return p.errorf("#include 需要 \"文件\" 或 <文件>")
+	}
+
+	var candidates []string
+	if filepath.IsAbs(name) {
+		candidates = []string{name}
+	} else {
+		if quoted {
+			candidates = append(candidates, filepath.Join(filepath.Dir(p.file), name))
+		}
+		for _, dir := range p.opts.IncludeDirs {
+			candidates = append(candidates, filepath.Join(dir, name))
+		}
+	}
+
+	for _, path := range candidates {
+		data, err := os.ReadFile(path)
+		if p.opts.Depend != nil {
+			p.opts.Depend(path, err == nil)
+		}
+		if err == nil {
+			return p.processFile(path, data)
+		}
+	}
+	return p.errorf("找不到包含文件 %s", name)
+}
@@ -0,0 +1,152 @@
+package cpp
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func preprocess(t *testing.T, src string, opts Options) string {
+	t.Helper()
+	out, err := PreprocessSource("t.dts", []byte(src), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestConditionals(t *testing.T) {
+	src := `#define A 1
+#if A
+a
+#if 0
+b
+#elif defined(A) && A > 0
+c
+#else
+d
+#endif
+#elif 1
+e
+#else
+f
+#endif
+#ifdef C
+g
+#elif B == 2
+h
+#endif
+#ifndef A
+i
+#else
+j
+#endif
+`
+	// 每个源码行对应一个输出行，指令和未生效的行输出为空行
+	want := "# 1 \"t.dts\"\n" +
+		"\n\na\n\n\n\nc\n\n\n\n\n\n\n\n\n" +
+		"\n\n\nh\n\n" +
+		"\n\n\nj\n\n"
+	if got := preprocess(t, src, Options{Defines: []string{"B=2"}}); got != want {
+		t.Errorf("输出 = %q\n期望 %q", got, want)
+	}
+	want = "# 1 \"t.dts\"\n" +
+		"\n\na\n\n\n\nc\n\n\n\n\n\n\n\n\n" +
+		"\ng\n\n\n\n" +
+		"\n\n\nj\n\n"
+	if got := preprocess(t, src, Options{Defines: []string{"C"}}); got != want {
+		t.Errorf("定义 C 时输出 = %q\n期望 %q", got, want)
+	}
+}
+
+func TestMacros(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"对象式宏", "#define N 4\n#define M (N * 2)\nx = <M>;\n", "x = <(4 * 2)>;"},
+		{"函数式宏", "#define ADD(a, b) ((a) + (b))\nx = <ADD(1, ADD(2, 3))>;\n", "x = <((1) + (((2) + (3))))>;"},
+		{"字符串化", "#define STR(x) #x\ns = STR(a  b);\n", `s = "a b";`},
+		{"拼接", "#define CAT(a, b) a##b\nCAT(foo, bar);\n", "foobar;"},
+		{"可变参数", "#define F(x, ...) f(x, __VA_ARGS__)\nF(1, 2, 3);\n", "f(1, 2, 3);"},
+		{"不带括号的函数式宏名", "#define F(x) x\nF;\n", "F;"},
+		{"自引用", "#define X X + 1\nX;\n", "X + 1;"},
+		{"取消定义", "#define X 1\n#undef X\nX;\n", "X;"},
+		{"DTS属性", "#define N 2\n#address-cells = <N>;\n", "#address-cells = <2>;"},
+		{"注释", "#define N 1 /* 注释 */\nx = <N>; // 注释\n", "x = <1>; "},
+		{"字符串中不展开", "#define N 1\ns = \"N\";\n", `s = "N";`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := preprocess(t, tt.src, Options{})
+			if !strings.Contains(out, "\n"+tt.want+"\n") {
+				t.Errorf("输出 = %q, 期望包含 %q", out, tt.want)
+			}
+		})
+	}
+}
+
+// TestMultiLineArgs 跨行的宏参数展开到第一行，之后补足空行以保持行号
+func TestMultiLineArgs(t *testing.T) {
+	src := "#define ADD(a, b) ((a) + (b))\nx = <ADD(1,\n\t2)>;\ny;\n"
+	want := "# 1 \"t.dts\"\n\nx = <((1) + (2))>;\n\ny;\n"
+	if got := preprocess(t, src, Options{}); got != want {
+		t.Errorf("输出 = %q\n期望 %q", got, want)
+	}
+}
+
+func TestLineMarkers(t *testing.T) {
+	dir := t.TempDir()
+	inc := filepath.Join(dir, "inc")
+	if err := os.Mkdir(inc, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.dtsi"), []byte("#include <b.h>\na;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(inc, "b.h"), []byte("#define B 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	main := filepath.Join(dir, "main.dts")
+	src := "/dts-v1/;\n#include \"a.dtsi\"\nx = <B>;\n"
+	out, err := PreprocessSource(main, []byte(src), Options{IncludeDirs: []string{inc}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := filepath.Join(dir, "a.dtsi"), filepath.Join(inc, "b.h")
+	want := "# 1 \"" + main + "\"\n/dts-v1/;\n" +
+		"# 1 \"" + a + "\"\n" +
+		"# 1 \"" + b + "\"\n\n" +
+		"# 2 \"" + a + "\"\na;\n" +
+		"# 3 \"" + main + "\"\nx = <2>;\n"
+	if string(out) != want {
+		t.Errorf("输出 = %q\n期望 %q", out, want)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		line int
+		want string
+	}{
+		{"a\n#else\n", 2, "#else 没有对应的 #if"},
+		{"#if 1\n#else\n#elif 1\n#endif\n", 3, "#elif 出现在 #else 之后"},
+		{"#endif\n", 1, "#endif 没有对应的 #if"},
+		{"#if 1\na\n", 2, "#if 未结束"},
+		{"#if 0\n#error 不会报告\n#else\n#error 停止\n#endif\n", 4, "#error 停止"},
+		{"x\n#include \"none.h\"\n", 2, "找不到包含文件 none.h"},
+		{"#define F(a\n", 1, "宏 F 的参数列表未结束"},
+	}
+	for _, tt := range tests {
+		_, err := PreprocessSource("t.dts", []byte(tt.src), Options{})
+		var e *Error
+		if !errors.As(err, &e) || e.Line != tt.line || !strings.Contains(e.Msg, tt.want) {
+			t.Errorf("%q: 错误 = %v, 期望第 %d 行: %s", tt.src, err, tt.line, tt.want)
+		}
+	}
+}
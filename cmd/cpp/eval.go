@@ -0,0 +1,237 @@
+package cpp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// evalExpr 计算 #if 中的整数表达式
+func evalExpr(s string) (int64, error) {
+	e := &exprParser{s: s}
+	v, err := e.ternary()
+	if err != nil {
+		return 0, err
+	}
+	e.skip()
+	if e.pos < len(e.s) {
+		return 0, fmt.Errorf("多余的内容 %q", e.s[e.pos:])
+	}
+	return v, nil
+}
+
+type exprParser struct {
+	s   string
+	pos int
+}
+
+// 二元运算符，按优先级从低到高排列
+var exprLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<=", ">=", "<", ">"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (e *exprParser) skip() {
+	for e.pos < len(e.s) && strings.IndexByte(" \t\r\n", e.s[e.pos]) >= 0 {
+		e.pos++
+	}
+}
+
+// matchOp 匹配运算符，避免把 || 误认为 |、把 << 误认为 < 等
+func (e *exprParser) matchOp(op string) bool {
+	e.skip()
+	if !strings.HasPrefix(e.s[e.pos:], op) {
+		return false
+	}
+	if len(op) == 1 && e.pos+1 < len(e.s) {
+		next := e.s[e.pos+1]
+		if (op == "|" || op == "&" || op == "<" || op == ">") && next == op[0] ||
+			(op == "<" || op == ">" || op == "!" || op == "=") && next == '=' {
+			return false
+		}
+	}
+	e.pos += len(op)
+	return true
+}
+
+func (e *exprParser) ternary() (int64, error) {
+	c, err := e.binary(0)
+	if err != nil {
+		return 0, err
+	}
+	if !e.matchOp("?") {
+		return c, nil
+	}
+	a, err := e.ternary()
+	if err != nil {
+		return 0, err
+	}
+	if !e.matchOp(":") {
+		return 0, fmt.Errorf("缺少 ':'")
+	}
+	b, err := e.ternary()
+	if err != nil {
+		return 0, err
+	}
+	if c != 0 {
+		return a, nil
+	}
+	return b, nil
+}
+
+func (e *exprParser) binary(level int) (int64, error) {
+	if level == len(exprLevels) {
+		return e.unary()
+	}
+	left, err := e.binary(level + 1)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := ""
+		for _, candidate := range exprLevels[level] {
+			if e.matchOp(candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		right, err := e.binary(level + 1)
+		if err != nil {
+			return 0, err
+		}
+		if left, err = apply(op, left, right); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (e *exprParser) unary() (int64, error) {
+	for _, op := range []string{"-", "+", "~", "!"} {
+		if e.matchOp(op) {
+			v, err := e.unary()
+			if err != nil {
+				return 0, err
+			}
+			switch op {
+			case "-":
+				return -v, nil
+			case "~":
+				return ^v, nil
+			case "!":
+				return b2i(v == 0), nil
+			}
+			return v, nil
+		}
+	}
+	return e.primary()
+}
+
+func (e *exprParser) primary() (int64, error) {
+	e.skip()
+	if e.pos >= len(e.s) {
+		return 0, fmt.Errorf("表达式不完整")
+	}
+
+	c := e.s[e.pos]
+	switch {
+	case c == '(':
+		e.pos++
+		v, err := e.ternary()
+		if err != nil {
+			return 0, err
+		}
+		if !e.matchOp(")") {
+			return 0, fmt.Errorf("缺少 ')'")
+		}
+		return v, nil
+
+	case c == '\'':
+		end := strings.IndexByte(e.s[e.pos+1:], '\'')
+		if end < 0 {
+			return 0, fmt.Errorf("字符字面量未结束")
+		}
+		lit, err := strconv.Unquote(e.s[e.pos : e.pos+end+2])
+		if err != nil || len(lit) == 0 {
+			return 0, fmt.Errorf("字符字面量无效")
+		}
+		e.pos += end + 2
+		return int64(lit[0]), nil
+
+	case c >= '0' && c <= '9':
+		start := e.pos
+		for e.pos < len(e.s) && isIdentChar(e.s[e.pos]) {
+			e.pos++
+		}
+		text := strings.TrimRight(e.s[start:e.pos], "uUlL")
+		v, err := strconv.ParseUint(text, 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("无效的整数 %q", e.s[start:e.pos])
+		}
+		return int64(v), nil
+	}
+	return 0, fmt.Errorf("无法识别 %q", e.s[e.pos:])
+}
+
+func apply(op string, a, b int64) (int64, error) {
+	switch op {
+	case "||":
+		return b2i(a != 0 || b != 0), nil
+	case "&&":
+		return b2i(a != 0 && b != 0), nil
+	case "|":
+		return a | b, nil
+	case "^":
+		return a ^ b, nil
+	case "&":
+		return a & b, nil
+	case "==":
+		return b2i(a == b), nil
+	case "!=":
+		return b2i(a != b), nil
+	case "<":
+		return b2i(a < b), nil
+	case "<=":
+		return b2i(a <= b), nil
+	case ">":
+		return b2i(a > b), nil
+	case ">=":
+		return b2i(a >= b), nil
+	case "<<":
+		return a << uint64(b), nil
+	case ">>":
+		return a >> uint64(b), nil
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/", "%":
+		if b == 0 {
+			return 0, fmt.Errorf("除数为零")
+		}
+		if op == "/" {
+			return a / b, nil
+		}
+		return a % b, nil
+	}
+	return 0, fmt.Errorf("未知运算符 %s", op)
+}
+
+func b2i(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
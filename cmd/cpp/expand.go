@@ -0,0 +1,284 @@
+package cpp
+
+import (
+	"strconv"
+	"strings"
+)
+
+// expand 展开记号中的宏。atEnd 为 false 时，末尾的函数式宏调用如果参数不完整，
+// 返回 incomplete 由调用方补充下一行后重试
+func (p *preprocessor) expand(toks []token, disabled map[string]bool, atEnd bool) ([]token, bool, error) {
+	var out []token
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		m := p.macros[t.text]
+		if t.kind != tokIdent || m == nil || disabled[t.text] {
+			out = append(out, t)
+			continue
+		}
+
+		inner := withDisabled(disabled, m.name)
+		if !m.function {
+			expanded, _, err := p.expand(paste(m.body), inner, true)
+			if err != nil {
+				return nil, false, err
+			}
+			out = append(out, expanded...)
+			continue
+		}
+
+		// 函数式宏名之后没有括号时不展开
+		j := i + 1
+		for j < len(toks) && toks[j].kind == tokSpace {
+			j++
+		}
+		if j >= len(toks) && !atEnd {
+			return nil, true, nil
+		}
+		if j >= len(toks) || toks[j].text != "(" {
+			out = append(out, t)
+			continue
+		}
+
+		args, end, ok := collectArgs(toks, j)
+		if !ok {
+			if atEnd {
+				return nil, false, p.errorf("宏 %s 的参数未结束", m.name)
+			}
+			return nil, true, nil
+		}
+		if len(m.params) == 0 && len(args) == 1 && len(args[0]) == 0 {
+			args = nil
+		}
+		if m.variadic && len(args) >= len(m.params)-1 {
+			// 多余的参数合并到可变参数中
+			if len(args) > len(m.params) {
+				last := args[len(m.params)-1]
+				for _, a := range args[len(m.params):] {
+					last = append(last, token{tokOther, ","}, token{tokSpace, " "})
+					last = append(last, a...)
+				}
+				args = append(args[:len(m.params)-1], last)
+			}
+			for len(args) < len(m.params) {
+				args = append(args, nil)
+			}
+		}
+		if len(args) != len(m.params) {
+			return nil, false, p.errorf("宏 %s 需要 %d 个参数，实际为 %d 个", m.name, len(m.params), len(args))
+		}
+
+		body, err := p.substitute(m, args, disabled)
+		if err != nil {
+			return nil, false, err
+		}
+		expanded, _, err := p.expand(body, inner, true)
+		if err != nil {
+			return nil, false, err
+		}
+		out = append(out, expanded...)
+		i = end
+	}
+	return out, false, nil
+}
+
+func withDisabled(disabled map[string]bool, name string) map[string]bool {
+	inner := make(map[string]bool, len(disabled)+1)
+	for k := range disabled {
+		inner[k] = true
+	}
+	inner[name] = true
+	return inner
+}
+
+// collectArgs 从 ( 开始收集宏参数，返回参数和 ) 的位置
+func collectArgs(toks []token, open int) ([][]token, int, bool) {
+	var args [][]token
+	var cur []token
+	depth := 0
+	for i := open; i < len(toks); i++ {
+		t := toks[i]
+		switch t.text {
+		case "(":
+			depth++
+			if depth == 1 {
+				continue
+			}
+		case ")":
+			depth--
+			if depth == 0 {
+				return append(args, trimSpace(cur)), i, true
+			}
+		case ",":
+			if depth == 1 {
+				args = append(args, trimSpace(cur))
+				cur = nil
+				continue
+			}
+		}
+		cur = append(cur, t)
+	}
+	return nil, 0, false
+}
+
+// substitute 将参数代入宏体，处理 # 字符串化和 ## 拼接
+func (p *preprocessor) substitute(m *macro, args [][]token, disabled map[string]bool) ([]token, error) {
+	index := make(map[string]int, len(m.params))
+	for i, name := range m.params {
+		index[name] = i
+	}
+
+	body := m.body
+	var out []token
+	for i := 0; i < len(body); i++ {
+		t := body[i]
+
+		if t.text == "#" {
+			j := i + 1
+			for j < len(body) && body[j].kind == tokSpace {
+				j++
+			}
+			if j < len(body) {
+				if idx, ok := index[body[j].text]; ok {
+					out = append(out, token{tokString, strconv.Quote(stringify(args[idx]))})
+					i = j
+					continue
+				}
+			}
+		}
+
+		idx, isParam := index[t.text]
+		if t.kind != tokIdent || !isParam {
+			out = append(out, t)
+			continue
+		}
+
+		// 与 ## 相邻的参数不展开
+		if nextNonSpace(body, i, 1) == "##" || nextNonSpace(body, i, -1) == "##" {
+			out = append(out, args[idx]...)
+			continue
+		}
+		expanded, _, err := p.expand(args[idx], disabled, true)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, expanded...)
+	}
+	return paste(out), nil
+}
+
+// stringify 与 C 预处理器相同，参数中的连续空白合并为一个空格
+func stringify(toks []token) string {
+	var sb strings.Builder
+	for _, t := range toks {
+		if t.kind == tokSpace {
+			sb.WriteByte(' ')
+		} else {
+			sb.WriteString(t.text)
+		}
+	}
+	return sb.String()
+}
+
+func nextNonSpace(toks []token, i, dir int) string {
+	for j := i + dir; j >= 0 && j < len(toks); j += dir {
+		if toks[j].kind != tokSpace {
+			return toks[j].text
+		}
+	}
+	return ""
+}
+
+// paste 处理 ## 记号拼接
+func paste(toks []token) []token {
+	var out []token
+	for i := 0; i < len(toks); i++ {
+		if toks[i].text != "##" {
+			out = append(out, toks[i])
+			continue
+		}
+		out = trimSpace(out)
+		j := i + 1
+		for j < len(toks) && toks[j].kind == tokSpace {
+			j++
+		}
+		left := ""
+		if len(out) > 0 {
+			left = out[len(out)-1].text
+			out = out[:len(out)-1]
+		}
+		right := ""
+		if j < len(toks) {
+			right = toks[j].text
+		}
+		out = append(out, tokenize(left+right)...)
+		i = j
+	}
+	return out
+}
+
+// condition 计算 #if/#ifdef/#ifndef 的条件
+func (p *preprocessor) condition(kind, rest string) (bool, error) {
+	switch kind {
+	case "ifdef", "ifndef":
+		name := strings.TrimSpace(rest)
+		_, defined := p.macros[name]
+		return defined == (kind == "ifdef"), nil
+	}
+
+	// 先处理 defined，再展开宏，剩余的标识符按0处理
+	toks := tokenize(rest)
+	var resolved []token
+	for i := 0; i < len(toks); i++ {
+		if toks[i].text != "defined" {
+			resolved = append(resolved, toks[i])
+			continue
+		}
+		j := i + 1
+		for j < len(toks) && toks[j].kind == tokSpace {
+			j++
+		}
+		paren := j < len(toks) && toks[j].text == "("
+		if paren {
+			j++
+			for j < len(toks) && toks[j].kind == tokSpace {
+				j++
+			}
+		}
+		if j >= len(toks) || toks[j].kind != tokIdent {
+			return false, p.errorf("defined 之后需要宏名")
+		}
+		_, defined := p.macros[toks[j].text]
+		if paren {
+			j++
+			for j < len(toks) && toks[j].kind == tokSpace {
+				j++
+			}
+			if j >= len(toks) || toks[j].text != ")" {
+				return false, p.errorf("defined( 缺少 )")
+			}
+		}
+		value := "0"
+		if defined {
+			value = "1"
+		}
+		resolved = append(resolved, token{tokNumber, value})
+		i = j
+	}
+
+	expanded, _, err := p.expand(resolved, nil, true)
+	if err != nil {
+		return false, err
+	}
+	for i, t := range expanded {
+		if t.kind == tokIdent {
+			expanded[i] = token{tokNumber, "0"}
+		}
+	}
+
+	v, err := evalExpr(join(expanded))
+	if err != nil {
+		return false, p.errorf("#if 表达式无效: %v", err)
+	}
+	return v != 0, nil
+}
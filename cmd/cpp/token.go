@@ -0,0 +1,141 @@
+package cpp
+
+import "strings"
+
+type tokenKind int
+
+const (
+	tokIdent tokenKind = iota
+	tokNumber
+	tokString
+	tokSpace
+	tokOther
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func isIdentStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9'
+}
+
+// tokenize 将一行文本拆分为预处理记号，保留空白以便原样输出
+func tokenize(s string) []token {
+	var toks []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == '\v':
+			for i < len(s) && strings.IndexByte(" \t\r\n\f\v", s[i]) >= 0 {
+				i++
+			}
+			toks = append(toks, token{tokSpace, s[start:i]})
+		case isIdentStart(c):
+			for i < len(s) && isIdentChar(s[i]) {
+				i++
+			}
+			toks = append(toks, token{tokIdent, s[start:i]})
+		case c >= '0' && c <= '9':
+			for i < len(s) && (isIdentChar(s[i]) || s[i] == '.') {
+				i++
+			}
+			toks = append(toks, token{tokNumber, s[start:i]})
+		case c == '"' || c == '\'':
+			i++
+			for i < len(s) && s[i] != c {
+				if s[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			i = min(i+1, len(s))
+			toks = append(toks, token{tokString, s[start:i]})
+		case c == '#' && i+1 < len(s) && s[i+1] == '#':
+			i += 2
+			toks = append(toks, token{tokOther, "##"})
+		default:
+			i++
+			toks = append(toks, token{tokOther, s[start:i]})
+		}
+	}
+	return toks
+}
+
+func join(toks []token) string {
+	var sb strings.Builder
+	for _, t := range toks {
+		sb.WriteString(t.text)
+	}
+	return sb.String()
+}
+
+func trimSpace(toks []token) []token {
+	for len(toks) > 0 && toks[0].kind == tokSpace {
+		toks = toks[1:]
+	}
+	for len(toks) > 0 && toks[len(toks)-1].kind == tokSpace {
+		toks = toks[:len(toks)-1]
+	}
+	return toks
+}
+
+// stripComments 删除注释并合并续行，保持行数不变
+func stripComments(src []byte) []string {
+	var sb strings.Builder
+	pendingNewlines := 0
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '\\' && i+1 < len(src) && src[i+1] == '\n':
+			// 续行：合并到当前逻辑行，之后补回空行
+			i++
+			pendingNewlines++
+		case c == '\\' && i+2 < len(src) && src[i+1] == '\r' && src[i+2] == '\n':
+			i += 2
+			pendingNewlines++
+		case c == '"':
+			sb.WriteByte(c)
+			for i+1 < len(src) && src[i+1] != '"' && src[i+1] != '\n' {
+				i++
+				sb.WriteByte(src[i])
+				if src[i] == '\\' && i+1 < len(src) && src[i+1] != '\n' {
+					i++
+					sb.WriteByte(src[i])
+				}
+			}
+			if i+1 < len(src) && src[i+1] == '"' {
+				i++
+				sb.WriteByte('"')
+			}
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i+1 < len(src) && src[i+1] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			sb.WriteByte(' ')
+			i += 2
+			for i < len(src) && !(src[i] == '*' && i+1 < len(src) && src[i+1] == '/') {
+				if src[i] == '\n' {
+					sb.WriteByte('\n')
+				}
+				i++
+			}
+			i++
+		case c == '\n':
+			sb.WriteByte('\n')
+			for ; pendingNewlines > 0; pendingNewlines-- {
+				sb.WriteByte('\n')
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return strings.Split(sb.String(), "\n")
+}
@@ -0,0 +1,169 @@
+package decode
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// Region 一段地址区间
+type Region struct {
+	Address uint64
+	Size    uint64
+}
+
+// Range 一条 ranges 映射
+type Range struct {
+	Child  uint64
+	Parent uint64
+	Size   uint64
+}
+
+// cellCount 读取节点的单元数属性。普通设备树缺省时使用规范默认值；
+// overlay 中的节点地址空间由应用目标决定，缺省时视为未知
+func (d *Decoder) cellCount(n *fdt.Node, name string, def int) (int, bool) {
+	if n == nil {
+		return 0, false
+	}
+	if p := n.Property(name); p != nil {
+		if len(p.Value) != 4 {
+			return 0, false
+		}
+		return int(p.U32()), true
+	}
+	if d.tree.IsOverlay() {
+		return 0, false
+	}
+	return def, true
+}
+
+// AddressCells 返回总线节点的 #address-cells，缺省为 2
+func (d *Decoder) AddressCells(bus *fdt.Node) (int, bool) {
+	return d.cellCount(bus, "#address-cells", 2)
+}
+
+// SizeCells 返回总线节点的 #size-cells，缺省为 1
+func (d *Decoder) SizeCells(bus *fdt.Node) (int, bool) {
+	return d.cellCount(bus, "#size-cells", 1)
+}
+
+// Reg 按父节点的单元数解析 reg 属性
+func (d *Decoder) Reg(n *fdt.Node) ([]Region, bool) {
+	return d.Regions(n, "reg")
+}
+
+// Regions 按父节点的单元数解析由 <地址 大小> 组成的属性，如 reg、alloc-ranges
+func (d *Decoder) Regions(n *fdt.Node, name string) ([]Region, bool) {
+	p := n.Property(name)
+	if p == nil || n.Parent == nil {
+		return nil, false
+	}
+	ac, ok1 := d.AddressCells(n.Parent)
+	sc, ok2 := d.SizeCells(n.Parent)
+	if !ok1 || !ok2 || ac < 1 || ac > 2 || sc > 2 {
+		return nil, false
+	}
+	cells := p.U32s()
+	if len(p.Value)%4 != 0 || len(cells) == 0 || len(cells)%(ac+sc) != 0 {
+		return nil, false
+	}
+
+	var regions []Region
+	for i := 0; i < len(cells); i += ac + sc {
+		regions = append(regions, Region{
+			Address: fdt.ReadCells(cells[i:], ac),
+			Size:    fdt.ReadCells(cells[i+ac:], sc),
+		})
+	}
+	return regions, true
+}
+
+// Ranges 解析总线节点的 ranges 或 dma-ranges 属性。
+// 空属性表示一一映射，返回空列表
+func (d *Decoder) Ranges(bus *fdt.Node, name string) ([]Range, bool) {
+	p := bus.Property(name)
+	if p == nil || bus.Parent == nil {
+		return nil, false
+	}
+	cac, ok1 := d.AddressCells(bus)
+	pac, ok2 := d.AddressCells(bus.Parent)
+	sc, ok3 := d.SizeCells(bus)
+	if !ok1 || !ok2 || !ok3 || cac < 1 || cac > 2 || pac < 1 || pac > 2 || sc > 2 {
+		return nil, false
+	}
+	cells := p.U32s()
+	if len(p.Value)%4 != 0 || len(cells)%(cac+pac+sc) != 0 {
+		return nil, false
+	}
+
+	ranges := []Range{}
+	for i := 0; i < len(cells); i += cac + pac + sc {
+		ranges = append(ranges, Range{
+			Child:  fdt.ReadCells(cells[i:], cac),
+			Parent: fdt.ReadCells(cells[i+cac:], pac),
+			Size:   fdt.ReadCells(cells[i+cac+pac:], sc),
+		})
+	}
+	return ranges, true
+}
+
+// Translate 通过上级总线的 ranges 将节点 reg 中的地址转换为 CPU 地址
+func (d *Decoder) Translate(n *fdt.Node, addr uint64) (uint64, bool) {
+	for bus := n.Parent; bus != nil && bus.Parent != nil; bus = bus.Parent {
+		ranges, ok := d.Ranges(bus, "ranges")
+		if !ok {
+			return 0, false
+		}
+		if len(ranges) == 0 {
+			continue
+		}
+		found := false
+		for _, r := range ranges {
+			if addr >= r.Child && addr-r.Child < r.Size {
+				addr = r.Parent + (addr - r.Child)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	return addr, true
+}
+
+func (d *Decoder) explainReg(n *fdt.Node) ([]string, bool) {
+	regions, ok := d.Reg(n)
+	if !ok {
+		return nil, false
+	}
+	// 只有地址没有大小的 reg (如 CPU、I2C 设备) 仅输出地址
+	sc, _ := d.SizeCells(n.Parent)
+
+	var items []string
+	for _, r := range regions {
+		var b strings.Builder
+		fmt.Fprintf(&b, "0x%x", r.Address)
+		if sc > 0 {
+			fmt.Fprintf(&b, " size 0x%x", r.Size)
+		}
+		if cpu, ok := d.Translate(n, r.Address); ok && cpu != r.Address {
+			fmt.Fprintf(&b, " (cpu 0x%x)", cpu)
+		}
+		items = append(items, b.String())
+	}
+	return items, true
+}
+
+func (d *Decoder) explainRanges(n *fdt.Node, p *fdt.Property) ([]string, bool) {
+	ranges, ok := d.Ranges(n, p.Name)
+	if !ok {
+		return nil, false
+	}
+	var items []string
+	for _, r := range ranges {
+		items = append(items, fmt.Sprintf("0x%x -> 0x%x size 0x%x", r.Child, r.Parent, r.Size))
+	}
+	return items, true
+}
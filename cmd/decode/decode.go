@@ -0,0 +1,168 @@
+// Package decode 根据 #address-cells、#size-cells、#interrupt-cells、
+// #clock-cells 等单元数属性解释 reg、ranges、interrupts、clocks 的取值
+package decode
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// Decoder 设备树属性解释器
+type Decoder struct {
+	tree   *fdt.Tree
+	refs   *fdt.Refs
+	labels map[*fdt.Node]string
+}
+
+// New 为设备树创建解释器
+func New(t *fdt.Tree) *Decoder {
+	d := &Decoder{
+		tree:   t,
+		refs:   fdt.NewRefs(t),
+		labels: make(map[*fdt.Node]string),
+	}
+	if symbols := t.Root.Child("__symbols__"); symbols != nil {
+		for _, p := range symbols.Properties {
+			if n := t.Lookup(p.String()); n != nil && d.labels[n] == "" {
+				d.labels[n] = p.Name
+			}
+		}
+	}
+	t.Root.Walk(func(n *fdt.Node) bool {
+		if len(n.Labels) > 0 && d.labels[n] == "" {
+			d.labels[n] = n.Labels[0]
+		}
+		return true
+	})
+	return d
+}
+
+// Explain 返回属性取值的解释文本，无法解释的属性返回 false
+func (d *Decoder) Explain(n *fdt.Node, p *fdt.Property) (string, bool) {
+	if len(p.Value) == 0 || len(p.Value)%4 != 0 {
+		return "", false
+	}
+
+	var items []string
+	var ok bool
+	switch p.Name {
+	case "reg":
+		items, ok = d.explainReg(n)
+	case "ranges", "dma-ranges":
+		items, ok = d.explainRanges(n, p)
+	case "interrupts":
+		items, ok = d.explainInterrupts(n, p)
+	case "interrupts-extended":
+		items, ok = d.explainSpecifiers(n, p, "#interrupt-cells", d.interruptSpec)
+	case "clocks", "assigned-clocks", "assigned-clock-parents":
+		items, ok = d.explainSpecifiers(n, p, "#clock-cells", decimalSpec)
+	}
+	if !ok || len(items) == 0 {
+		return "", false
+	}
+
+	// 按 *-names 属性为每一项加上名称
+	if names := n.Property(namesProp(p.Name)); names != nil && names.IsStringList() {
+		if list := names.Strings(); len(list) == len(items) {
+			for i := range items {
+				items[i] = list[i] + ": " + items[i]
+			}
+		}
+	}
+	return strings.Join(items, ", "), true
+}
+
+// namesProp 返回与属性对应的名称列表属性
+func namesProp(name string) string {
+	switch name {
+	case "interrupts", "interrupts-extended":
+		return "interrupt-names"
+	case "clocks":
+		return "clock-names"
+	case "reg":
+		return "reg-names"
+	}
+	return ""
+}
+
+// Label 返回节点的标签，没有标签时返回空字符串
+func (d *Decoder) Label(n *fdt.Node) string {
+	return d.labels[n]
+}
+
+// Name 返回节点的引用写法，优先使用标签
+func (d *Decoder) Name(n *fdt.Node) string {
+	if label := d.labels[n]; label != "" {
+		return "&" + label
+	}
+	return "&{" + n.Path() + "}"
+}
+
+// specFunc 格式化 phandle 之后的参数单元
+type specFunc func(provider *fdt.Node, args []uint32) string
+
+func decimalSpec(_ *fdt.Node, args []uint32) string {
+	parts := make([]string, len(args))
+	for i, v := range args {
+		parts[i] = fmt.Sprint(v)
+	}
+	return strings.Join(parts, " ")
+}
+
+// explainSpecifiers 解释 <&provider args...> 列表。每一项的参数单元由
+// 引用偏移划分，因此 overlay 中未解析的外部引用同样可以解释
+func (d *Decoder) explainSpecifiers(n *fdt.Node, p *fdt.Property, cellsProp string, spec specFunc) ([]string, bool) {
+	refs := d.refs.Find(n, p)
+	if len(refs) == 0 {
+		return nil, false
+	}
+	cells := p.U32s()
+	var items []string
+	for i, ref := range refs {
+		end := len(cells)
+		if i+1 < len(refs) {
+			end = refs[i+1].Offset / 4
+		}
+		args := cells[ref.Offset/4+1 : end]
+
+		name := "&" + ref.Label
+		if ref.Target != nil {
+			name = d.Name(ref.Target)
+			// 参数之后的 0 单元是占位的空条目
+			if cp := ref.Target.Property(cellsProp); cp != nil && int(cp.U32()) < len(args) {
+				args = args[:cp.U32()]
+			}
+		}
+		if len(args) > 0 {
+			name += " " + spec(ref.Target, args)
+		}
+		items = append(items, name)
+	}
+	return items, true
+}
+
+// Count 返回 reg、ranges、interrupts 和 phandle 说明符列表的条目数
+func (d *Decoder) Count(n *fdt.Node, p *fdt.Property) (int, bool) {
+	switch p.Name {
+	case "reg":
+		regions, ok := d.Reg(n)
+		return len(regions), ok
+	case "ranges", "dma-ranges":
+		ranges, ok := d.Ranges(n, p.Name)
+		return len(ranges), ok
+	case "interrupts":
+		parent := d.InterruptParent(n)
+		if parent == nil || len(p.Value)%4 != 0 {
+			return 0, false
+		}
+		count := int(parent.Property("#interrupt-cells").U32())
+		if count == 0 || len(p.Value)/4%count != 0 {
+			return 0, false
+		}
+		return len(p.Value) / 4 / count, true
+	}
+	refs := d.refs.Find(n, p)
+	return len(refs), len(refs) > 0
+}
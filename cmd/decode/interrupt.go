@@ -0,0 +1,102 @@
+package decode
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// GIC 中断类型，与 dt-bindings/interrupt-controller/arm-gic.h 一致
+var gicTypes = []string{"GIC_SPI", "GIC_PPI", "GIC_ESPI", "GIC_EPPI"}
+
+// 触发方式，与 dt-bindings/interrupt-controller/irq.h 一致
+var irqTypes = map[uint32]string{
+	0: "IRQ_TYPE_NONE",
+	1: "IRQ_TYPE_EDGE_RISING",
+	2: "IRQ_TYPE_EDGE_FALLING",
+	3: "IRQ_TYPE_EDGE_BOTH",
+	4: "IRQ_TYPE_LEVEL_HIGH",
+	8: "IRQ_TYPE_LEVEL_LOW",
+}
+
+// InterruptParent 按 interrupt-parent 和节点层级查找中断控制器，
+// 与内核 of_irq_find_parent 的规则一致
+func (d *Decoder) InterruptParent(n *fdt.Node) *fdt.Node {
+	// 限制查找次数，避免 interrupt-parent 成环
+	for i := 0; i < 64 && n != nil; i++ {
+		if p := n.Property("interrupt-parent"); p != nil && len(p.Value) == 4 {
+			n = d.refs.Node(p.U32())
+		} else {
+			n = n.Parent
+		}
+		if n != nil && n.Property("#interrupt-cells") != nil {
+			return n
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) explainInterrupts(n *fdt.Node, p *fdt.Property) ([]string, bool) {
+	parent := d.InterruptParent(n)
+	if parent == nil {
+		return nil, false
+	}
+	count := int(parent.Property("#interrupt-cells").U32())
+	cells := p.U32s()
+	if count == 0 || len(cells)%count != 0 {
+		return nil, false
+	}
+
+	var items []string
+	for i := 0; i < len(cells); i += count {
+		items = append(items, d.interruptSpec(parent, cells[i:i+count]))
+	}
+	return items, true
+}
+
+// interruptSpec 按中断控制器的绑定格式化一个中断说明符
+func (d *Decoder) interruptSpec(ctrl *fdt.Node, args []uint32) string {
+	if ctrl != nil && isGIC(ctrl) && len(args) >= 3 {
+		kind := fmt.Sprint(args[0])
+		if int(args[0]) < len(gicTypes) {
+			kind = gicTypes[args[0]]
+		}
+		flags := irqType(args[2] & 0xff)
+		// PPI 的 8~15 位为 CPU 掩码
+		if mask := args[2] >> 8 & 0xff; mask != 0 {
+			flags = fmt.Sprintf("(GIC_CPU_MASK_RAW(0x%x) | %s)", mask, flags)
+		}
+		parts := []string{kind, fmt.Sprint(args[1]), flags}
+		if len(args) > 3 {
+			parts = append(parts, decimalSpec(ctrl, args[3:]))
+		}
+		return strings.Join(parts, " ")
+	}
+	// 两个单元的控制器通常为 <中断号 触发方式>
+	if len(args) == 2 {
+		return fmt.Sprintf("%d %s", args[0], irqType(args[1]))
+	}
+	return decimalSpec(ctrl, args)
+}
+
+func irqType(v uint32) string {
+	if name, ok := irqTypes[v]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%x", v)
+}
+
+// isGIC 判断节点是否为 ARM GIC 兼容的中断控制器
+func isGIC(n *fdt.Node) bool {
+	p := n.Property("compatible")
+	if p == nil {
+		return false
+	}
+	for _, c := range p.Strings() {
+		if strings.Contains(c, "gic") && !strings.Contains(c, "v2m") && !strings.Contains(c, "its") {
+			return true
+		}
+	}
+	return false
+}
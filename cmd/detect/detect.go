@@ -0,0 +1,264 @@
+package detect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/compression"
+	"github.com/kiy7086/dtbotool/cmd/sparse"
+)
+
+const (
+	DtTableMagic = 0xD7B7AB1E
+	FdtMagic     = 0xD00DFEED
+	QcdtMagic    = "QCDT"
+	BootMagic    = "ANDROID!"
+	VendorMagic  = "VNDRBOOT"
+
+	fdtHeaderSize = 40
+)
+
+// Format 输入数据格式
+type Format int
+
+const (
+	Unknown     Format = iota
+	DtTable            // Android dt_table (dtbo镜像)
+	Fdt                // 单个扁平设备树
+	Qcdt               // 高通 QCDT 多设备树镜像
+	BootImage          // Android boot 镜像
+	VendorBoot         // Android vendor_boot 镜像
+	AppendedFdt        // 末尾附加了设备树的数据(如 Image.gz-dtb)
+	Directory          // 目录
+)
+
+func (f Format) String() string {
+	switch f {
+	case DtTable:
+		return "dtbo"
+	case Fdt:
+		return "dtb"
+	case Qcdt:
+		return "qcdt"
+	case BootImage:
+		return "boot"
+	case VendorBoot:
+		return "vendor_boot"
+	case AppendedFdt:
+		return "appended"
+	case Directory:
+		return "dir"
+	default:
+		return "unknown"
+	}
+}
+
+// Description 返回格式的中文描述
+func (f Format) Description() string {
+	switch f {
+	case DtTable:
+		return "DTBO镜像 (dt_table)"
+	case Fdt:
+		return "设备树二进制 (FDT)"
+	case Qcdt:
+		return "高通设备树镜像 (QCDT)"
+	case BootImage:
+		return "Android boot 镜像"
+	case VendorBoot:
+		return "Android vendor_boot 镜像"
+	case AppendedFdt:
+		return "附加设备树的内核镜像"
+	case Directory:
+		return "目录"
+	default:
+		return "未知格式"
+	}
+}
+
+// ParseFormat 解析 --format 参数，空字符串表示自动检测
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "", "auto":
+		return Unknown, nil
+	case "dtbo", "dt_table", "img":
+		return DtTable, nil
+	case "dtb", "fdt":
+		return Fdt, nil
+	case "qcdt":
+		return Qcdt, nil
+	case "boot":
+		return BootImage, nil
+	case "vendor_boot":
+		return VendorBoot, nil
+	case "appended":
+		return AppendedFdt, nil
+	case "dir":
+		return Directory, nil
+	}
+	return Unknown, fmt.Errorf("未知的格式: %s", name)
+}
+
+// Result 检测结果
+type Result struct {
+	Format      Format
+	Compression compression.Type
+	Sparse      bool
+	Size        int      // 解压和还原sparse后的数据大小
+	Details     []string // 格式相关的附加信息
+}
+
+// Detect 根据魔数检测数据格式，数据应已解压
+func Detect(data []byte) Format {
+	switch {
+	case len(data) >= 4 && binary.BigEndian.Uint32(data) == DtTableMagic:
+		return DtTable
+	case len(data) >= 4 && binary.LittleEndian.Uint32(data) == DtTableMagic:
+		return DtTable
+	case IsFdt(data):
+		return Fdt
+	case bytes.HasPrefix(data, []byte(QcdtMagic)):
+		return Qcdt
+	case bytes.HasPrefix(data, []byte(BootMagic)):
+		return BootImage
+	case bytes.HasPrefix(data, []byte(VendorMagic)):
+		return VendorBoot
+	case len(ScanFdts(data)) > 0:
+		return AppendedFdt
+	}
+	return Unknown
+}
+
+// IsFdt 检查数据开头是否为有效的FDT头部
+func IsFdt(data []byte) bool {
+	if len(data) < fdtHeaderSize || binary.BigEndian.Uint32(data) != FdtMagic {
+		return false
+	}
+	be := binary.BigEndian
+	totalSize := be.Uint32(data[4:])
+	offStruct := be.Uint32(data[8:])
+	offStrings := be.Uint32(data[12:])
+	version := be.Uint32(data[20:])
+	return totalSize >= fdtHeaderSize && totalSize <= uint32(len(data)) &&
+		offStruct < totalSize && offStrings <= totalSize && version >= 16
+}
+
+// ScanFdts 在数据中搜索所有有效的FDT，返回各设备树的切片
+func ScanFdts(data []byte) [][]byte {
+	var fdts [][]byte
+	magic := binary.BigEndian.AppendUint32(nil, FdtMagic)
+
+	for pos := 0; pos < len(data); {
+		i := bytes.Index(data[pos:], magic)
+		if i < 0 {
+			break
+		}
+		pos += i
+		if IsFdt(data[pos:]) {
+			size := int(binary.BigEndian.Uint32(data[pos+4:]))
+			fdts = append(fdts, data[pos:pos+size])
+			pos += size
+			continue
+		}
+		pos += len(magic)
+	}
+	return fdts
+}
+
+// ReadFile 读取文件，透明解压并还原sparse镜像，同时检测格式
+func ReadFile(path string) ([]byte, *Result, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取文件失败: %v", err)
+	}
+
+	data, ctype, err := compression.Decompress(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := &Result{Compression: ctype}
+	if sparse.IsSparse(data) {
+		if data, err = sparse.Unsparse(data); err != nil {
+			return nil, nil, fmt.Errorf("还原sparse镜像失败: %v", err)
+		}
+		result.Sparse = true
+		// 分区转储中的内容也可能是压缩的
+		if data, _, err = compression.Decompress(data); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	result.Format = Detect(data)
+	result.Size = len(data)
+	result.Details = describe(data, result.Format)
+	return data, result, nil
+}
+
+// DetectFile 检测文件或目录的格式
+func DetectFile(path string) (*Result, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &Result{Format: Directory}, nil
+	}
+
+	_, result, err := ReadFile(path)
+	return result, err
+}
+
+// describe 生成格式相关的附加信息
+func describe(data []byte, format Format) []string {
+	switch format {
+	case DtTable:
+		endian := binary.ByteOrder(binary.BigEndian)
+		if binary.LittleEndian.Uint32(data) == DtTableMagic {
+			endian = binary.LittleEndian
+		}
+		if len(data) < 32 {
+			return nil
+		}
+		return []string{
+			fmt.Sprintf("条目数量: %d", endian.Uint32(data[16:])),
+			fmt.Sprintf("页大小: %d", endian.Uint32(data[24:])),
+			fmt.Sprintf("版本: %d", endian.Uint32(data[28:])),
+		}
+	case Fdt:
+		be := binary.BigEndian
+		return []string{
+			fmt.Sprintf("FDT版本: %d", be.Uint32(data[20:])),
+			fmt.Sprintf("设备树大小: %d 字节", be.Uint32(data[4:])),
+		}
+	case Qcdt:
+		if len(data) < 12 {
+			return nil
+		}
+		return []string{
+			fmt.Sprintf("QCDT版本: %d", binary.LittleEndian.Uint32(data[4:])),
+			fmt.Sprintf("条目数量: %d", binary.LittleEndian.Uint32(data[8:])),
+		}
+	case BootImage:
+		if len(data) < 44 {
+			return nil
+		}
+		return []string{
+			fmt.Sprintf("头部版本: %d", binary.LittleEndian.Uint32(data[40:])),
+			fmt.Sprintf("包含设备树: %d 个", len(ScanFdts(data))),
+		}
+	case VendorBoot:
+		if len(data) < 12 {
+			return nil
+		}
+		return []string{
+			fmt.Sprintf("头部版本: %d", binary.LittleEndian.Uint32(data[8:])),
+			fmt.Sprintf("包含设备树: %d 个", len(ScanFdts(data))),
+		}
+	case AppendedFdt:
+		return []string{fmt.Sprintf("附加设备树: %d 个", len(ScanFdts(data)))}
+	}
+	return nil
+}
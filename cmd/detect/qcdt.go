@@ -0,0 +1,50 @@
+package detect
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// SplitQcdt 解析 QCDT 镜像，返回其中的所有设备树(共享偏移的条目只返回一次)
+func SplitQcdt(data []byte) ([][]byte, error) {
+	if len(data) < 12 || string(data[:4]) != QcdtMagic {
+		return nil, fmt.Errorf("无效的QCDT文件格式")
+	}
+
+	le := binary.LittleEndian
+	version := le.Uint32(data[4:])
+	count := le.Uint32(data[8:])
+
+	// 各版本条目的字段数，最后两个字段为偏移和大小
+	var words int
+	switch version {
+	case 1:
+		words = 5
+	case 2:
+		words = 6
+	case 3:
+		words = 10
+	default:
+		return nil, fmt.Errorf("不支持的QCDT版本: %d", version)
+	}
+
+	var dtbs [][]byte
+	seen := make(map[uint32]bool)
+	for i := uint32(0); i < count; i++ {
+		entry := 12 + int(i)*words*4
+		if entry+words*4 > len(data) {
+			return nil, fmt.Errorf("QCDT条目 %d 被截断", i)
+		}
+		offset := le.Uint32(data[entry+(words-2)*4:])
+		size := le.Uint32(data[entry+(words-1)*4:])
+		if uint64(offset)+uint64(size) > uint64(len(data)) {
+			return nil, fmt.Errorf("QCDT条目 %d 范围无效", i)
+		}
+		if seen[offset] {
+			continue
+		}
+		seen[offset] = true
+		dtbs = append(dtbs, data[offset:offset+size])
+	}
+	return dtbs, nil
+}
@@ -0,0 +1,91 @@
+// Package diag 定义编译诊断信息。每条诊断包含文件、行、列、级别和消息，
+// 可以输出为编辑器和终端能够识别的 "文件:行:列: 级别: 消息" 文本或 JSON
+package diag
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Severity 诊断级别
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+)
+
+func (s Severity) String() string {
+	if s == Warning {
+		return "警告"
+	}
+	return "错误"
+}
+
+// MarshalText JSON 中使用英文级别名，便于编辑器识别
+func (s Severity) MarshalText() ([]byte, error) {
+	if s == Warning {
+		return []byte("warning"), nil
+	}
+	return []byte("error"), nil
+}
+
+// Diagnostic 一条诊断信息，行号和列号从 1 开始，未知时为 0
+type Diagnostic struct {
+	File     string   `json:"file"`
+	Line     int      `json:"line,omitempty"`
+	Column   int      `json:"column,omitempty"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// Location 返回 "文件:行:列" 形式的位置，省略未知的部分
+func (d Diagnostic) Location() string {
+	loc := d.File
+	if d.Line > 0 {
+		loc += ":" + strconv.Itoa(d.Line)
+		if d.Column > 0 {
+			loc += ":" + strconv.Itoa(d.Column)
+		}
+	}
+	return loc
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Location(), d.Severity, d.Message)
+}
+
+// Located 带源码位置的错误
+type Located interface {
+	error
+	Diagnostic() Diagnostic
+}
+
+// FromError 将错误转换为诊断信息。错误链中有带位置的错误时使用其位置，
+// 否则作为 file 的错误
+func FromError(file string, err error) Diagnostic {
+	var located Located
+	if errors.As(err, &located) {
+		return located.Diagnostic()
+	}
+	return Diagnostic{File: file, Severity: Error, Message: err.Error()}
+}
+
+// Print 以文本形式输出诊断信息，作为未指定接收方时的默认行为
+func Print(d Diagnostic) {
+	fmt.Println(d.String())
+}
+
+// WriteJSON 将诊断信息输出为 JSON 数组
+func WriteJSON(w io.Writer, diags []Diagnostic) error {
+	if diags == nil {
+		diags = []Diagnostic{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(diags)
+}
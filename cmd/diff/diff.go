@@ -0,0 +1,48 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/kiy7086/dtbotool/cmd/input"
+	"github.com/kiy7086/dtbotool/cmd/treediff"
+)
+
+// HandleDiff 比较两个设备树并按指定格式输出差异，返回是否存在差异。
+// format 可以是 unified (默认)、json (RFC 6902 JSON Patch) 或 summary
+func HandleDiff(a, b, format string, depth int) (bool, error) {
+	itemA, err := input.LoadOne(a)
+	if err != nil {
+		return false, err
+	}
+	itemB, err := input.LoadOne(b)
+	if err != nil {
+		return false, err
+	}
+
+	changes := treediff.Compare(itemA.Tree, itemB.Tree)
+	switch format {
+	case "", "unified":
+		if len(changes) == 0 {
+			fmt.Println("两个设备树没有差异")
+			return false, nil
+		}
+		treediff.WriteUnified(os.Stdout, itemA.Name, itemB.Name, changes)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(treediff.Patch(changes)); err != nil {
+			return false, err
+		}
+	case "summary":
+		if depth < 1 {
+			return false, fmt.Errorf("子树深度必须大于0")
+		}
+		treediff.WriteSummary(os.Stdout, treediff.Summarize(changes, depth))
+	default:
+		return false, fmt.Errorf("未知的输出格式: %s (可选 unified/json/summary)", format)
+	}
+	return len(changes) > 0, nil
+}
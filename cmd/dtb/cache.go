@@ -0,0 +1,166 @@
+package dtb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/kiy7086/dtbotool/cmd/treefile"
+)
+
+// CacheFile 增量编译的缓存清单，保存在输出目录中
+const CacheFile = ".dtbcache.json"
+
+// cacheVersion 清单格式或编译器输出变化时递增，使旧的缓存全部失效
+const cacheVersion = 2
+
+// buildCache 增量编译缓存。每个源文件的键由编译选项、源文件内容以及编译时
+// 实际读取的所有包含文件的路径和内容计算得出，键和输出文件都未变化、
+// 且查找包含文件时不存在的路径仍不存在时跳过编译
+type buildCache struct {
+	path    string
+	options string
+
+	Version int                    `json:"version"`
+	Entries map[string]*cacheEntry `json:"entries"` // 以源文件名为键
+}
+
+// cacheEntry 一个源文件上次成功编译的记录
+type cacheEntry struct {
+	Key     string   `json:"key"`
+	Deps    []string `json:"deps,omitempty"`    // 通过 #include、/include/ 和 /incbin/ 读取的文件
+	Missing []string `json:"missing,omitempty"` // 查找包含文件时先于实际文件查找、但不存在的路径
+	Output  string   `json:"output"`            // 输出文件内容的哈希
+}
+
+// loadCache 读取输出目录中的缓存清单。清单不存在、损坏或版本不同时返回空缓存
+func loadCache(dir string, opts CompileOptions) *buildCache {
+	c := &buildCache{
+		path:    filepath.Join(dir, CacheFile),
+		options: opts.cacheKey(),
+		Version: cacheVersion,
+		Entries: make(map[string]*cacheEntry),
+	}
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return c
+	}
+	var saved buildCache
+	if err := json.Unmarshal(data, &saved); err != nil || saved.Version != cacheVersion || saved.Entries == nil {
+		return c
+	}
+	c.Entries = saved.Entries
+	return c
+}
+
+// save 写回缓存清单
+func (c *buildCache) save() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(c.path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("写入编译缓存失败: %v", err)
+	}
+	return nil
+}
+
+// fresh 判断源文件的输出是否仍然有效。查找时不存在的路径出现文件后，
+// 包含会解析到新的文件，此时也需要重新编译
+func (c *buildCache) fresh(name, source, output string) bool {
+	e := c.Entries[name]
+	if e == nil {
+		return false
+	}
+	for _, path := range e.Missing {
+		if _, err := os.Stat(path); err == nil {
+			return false
+		}
+	}
+	key := c.sourceKey(source, e.Deps)
+	return key != "" && key == e.Key && fileHash(output) == e.Output
+}
+
+// record 记录一次成功的编译，deps 为编译时查找过的文件
+func (c *buildCache) record(name, source, output string, deps dependencies) {
+	key := c.sourceKey(source, deps.found)
+	out := fileHash(output)
+	if key == "" || out == "" {
+		delete(c.Entries, name)
+		return
+	}
+	c.Entries[name] = &cacheEntry{Key: key, Deps: deps.found, Missing: deps.missing, Output: out}
+}
+
+// prune 删除源文件已不存在的条目，不删除输出文件
+func (c *buildCache) prune(names []string) {
+	for name := range c.Entries {
+		if !slices.Contains(names, name) {
+			delete(c.Entries, name)
+		}
+	}
+}
+
+// sourceKey 计算源文件及其依赖的键，任一文件无法读取时返回空
+func (c *buildCache) sourceKey(source string, deps []string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d %s\n", cacheVersion, c.options)
+	for i, path := range append([]string{source}, deps...) {
+		sum := fileHash(path)
+		if sum == "" {
+			return ""
+		}
+		// 源文件只比较内容，包含文件还要比较路径，搜索路径中的同名文件替换后也会重新编译
+		if i == 0 {
+			path = ""
+		}
+		fmt.Fprintf(h, "%s %s\n", path, sum)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheKey 影响编译结果的选项的哈希
+func (o CompileOptions) cacheKey() string {
+	data, err := json.Marshal(struct {
+		Dtc    DtcOptions
+		Format treefile.Format
+	}{o.Dtc, o.Format})
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// fileHash 文件内容的 SHA-256，文件无法读取时返回空
+func fileHash(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// dependencies 收集编译时读取的文件和查找过但不存在的路径，路径转为绝对路径并去重
+type dependencies struct {
+	found   []string
+	missing []string
+}
+
+func (d *dependencies) add(path string, exists bool) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	list := &d.missing
+	if exists {
+		list = &d.found
+	}
+	if !slices.Contains(*list, path) {
+		*list = append(*list, path)
+	}
+}
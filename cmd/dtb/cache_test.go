@@ -0,0 +1,93 @@
+package dtb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// TestCache 源文件、包含文件、选项和输出任一变化，或者查找包含文件时
+// 先于实际文件的路径出现了文件，都需要重新编译
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	out := filepath.Join(dir, "out")
+	first := filepath.Join(dir, "first")
+	second := filepath.Join(dir, "second")
+	for _, d := range []string{src, first, second} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(path, data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(src, "a.dts"), "/dts-v1/;\n#include <inc.dtsi>\n/ { model = MODEL; };\n")
+	write(filepath.Join(second, "inc.dtsi"), "#define MODEL \"second\"\n")
+
+	dtb := filepath.Join(out, "a.dtb")
+	old := time.Now().Add(-time.Hour)
+	opts := CompileOptions{Dtc: DtcOptions{IncludeDirs: []string{first, second}}}
+
+	// compile 编译目录并返回输出是否被重新写入
+	compile := func(opts CompileOptions) bool {
+		t.Helper()
+		if _, err := os.Stat(dtb); err == nil {
+			if err := os.Chtimes(dtb, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := CompileAllDtsInDir(src, opts, out); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(dtb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.ModTime().After(old)
+	}
+	model := func() string {
+		t.Helper()
+		tree, err := fdt.ReadFile(dtb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tree.Root.Property("model").String()
+	}
+
+	steps := []struct {
+		name    string
+		change  func()
+		opts    CompileOptions
+		rebuilt bool
+		model   string
+	}{
+		{"首次编译", nil, opts, true, "second"},
+		{"未变化", nil, opts, false, "second"},
+		{"包含文件变化", func() { write(filepath.Join(second, "inc.dtsi"), "#define MODEL \"changed\"\n") }, opts, true, "changed"},
+		{"选项变化", nil, CompileOptions{Dtc: DtcOptions{IncludeDirs: opts.Dtc.IncludeDirs, Symbols: true}}, true, "changed"},
+		{"恢复选项", nil, opts, true, "changed"},
+		{"同名文件出现在之前的搜索路径中", func() { write(filepath.Join(first, "inc.dtsi"), "#define MODEL \"first\"\n") }, opts, true, "first"},
+		{"输出被修改", func() { write(dtb, "x") }, opts, true, "first"},
+		{"源文件变化", func() { write(filepath.Join(src, "a.dts"), "/dts-v1/;\n/ { model = \"plain\"; };\n") }, opts, true, "plain"},
+		{"不再包含的文件变化不影响缓存", func() { write(filepath.Join(first, "inc.dtsi"), "") }, opts, false, "plain"},
+		{"强制重新编译", nil, CompileOptions{Dtc: opts.Dtc, Force: true}, true, "plain"},
+	}
+	for _, step := range steps {
+		if step.change != nil {
+			step.change()
+		}
+		if got := compile(step.opts); got != step.rebuilt {
+			t.Fatalf("%s: 重新编译 = %v, 期望 %v", step.name, got, step.rebuilt)
+		}
+		if got := model(); got != step.model {
+			t.Fatalf("%s: model = %q, 期望 %q", step.name, got, step.model)
+		}
+	}
+}
@@ -1,15 +1,65 @@
 package dtb
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/cpp"
+	"github.com/kiy7086/dtbotool/cmd/diag"
+	"github.com/kiy7086/dtbotool/cmd/dts"
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+	"github.com/kiy7086/dtbotool/cmd/parallel"
+	"github.com/kiy7086/dtbotool/cmd/treefile"
 )
 
-// CompileAllDtsInDir 编译目录中的所有DTS文件
-func CompileAllDtsInDir(dtsDir string, outDir ...string) error {
+// CompileOptions DTS 编译选项
+type CompileOptions struct {
+	Dtc    DtcOptions      // 编译配置
+	Format treefile.Format // 源文件格式，Auto 表示按扩展名判断
+	Force  bool            // 批量编译时忽略缓存，重新编译所有文件
+	Jobs   int             // 批量编译的并发数，不大于 0 时使用CPU数量
+
+	// Report 接收编译过程中的警告和失败的诊断信息。为 nil 时警告直接输出，
+	// 失败只通过返回的错误报告
+	Report func(diag.Diagnostic)
+
+	out io.Writer // 批量编译时每个文件的输出，为 nil 时输出到标准输出
+}
+
+// printf 输出编译过程信息
+func (o CompileOptions) printf(format string, args ...any) {
+	if o.out != nil {
+		fmt.Fprintf(o.out, format, args...)
+	} else {
+		fmt.Printf(format, args...)
+	}
+}
+
+// warn 报告一条警告
+func (o CompileOptions) warn(d diag.Diagnostic) {
+	if o.Report != nil {
+		o.Report(d)
+	} else {
+		o.printf("%s\n", d)
+	}
+}
+
+// reportFailure 将编译失败报告给 Report。检查失败时每一项错误都已报告，不再重复
+func (o CompileOptions) reportFailure(file string, err error) {
+	var ce *checkError
+	if o.Report != nil && !errors.As(err, &ce) {
+		o.Report(diag.FromError(file, err))
+	}
+}
+
+// CompileAllDtsInDir 以 opts.Jobs 个并发编译目录中的所有DTS文件，每个文件的输出
+// 按文件顺序显示。输出目录中的缓存清单记录了每个文件上次编译时的源文件、
+// 包含文件和选项，均未变化且输出完好的文件会被跳过
+func CompileAllDtsInDir(dtsDir string, opts CompileOptions, outDir ...string) error {
 	// 确定输出目录
 	dtbDir := strings.TrimSuffix(dtsDir, "_decompiled") + "_compiled"
 	if len(outDir) > 0 && outDir[0] != "" {
@@ -25,10 +75,10 @@ func CompileAllDtsInDir(dtsDir string, outDir ...string) error {
 		return fmt.Errorf("读取目录失败: %v", err)
 	}
 
-	// 统计文件数量
+	// 统计文件数量，JSON/YAML 文档与 DTS 一样作为源文件
 	var dtsFiles []string
 	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".dts") {
+		if !file.IsDir() && treefile.IsSource(file.Name()) {
 			dtsFiles = append(dtsFiles, file.Name())
 		}
 	}
@@ -39,26 +89,73 @@ func CompileAllDtsInDir(dtsDir string, outDir ...string) error {
 
 	fmt.Printf("找到 %d 个 DTS 文件需要编译\n", len(dtsFiles))
 
-	// 编译所有文件
-	var failedFiles []string
-	for _, fileName := range dtsFiles {
-		dtsPath := filepath.Join(dtsDir, fileName)
-		dtbPath := filepath.Join(dtbDir, strings.TrimSuffix(fileName, ".dts")+".dtb")
+	cache := loadCache(dtbDir, opts)
+	cache.prune(dtsFiles)
+
+	// 并发编译时缓存只读，诊断先按文件收集，全部完成后再按顺序记录和报告
+	dtsPaths := make([]string, len(dtsFiles))
+	dtbPaths := make([]string, len(dtsFiles))
+	deps := make([]dependencies, len(dtsFiles))
+	diags := make([][]diag.Diagnostic, len(dtsFiles))
+	skip := make([]bool, len(dtsFiles))
+	errs := parallel.Run(opts.Jobs, len(dtsFiles), func(i int, w io.Writer) error {
+		fileName := dtsFiles[i]
+		dtsPaths[i] = filepath.Join(dtsDir, fileName)
+		dtbPaths[i] = filepath.Join(dtbDir, strings.TrimSuffix(fileName, filepath.Ext(fileName))+".dtb")
+
+		if !opts.Force && cache.fresh(fileName, dtsPaths[i], dtbPaths[i]) {
+			fmt.Fprintf(w, "\n未变化，跳过: %s\n", fileName)
+			skip[i] = true
+			return nil
+		}
 
-		fmt.Printf("\n正在处理: %s\n", fileName)
+		fmt.Fprintf(w, "\n正在处理: %s\n", fileName)
 
-		if err := CompileDts(dtsPath, dtbPath); err != nil {
-			fmt.Printf("警告: 编译失败: %v\n", err)
-			failedFiles = append(failedFiles, fileName)
-			continue
+		jobOpts := opts
+		jobOpts.out = w
+		if opts.Report != nil {
+			jobOpts.Report = func(d diag.Diagnostic) {
+				diags[i] = append(diags[i], d)
+			}
+		}
+		err := compileDts(dtsPaths[i], dtbPaths[i], jobOpts, deps[i].add)
+		if err != nil {
+			fmt.Fprintf(w, "警告: 编译失败: %v\n", err)
 		}
+		return err
+	})
+
+	// 失败的文件在最后按 "源文件: 文件:行:列" 列出，便于在终端或编辑器中跳转。
+	// 错误位于包含文件中时，前缀说明是哪个源文件编译失败
+	var failures []string
+	skipped := 0
+	for i, fileName := range dtsFiles {
+		for _, d := range diags[i] {
+			opts.Report(d)
+		}
+		switch {
+		case errs[i] != nil:
+			failures = append(failures, fmt.Sprintf("%s: %s", fileName, diag.FromError(dtsPaths[i], errs[i])))
+			delete(cache.Entries, fileName)
+		case skip[i]:
+			skipped++
+		default:
+			cache.record(fileName, dtsPaths[i], dtbPaths[i], deps[i])
+		}
+	}
+
+	if err := cache.save(); err != nil {
+		fmt.Printf("警告: %v\n", err)
+	}
+	if skipped > 0 {
+		fmt.Printf("\n%d 个文件未变化，已跳过 (使用 --force 重新编译全部文件)\n", skipped)
 	}
 
 	// 显示编译结果摘要
-	if len(failedFiles) > 0 {
-		fmt.Printf("\n编译完成，但有 %d 个文件失败:\n", len(failedFiles))
-		for _, file := range failedFiles {
-			fmt.Printf("- %s\n", file)
+	if len(failures) > 0 {
+		fmt.Printf("\n编译完成，但有 %d 个文件失败:\n", len(failures))
+		for _, f := range failures {
+			fmt.Println(f)
 		}
 		return fmt.Errorf("部分文件编译失败")
 	}
@@ -68,26 +165,74 @@ func CompileAllDtsInDir(dtsDir string, outDir ...string) error {
 }
 
 // CompileDts 将DTS文件编译为DTB文件
-func CompileDts(dtsFile, dtbFile string) error {
-	fmt.Printf("正在编译 %s...\n", dtsFile)
+func CompileDts(dtsFile, dtbFile string, opts CompileOptions) error {
+	return compileDts(dtsFile, dtbFile, opts, nil)
+}
+
+// compileDts 编译单个文件，depend 接收编译时查找过的包含文件
+func compileDts(dtsFile, dtbFile string, opts CompileOptions, depend func(string, bool)) error {
+	opts.printf("正在编译 %s...\n", dtsFile)
 
 	// 首先检查输入文件是否存在
 	if _, err := os.Stat(dtsFile); os.IsNotExist(err) {
 		return fmt.Errorf("DTS文件不存在: %s", dtsFile)
 	}
 
-	// 使用dtc编译
-	cmd := exec.Command("dtc",
-		"-I", "dts", // 输入格式为DTS
-		"-O", "dtb", // 输出格��为DTB
-		"-o", dtbFile, // 输出文件
-		dtsFile) // 输入文件
-
-	output, err := cmd.CombinedOutput()
+	tree, err := compileSource(dtsFile, opts, depend)
 	if err != nil {
-		return fmt.Errorf("编译DTS失败: %v\n%s", err, output)
+		opts.reportFailure(dtsFile, err)
+		return err
+	}
+
+	if err := fdt.WriteFile(dtbFile, tree); err != nil {
+		return err
 	}
 
-	fmt.Printf("已将 %s 编译为 %s\n", dtsFile, dtbFile)
+	opts.printf("已将 %s 编译为 %s\n", dtsFile, dtbFile)
 	return nil
 }
+
+// compileSource 按格式读取源文件: JSON/YAML 文档直接转换，DTS 经过预处理后编译，
+// 然后按编译配置设置输出布局并进行检查
+func compileSource(file string, opts CompileOptions, depend func(string, bool)) (*fdt.Tree, error) {
+	if err := opts.Dtc.Validate(); err != nil {
+		return nil, err
+	}
+
+	format := opts.Format
+	if format == treefile.Auto {
+		format = treefile.FromExt(file)
+	}
+
+	var tree *fdt.Tree
+	var err error
+	if format == treefile.JSON || format == treefile.YAML {
+		if tree, err = treefile.ReadFile(file, format); err != nil {
+			return nil, err
+		}
+	} else {
+		// 先经过预处理器展开 #include 和宏，行标记保证错误指向原始文件
+		src, err := cpp.Preprocess(file, cpp.Options{IncludeDirs: opts.Dtc.IncludeDirs, Report: opts.warn, Depend: depend})
+		if err != nil {
+			return nil, fmt.Errorf("预处理DTS失败: %w", err)
+		}
+
+		// 使用内置编译器编译
+		dtsOpts := opts.Dtc.dtsOptions()
+		dtsOpts.Report = opts.warn
+		dtsOpts.Depend = depend
+		if tree, err = dts.CompileSource(file, src, dtsOpts); err != nil {
+			return nil, fmt.Errorf("编译DTS失败: %w", err)
+		}
+	}
+
+	if opts.Dtc.Checks {
+		if err := opts.Dtc.check(file, tree, opts.warn); err != nil {
+			return nil, err
+		}
+	}
+	if err := opts.Dtc.apply(tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
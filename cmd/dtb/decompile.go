@@ -2,14 +2,38 @@ package dtb
 
 import (
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/compression"
+	"github.com/kiy7086/dtbotool/cmd/dts"
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+	"github.com/kiy7086/dtbotool/cmd/parallel"
+	"github.com/kiy7086/dtbotool/cmd/treefile"
 )
 
-// DecompileAllDtbInDir 反编译目录中的所有DTB文件
-func DecompileAllDtbInDir(dtbDir string) error {
+// DecompileOptions 反编译选项
+type DecompileOptions struct {
+	Format   treefile.Format // 批量反编译时的输出格式 (DTS/JSON/YAML)
+	Annotate bool            // 在DTS中以注释解释 reg、interrupts、clocks 等属性
+	Jobs     int             // 批量反编译的并发数，不大于 0 时使用CPU数量
+
+	out io.Writer // 批量反编译时每个文件的输出，为 nil 时输出到标准输出
+}
+
+// printf 输出反编译过程信息
+func (o DecompileOptions) printf(format string, args ...any) {
+	if o.out != nil {
+		fmt.Fprintf(o.out, format, args...)
+	} else {
+		fmt.Printf(format, args...)
+	}
+}
+
+// DecompileAllDtbInDir 反编译目录中的所有DTB文件，opts.Format 决定输出 DTS、JSON 还是 YAML
+func DecompileAllDtbInDir(dtbDir string, opts DecompileOptions) error {
 	// 创建DTS输出目录
 	dtsDir := strings.TrimSuffix(dtbDir, "_extracted") + "_decompiled"
 	if err := os.MkdirAll(dtsDir, 0755); err != nil {
@@ -21,38 +45,76 @@ func DecompileAllDtbInDir(dtbDir string) error {
 		return fmt.Errorf("读取目录失败: %v", err)
 	}
 
+	var dtbFiles []string
 	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".dtb") {
-			dtbPath := filepath.Join(dtbDir, file.Name())
-			dtsPath := filepath.Join(dtsDir, strings.TrimSuffix(file.Name(), ".dtb")+".dts")
-			if err := DecompileDtb(dtbPath, dtsPath); err != nil {
-				fmt.Printf("警告: 反编译 %s 失败: %v\n", dtbPath, err)
-			}
+		if !file.IsDir() && strings.HasSuffix(compression.TrimExt(file.Name()), ".dtb") {
+			dtbFiles = append(dtbFiles, filepath.Join(dtbDir, file.Name()))
 		}
 	}
+	if err := DecompileFiles(dtbFiles, dtsDir, opts); err != nil {
+		return err
+	}
 
 	fmt.Printf("已将反编译的DTS文件保存到: %s\n", dtsDir)
 	return nil
 }
 
-// DecompileDtb 将DTB文件反编译为DTS文件
-func DecompileDtb(dtbFile, dtsFile string) error {
-	// 使用dtc反编译
-	cmd := exec.Command("dtc",
-		"-I", "dtb", // 输入格式为DTB
-		"-O", "dts", // 输出格式为DTS
-		"-o", dtsFile, // 输出文件
-		"-S", "4", // 缩进级别
-		"-R", "8", // 每行最大引用数
-		"-b", "0", // 设置引导CPU为0
-		"-@",    // 启用符号引用
-		dtbFile) // 输入文件
-
-	output, err := cmd.CombinedOutput()
+// DecompileFiles 以 opts.Jobs 个并发将多个DTB文件反编译到 dtsDir，每个文件的输出
+// 按文件顺序显示，失败的文件在最后汇总
+func DecompileFiles(dtbFiles []string, dtsDir string, opts DecompileOptions) error {
+	errs := parallel.Run(opts.Jobs, len(dtbFiles), func(i int, w io.Writer) error {
+		dtbPath := dtbFiles[i]
+		name := strings.TrimSuffix(compression.TrimExt(filepath.Base(dtbPath)), ".dtb")
+		dtsPath := filepath.Join(dtsDir, name+opts.Format.Ext())
+
+		fmt.Fprintf(w, "正在处理: %s\n", filepath.Base(dtbPath))
+		jobOpts := opts
+		jobOpts.out = w
+		err := DecompileDtb(dtbPath, dtsPath, jobOpts)
+		if err != nil {
+			fmt.Fprintf(w, "警告: 反编译 %s 失败: %v\n", dtbPath, err)
+		}
+		return err
+	})
+
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", dtbFiles[i], err))
+		}
+	}
+	if len(failed) > 0 {
+		fmt.Printf("\n反编译完成，但有 %d 个文件失败:\n", len(failed))
+		for _, f := range failed {
+			fmt.Printf("- %s\n", f)
+		}
+		return fmt.Errorf("部分文件反编译失败")
+	}
+	return nil
+}
+
+// DecompileDtb 将DTB文件反编译为DTS文件，输出文件扩展名为 .json 或 .yaml 时
+// 写出对应格式的文档
+func DecompileDtb(dtbFile, dtsFile string, opts DecompileOptions) error {
+	tree, err := fdt.ReadFile(dtbFile)
 	if err != nil {
-		return fmt.Errorf("反编译DTB失败: %v\n%s", err, output)
+		return fmt.Errorf("反编译DTB失败: %v", err)
+	}
+
+	if format := treefile.FromExt(dtsFile); format == treefile.JSON || format == treefile.YAML {
+		if err := treefile.WriteFile(dtsFile, tree, format); err != nil {
+			return err
+		}
+		opts.printf("已将 %s 导出为 %s\n", dtbFile, dtsFile)
+		return nil
+	}
+
+	// 使用 __symbols__ 恢复标签和引用
+	source := dts.Decompile(tree, dts.DecompileOptions{Symbols: true, Annotate: opts.Annotate})
+	if err := os.WriteFile(dtsFile, source, 0644); err != nil {
+		return fmt.Errorf("写入DTS文件失败: %v", err)
 	}
 
-	fmt.Printf("已将 %s 反编译为 %s\n", dtbFile, dtsFile)
+	opts.printf("已将 %s 反编译为 %s\n", dtbFile, dtsFile)
 	return nil
 }
@@ -0,0 +1,213 @@
+package dtb
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/diag"
+	"github.com/kiy7086/dtbotool/cmd/dts"
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+	"github.com/kiy7086/dtbotool/cmd/lint"
+)
+
+// ProfileFile 编译配置文件名，从当前目录向上查找
+const ProfileFile = ".dtcprofile"
+
+// DtcOptions 编译配置，对应 dtc 的常用参数。编译由内置编译器完成，不调用
+// 外部的 dtc，因此不存在版本差异；配置中出现不支持的选项时直接报错
+type DtcOptions struct {
+	Symbols     bool     // 生成 __symbols__ 节点 (-@)
+	IncludeDirs []string // #include 和 /include/ 的搜索路径 (-i)
+	Padding     uint32   // 在设备树末尾填充的字节数 (-p)
+	MinSize     uint32   // 输出的最小总大小，不足时填充 (-S)
+	Reserve     int      // 额外的空内存保留区条目数 (-R)
+	BootCpu     *uint32  // 启动CPU的物理ID，为 nil 时取 /cpus 下第一个CPU的 reg (-b)
+	Checks      bool     // 编译后按 lint 规则检查，错误时编译失败
+	Suppress    []string // 不显示的警告，可以是编译警告或 lint 规则 (-W no-<id>)
+}
+
+// Set 按配置项名称设置选项，配置文件和命令行参数共用
+func (o *DtcOptions) Set(key, value string) error {
+	var err error
+	switch key {
+	case "symbols":
+		o.Symbols, err = parseBool(value)
+	case "include":
+		for _, dir := range strings.Split(value, ",") {
+			if dir = strings.TrimSpace(dir); dir != "" {
+				o.IncludeDirs = append(o.IncludeDirs, dir)
+			}
+		}
+	case "padding":
+		o.Padding, err = parseUint32(value)
+	case "size":
+		o.MinSize, err = parseUint32(value)
+	case "reserve":
+		var n uint32
+		n, err = parseUint32(value)
+		o.Reserve = int(n)
+	case "boot-cpu":
+		var id uint32
+		if id, err = parseUint32(value); err == nil {
+			o.BootCpu = &id
+		}
+	case "checks":
+		o.Checks, err = parseBool(value)
+	case "suppress":
+		for _, id := range strings.Split(value, ",") {
+			id = strings.TrimPrefix(strings.TrimSpace(id), "no-")
+			if id == "" {
+				continue
+			}
+			if _, ok := dts.Warnings[id]; !ok && lint.Lookup(id) == nil {
+				return fmt.Errorf("未知的警告: %s", id)
+			}
+			o.Suppress = append(o.Suppress, id)
+		}
+	default:
+		return fmt.Errorf("不支持的选项: %s", key)
+	}
+	if err != nil {
+		return fmt.Errorf("%s 的值 \"%s\" 无效: %v", key, value, err)
+	}
+	return nil
+}
+
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "yes", "on":
+		return true, nil
+	case "no", "off":
+		return false, nil
+	}
+	return strconv.ParseBool(s)
+}
+
+func parseUint32(s string) (uint32, error) {
+	v, err := strconv.ParseUint(s, 0, 32)
+	return uint32(v), err
+}
+
+// LoadDtcOptions 读取编译配置文件。path 为空时从当前目录向上查找 .dtcprofile，
+// 找不到时返回默认配置。每行格式为 "选项: 值"，# 开始注释，
+// include 中的相对路径相对于配置文件所在目录
+func LoadDtcOptions(path string) (DtcOptions, error) {
+	var opts DtcOptions
+	if path == "" {
+		if path = lint.FindFile(".", ProfileFile); path == "" {
+			return opts, nil
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return opts, fmt.Errorf("读取编译配置失败: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for num := 1; scanner.Scan(); num++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return opts, fmt.Errorf("%s:%d: 需要 \"选项: 值\"", path, num)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if key == "include" {
+			var dirs []string
+			for _, dir := range strings.Split(value, ",") {
+				if dir = strings.TrimSpace(dir); dir != "" && !filepath.IsAbs(dir) {
+					dir = filepath.Join(filepath.Dir(path), dir)
+				}
+				dirs = append(dirs, dir)
+			}
+			value = strings.Join(dirs, ",")
+		}
+		if err := opts.Set(key, value); err != nil {
+			return opts, fmt.Errorf("%s:%d: %v", path, num, err)
+		}
+	}
+	return opts, scanner.Err()
+}
+
+// Validate 检查选项之间的冲突
+func (o DtcOptions) Validate() error {
+	if o.Padding > 0 && o.MinSize > 0 {
+		return fmt.Errorf("padding 和 size 不能同时使用")
+	}
+	return nil
+}
+
+// dtsOptions 返回内置编译器的选项
+func (o DtcOptions) dtsOptions() dts.Options {
+	return dts.Options{IncludeDirs: o.IncludeDirs, Symbols: o.Symbols, Suppress: o.Suppress}
+}
+
+// apply 设置输出布局相关的选项: 启动CPU、空保留区条目、填充和最小大小
+func (o DtcOptions) apply(t *fdt.Tree) error {
+	if o.BootCpu != nil {
+		t.BootCpuidPhys = *o.BootCpu
+	}
+	// 全零条目与结束标记相同，引导程序可以在此写入新的保留区
+	t.Reserve = append(t.Reserve, make([]fdt.ReserveEntry, o.Reserve)...)
+	t.Padding = o.Padding
+	if o.MinSize > 0 {
+		data, err := t.Bytes()
+		if err != nil {
+			return err
+		}
+		if size := uint32(len(data)); size < o.MinSize {
+			t.Padding += o.MinSize - size
+		}
+	}
+	return nil
+}
+
+// checkError 检查发现错误，各项错误已经作为诊断报告
+type checkError struct {
+	count int
+}
+
+func (e *checkError) Error() string {
+	return fmt.Sprintf("检查发现 %d 个错误", e.count)
+}
+
+// check 按 lint 规则检查编译结果，将结果交给 report，存在错误时返回 error。
+// 检查针对整个设备树，诊断只有文件没有行号，节点路径放在消息中
+func (o DtcOptions) check(file string, t *fdt.Tree, report func(diag.Diagnostic)) error {
+	cfg, err := lint.LoadConfig(lint.Options{})
+	if err != nil {
+		return err
+	}
+	for _, id := range o.Suppress {
+		if lint.Lookup(id) != nil {
+			cfg.Set(id, lint.Off)
+		}
+	}
+
+	errors := 0
+	for _, d := range lint.Run(t, cfg) {
+		severity := diag.Warning
+		if d.Level == lint.Error {
+			severity = diag.Error
+			errors++
+		}
+		report(diag.Diagnostic{
+			File:     file,
+			Severity: severity,
+			Message:  fmt.Sprintf("%s: %s [%s]", d.Path, d.Message, d.Rule),
+		})
+	}
+	if errors > 0 {
+		return &checkError{errors}
+	}
+	return nil
+}
@@ -1,68 +1,243 @@
 package dtb
 
 import (
+	"encoding/binary"
 	"fmt"
-	"os"
-	"os/exec"
 	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/compression"
+	"github.com/kiy7086/dtbotool/cmd/fdt"
 )
 
-// VerifyDtb 验证DTB文件
-func VerifyDtb(dtbFile string) error {
-	// 1. 检查文件大小
-	info, err := os.Stat(dtbFile)
+// 普通设备树根节点必需的属性
+var requiredRootProps = []string{"compatible", "model", "#address-cells", "#size-cells"}
+
+// Result 结构化校验的结果
+type Result struct {
+	Overlay  bool
+	Errors   []string
+	Warnings []string
+}
+
+func (r *Result) errorf(format string, args ...any) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+}
+
+func (r *Result) warnf(format string, args ...any) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Err 将所有错误合并为一个 error，没有错误时返回 nil
+func (r *Result) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(r.Errors, "; "))
+}
+
+// Verify 校验FDT数据: 头部与块布局、节点结构，普通设备树检查根节点的
+// 必需属性，overlay 检查片段结构和修正表
+func Verify(data []byte) *Result {
+	r := &Result{}
+	warnings, err := fdt.CheckLayout(data)
 	if err != nil {
-		return fmt.Errorf("无法读取DTB文件: %v", err)
+		r.errorf("%v", err)
+		return r
 	}
-	if info.Size() == 0 {
-		return fmt.Errorf("DTB文件为空")
+	r.Warnings = append(r.Warnings, warnings...)
+
+	tree, err := fdt.Parse(data)
+	if err != nil {
+		r.errorf("%v", err)
+		return r
 	}
 
-	// 2. 使用dtc反编译验证
-	cmd := exec.Command("dtc",
-		"-I", "dtb",
-		"-O", "dts",
-		"-f", // 强制处理
-		"-q", // 安静模式
-		dtbFile)
+	tree.Root.Walk(func(n *fdt.Node) bool {
+		checkNode(r, n)
+		return true
+	})
 
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("DTB文件格式无效: %v\n%s", err, output)
+	r.Overlay = isOverlay(tree)
+	if r.Overlay {
+		checkOverlay(r, tree)
+		return r
 	}
+	for _, name := range requiredRootProps {
+		if tree.Root.Property(name) == nil {
+			r.warnf("根节点缺少 %s 属性", name)
+		}
+	}
+	return r
+}
 
-	// 3. 检查关键属性
-	cmd = exec.Command("dtc",
-		"-I", "dtb",
-		"-O", "dts",
-		"-f",
-		dtbFile)
+// isOverlay 判断是否为 overlay，缺少修正表但有片段节点的也视为 overlay
+func isOverlay(t *fdt.Tree) bool {
+	if t.IsOverlay() {
+		return true
+	}
+	for _, c := range t.Root.Children {
+		if strings.HasPrefix(c.Name, "fragment") {
+			return true
+		}
+	}
+	return false
+}
 
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("无法读取DTB内容: %v", err)
+// checkNode 检查同名的属性和子节点
+func checkNode(r *Result, n *fdt.Node) {
+	props := make(map[string]bool)
+	for _, p := range n.Properties {
+		if props[p.Name] {
+			r.errorf("%s: 属性 %s 重复", n.Path(), p.Name)
+		}
+		props[p.Name] = true
+	}
+	children := make(map[string]bool)
+	for _, c := range n.Children {
+		if children[c.Name] {
+			r.errorf("%s: 子节点 %s 重复", n.Path(), c.Name)
+		}
+		children[c.Name] = true
 	}
+}
 
-	// 检查必要的属性
-	dts := string(output)
-	requiredProps := []string{
-		"compatible",
-		"model",
+func checkOverlay(r *Result, t *fdt.Tree) {
+	fixups := t.Root.Child("__fixups__")
+	fragments := 0
+	for _, frag := range t.Root.Children {
+		switch frag.Name {
+		case "__symbols__", "__fixups__", "__local_fixups__":
+			continue
+		}
+		if frag.Child("__overlay__") == nil {
+			r.errorf("%s: 片段缺少 __overlay__ 节点", frag.Path())
+			continue
+		}
+		fragments++
+
+		target, targetPath := frag.Property("target"), frag.Property("target-path")
+		switch {
+		case target == nil && targetPath == nil:
+			r.errorf("%s: 缺少 target 或 target-path 属性", frag.Path())
+		case target != nil && targetPath != nil:
+			r.warnf("%s: 同时存在 target 和 target-path，将使用 target", frag.Path())
+		case target != nil && len(target.Value) != 4:
+			r.errorf("%s: target 属性长度无效", frag.Path())
+		case target != nil && target.U32() == 0xffffffff && !hasFixup(fixups, frag.Path()+":target:0"):
+			r.errorf("%s: target 引用未解析，且 __fixups__ 中没有对应的条目", frag.Path())
+		case targetPath != nil && !strings.HasPrefix(targetPath.String(), "/"):
+			r.errorf("%s: target-path \"%s\" 不是绝对路径", frag.Path(), targetPath.String())
+		}
 	}
+	if fragments == 0 {
+		r.errorf("overlay 不包含任何片段")
+	}
+
+	if fixups != nil {
+		for _, p := range fixups.Properties {
+			if !p.IsStringList() {
+				r.errorf("__fixups__: %s 的值不是字符串列表", p.Name)
+				continue
+			}
+			for _, entry := range p.Strings() {
+				if err := checkFixup(t, entry); err != nil {
+					r.errorf("__fixups__: %s: %v", p.Name, err)
+				}
+			}
+		}
+	}
+	if local := t.Root.Child("__local_fixups__"); local != nil {
+		checkLocalFixups(r, t, local, t.Root)
+	}
+}
 
-	var missingProps []string
-	for _, prop := range requiredProps {
-		if !strings.Contains(dts, prop) {
-			missingProps = append(missingProps, prop)
+func hasFixup(fixups *fdt.Node, entry string) bool {
+	if fixups == nil {
+		return false
+	}
+	for _, p := range fixups.Properties {
+		for _, s := range p.Strings() {
+			if s == entry {
+				return true
+			}
 		}
 	}
+	return false
+}
+
+// checkFixup 检查 "路径:属性:偏移" 指向存在的属性中的 32 位单元
+func checkFixup(t *fdt.Tree, entry string) error {
+	path, prop, off, err := fdt.ParseFixup(entry)
+	if err != nil {
+		return err
+	}
+	n := t.Lookup(path)
+	if n == nil {
+		return fmt.Errorf("节点 %s 不存在", path)
+	}
+	p := n.Property(prop)
+	if p == nil {
+		return fmt.Errorf("属性 %s:%s 不存在", path, prop)
+	}
+	if off%4 != 0 || off+4 > len(p.Value) {
+		return fmt.Errorf("偏移 %d 超出属性 %s:%s 的范围", off, path, prop)
+	}
+	return nil
+}
 
-	if len(missingProps) > 0 {
-		fmt.Printf("警告: DTB文件缺少以下关键属性:\n")
-		for _, prop := range missingProps {
-			fmt.Printf("  - %s\n", prop)
+// checkLocalFixups 检查 __local_fixups__ 与设备树结构对应，且偏移处的
+// phandle 属于 overlay 内部的节点。0 和 0xffffffff 不是有效的 phandle，
+// 没有 phandle 的节点也会返回 0，需要单独排除
+func checkLocalFixups(r *Result, t *fdt.Tree, local, n *fdt.Node) {
+	for _, p := range local.Properties {
+		target := n.Property(p.Name)
+		if target == nil {
+			r.errorf("__local_fixups__: 属性 %s:%s 不存在", n.Path(), p.Name)
+			continue
 		}
+		if len(p.Value)%4 != 0 {
+			r.errorf("__local_fixups__: %s:%s 的偏移列表长度无效", n.Path(), p.Name)
+			continue
+		}
+		for i := 0; i < len(p.Value); i += 4 {
+			off := int(binary.BigEndian.Uint32(p.Value[i:]))
+			if off%4 != 0 || off+4 > len(target.Value) {
+				r.errorf("__local_fixups__: 偏移 %d 超出属性 %s:%s 的范围", off, n.Path(), p.Name)
+				continue
+			}
+			if ph := binary.BigEndian.Uint32(target.Value[off:]); ph == 0 || ph == 0xffffffff || t.FindPhandle(ph) == nil {
+				r.errorf("__local_fixups__: %s:%s 偏移 %d 处的 phandle 0x%x 不存在", n.Path(), p.Name, off, ph)
+			}
+		}
+	}
+	for _, c := range local.Children {
+		child := n.Child(c.Name)
+		if child == nil || child.Name != c.Name {
+			r.errorf("__local_fixups__: 节点 %s 不存在", strings.TrimSuffix(n.Path(), "/")+"/"+c.Name)
+			continue
+		}
+		checkLocalFixups(r, t, c, child)
+	}
+}
+
+// VerifyDtb 校验DTB文件，输出警告，存在结构错误时返回错误
+func VerifyDtb(dtbFile string) error {
+	data, err := compression.ReadFile(dtbFile)
+	if err != nil {
+		return fmt.Errorf("无法读取DTB文件: %v", err)
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("DTB文件为空")
+	}
+
+	result := Verify(data)
+	for _, w := range result.Warnings {
+		fmt.Printf("警告: %s\n", w)
+	}
+	if err := result.Err(); err != nil {
+		return fmt.Errorf("DTB文件格式无效: %v", err)
 	}
 
-	fmt.Printf("DTB文件验证通过 (大小: %d 字节)\n", info.Size())
+	fmt.Printf("DTB文件验证通过 (大小: %d 字节)\n", len(data))
 	return nil
 }
@@ -0,0 +1,247 @@
+package dtb
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+	"github.com/kiy7086/dtbotool/cmd/internal/dtstest"
+)
+
+func TestVerifyValid(t *testing.T) {
+	for name, src := range map[string]string{"base": dtstest.Base, "overlay": dtstest.Overlay} {
+		r := Verify(dtstest.DTB(t, src))
+		if len(r.Errors) > 0 || len(r.Warnings) > 0 {
+			t.Errorf("%s: 错误 %v, 警告 %v", name, r.Errors, r.Warnings)
+		}
+		if r.Overlay != (name == "overlay") {
+			t.Errorf("%s: Overlay = %v", name, r.Overlay)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		edit func(t *fdt.Tree)        // 修改解析后的设备树
+		raw  func(data []byte) []byte // 修改序列化后的数据
+		want string                   // 应当报告的错误
+		warn string                   // 应当报告的警告
+	}{
+		{
+			name: "魔数无效",
+			src:  dtstest.Base,
+			raw:  func(d []byte) []byte { d[0] = 0; return d },
+			want: "FDT魔数无效",
+		},
+		{
+			name: "字符串块超出范围",
+			src:  dtstest.Base,
+			raw: func(d []byte) []byte {
+				binary.BigEndian.PutUint32(d[32:], uint32(len(d)))
+				return d
+			},
+			want: "字符串块超出FDT范围",
+		},
+		{
+			name: "数据块重叠",
+			src:  dtstest.Base,
+			raw: func(d []byte) []byte {
+				binary.BigEndian.PutUint32(d[12:], binary.BigEndian.Uint32(d[8:]))
+				return d
+			},
+			want: "重叠",
+		},
+		{
+			name: "多余数据",
+			src:  dtstest.Base,
+			raw:  func(d []byte) []byte { return append(d, 0, 0, 0, 0) },
+			warn: "多余数据",
+		},
+		{
+			name: "重复属性",
+			src:  dtstest.Base,
+			edit: func(t *fdt.Tree) {
+				t.Root.Properties = append(t.Root.Properties, &fdt.Property{Name: "model"})
+			},
+			want: "属性 model 重复",
+		},
+		{
+			name: "重复子节点",
+			src:  dtstest.Base,
+			edit: func(t *fdt.Tree) {
+				t.Root.Children = append(t.Root.Children, &fdt.Node{Name: "cpus", Parent: t.Root})
+			},
+			want: "子节点 cpus 重复",
+		},
+		{
+			name: "缺少根节点属性",
+			src:  dtstest.Base,
+			edit: func(t *fdt.Tree) { t.Root.RemoveProperty("model") },
+			warn: "根节点缺少 model 属性",
+		},
+		{
+			name: "片段缺少 __overlay__",
+			src:  dtstest.Overlay,
+			edit: func(t *fdt.Tree) { t.Root.AddChild("fragment@9") },
+			want: "片段缺少 __overlay__",
+		},
+		{
+			name: "缺少 target",
+			src:  dtstest.Overlay,
+			edit: func(t *fdt.Tree) { t.Lookup("/fragment@1").RemoveProperty("target-path") },
+			want: "缺少 target 或 target-path",
+		},
+		{
+			name: "同时有 target 和 target-path",
+			src:  dtstest.Overlay,
+			edit: func(t *fdt.Tree) { t.Lookup("/fragment@1").SetProperty("target", fdt.U32Value(1)) },
+			warn: "同时存在 target 和 target-path",
+		},
+		{
+			name: "target 长度无效",
+			src:  dtstest.Overlay,
+			edit: func(t *fdt.Tree) { t.Lookup("/fragment@0").SetProperty("target", []byte{1}) },
+			want: "target 属性长度无效",
+		},
+		{
+			name: "target 未解析",
+			src:  dtstest.Overlay,
+			edit: func(t *fdt.Tree) { t.Lookup("/__fixups__").RemoveProperty("uart") },
+			want: "target 引用未解析",
+		},
+		{
+			name: "target-path 不是绝对路径",
+			src:  dtstest.Overlay,
+			edit: func(t *fdt.Tree) { t.Lookup("/fragment@1").SetProperty("target-path", fdt.StringValue("chosen")) },
+			want: "不是绝对路径",
+		},
+		{
+			name: "没有片段",
+			src:  "/dts-v1/;\n/plugin/;\n/ { };\n",
+			edit: func(t *fdt.Tree) { t.Root.AddChild("__fixups__") },
+			want: "不包含任何片段",
+		},
+		{
+			name: "__fixups__ 不是字符串列表",
+			src:  dtstest.Overlay,
+			edit: func(t *fdt.Tree) { t.Lookup("/__fixups__").SetProperty("clk", fdt.U32Value(1)) },
+			want: "clk 的值不是字符串列表",
+		},
+		{
+			name: "__fixups__ 条目格式无效",
+			src:  dtstest.Overlay,
+			edit: func(t *fdt.Tree) { t.Lookup("/__fixups__").SetProperty("clk", fdt.StringValue("/fragment@1")) },
+			want: "无效的修正条目",
+		},
+		{
+			name: "__fixups__ 节点不存在",
+			src:  dtstest.Overlay,
+			edit: func(t *fdt.Tree) { t.Lookup("/__fixups__").SetProperty("clk", fdt.StringValue("/nope:clocks:0")) },
+			want: "节点 /nope 不存在",
+		},
+		{
+			name: "__fixups__ 属性不存在",
+			src:  dtstest.Overlay,
+			edit: func(t *fdt.Tree) {
+				t.Lookup("/__fixups__").SetProperty("clk", fdt.StringValue("/fragment@1/__overlay__/user:nope:0"))
+			},
+			want: "属性 /fragment@1/__overlay__/user:nope 不存在",
+		},
+		{
+			name: "__fixups__ 偏移越界",
+			src:  dtstest.Overlay,
+			edit: func(t *fdt.Tree) {
+				t.Lookup("/__fixups__").SetProperty("clk", fdt.StringValue("/fragment@1/__overlay__/user:clocks:4"))
+			},
+			want: "偏移 4 超出属性",
+		},
+		{
+			name: "__local_fixups__ 属性不存在",
+			src:  dtstest.Overlay,
+			edit: func(t *fdt.Tree) {
+				t.Lookup("/__local_fixups__/fragment@1/__overlay__/user").SetProperty("nope", fdt.U32Value(0))
+			},
+			want: "__local_fixups__: 属性 /fragment@1/__overlay__/user:nope 不存在",
+		},
+		{
+			name: "__local_fixups__ 偏移列表长度无效",
+			src:  dtstest.Overlay,
+			edit: func(t *fdt.Tree) {
+				t.Lookup("/__local_fixups__/fragment@1/__overlay__/user").SetProperty("dev", []byte{0, 0})
+			},
+			want: "偏移列表长度无效",
+		},
+		{
+			name: "__local_fixups__ 偏移越界",
+			src:  dtstest.Overlay,
+			edit: func(t *fdt.Tree) {
+				t.Lookup("/__local_fixups__/fragment@1/__overlay__/user").SetProperty("dev", fdt.U32Value(4))
+			},
+			want: "偏移 4 超出属性",
+		},
+		{
+			name: "__local_fixups__ 节点不存在",
+			src:  dtstest.Overlay,
+			edit: func(t *fdt.Tree) { t.Lookup("/__local_fixups__/fragment@1").AddChild("nope") },
+			want: "节点 /fragment@1/nope 不存在",
+		},
+		{
+			name: "__local_fixups__ 指向不存在的 phandle",
+			src:  dtstest.Overlay,
+			edit: func(t *fdt.Tree) { t.Lookup("/fragment@1/__overlay__/user").SetProperty("dev", fdt.U32Value(7)) },
+			want: "phandle 0x7 不存在",
+		},
+		{
+			name: "__local_fixups__ 指向为0的单元",
+			src:  dtstest.Overlay,
+			edit: func(t *fdt.Tree) { t.Lookup("/fragment@1/__overlay__/user").SetProperty("dev", fdt.U32Value(0)) },
+			want: "phandle 0x0 不存在",
+		},
+		{
+			name: "__local_fixups__ 指向未解析的单元",
+			src:  dtstest.Overlay,
+			edit: func(t *fdt.Tree) {
+				t.Lookup("/fragment@1/__overlay__/user").SetProperty("dev", fdt.U32Value(0xffffffff))
+			},
+			want: "phandle 0xffffffff 不存在",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := dtstest.Compile(t, tt.src)
+			if tt.edit != nil {
+				tt.edit(tree)
+			}
+			data, err := tree.Bytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.raw != nil {
+				data = tt.raw(data)
+			}
+
+			r := Verify(data)
+			if tt.want != "" && !contains(r.Errors, tt.want) {
+				t.Errorf("错误 = %v, 期望包含 %q", r.Errors, tt.want)
+			}
+			if tt.want == "" && len(r.Errors) > 0 {
+				t.Errorf("意外的错误: %v", r.Errors)
+			}
+			if tt.warn != "" && !contains(r.Warnings, tt.warn) {
+				t.Errorf("警告 = %v, 期望包含 %q", r.Warnings, tt.warn)
+			}
+		})
+	}
+}
+
+func contains(list []string, sub string) bool {
+	for _, s := range list {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package dtbo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Entry DTBO 镜像中的一个设备树条目
+type Entry struct {
+	DtEntry
+	Index int
+	Data  []byte
+}
+
+// ReadEntries 解析内存中的 DTBO 镜像，返回所有条目及其设备树数据
+func ReadEntries(data []byte) ([]Entry, error) {
+	endian, header, err := verifyMagicAndGetEndian(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for i := uint32(0); i < header.DtEntryCount; i++ {
+		entryOffset := header.DtEntriesOffset + i*header.DtEntrySize
+		if uint64(entryOffset)+32 > uint64(len(data)) {
+			return nil, fmt.Errorf("设备树条目 %d 超出文件范围", i)
+		}
+
+		var entry DtEntry
+		if err := binary.Read(bytes.NewReader(data[entryOffset:]), endian, &entry); err != nil {
+			return nil, fmt.Errorf("解析设备树条目失败: %v", err)
+		}
+		if uint64(entry.DtOffset)+uint64(entry.DtSize) > uint64(len(data)) {
+			return nil, fmt.Errorf("设备树条目 %d 范围无效", i)
+		}
+
+		entries = append(entries, Entry{
+			DtEntry: entry,
+			Index:   int(i),
+			Data:    data[entry.DtOffset : entry.DtOffset+entry.DtSize],
+		})
+	}
+	return entries, nil
+}
@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/compression"
 )
 
 func PackDtbo(dtbDir, dtboFile string) error {
@@ -16,7 +18,7 @@ func PackDtbo(dtbDir, dtboFile string) error {
 
 	var dtbFiles []string
 	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".dtb") {
+		if !file.IsDir() && strings.HasSuffix(compression.TrimExt(file.Name()), ".dtb") {
 			dtbFiles = append(dtbFiles, filepath.Join(dtbDir, file.Name()))
 		}
 	}
@@ -49,7 +51,7 @@ func PackDtbo(dtbDir, dtboFile string) error {
 
 	entries := make([]DtEntry, len(dtbFiles))
 	for i, dtbFile := range dtbFiles {
-		dtbData, err := os.ReadFile(dtbFile)
+		dtbData, err := compression.ReadFile(dtbFile)
 		if err != nil {
 			return fmt.Errorf("读取DTB文件失败: %v", err)
 		}
@@ -69,7 +71,7 @@ func PackDtbo(dtbDir, dtboFile string) error {
 	}
 
 	for _, dtbFile := range dtbFiles {
-		dtbData, err := os.ReadFile(dtbFile)
+		dtbData, err := compression.ReadFile(dtbFile)
 		if err != nil {
 			return fmt.Errorf("读取DTB文件失败: %v", err)
 		}
@@ -0,0 +1,67 @@
+package dtbo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// ReplaceEntry 替换镜像中第 index 个条目的设备树数据并重新排布数据区，
+// 头部字段、字节序以及条目的 ID、版本和自定义字段保持不变。
+// 原镜像 total_size 之后的数据 (如分区镜像中的填充和 AVB footer) 原样保留，
+// 新镜像不大于原镜像时以零填充到原来的大小，使这些数据的偏移不变
+func ReplaceEntry(data []byte, index int, dtb []byte) ([]byte, error) {
+	endian, header, err := verifyMagicAndGetEndian(data)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ReadEntries(data)
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= len(entries) {
+		return nil, fmt.Errorf("条目序号 %d 超出范围 (共 %d 个)", index, len(entries))
+	}
+
+	tableEnd := header.DtEntriesOffset + header.DtEntrySize*header.DtEntryCount
+	var out bytes.Buffer
+	out.Write(data[:tableEnd])
+
+	// 多个条目共享同一份数据时只写一次
+	written := make(map[[2]uint32]uint32)
+	for i := range entries {
+		e := &entries[i]
+		blob := e.Data
+		key := [2]uint32{e.DtOffset, e.DtSize}
+		if i == index {
+			blob = dtb
+			key = [2]uint32{0xFFFFFFFF, uint32(i)}
+		}
+		offset, ok := written[key]
+		if !ok {
+			offset = uint32(out.Len())
+			out.Write(blob)
+			written[key] = offset
+		}
+		e.DtOffset = offset
+		e.DtSize = uint32(len(blob))
+	}
+
+	result := out.Bytes()
+	for i, e := range entries {
+		var buf bytes.Buffer
+		if err := binary.Write(&buf, endian, e.DtEntry); err != nil {
+			return nil, fmt.Errorf("写入条目失败: %v", err)
+		}
+		copy(result[header.DtEntriesOffset+uint32(i)*header.DtEntrySize:], buf.Bytes())
+	}
+	endian.PutUint32(result[4:], uint32(len(result)))
+
+	if size := int(header.TotalSize); size < len(data) {
+		if len(result) < size {
+			result = append(result, make([]byte, size-len(result))...)
+		}
+		result = append(result, data[size:]...)
+	}
+	return result, nil
+}
@@ -6,12 +6,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"github.com/kiy7086/dtbotool/cmd/detect"
 )
 
 func UnpackDtbo(dtboFile, outDir string) error {
-	data, err := os.ReadFile(dtboFile)
+	data, _, err := detect.ReadFile(dtboFile)
 	if err != nil {
-		return fmt.Errorf("读取DTBO文件失败: %v", err)
+		return err
 	}
 
 	endian, header, err := verifyMagicAndGetEndian(data)
@@ -3,12 +3,15 @@ package dtbo
 import (
 	"fmt"
 	"os"
+
+	"github.com/kiy7086/dtbotool/cmd/compression"
+	"github.com/kiy7086/dtbotool/cmd/detect"
 )
 
 func VerifyDtbo(dtboFile string) error {
-	data, err := os.ReadFile(dtboFile)
+	data, _, err := detect.ReadFile(dtboFile)
 	if err != nil {
-		return fmt.Errorf("读取文件失败: %v", err)
+		return err
 	}
 
 	_, header, err := verifyMagicAndGetEndian(data)
@@ -33,12 +36,18 @@ func RestoreDtbo(backupFile, outputFile string) error {
 		return fmt.Errorf("读取备份文件失败: %v", err)
 	}
 
-	_, header, err := verifyMagicAndGetEndian(data)
+	// 备份保存的是原始文件，校验时需要先解压
+	plain, _, err := compression.Decompress(data)
+	if err != nil {
+		return err
+	}
+
+	_, header, err := verifyMagicAndGetEndian(plain)
 	if err != nil {
 		return err
 	}
 
-	if uint32(len(data)) < header.TotalSize {
+	if uint32(len(plain)) < header.TotalSize {
 		return fmt.Errorf("备份文件大小不正确")
 	}
 
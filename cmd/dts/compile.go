@@ -0,0 +1,74 @@
+package dts
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kiy7086/dtbotool/cmd/diag"
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// Options 编译选项
+type Options struct {
+	IncludeDirs []string                       // /include/ 和 /incbin/ 的搜索路径
+	Symbols     bool                           // 生成 __symbols__ 节点 (相当于 dtc -@)
+	Suppress    []string                       // 不显示的编译警告，如 duplicate-symbol
+	Report      func(diag.Diagnostic)          // 接收编译警告，为 nil 时直接输出
+	Depend      func(path string, exists bool) // 接收 /include/ 和 /incbin/ 读取的文件，以及在此之前查找过但不存在的路径
+}
+
+// Warnings 编译过程中可以关闭的警告
+var Warnings = map[string]string{
+	"duplicate-symbol": "源码中的 __symbols__ 已存在同名但路径不同的标签",
+}
+
+// Compile 编译DTS文件为设备树
+func Compile(dtsFile string, opts Options) (*fdt.Tree, error) {
+	data, err := os.ReadFile(dtsFile)
+	if err != nil {
+		return nil, fmt.Errorf("读取DTS文件失败: %v", err)
+	}
+	return CompileSource(dtsFile, data, opts)
+}
+
+// CompileSource 编译内存中的DTS源码，文件名用于错误定位和解析相对路径
+func CompileSource(filename string, src []byte, opts Options) (*fdt.Tree, error) {
+	root := &node{name: "", pos: Pos{File: filename, Line: 1, Column: 1}}
+	p := &parser{
+		s:    newScanner(filename, src, opts),
+		root: root,
+	}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+
+	r := &resolver{root: root, plugin: p.plugin, quiet: make(map[string]bool), report: opts.Report}
+	if r.report == nil {
+		r.report = diag.Print
+	}
+	for _, id := range opts.Suppress {
+		r.quiet[id] = true
+	}
+	if err := r.resolve(opts.Symbols); err != nil {
+		return nil, err
+	}
+
+	tree := fdt.NewTree()
+	tree.Reserve = p.reserve
+	tree.Root = root.toFdt(nil)
+	tree.BootCpuidPhys = guessBootCpuid(tree)
+	return tree, nil
+}
+
+// guessBootCpuid 与 dtc 相同，取 /cpus 下第一个子节点的 reg 作为启动CPU
+func guessBootCpuid(t *fdt.Tree) uint32 {
+	cpus := t.Root.Child("cpus")
+	if cpus == nil || len(cpus.Children) == 0 {
+		return 0
+	}
+	reg := cpus.Children[0].Property("reg")
+	if reg == nil || len(reg.Value) != 4 {
+		return 0
+	}
+	return reg.U32()
+}
@@ -0,0 +1,303 @@
+package dts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/decode"
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// DecompileOptions 反编译选项
+type DecompileOptions struct {
+	Symbols  bool // 使用 __symbols__ 恢复标签，并将 phandle 数值替换为 &label 引用
+	Annotate bool // 在属性后以注释解释 reg、interrupts、clocks 等单元数组
+}
+
+// 按名称确定为单元数组的属性
+var cellProps = map[string]bool{
+	"reg":             true,
+	"ranges":          true,
+	"dma-ranges":      true,
+	"phandle":         true,
+	"linux,phandle":   true,
+	"interrupts":      true,
+	"clock-frequency": true,
+	"interrupt-map":   true,
+	"bus-range":       true,
+}
+
+// 按名称确定为字符串的属性
+var stringProps = map[string]bool{
+	"compatible":  true,
+	"model":       true,
+	"status":      true,
+	"device_type": true,
+	"label":       true,
+	"bootargs":    true,
+	"stdout-path": true,
+}
+
+// Decompile 将设备树输出为DTS源码，格式与 dtc -I dtb -O dts 保持一致
+func Decompile(t *fdt.Tree, opts DecompileOptions) []byte {
+	e := &emitter{
+		tree:   t,
+		labels: make(map[*fdt.Node][]string),
+	}
+	t.Root.Walk(func(n *fdt.Node) bool {
+		e.labels[n] = append(e.labels[n], n.Labels...)
+		return true
+	})
+
+	if opts.Annotate {
+		e.decoder = decode.New(t)
+	}
+	if opts.Symbols {
+		e.refs = fdt.NewRefs(t)
+		e.restoreSymbols()
+		// overlay 的引用恢复为 &label 后，修正表会在重新编译时自动生成
+		e.plugin = e.refs.IsOverlay()
+	}
+
+	e.buf.WriteString("/dts-v1/;\n")
+	if e.plugin {
+		e.buf.WriteString("/plugin/;\n")
+	}
+	e.buf.WriteString("\n")
+
+	for _, r := range t.Reserve {
+		fmt.Fprintf(&e.buf, "/memreserve/\t0x%016x 0x%016x;\n", r.Address, r.Size)
+	}
+	e.node(t.Root, 0)
+	return e.buf.Bytes()
+}
+
+type emitter struct {
+	buf     bytes.Buffer
+	tree    *fdt.Tree
+	refs    *fdt.Refs
+	labels  map[*fdt.Node][]string
+	plugin  bool
+	decoder *decode.Decoder
+}
+
+// restoreSymbols 根据 __symbols__ 为节点添加标签
+func (e *emitter) restoreSymbols() {
+	symbols := e.tree.Root.Child("__symbols__")
+	if symbols == nil {
+		return
+	}
+	for _, p := range symbols.Properties {
+		n := e.tree.Lookup(p.String())
+		if n == nil || !isLabelName(p.Name) {
+			continue
+		}
+		if !contains(e.labels[n], p.Name) {
+			e.labels[n] = append(e.labels[n], p.Name)
+		}
+	}
+}
+
+func isLabelName(name string) bool {
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isLabelChar(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *emitter) indent(level int) {
+	e.buf.WriteString(strings.Repeat("\t", level))
+}
+
+func (e *emitter) node(n *fdt.Node, level int) {
+	e.indent(level)
+	for _, l := range e.labels[n] {
+		e.buf.WriteString(l + ": ")
+	}
+	if n.Parent == nil {
+		e.buf.WriteString("/ {\n")
+	} else {
+		e.buf.WriteString(n.Name + " {\n")
+	}
+
+	for _, p := range n.Properties {
+		e.indent(level + 1)
+		for _, l := range p.Labels {
+			e.buf.WriteString(l + ": ")
+		}
+		e.buf.WriteString(p.Name)
+		e.propValue(n, p)
+	}
+
+	for _, c := range n.Children {
+		if e.plugin && n.Parent == nil && (c.Name == "__fixups__" || c.Name == "__local_fixups__") {
+			continue
+		}
+		e.buf.WriteString("\n")
+		e.node(c, level+1)
+	}
+
+	e.indent(level)
+	e.buf.WriteString("};\n")
+}
+
+// refName 返回引用目标的 DTS 写法
+func (e *emitter) refName(ref fdt.PhandleRef) string {
+	if ref.Target == nil {
+		return "&" + ref.Label
+	}
+	if labels := e.labels[ref.Target]; len(labels) > 0 {
+		return "&" + labels[0]
+	}
+	return "&{" + ref.Target.Path() + "}"
+}
+
+func (e *emitter) propValue(n *fdt.Node, p *fdt.Property) {
+	if len(p.Value) == 0 {
+		e.buf.WriteString(";\n")
+		return
+	}
+	e.buf.WriteString(" = ")
+
+	var refs []fdt.PhandleRef
+	if e.refs != nil {
+		refs = e.refs.Find(n, p)
+	}
+
+	switch {
+	case len(refs) > 0:
+		e.cells(p.Value, refs)
+	case guessType(p) == typeString:
+		e.buf.WriteString(QuoteString(p.Value))
+	case guessType(p) == typeCells:
+		e.cells(p.Value, nil)
+	default:
+		e.bytes(p.Value)
+	}
+	e.buf.WriteString(";")
+	if e.decoder != nil {
+		if text, ok := e.decoder.Explain(n, p); ok {
+			e.buf.WriteString(" /* " + text + " */")
+		}
+	}
+	e.buf.WriteString("\n")
+}
+
+func (e *emitter) cells(v []byte, refs []fdt.PhandleRef) {
+	e.buf.WriteString("<")
+	for i := 0; i+4 <= len(v); i += 4 {
+		if i > 0 {
+			e.buf.WriteString(" ")
+		}
+		if len(refs) > 0 && refs[0].Offset == i {
+			e.buf.WriteString(e.refName(refs[0]))
+			refs = refs[1:]
+			continue
+		}
+		fmt.Fprintf(&e.buf, "0x%02x", binary.BigEndian.Uint32(v[i:]))
+	}
+	e.buf.WriteString(">")
+}
+
+func (e *emitter) bytes(v []byte) {
+	e.buf.WriteString("[")
+	for i, b := range v {
+		if i > 0 {
+			e.buf.WriteString(" ")
+		}
+		fmt.Fprintf(&e.buf, "%02x", b)
+	}
+	e.buf.WriteString("]")
+}
+
+type valueType int
+
+const (
+	typeBytes valueType = iota
+	typeCells
+	typeString
+)
+
+// guessType 推断属性值类型。已知属性按名称判断，其余沿用 dtc 的推断规则
+func guessType(p *fdt.Property) valueType {
+	v := p.Value
+	isCells := len(v)%4 == 0
+	if isCells && (cellProps[p.Name] || strings.HasPrefix(p.Name, "#")) {
+		return typeCells
+	}
+	if (stringProps[p.Name] || strings.HasSuffix(p.Name, "-names")) && fdt.IsStringList(v) {
+		return typeString
+	}
+
+	notString, nul := 0, 0
+	for _, c := range v {
+		if !isStringChar(c) {
+			notString++
+		}
+		if c == 0 {
+			nul++
+		}
+	}
+	if v[len(v)-1] == 0 && notString == 0 && nul <= len(v)-nul {
+		return typeString
+	}
+	if isCells {
+		return typeCells
+	}
+	return typeBytes
+}
+
+func isStringChar(c byte) bool {
+	return c >= 0x20 && c < 0x7F || c == 0 || strings.IndexByte("\a\b\t\n\v\f\r", c) >= 0
+}
+
+// QuoteString 将以NUL结尾的字符串数据转义为DTS字符串字面量，中间的NUL输出为 \0
+func QuoteString(v []byte) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	body := v[:len(v)-1]
+	for i, c := range body {
+		switch c {
+		case '\a':
+			sb.WriteString(`\a`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\v':
+			sb.WriteString(`\v`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '"':
+			sb.WriteString(`\"`)
+		case 0:
+			// 后面紧跟数字时使用完整的八进制写法，避免被解析为其他字符
+			if i+1 < len(body) && body[i+1] >= '0' && body[i+1] <= '7' {
+				sb.WriteString(`\000`)
+			} else {
+				sb.WriteString(`\0`)
+			}
+		default:
+			if c >= 0x20 && c < 0x7F {
+				sb.WriteByte(c)
+			} else {
+				fmt.Fprintf(&sb, `\x%02x`, c)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
@@ -0,0 +1,37 @@
+package dts
+
+import (
+	"fmt"
+
+	"github.com/kiy7086/dtbotool/cmd/diag"
+)
+
+// Pos 源码位置
+type Pos struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// Error 带源码位置的编译错误
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: 错误: %s", e.Pos, e.Msg)
+}
+
+// Diagnostic 返回错误对应的诊断信息
+func (e *Error) Diagnostic() diag.Diagnostic {
+	return diag.Diagnostic{File: e.Pos.File, Line: e.Pos.Line, Column: e.Pos.Column, Severity: diag.Error, Message: e.Msg}
+}
+
+func errorf(pos Pos, format string, args ...any) *Error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,541 @@
+package dts
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// parser 解析DTS源码并直接构建节点树
+type parser struct {
+	s           *scanner
+	root        *node
+	plugin      bool
+	sawVersion  bool
+	reserve     []fdt.ReserveEntry
+	fragmentSeq int
+}
+
+func (p *parser) pos() Pos {
+	return p.s.pos()
+}
+
+func (p *parser) skip() error {
+	return p.s.skipSpace()
+}
+
+func (p *parser) expect(c byte) error {
+	if err := p.skip(); err != nil {
+		return err
+	}
+	if p.s.peek() != c {
+		return p.unexpected(fmt.Sprintf("'%c'", c))
+	}
+	p.s.next()
+	return nil
+}
+
+func (p *parser) unexpected(want string) error {
+	if p.s.eof() {
+		return errorf(p.pos(), "需要 %s，但已到达文件末尾", want)
+	}
+	return errorf(p.pos(), "需要 %s，但遇到 '%c'", want, p.s.peek())
+}
+
+// keyword 识别当前位置形如 /name/ 的关键字，不消耗输入
+func (p *parser) keyword() string {
+	if p.s.peek() != '/' {
+		return ""
+	}
+	i := 1
+	for {
+		c := p.s.peekAt(i)
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' {
+			i++
+			continue
+		}
+		if c == '/' && i > 1 {
+			src := p.s.cur()
+			return string(src.data[src.off+1 : src.off+i])
+		}
+		return ""
+	}
+}
+
+func (p *parser) consumeKeyword(kw string) {
+	for range len(kw) + 2 {
+		p.s.next()
+	}
+}
+
+// word 读取节点名或属性名
+func (p *parser) word() string {
+	var sb strings.Builder
+	for !p.s.eof() && isNameChar(p.s.peek()) {
+		sb.WriteByte(p.s.next())
+	}
+	return sb.String()
+}
+
+// labels 读取连续的 label: 定义
+func (p *parser) labels() ([]string, error) {
+	var names []string
+	for {
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		c := p.s.peek()
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_') {
+			return names, nil
+		}
+		i := 1
+		for isLabelChar(p.s.peekAt(i)) {
+			i++
+		}
+		if p.s.peekAt(i) != ':' {
+			return names, nil
+		}
+		src := p.s.cur()
+		names = append(names, string(src.data[src.off:src.off+i]))
+		for range i + 1 {
+			p.s.next()
+		}
+	}
+}
+
+// ref 读取 &label 或 &{/path} 引用
+func (p *parser) ref() (string, Pos, error) {
+	pos := p.pos()
+	p.s.next() // &
+	if p.s.peek() == '{' {
+		p.s.next()
+		var sb strings.Builder
+		for p.s.peek() != '}' {
+			if p.s.eof() || p.s.peek() == '\n' {
+				return "", pos, errorf(pos, "路径引用未结束")
+			}
+			sb.WriteByte(p.s.next())
+		}
+		p.s.next()
+		if !strings.HasPrefix(sb.String(), "/") {
+			return "", pos, errorf(pos, "路径引用必须以 / 开头")
+		}
+		return sb.String(), pos, nil
+	}
+
+	var sb strings.Builder
+	for isLabelChar(p.s.peek()) {
+		sb.WriteByte(p.s.next())
+	}
+	if sb.Len() == 0 {
+		return "", pos, errorf(pos, "& 之后需要标签名")
+	}
+	return sb.String(), pos, nil
+}
+
+func (p *parser) parse() error {
+	for {
+		if err := p.skip(); err != nil {
+			return err
+		}
+		if p.s.eof() {
+			break
+		}
+
+		kw := p.keyword()
+		if kw != "dts-v1" && !p.sawVersion {
+			return errorf(p.pos(), "缺少 /dts-v1/ 声明")
+		}
+
+		var err error
+		switch kw {
+		case "dts-v1":
+			p.consumeKeyword(kw)
+			p.sawVersion = true
+			err = p.expect(';')
+		case "plugin":
+			p.consumeKeyword(kw)
+			p.plugin = true
+			err = p.expect(';')
+		case "memreserve":
+			err = p.memreserve()
+		case "delete-node", "omit-if-no-ref":
+			err = p.topLevelRefOp(kw)
+		default:
+			err = p.topLevelNode()
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if !p.sawVersion {
+		return errorf(p.pos(), "缺少 /dts-v1/ 声明")
+	}
+	return nil
+}
+
+func (p *parser) memreserve() error {
+	p.consumeKeyword("memreserve")
+	addr, err := p.integerPrim()
+	if err != nil {
+		return err
+	}
+	size, err := p.integerPrim()
+	if err != nil {
+		return err
+	}
+	p.reserve = append(p.reserve, fdt.ReserveEntry{Address: addr, Size: size})
+	return p.expect(';')
+}
+
+func (p *parser) topLevelRefOp(kw string) error {
+	p.consumeKeyword(kw)
+	if err := p.skip(); err != nil {
+		return err
+	}
+	if p.s.peek() != '&' {
+		return p.unexpected("节点引用")
+	}
+	ref, pos, err := p.ref()
+	if err != nil {
+		return err
+	}
+
+	target := p.root.lookupRef(ref)
+	if target == nil {
+		return errorf(pos, "标签或路径 %s 不存在", ref)
+	}
+	if kw == "delete-node" {
+		if target == p.root {
+			return errorf(pos, "不能删除根节点")
+		}
+		target.markDeleted()
+	} else {
+		target.omitIfNoRef = true
+	}
+	return p.expect(';')
+}
+
+func (p *parser) topLevelNode() error {
+	labels, err := p.labels()
+	if err != nil {
+		return err
+	}
+	if err := p.skip(); err != nil {
+		return err
+	}
+
+	var target *node
+	switch p.s.peek() {
+	case '/':
+		p.s.next()
+		target = p.root
+
+	case '&':
+		ref, pos, err := p.ref()
+		if err != nil {
+			return err
+		}
+		target = p.root.lookupRef(ref)
+		if target == nil {
+			if !p.plugin {
+				return errorf(pos, "标签或路径 %s 不存在", ref)
+			}
+			target = p.orphan(ref, pos)
+		}
+
+	default:
+		return p.unexpected("'/' 或节点引用")
+	}
+
+	for i := len(labels) - 1; i >= 0; i-- {
+		addLabel(&target.labels, labels[i])
+	}
+	if err := p.nodeBody(target); err != nil {
+		return err
+	}
+	return p.expect(';')
+}
+
+// orphan 为 overlay 中无法在本地解析的引用生成 fragment 节点
+func (p *parser) orphan(ref string, pos Pos) *node {
+	frag := p.root.addChild(p.nextFragment(), pos)
+	frag.generated = true
+
+	if strings.HasPrefix(ref, "/") {
+		frag.setProperty(&prop{name: "target-path", val: fdt.StringValue(ref), pos: pos})
+	} else {
+		frag.setProperty(&prop{
+			name:    "target",
+			val:     fdt.U32Value(0xFFFFFFFF),
+			markers: []marker{{offset: 0, kind: refPhandle, ref: ref, pos: pos}},
+			pos:     pos,
+		})
+	}
+	return frag.addChild("__overlay__", pos)
+}
+
+// nextFragment 返回下一个未被使用的 fragment@N 节点名
+func (p *parser) nextFragment() string {
+	for {
+		name := fmt.Sprintf("fragment@%d", p.fragmentSeq)
+		p.fragmentSeq++
+		if p.root.childWithDeleted(name) == nil {
+			return name
+		}
+	}
+}
+
+// nodeBody 解析 { ... } 并合并到节点 n
+func (p *parser) nodeBody(n *node) error {
+	if err := p.expect('{'); err != nil {
+		return err
+	}
+
+	defined := make(map[string]Pos)
+	nodes := make(map[string]Pos)
+	sawChild := false
+	for {
+		if err := p.skip(); err != nil {
+			return err
+		}
+		if p.s.eof() {
+			return errorf(n.pos, "节点 %s 未结束", n.path())
+		}
+		if p.s.peek() == '}' {
+			p.s.next()
+			return nil
+		}
+
+		omit := false
+		switch kw := p.keyword(); kw {
+		case "delete-property", "delete-node":
+			p.consumeKeyword(kw)
+			if err := p.skip(); err != nil {
+				return err
+			}
+			pos := p.pos()
+			name := p.word()
+			if name == "" {
+				return errorf(pos, "/%s/ 之后需要名称", kw)
+			}
+			if kw == "delete-property" {
+				n.deleteProperty(name)
+			} else if c := n.child(name); c != nil {
+				c.markDeleted()
+				delete(nodes, name)
+			}
+			if err := p.expect(';'); err != nil {
+				return err
+			}
+			continue
+		case "omit-if-no-ref":
+			p.consumeKeyword(kw)
+			omit = true
+		case "":
+		default:
+			return errorf(p.pos(), "此处不允许 /%s/", kw)
+		}
+
+		labels, err := p.labels()
+		if err != nil {
+			return err
+		}
+		if err := p.skip(); err != nil {
+			return err
+		}
+		pos := p.pos()
+		name := p.word()
+		if name == "" {
+			return p.unexpected("属性名或节点名")
+		}
+		if err := p.skip(); err != nil {
+			return err
+		}
+
+		switch p.s.peek() {
+		case '{':
+			sawChild = true
+			// 与 dtc 相同，同一节点体中重复定义的子节点是错误，不合并
+			if prev, ok := nodes[name]; ok {
+				return errorf(pos, "重复的节点名 %s (上次定义于 %s)", name, prev)
+			}
+			nodes[name] = pos
+			// 生成的 fragment 与源码中的节点同名时，为生成的节点换一个序号
+			if c := n.childWithDeleted(name); c != nil && c.generated {
+				c.name = p.nextFragment()
+			}
+			c := n.addChild(name, pos)
+			c.omitIfNoRef = c.omitIfNoRef || omit
+			for i := len(labels) - 1; i >= 0; i-- {
+				addLabel(&c.labels, labels[i])
+			}
+			if err := p.nodeBody(c); err != nil {
+				return err
+			}
+
+		case '=', ';':
+			if omit {
+				return errorf(pos, "/omit-if-no-ref/ 只能用于节点")
+			}
+			if sawChild {
+				return errorf(pos, "属性 %s 必须位于子节点之前", name)
+			}
+			if prev, ok := defined[name]; ok {
+				return errorf(pos, "重复的属性名 %s (上次定义于 %s)", name, prev)
+			}
+			defined[name] = pos
+
+			pr := &prop{name: name, pos: pos}
+			for i := len(labels) - 1; i >= 0; i-- {
+				addLabel(&pr.labels, labels[i])
+			}
+			if p.s.peek() == '=' {
+				p.s.next()
+				if err := p.propValue(pr); err != nil {
+					return err
+				}
+			}
+			n.setProperty(pr)
+
+		default:
+			return p.unexpected("'{'、'=' 或 ';'")
+		}
+
+		if err := p.expect(';'); err != nil {
+			return err
+		}
+	}
+}
+
+// propValue 解析属性值，多个部分以逗号连接
+func (p *parser) propValue(pr *prop) error {
+	for {
+		if _, err := p.labels(); err != nil {
+			return err
+		}
+		if err := p.skip(); err != nil {
+			return err
+		}
+
+		var err error
+		switch kw := p.keyword(); {
+		case p.s.peek() == '"':
+			var str []byte
+			if str, err = p.s.stringLiteral(); err == nil {
+				pr.val = append(append(pr.val, str...), 0)
+			}
+		case p.s.peek() == '<':
+			err = p.cells(pr, 32)
+		case kw == "bits":
+			p.consumeKeyword(kw)
+			err = p.sizedCells(pr)
+		case p.s.peek() == '[':
+			err = p.byteString(pr)
+		case p.s.peek() == '&':
+			var ref string
+			var pos Pos
+			if ref, pos, err = p.ref(); err == nil {
+				pr.markers = append(pr.markers, marker{offset: len(pr.val), kind: refPath, ref: ref, pos: pos})
+			}
+		case kw == "incbin":
+			p.consumeKeyword(kw)
+			err = p.incbin(pr)
+		default:
+			return p.unexpected("属性值")
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := p.labels(); err != nil {
+			return err
+		}
+		if err := p.skip(); err != nil {
+			return err
+		}
+		if p.s.peek() != ',' {
+			return nil
+		}
+		p.s.next()
+	}
+}
+
+func (p *parser) sizedCells(pr *prop) error {
+	if err := p.skip(); err != nil {
+		return err
+	}
+	pos := p.pos()
+	bits, err := p.literal()
+	if err != nil {
+		return err
+	}
+	if bits != 8 && bits != 16 && bits != 32 && bits != 64 {
+		return errorf(pos, "/bits/ 只能是 8、16、32 或 64")
+	}
+	if err := p.skip(); err != nil {
+		return err
+	}
+	if p.s.peek() != '<' {
+		return p.unexpected("'<'")
+	}
+	return p.cells(pr, int(bits))
+}
+
+// cells 解析 <...> 单元数组
+func (p *parser) cells(pr *prop, bits int) error {
+	p.s.next() // <
+	for {
+		if _, err := p.labels(); err != nil {
+			return err
+		}
+		if err := p.skip(); err != nil {
+			return err
+		}
+		if p.s.peek() == '>' {
+			p.s.next()
+			return nil
+		}
+		if p.s.eof() {
+			return p.unexpected("'>'")
+		}
+
+		if p.s.peek() == '&' {
+			ref, pos, err := p.ref()
+			if err != nil {
+				return err
+			}
+			if bits != 32 {
+				return errorf(pos, "只有32位单元可以包含phandle引用")
+			}
+			pr.markers = append(pr.markers, marker{offset: len(pr.val), kind: refPhandle, ref: ref, pos: pos})
+			pr.val = append(pr.val, 0xFF, 0xFF, 0xFF, 0xFF)
+			continue
+		}
+
+		pos := p.pos()
+		v, err := p.integerPrim()
+		if err != nil {
+			return err
+		}
+		if bits < 64 {
+			mask := uint64(1)<<bits - 1
+			if v > mask && v|mask != ^uint64(0) {
+				return errorf(pos, "数值 0x%X 超出 %d 位范围", v, bits)
+			}
+		}
+		switch bits {
+		case 8:
+			pr.val = append(pr.val, byte(v))
+		case 16:
+			pr.val = binary.BigEndian.AppendUint16(pr.val, uint16(v))
+		case 32:
+			pr.val = binary.BigEndian.AppendUint32(pr.val, uint32(v))
+		case 64:
+			pr.val = binary.BigEndian.AppendUint64(pr.val, v)
+		}
+	}
+}
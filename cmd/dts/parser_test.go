@@ -0,0 +1,172 @@
+package dts
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kiy7086/dtbotool/cmd/diag"
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// compileString 编译测试源码，警告被忽略
+func compileString(src string) (*fdt.Tree, error) {
+	return CompileSource("t.dts", []byte(src), Options{Report: func(diag.Diagnostic) {}})
+}
+
+// propValue 返回 "路径:属性" 的值，节点或属性不存在时返回 nil
+func propValue(tree *fdt.Tree, spec string) []byte {
+	path, name, _ := strings.Cut(spec, ":")
+	n := tree.Lookup(path)
+	if n == nil {
+		return nil
+	}
+	p := n.Property(name)
+	if p == nil {
+		return nil
+	}
+	if p.Value == nil {
+		return []byte{}
+	}
+	return p.Value
+}
+
+func TestParseValues(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		prop string
+		want []byte
+	}{
+		{"空属性", "/ { a; };", "/:a", []byte{}},
+		{"单元", "/ { a = <1 0x20>; };", "/:a", fdt.CellsValue(1, 0x20)},
+		{"表达式", "/ { a = <(1 << 4 | 2) (10 / 3) (-1)>; };", "/:a", fdt.CellsValue(0x12, 3, 0xFFFFFFFF)},
+		{"条件表达式", "/ { a = <(1 ? 2 : 3) (0 ? 2 : 3)>; };", "/:a", fdt.CellsValue(2, 3)},
+		{"字符", "/ { a = <'A' '\\n'>; };", "/:a", fdt.CellsValue('A', '\n')},
+		{"8位", "/ { a = /bits/ 8 <1 2 0xff>; };", "/:a", []byte{1, 2, 0xFF}},
+		{"16位", "/ { a = /bits/ 16 <0x1234>; };", "/:a", []byte{0x12, 0x34}},
+		{"64位", "/ { a = /bits/ 64 <1>; };", "/:a", []byte{0, 0, 0, 0, 0, 0, 0, 1}},
+		{"字符串列表", `/ { a = "x", "yz"; };`, "/:a", []byte("x\x00yz\x00")},
+		{"字节串", "/ { a = [01 0203 ff]; };", "/:a", []byte{1, 2, 3, 0xFF}},
+		{"混合", `/ { a = "x", <1>, [02]; };`, "/:a", []byte{'x', 0, 0, 0, 0, 1, 2}},
+		{"节点合并", "/ { n { a = <1>; }; }; / { n { b = <2>; }; };", "/n:b", fdt.CellsValue(2)},
+		{"后定义覆盖", "/ { a = <1>; }; / { a = <2>; };", "/:a", fdt.CellsValue(2)},
+		{"标签引用节点", "/ { l: n { }; }; &l { a = <3>; };", "/n:a", fdt.CellsValue(3)},
+		{"路径引用节点", "/ { n { }; }; &{/n} { a = <4>; };", "/n:a", fdt.CellsValue(4)},
+		{"删除属性", "/ { a; b; }; / { /delete-property/ a; };", "/:a", nil},
+		{"删除节点", "/ { n { a; }; }; / { /delete-node/ n; };", "/n:a", nil},
+		{"顶层删除节点", "/ { l: n { a; }; }; /delete-node/ &l;", "/n:a", nil},
+		{"删除后重新定义", "/ { n { a; }; /delete-node/ n; n { b; }; };", "/n:b", []byte{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := compileString("/dts-v1/;\n" + tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := propValue(tree, tt.prop)
+			if (got == nil) != (tt.want == nil) || !bytes.Equal(got, tt.want) {
+				t.Errorf("%s = %x, 期望 %x", tt.prop, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMemreserve(t *testing.T) {
+	tree, err := compileString("/dts-v1/;\n/memreserve/ 0x1000 0x200;\n/ { };")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.Reserve) != 1 || tree.Reserve[0] != (fdt.ReserveEntry{Address: 0x1000, Size: 0x200}) {
+		t.Errorf("保留区域 = %v", tree.Reserve)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string // 错误消息中应包含的内容
+		pos  string
+	}{
+		{"缺少版本声明", "/ { };", "缺少 /dts-v1/", "t.dts:1:1"},
+		{"重复属性", "/dts-v1/;\n/ { a; a; };", "重复的属性名 a", "t.dts:2:8"},
+		{"重复节点", "/dts-v1/;\n/ {\n\tn { };\n\tn { };\n};", "重复的节点名 n", "t.dts:4:2"},
+		{"子节点中的重复节点", "/dts-v1/;\n/ { p { n { }; n { }; }; };", "重复的节点名 n", "t.dts:2:16"},
+		{"属性在子节点之后", "/dts-v1/;\n/ { n { }; a; };", "必须位于子节点之前", "t.dts:2:12"},
+		{"未知标签", "/dts-v1/;\n&nope { };", "标签或路径 nope 不存在", "t.dts:2:1"},
+		{"节点未结束", "/dts-v1/;\n/ { n {", "未结束", ""},
+		{"缺少分号", "/dts-v1/;\n/ { a = <1> };", "", "t.dts:2:13"},
+		{"omit-if-no-ref 用于属性", "/dts-v1/;\n/ { /omit-if-no-ref/ a; };", "只能用于节点", ""},
+		{"除零", "/dts-v1/;\n/ { a = <(1 / 0)>; };", "", ""},
+		{"删除根节点", "/dts-v1/;\n/ { l: n { }; };\n/delete-node/ &{/};", "不能删除根节点", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileString(tt.src)
+			if err == nil {
+				t.Fatal("期望编译失败")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("错误 = %v, 期望包含 %q", err, tt.want)
+			}
+			if tt.pos != "" && !strings.HasPrefix(err.Error(), tt.pos+":") {
+				t.Errorf("错误 = %v, 期望位于 %s", err, tt.pos)
+			}
+		})
+	}
+}
+
+func TestParseOrphanFragments(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string // 根节点的子节点
+		fix  map[string]string
+	}{
+		{
+			"依次编号",
+			"&a { x; }; &b { y; };",
+			[]string{"fragment@0", "fragment@1", "__fixups__"},
+			map[string]string{"a": "/fragment@0:target:0", "b": "/fragment@1:target:0"},
+		},
+		{
+			"跳过已有的序号",
+			"/ { fragment@0 { }; }; &a { x; };",
+			[]string{"fragment@0", "fragment@1", "__fixups__"},
+			map[string]string{"a": "/fragment@1:target:0"},
+		},
+		{
+			"源码中之后定义的同名节点",
+			"&a { x; }; / { fragment@0 { }; }; &b { y; };",
+			[]string{"fragment@1", "fragment@0", "fragment@2", "__fixups__"},
+			map[string]string{"a": "/fragment@1:target:0", "b": "/fragment@2:target:0"},
+		},
+		{
+			"路径目标",
+			"&{/soc} { x; };",
+			[]string{"fragment@0"},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := compileString("/dts-v1/;\n/plugin/;\n" + tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, c := range tree.Root.Children {
+				names = append(names, c.Name)
+			}
+			if strings.Join(names, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("子节点 = %v, 期望 %v", names, tt.want)
+			}
+			for label, want := range tt.fix {
+				if got := string(propValue(tree, "/__fixups__:"+label)); got != want+"\x00" {
+					t.Errorf("__fixups__/%s = %q, 期望 %q", label, got, want)
+				}
+			}
+		})
+	}
+}
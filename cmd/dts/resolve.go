@@ -0,0 +1,334 @@
+package dts
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/diag"
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// resolver 处理引用、phandle 分配以及 overlay 相关的特殊节点
+type resolver struct {
+	root        *node
+	plugin      bool
+	nextPhandle uint32
+	quiet       map[string]bool // 关闭的警告
+	report      func(diag.Diagnostic)
+}
+
+// warnf 报告编译警告，id 对应的警告已关闭时忽略
+func (r *resolver) warnf(pos Pos, id, format string, args ...any) {
+	if r.quiet[id] {
+		return
+	}
+	r.report(diag.Diagnostic{
+		File:     pos.File,
+		Line:     pos.Line,
+		Column:   pos.Column,
+		Severity: diag.Warning,
+		Message:  fmt.Sprintf(format, args...) + " [" + id + "]",
+	})
+}
+
+func (r *resolver) resolve(symbols bool) error {
+	if err := r.checkLabels(); err != nil {
+		return err
+	}
+	if err := r.explicitPhandles(); err != nil {
+		return err
+	}
+	if err := r.fixupPhandles(); err != nil {
+		return err
+	}
+	if err := r.fixupPaths(); err != nil {
+		return err
+	}
+	r.omitUnreferenced()
+
+	if symbols {
+		r.generateSymbols()
+	}
+	if r.plugin {
+		r.generateFixups()
+		r.generateLocalFixups()
+	}
+	return nil
+}
+
+// checkLabels 检查重复定义的标签
+func (r *resolver) checkLabels() error {
+	owners := make(map[string]*node)
+	var err error
+	r.root.walk(func(n *node) {
+		for _, name := range liveLabels(n.labels) {
+			if prev, ok := owners[name]; ok && prev != n && err == nil {
+				err = errorf(n.pos, "标签 %s 重复定义于 %s 和 %s", name, prev.path(), n.path())
+			}
+			owners[name] = n
+		}
+	})
+	return err
+}
+
+// explicitPhandles 读取源码中显式指定的 phandle
+func (r *resolver) explicitPhandles() error {
+	used := make(map[uint32]*node)
+	var err error
+	r.root.walk(func(n *node) {
+		for _, name := range []string{"phandle", "linux,phandle"} {
+			p := n.property(name)
+			if p == nil || err != nil {
+				continue
+			}
+			if len(p.val) != 4 || len(p.markers) > 0 {
+				err = errorf(p.pos, "%s 属性必须是单个32位值", name)
+				return
+			}
+			v := binary.BigEndian.Uint32(p.val)
+			if v == 0 || v == 0xFFFFFFFF {
+				err = errorf(p.pos, "%s 的值 0x%X 无效", name, v)
+				return
+			}
+			if n.phandle != 0 && n.phandle != v {
+				err = errorf(p.pos, "节点 %s 的 phandle 与 linux,phandle 不一致", n.path())
+				return
+			}
+			if other, ok := used[v]; ok && other != n {
+				err = errorf(p.pos, "phandle 0x%X 同时被 %s 和 %s 使用", v, other.path(), n.path())
+				return
+			}
+			used[v] = n
+			n.phandle = v
+		}
+	})
+	return err
+}
+
+// nodePhandle 返回节点的 phandle，没有时按 dtc 的规则分配并添加 phandle 属性
+func (r *resolver) nodePhandle(n *node) uint32 {
+	if n.phandle != 0 {
+		return n.phandle
+	}
+	if r.nextPhandle == 0 {
+		r.nextPhandle = 1
+	}
+	for r.phandleUsed(r.nextPhandle) {
+		r.nextPhandle++
+	}
+	n.phandle = r.nextPhandle
+	if n.property("phandle") == nil {
+		n.setProperty(&prop{name: "phandle", val: fdt.U32Value(n.phandle), pos: n.pos})
+	}
+	return n.phandle
+}
+
+func (r *resolver) phandleUsed(v uint32) bool {
+	used := false
+	r.root.walk(func(n *node) {
+		used = used || n.phandle == v
+	})
+	return used
+}
+
+func (r *resolver) fixupPhandles() error {
+	var err error
+	r.root.walk(func(n *node) {
+		for _, p := range n.props {
+			if p.deleted || err != nil {
+				continue
+			}
+			for _, m := range p.markers {
+				if m.kind != refPhandle {
+					continue
+				}
+				target := r.root.lookupRef(m.ref)
+				if target == nil {
+					if !r.plugin {
+						err = errorf(m.pos, "引用了不存在的节点或标签 %q", m.ref)
+						return
+					}
+					binary.BigEndian.PutUint32(p.val[m.offset:], 0xFFFFFFFF)
+					continue
+				}
+				target.referenced = true
+				binary.BigEndian.PutUint32(p.val[m.offset:], r.nodePhandle(target))
+			}
+		}
+	})
+	return err
+}
+
+// fixupPaths 将 &label 路径引用替换为目标节点的完整路径
+func (r *resolver) fixupPaths() error {
+	var err error
+	r.root.walk(func(n *node) {
+		for _, p := range n.props {
+			if p.deleted || err != nil {
+				continue
+			}
+			for i := range p.markers {
+				m := &p.markers[i]
+				if m.kind != refPath {
+					continue
+				}
+				target := r.root.lookupRef(m.ref)
+				if target == nil {
+					err = errorf(m.pos, "引用了不存在的节点或标签 %q", m.ref)
+					return
+				}
+				target.referenced = true
+
+				path := fdt.StringValue(target.path())
+				p.val = slices.Insert(p.val, m.offset, path...)
+				for j := range p.markers {
+					if j != i && p.markers[j].offset >= m.offset && (j > i || p.markers[j].offset > m.offset) {
+						p.markers[j].offset += len(path)
+					}
+				}
+			}
+		}
+	})
+	return err
+}
+
+// omitUnreferenced 删除带有 /omit-if-no-ref/ 且未被引用的节点
+func (r *resolver) omitUnreferenced() {
+	r.root.walk(func(n *node) {
+		if n.omitIfNoRef && !n.referenced {
+			n.markDeleted()
+		}
+	})
+}
+
+// specialChild 获取或创建根节点下的特殊节点
+func (r *resolver) specialChild(name string) *node {
+	return r.root.addChild(name, r.root.pos)
+}
+
+// generateSymbols 生成 __symbols__ 节点，并为所有带标签的节点分配 phandle
+func (r *resolver) generateSymbols() {
+	var labeled []*node
+	r.root.walk(func(n *node) {
+		if len(liveLabels(n.labels)) > 0 {
+			labeled = append(labeled, n)
+		}
+	})
+	if len(labeled) == 0 {
+		return
+	}
+
+	symbols := r.specialChild("__symbols__")
+	for _, n := range labeled {
+		for _, name := range liveLabels(n.labels) {
+			// 反编译得到的源码会保留原有的 __symbols__，内容相同时无需警告
+			if p := symbols.property(name); p != nil {
+				if string(p.val) != string(fdt.StringValue(n.path())) {
+					r.warnf(n.pos, "duplicate-symbol", "__symbols__ 中已存在标签 %s", name)
+				}
+				continue
+			}
+			symbols.setProperty(&prop{name: name, val: fdt.StringValue(n.path()), pos: n.pos})
+		}
+		r.nodePhandle(n)
+	}
+}
+
+// forEachPhandleRef 遍历所有 phandle 引用，target 为 nil 表示本地无法解析
+func (r *resolver) forEachPhandleRef(fn func(n *node, p *prop, m marker, target *node)) {
+	r.root.walk(func(n *node) {
+		for _, p := range n.props {
+			if p.deleted {
+				continue
+			}
+			for _, m := range p.markers {
+				if m.kind == refPhandle {
+					fn(n, p, m, r.root.lookupRef(m.ref))
+				}
+			}
+		}
+	})
+}
+
+// generateFixups 生成 __fixups__，记录需要由基础设备树解析的引用
+func (r *resolver) generateFixups() {
+	type entry struct {
+		label string
+		value string
+	}
+	var entries []entry
+	r.forEachPhandleRef(func(n *node, p *prop, m marker, target *node) {
+		if target == nil {
+			entries = append(entries, entry{m.ref, fmt.Sprintf("%s:%s:%d", n.path(), p.name, m.offset)})
+		}
+	})
+	if len(entries) == 0 {
+		return
+	}
+
+	fixups := r.specialChild("__fixups__")
+	for _, e := range entries {
+		if p := fixups.property(e.label); p != nil {
+			p.val = append(p.val, fdt.StringValue(e.value)...)
+			continue
+		}
+		fixups.setProperty(&prop{name: e.label, val: fdt.StringValue(e.value)})
+	}
+}
+
+// generateLocalFixups 生成 __local_fixups__，记录 overlay 内部 phandle 引用的位置
+func (r *resolver) generateLocalFixups() {
+	type entry struct {
+		path   string
+		prop   string
+		offset int
+	}
+	var entries []entry
+	r.forEachPhandleRef(func(n *node, p *prop, m marker, target *node) {
+		if target != nil {
+			entries = append(entries, entry{n.path(), p.name, m.offset})
+		}
+	})
+	if len(entries) == 0 {
+		return
+	}
+
+	local := r.specialChild("__local_fixups__")
+	for _, e := range entries {
+		wn := local
+		for _, part := range strings.Split(e.path, "/") {
+			if part != "" {
+				wn = wn.addChild(part, r.root.pos)
+			}
+		}
+		offset := fdt.U32Value(uint32(e.offset))
+		if p := wn.property(e.prop); p != nil {
+			p.val = append(p.val, offset...)
+			continue
+		}
+		wn.setProperty(&prop{name: e.prop, val: offset})
+	}
+}
+
+// toFdt 将编译结果转换为 fdt.Tree，丢弃已删除的节点和属性
+func (n *node) toFdt(parent *fdt.Node) *fdt.Node {
+	out := &fdt.Node{Name: n.name, Parent: parent, Labels: liveLabels(n.labels)}
+	for _, p := range n.props {
+		if p.deleted {
+			continue
+		}
+		out.Properties = append(out.Properties, &fdt.Property{
+			Name:   p.name,
+			Labels: liveLabels(p.labels),
+			Value:  p.val,
+		})
+	}
+	for _, c := range n.children {
+		if !c.deleted {
+			out.Children = append(out.Children, c.toFdt(out))
+		}
+	}
+	return out
+}
@@ -0,0 +1,188 @@
+package dts
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kiy7086/dtbotool/cmd/diag"
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		props map[string][]byte // "路径:属性" 的期望值，nil 表示不存在
+	}{
+		{
+			"按引用顺序分配 phandle",
+			"/ { a: a { }; b: b { }; c { x = <&b &a>; }; };",
+			map[string][]byte{
+				"/b:phandle": fdt.U32Value(1),
+				"/a:phandle": fdt.U32Value(2),
+				"/c:x":       fdt.CellsValue(1, 2),
+			},
+		},
+		{
+			"跳过显式的 phandle",
+			"/ { a: a { }; b { phandle = <1>; }; c { x = <&a>; }; };",
+			map[string][]byte{
+				"/a:phandle": fdt.U32Value(2),
+				"/c:x":       fdt.CellsValue(2),
+			},
+		},
+		{
+			"使用显式的 phandle",
+			"/ { a: a { phandle = <0x10>; }; c { x = <&a>; }; };",
+			map[string][]byte{"/c:x": fdt.CellsValue(0x10)},
+		},
+		{
+			"路径引用",
+			`/ { a: a { b: b { }; }; c { x = &b; y = &{/a}, "z"; }; };`,
+			map[string][]byte{
+				"/c:x":         []byte("/a/b\x00"),
+				"/c:y":         []byte("/a\x00z\x00"),
+				"/a/b:phandle": nil,
+			},
+		},
+		{
+			"路径引用在单元中间",
+			`/ { a: a { }; c { x = "p", &a, <1>; }; };`,
+			map[string][]byte{"/c:x": append([]byte("p\x00/a\x00"), fdt.CellsValue(1)...)},
+		},
+		{
+			"未被引用的节点被删除",
+			"/ { /omit-if-no-ref/ a: a { p; }; /omit-if-no-ref/ b: b { p; }; c { x = <&b>; }; };",
+			map[string][]byte{"/a:p": nil, "/b:p": {}},
+		},
+		{
+			"删除节点后标签失效",
+			"/ { a: a { }; }; / { /delete-node/ a; a { }; };",
+			map[string][]byte{"/a:phandle": nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := compileString("/dts-v1/;\n" + tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for spec, want := range tt.props {
+				got := propValue(tree, spec)
+				if (got == nil) != (want == nil) || !bytes.Equal(got, want) {
+					t.Errorf("%s = %x, 期望 %x", spec, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"重复标签", "/ { l: a { }; l: b { }; };", "标签 l 重复定义"},
+		{"未知引用", "/ { x = <&nope>; };", `不存在的节点或标签 "nope"`},
+		{"未知路径引用", "/ { x = &nope; };", `不存在的节点或标签 "nope"`},
+		{"phandle 冲突", "/ { a { phandle = <1>; }; b { phandle = <1>; }; };", "phandle 0x1 同时被"},
+		{"phandle 无效", "/ { a { phandle = <0xffffffff>; }; };", "无效"},
+		{"phandle 不一致", "/ { a { phandle = <1>; linux,phandle = <2>; }; };", "不一致"},
+		{"phandle 格式", "/ { a { phandle = <1 2>; }; };", "单个32位值"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileString("/dts-v1/;\n" + tt.src)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("错误 = %v, 期望包含 %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveSymbols(t *testing.T) {
+	var warnings []diag.Diagnostic
+	src := "/dts-v1/;\n/ { a: x: a { }; b { }; __symbols__ { a = \"/b\"; }; };"
+	tree, err := CompileSource("t.dts", []byte(src), Options{
+		Symbols: true,
+		Report:  func(d diag.Diagnostic) { warnings = append(warnings, d) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := propValue(tree, "/__symbols__:x"); string(got) != "/a\x00" {
+		t.Errorf("__symbols__/x = %q", got)
+	}
+	if got := propValue(tree, "/a:phandle"); got == nil {
+		t.Error("带标签的节点应当分配 phandle")
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Message, "duplicate-symbol") {
+		t.Errorf("警告 = %v, 期望一个 duplicate-symbol", warnings)
+	}
+
+	warnings = nil
+	if _, err := CompileSource("t.dts", []byte(src), Options{
+		Symbols:  true,
+		Suppress: []string{"duplicate-symbol"},
+		Report:   func(d diag.Diagnostic) { warnings = append(warnings, d) },
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("关闭的警告仍被报告: %v", warnings)
+	}
+}
+
+func TestResolveOverlayFixups(t *testing.T) {
+	src := `/dts-v1/;
+/plugin/;
+&uart {
+	status = "okay";
+	l: dev { };
+	user { a = <&l &clk 1>; b = <&clk &l>; };
+};
+`
+	tree, err := compileString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]byte{
+		"/fragment@0:target":                              fdt.U32Value(0xFFFFFFFF),
+		"/fragment@0/__overlay__/dev:phandle":             fdt.U32Value(1),
+		"/fragment@0/__overlay__/user:a":                  fdt.CellsValue(1, 0xFFFFFFFF, 1),
+		"/__fixups__:uart":                                []byte("/fragment@0:target:0\x00"),
+		"/__fixups__:clk":                                 []byte("/fragment@0/__overlay__/user:a:4\x00/fragment@0/__overlay__/user:b:0\x00"),
+		"/__local_fixups__/fragment@0/__overlay__/user:a": fdt.CellsValue(0),
+		"/__local_fixups__/fragment@0/__overlay__/user:b": fdt.CellsValue(4),
+		"/__local_fixups__/fragment@0:target":             nil,
+	}
+	for spec, w := range want {
+		got := propValue(tree, spec)
+		if (got == nil) != (w == nil) || !bytes.Equal(got, w) {
+			t.Errorf("%s = %x, 期望 %x", spec, got, w)
+		}
+	}
+}
+
+func TestResolveIncbin(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "blob.bin"), []byte{1, 2, 3, 4, 5}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	src := `/dts-v1/;
+/ { a = /incbin/("blob.bin"); b = /incbin/("blob.bin", 1, 3); };`
+	tree, err := CompileSource(filepath.Join(dir, "t.dts"), []byte(src), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := propValue(tree, "/:a"); !bytes.Equal(got, []byte{1, 2, 3, 4, 5}) {
+		t.Errorf("a = %x", got)
+	}
+	if got := propValue(tree, "/:b"); !bytes.Equal(got, []byte{2, 3, 4}) {
+		t.Errorf("b = %x", got)
+	}
+}
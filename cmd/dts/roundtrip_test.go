@@ -0,0 +1,30 @@
+package dts_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kiy7086/dtbotool/cmd/dts"
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+	"github.com/kiy7086/dtbotool/cmd/internal/dtstest"
+)
+
+// TestRoundTrip 编译得到的DTB反编译后再次编译，结果应当逐字节相同
+func TestRoundTrip(t *testing.T) {
+	for name, src := range map[string]string{"base": dtstest.Base, "overlay": dtstest.Overlay} {
+		for _, symbols := range []bool{false, true} {
+			t.Run(name, func(t *testing.T) {
+				first := dtstest.DTB(t, src)
+				tree, err := fdt.Parse(first)
+				if err != nil {
+					t.Fatal(err)
+				}
+				source := dts.Decompile(tree, dts.DecompileOptions{Symbols: symbols})
+				second := dtstest.DTB(t, string(source))
+				if !bytes.Equal(first, second) {
+					t.Errorf("symbols=%v: 重新编译的结果不同 (%d / %d 字节)\n%s", symbols, len(first), len(second), source)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package dts
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+)
+
+const maxIncludeDepth = 32
+
+// source 单个源文件的读取状态
+type source struct {
+	file string
+	name string // 行标记指定的原始文件名，用于报告位置
+	data []byte
+	off  int
+	line int
+	col  int
+}
+
+// scanner 逐字符读取源码，负责处理注释和 /include/
+type scanner struct {
+	stack       []*source
+	includeDirs []string
+	depend      func(path string, exists bool)
+}
+
+func newScanner(file string, data []byte, opts Options) *scanner {
+	return &scanner{
+		stack:       []*source{{file: file, data: data, line: 1, col: 1}},
+		includeDirs: opts.IncludeDirs,
+		depend:      opts.Depend,
+	}
+}
+
+func (s *scanner) cur() *source {
+	return s.stack[len(s.stack)-1]
+}
+
+// popFinished 弹出已读完的被包含文件
+func (s *scanner) popFinished() {
+	for len(s.stack) > 1 && s.cur().off >= len(s.cur().data) {
+		s.stack = s.stack[:len(s.stack)-1]
+	}
+}
+
+func (s *scanner) eof() bool {
+	s.popFinished()
+	return s.cur().off >= len(s.cur().data)
+}
+
+func (s *scanner) peek() byte {
+	if s.eof() {
+		return 0
+	}
+	return s.cur().data[s.cur().off]
+}
+
+func (s *scanner) peekAt(n int) byte {
+	src := s.cur()
+	if src.off+n >= len(src.data) {
+		return 0
+	}
+	return src.data[src.off+n]
+}
+
+func (s *scanner) hasPrefix(prefix string) bool {
+	s.popFinished()
+	src := s.cur()
+	return bytes.HasPrefix(src.data[src.off:], []byte(prefix))
+}
+
+func (s *scanner) next() byte {
+	if s.eof() {
+		return 0
+	}
+	src := s.cur()
+	c := src.data[src.off]
+	src.off++
+	if c == '\n' {
+		src.line++
+		src.col = 1
+	} else {
+		src.col++
+	}
+	return c
+}
+
+func (s *scanner) pos() Pos {
+	s.popFinished()
+	src := s.cur()
+	name := src.file
+	if src.name != "" {
+		name = src.name
+	}
+	return Pos{File: name, Line: src.line, Column: src.col}
+}
+
+// skipSpace 跳过空白、注释，并展开 /include/
+func (s *scanner) skipSpace() error {
+	for !s.eof() {
+		c := s.peek()
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+			s.next()
+		case s.hasPrefix("//"):
+			for !s.eof() && s.peek() != '\n' {
+				s.next()
+			}
+		case s.hasPrefix("/*"):
+			start := s.pos()
+			s.next()
+			s.next()
+			for !s.hasPrefix("*/") {
+				if s.cur().off >= len(s.cur().data) {
+					return errorf(start, "注释未结束")
+				}
+				s.next()
+			}
+			s.next()
+			s.next()
+		case s.hasPrefix("/include/"):
+			if err := s.include(); err != nil {
+				return err
+			}
+		case c == '#' && s.cur().col == 1 && s.isLineMarker():
+			if err := s.lineMarker(); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *scanner) include() error {
+	pos := s.pos()
+	for range len("/include/") {
+		s.next()
+	}
+
+	// /include/ 与文件名之间只允许空白
+	for s.peek() == ' ' || s.peek() == '\t' {
+		s.next()
+	}
+	if s.peek() != '"' {
+		return errorf(s.pos(), "/include/ 之后需要文件名")
+	}
+	name, err := s.stringLiteral()
+	if err != nil {
+		return err
+	}
+
+	if len(s.stack) >= maxIncludeDepth {
+		return errorf(pos, "包含层级过深: %s", name)
+	}
+
+	path, data, err := s.findInclude(string(name), pos)
+	if err != nil {
+		return errorf(pos, "无法包含文件 %q: %v", name, err)
+	}
+	s.stack = append(s.stack, &source{file: path, data: data, line: 1, col: 1})
+	return nil
+}
+
+// isLineMarker 判断当前行是否为预处理器输出的行标记，如 # 12 "foo.dtsi" 或 #line 12
+func (s *scanner) isLineMarker() bool {
+	src := s.cur()
+	rest := src.data[src.off+1:]
+	rest = bytes.TrimLeft(rest, " \t")
+	if bytes.HasPrefix(rest, []byte("line")) {
+		after := rest[len("line"):]
+		if len(after) == 0 || (after[0] != ' ' && after[0] != '\t') {
+			return false
+		}
+		rest = bytes.TrimLeft(after, " \t")
+	}
+	n := 0
+	for n < len(rest) && rest[n] >= '0' && rest[n] <= '9' {
+		n++
+	}
+	return n > 0 && (n == len(rest) || bytes.IndexByte([]byte(" \t\r\n"), rest[n]) >= 0)
+}
+
+// lineMarker 解析行标记，之后的位置按标记中的文件名和行号报告
+func (s *scanner) lineMarker() error {
+	src := s.cur()
+	s.next() // #
+	for s.peek() == ' ' || s.peek() == '\t' {
+		s.next()
+	}
+	if s.hasPrefix("line") {
+		for range len("line") {
+			s.next()
+		}
+		for s.peek() == ' ' || s.peek() == '\t' {
+			s.next()
+		}
+	}
+
+	line := 0
+	for c := s.peek(); c >= '0' && c <= '9'; c = s.peek() {
+		line = line*10 + int(s.next()-'0')
+	}
+	for s.peek() == ' ' || s.peek() == '\t' {
+		s.next()
+	}
+	if s.peek() == '"' {
+		name, err := s.stringLiteral()
+		if err != nil {
+			return err
+		}
+		src.name = string(name)
+	}
+
+	// 行标记之后的标志位（如 GCC 的 1 2 3）忽略
+	for !s.eof() && s.peek() != '\n' {
+		s.next()
+	}
+	if s.peek() == '\n' {
+		s.next()
+	}
+	src.line = line
+	return nil
+}
+
+// findInclude 依次在当前文件目录和包含路径中查找文件。经过预处理的源码中，
+// 当前文件是 pos 中行标记指定的原始文件，而不是预处理输出
+func (s *scanner) findInclude(name string, pos Pos) (string, []byte, error) {
+	return s.findFile(name, filepath.Dir(pos.File))
+}
+
+// findFile 查找 /include/ 或 /incbin/ 的文件，并记录为依赖
+func (s *scanner) findFile(name, relDir string) (string, []byte, error) {
+	return findFile(name, relDir, s.includeDirs, s.depend)
+}
+
+// findFile 按相对目录和包含路径查找文件，depend 不为 nil 时接收依次查找过的路径
+func findFile(name, relDir string, includeDirs []string, depend func(string, bool)) (string, []byte, error) {
+	candidates := []string{name}
+	if !filepath.IsAbs(name) {
+		candidates = []string{filepath.Join(relDir, name)}
+		for _, dir := range includeDirs {
+			candidates = append(candidates, filepath.Join(dir, name))
+		}
+	}
+
+	var firstErr error
+	for _, path := range candidates {
+		data, err := os.ReadFile(path)
+		if depend != nil {
+			depend(path, err == nil)
+		}
+		if err == nil {
+			return path, data, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return "", nil, firstErr
+}
+
+// stringLiteral 读取带转义的字符串字面量
+func (s *scanner) stringLiteral() ([]byte, error) {
+	start := s.pos()
+	s.next() // "
+	var out []byte
+	for {
+		if s.cur().off >= len(s.cur().data) || s.peek() == '\n' {
+			return nil, errorf(start, "字符串未结束")
+		}
+		c := s.next()
+		if c == '"' {
+			return out, nil
+		}
+		if c != '\\' {
+			out = append(out, c)
+			continue
+		}
+		b, err := s.escape()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+}
+
+// escape 解析反斜杠之后的转义字符
+func (s *scanner) escape() (byte, error) {
+	pos := s.pos()
+	c := s.next()
+	switch c {
+	case 'a':
+		return '\a', nil
+	case 'b':
+		return '\b', nil
+	case 't':
+		return '\t', nil
+	case 'n':
+		return '\n', nil
+	case 'v':
+		return '\v', nil
+	case 'f':
+		return '\f', nil
+	case 'r':
+		return '\r', nil
+	case 'x':
+		v, n := 0, 0
+		for n < 2 && isHexDigit(s.peek()) {
+			v = v*16 + hexValue(s.next())
+			n++
+		}
+		if n == 0 {
+			return 0, errorf(pos, "\\x 之后需要十六进制数字")
+		}
+		return byte(v), nil
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		v := int(c - '0')
+		for n := 1; n < 3 && s.peek() >= '0' && s.peek() <= '7'; n++ {
+			v = v*8 + int(s.next()-'0')
+		}
+		return byte(v), nil
+	case 0:
+		return 0, errorf(pos, "转义字符不完整")
+	default:
+		return c, nil
+	}
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func hexValue(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10
+	default:
+		return int(c-'A') + 10
+	}
+}
+
+func isNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == ',' || c == '.' || c == '_' || c == '+' || c == '*' || c == '#' ||
+		c == '?' || c == '@' || c == '-'
+}
+
+func isLabelChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
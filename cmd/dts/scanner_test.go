@@ -0,0 +1,143 @@
+package dts
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// scanAll 跳过空白和注释，返回剩余的字符以及第一个字符的位置
+func scanAll(t *testing.T, s *scanner) (string, Pos) {
+	t.Helper()
+	var out []byte
+	var first Pos
+	for {
+		if err := s.skipSpace(); err != nil {
+			t.Fatalf("skipSpace: %v", err)
+		}
+		if s.eof() {
+			return string(out), first
+		}
+		if out == nil {
+			first = s.pos()
+		}
+		out = append(out, s.next())
+	}
+}
+
+func TestScannerSkipSpace(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+		pos  Pos
+	}{
+		{"空白", " \t\n a b", "ab", Pos{"t.dts", 2, 2}},
+		{"行注释", "// x\na // y\nb", "ab", Pos{"t.dts", 2, 1}},
+		{"块注释", "/* x\n * y */ a/**/b", "ab", Pos{"t.dts", 2, 9}},
+		{"行标记", "# 10 \"foo.dtsi\" 1\na", "a", Pos{"foo.dtsi", 10, 1}},
+		{"#line", "#line 5 \"bar.dts\"\n\na", "a", Pos{"bar.dts", 6, 1}},
+		{"不在行首的#不是行标记", "a #5", "a#5", Pos{"t.dts", 1, 1}},
+		{"#后不是数字", "#address-cells", "#address-cells", Pos{"t.dts", 1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, pos := scanAll(t, newScanner("t.dts", []byte(tt.src), Options{}))
+			if got != tt.want {
+				t.Errorf("内容 = %q, 期望 %q", got, tt.want)
+			}
+			if pos != tt.pos {
+				t.Errorf("位置 = %v, 期望 %v", pos, tt.pos)
+			}
+		})
+	}
+}
+
+func TestScannerUnterminatedComment(t *testing.T) {
+	s := newScanner("t.dts", []byte("a /* x"), Options{})
+	s.next()
+	if err := s.skipSpace(); err == nil {
+		t.Fatal("未结束的注释应当报错")
+	}
+}
+
+func TestScannerStringLiteral(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+		ok   bool
+	}{
+		{`"abc"`, "abc", true},
+		{`"a\"b"`, `a"b`, true},
+		{`"\t\n\\"`, "\t\n\\", true},
+		{`"\x41\102"`, "AB", true},
+		{`"abc`, "", false},
+	}
+	for _, tt := range tests {
+		s := newScanner("t.dts", []byte(tt.src), Options{})
+		got, err := s.stringLiteral()
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v", tt.src, err)
+			continue
+		}
+		if tt.ok && string(got) != tt.want {
+			t.Errorf("%s: 得到 %q, 期望 %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestScannerInclude(t *testing.T) {
+	dir := t.TempDir()
+	inc := filepath.Join(dir, "inc")
+	for path, data := range map[string]string{
+		"a.dtsi":     "top",
+		"sub/a.dtsi": "sub",
+		"inc/b.dtsi": "dir",
+	} {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	main := filepath.Join(dir, "main.dts")
+	sub := filepath.Join(dir, "sub", "x.dtsi")
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"相对当前文件", `/include/ "a.dtsi"`, "top"},
+		{"包含路径", `/include/ "b.dtsi"`, "dir"},
+		{"相对行标记中的文件", "# 1 \"" + sub + "\"\n/include/ \"a.dtsi\"", "sub"},
+		{"包含后继续读取", `x /include/ "a.dtsi" y`, "xtopy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var found, missing []string
+			s := newScanner(main, []byte(tt.src), Options{
+				IncludeDirs: []string{inc},
+				Depend: func(path string, exists bool) {
+					if exists {
+						found = append(found, path)
+					} else {
+						missing = append(missing, path)
+					}
+				},
+			})
+			got, _ := scanAll(t, s)
+			if got != tt.want {
+				t.Errorf("内容 = %q, 期望 %q", got, tt.want)
+			}
+			if len(found) != 1 {
+				t.Errorf("依赖 = %v, 期望一个文件", found)
+			}
+			if tt.want == "dir" && len(missing) != 1 {
+				t.Errorf("不存在的路径 = %v, 期望当前目录中的 b.dtsi", missing)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package dts
+
+import (
+	"strings"
+)
+
+type markerKind int
+
+const (
+	refPhandle markerKind = iota // <&label> 引用，占4字节
+	refPath                      // &label 路径引用，解析时插入路径字符串
+)
+
+// marker 属性值中的引用标记
+type marker struct {
+	offset int
+	kind   markerKind
+	ref    string
+	pos    Pos
+}
+
+type label struct {
+	name    string
+	deleted bool
+}
+
+// node 编译过程中的节点。删除的节点和属性只做标记，重新定义时恢复原位置，与 dtc 行为一致
+type node struct {
+	name        string
+	labels      []*label
+	props       []*prop
+	children    []*node
+	parent      *node
+	deleted     bool
+	omitIfNoRef bool
+	referenced  bool
+	generated   bool // 为 overlay 中无法解析的引用生成的 fragment
+	phandle     uint32
+	pos         Pos
+}
+
+type prop struct {
+	name    string
+	labels  []*label
+	val     []byte
+	markers []marker
+	deleted bool
+	pos     Pos
+}
+
+// addLabel 添加标签。与 dtc 相同，新标签插入到列表开头
+func addLabel(labels *[]*label, name string) {
+	for _, l := range *labels {
+		if l.name == name {
+			l.deleted = false
+			return
+		}
+	}
+	*labels = append([]*label{{name: name}}, *labels...)
+}
+
+func liveLabels(labels []*label) []string {
+	var names []string
+	for _, l := range labels {
+		if !l.deleted {
+			names = append(names, l.name)
+		}
+	}
+	return names
+}
+
+func (n *node) path() string {
+	if n.parent == nil {
+		return "/"
+	}
+	parent := n.parent.path()
+	if parent == "/" {
+		return "/" + n.name
+	}
+	return parent + "/" + n.name
+}
+
+func (n *node) property(name string) *prop {
+	for _, p := range n.props {
+		if !p.deleted && p.name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// setProperty 添加或覆盖属性
+func (n *node) setProperty(p *prop) {
+	for _, old := range n.props {
+		if old.name == p.name {
+			for i := len(p.labels) - 1; i >= 0; i-- {
+				addLabel(&old.labels, p.labels[i].name)
+			}
+			old.val = p.val
+			old.markers = p.markers
+			old.deleted = false
+			old.pos = p.pos
+			return
+		}
+	}
+	n.props = append(n.props, p)
+}
+
+func (n *node) deleteProperty(name string) {
+	for _, p := range n.props {
+		if p.name == name {
+			p.deleted = true
+		}
+	}
+}
+
+// childWithDeleted 查找子节点，包括已删除的节点
+func (n *node) childWithDeleted(name string) *node {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// child 查找未删除的子节点
+func (n *node) child(name string) *node {
+	for _, c := range n.children {
+		if !c.deleted && c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// addChild 获取或创建子节点，已删除的同名节点会被恢复
+func (n *node) addChild(name string, pos Pos) *node {
+	if c := n.childWithDeleted(name); c != nil {
+		c.deleted = false
+		return c
+	}
+	c := &node{name: name, parent: n, pos: pos}
+	n.children = append(n.children, c)
+	return c
+}
+
+// markDeleted 递归删除节点及其属性和标签
+func (n *node) markDeleted() {
+	n.deleted = true
+	for _, l := range n.labels {
+		l.deleted = true
+	}
+	for _, p := range n.props {
+		p.deleted = true
+		for _, l := range p.labels {
+			l.deleted = true
+		}
+	}
+	for _, c := range n.children {
+		c.markDeleted()
+	}
+}
+
+// walk 前序遍历未删除的节点
+func (n *node) walk(fn func(*node)) {
+	if n.deleted {
+		return
+	}
+	fn(n)
+	for _, c := range n.children {
+		c.walk(fn)
+	}
+}
+
+func (n *node) lookupPath(path string) *node {
+	cur := n
+	for _, part := range strings.Split(path, "/") {
+		if part == "" {
+			continue
+		}
+		if cur = cur.child(part); cur == nil {
+			return nil
+		}
+	}
+	return cur
+}
+
+func (n *node) lookupLabel(name string) *node {
+	var found *node
+	n.walk(func(c *node) {
+		if found != nil {
+			return
+		}
+		for _, l := range c.labels {
+			if !l.deleted && l.name == name {
+				found = c
+				return
+			}
+		}
+	})
+	return found
+}
+
+// lookupRef 按引用查找节点，引用可以是标签或以 / 开头的路径
+func (n *node) lookupRef(ref string) *node {
+	if strings.HasPrefix(ref, "/") {
+		return n.lookupPath(ref)
+	}
+	return n.lookupLabel(ref)
+}
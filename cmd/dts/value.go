@@ -0,0 +1,307 @@
+package dts
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// byteString 解析 [...] 字节串
+func (p *parser) byteString(pr *prop) error {
+	p.s.next() // [
+	for {
+		if _, err := p.labels(); err != nil {
+			return err
+		}
+		if err := p.skip(); err != nil {
+			return err
+		}
+		if p.s.peek() == ']' {
+			p.s.next()
+			return nil
+		}
+		if !isHexDigit(p.s.peek()) || !isHexDigit(p.s.peekAt(1)) {
+			return p.unexpected("两位十六进制数字")
+		}
+		hi := hexValue(p.s.next())
+		lo := hexValue(p.s.next())
+		pr.val = append(pr.val, byte(hi<<4|lo))
+	}
+}
+
+// incbin 解析 /incbin/("file"[, offset, length])
+func (p *parser) incbin(pr *prop) error {
+	if err := p.expect('('); err != nil {
+		return err
+	}
+	if err := p.skip(); err != nil {
+		return err
+	}
+	pos := p.pos()
+	if p.s.peek() != '"' {
+		return p.unexpected("文件名")
+	}
+	name, err := p.s.stringLiteral()
+	if err != nil {
+		return err
+	}
+
+	offset, length := uint64(0), int64(-1)
+	if err := p.skip(); err != nil {
+		return err
+	}
+	if p.s.peek() == ',' {
+		p.s.next()
+		if offset, err = p.integerPrim(); err != nil {
+			return err
+		}
+		if err := p.expect(','); err != nil {
+			return err
+		}
+		l, err := p.integerPrim()
+		if err != nil {
+			return err
+		}
+		length = int64(l)
+	}
+	if err := p.expect(')'); err != nil {
+		return err
+	}
+
+	_, data, err := p.s.findFile(string(name), filepath.Dir(pos.File))
+	if err != nil {
+		return errorf(pos, "无法读取 /incbin/ 文件 %q: %v", name, err)
+	}
+	if offset > uint64(len(data)) {
+		return errorf(pos, "/incbin/ 偏移超出文件大小")
+	}
+	data = data[offset:]
+	if length >= 0 {
+		if length > int64(len(data)) {
+			return errorf(pos, "/incbin/ 长度超出文件大小")
+		}
+		data = data[:length]
+	}
+	pr.val = append(pr.val, data...)
+	return nil
+}
+
+// integerPrim 解析整数字面量、字符字面量或括号表达式
+func (p *parser) integerPrim() (uint64, error) {
+	if err := p.skip(); err != nil {
+		return 0, err
+	}
+	switch c := p.s.peek(); {
+	case c == '(':
+		p.s.next()
+		v, err := p.expr()
+		if err != nil {
+			return 0, err
+		}
+		return v, p.expect(')')
+	case c == '\'':
+		return p.charLiteral()
+	case c >= '0' && c <= '9':
+		return p.literal()
+	}
+	return 0, p.unexpected("整数")
+}
+
+// literal 解析C风格整数字面量，忽略 U/L 后缀
+func (p *parser) literal() (uint64, error) {
+	pos := p.pos()
+	var sb strings.Builder
+	for c := p.s.peek(); isLabelChar(c); c = p.s.peek() {
+		sb.WriteByte(p.s.next())
+	}
+	text := strings.TrimRight(sb.String(), "uUlL")
+	if strings.HasPrefix(text, "0b") || strings.HasPrefix(text, "0o") || strings.Contains(text, "_") {
+		return 0, errorf(pos, "无效的整数 %q", sb.String())
+	}
+	v, err := strconv.ParseUint(text, 0, 64)
+	if err != nil {
+		return 0, errorf(pos, "无效的整数 %q", sb.String())
+	}
+	return v, nil
+}
+
+func (p *parser) charLiteral() (uint64, error) {
+	pos := p.pos()
+	p.s.next() // '
+	c := p.s.next()
+	if c == '\\' {
+		var err error
+		if c, err = p.s.escape(); err != nil {
+			return 0, err
+		}
+	}
+	if p.s.next() != '\'' {
+		return 0, errorf(pos, "字符字面量无效")
+	}
+	return uint64(c), nil
+}
+
+// 表达式运算符，按优先级从低到高排列
+var binaryOps = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+var allOps = []string{"||", "&&", "==", "!=", "<=", ">=", "<<", ">>",
+	"|", "^", "&", "<", ">", "+", "-", "*", "/", "%", "?", ":", "~", "!"}
+
+// peekOp 返回当前位置最长匹配的运算符
+func (p *parser) peekOp() string {
+	if err := p.skip(); err != nil {
+		return ""
+	}
+	for _, op := range allOps {
+		if p.s.hasPrefix(op) {
+			return op
+		}
+	}
+	return ""
+}
+
+func (p *parser) expr() (uint64, error) {
+	cond, err := p.binary(0)
+	if err != nil {
+		return 0, err
+	}
+	if p.peekOp() != "?" {
+		return cond, nil
+	}
+	p.s.next()
+	a, err := p.expr()
+	if err != nil {
+		return 0, err
+	}
+	if err := p.expect(':'); err != nil {
+		return 0, err
+	}
+	b, err := p.expr()
+	if err != nil {
+		return 0, err
+	}
+	if cond != 0 {
+		return a, nil
+	}
+	return b, nil
+}
+
+func (p *parser) binary(level int) (uint64, error) {
+	if level == len(binaryOps) {
+		return p.unary()
+	}
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		pos := p.pos()
+		op := p.peekOp()
+		if !contains(binaryOps[level], op) {
+			return left, nil
+		}
+		for range op {
+			p.s.next()
+		}
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return 0, err
+		}
+		if left, err = applyOp(op, left, right, pos); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (p *parser) unary() (uint64, error) {
+	switch op := p.peekOp(); op {
+	case "-", "~", "!":
+		p.s.next()
+		v, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case "-":
+			return -v, nil
+		case "~":
+			return ^v, nil
+		default:
+			return boolValue(v == 0), nil
+		}
+	}
+	return p.integerPrim()
+}
+
+func applyOp(op string, a, b uint64, pos Pos) (uint64, error) {
+	switch op {
+	case "||":
+		return boolValue(a != 0 || b != 0), nil
+	case "&&":
+		return boolValue(a != 0 && b != 0), nil
+	case "|":
+		return a | b, nil
+	case "^":
+		return a ^ b, nil
+	case "&":
+		return a & b, nil
+	case "==":
+		return boolValue(a == b), nil
+	case "!=":
+		return boolValue(a != b), nil
+	case "<":
+		return boolValue(a < b), nil
+	case "<=":
+		return boolValue(a <= b), nil
+	case ">":
+		return boolValue(a > b), nil
+	case ">=":
+		return boolValue(a >= b), nil
+	case "<<":
+		return a << b, nil
+	case ">>":
+		return a >> b, nil
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/", "%":
+		if b == 0 {
+			return 0, errorf(pos, "除数为零")
+		}
+		if op == "/" {
+			return a / b, nil
+		}
+		return a % b, nil
+	}
+	return 0, errorf(pos, "未知运算符 %s", op)
+}
+
+func boolValue(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package explain
+
+import (
+	"fmt"
+
+	"github.com/kiy7086/dtbotool/cmd/decode"
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+	"github.com/kiy7086/dtbotool/cmd/input"
+)
+
+// HandleExplain 解释输入文件中每个设备树的 reg、ranges、interrupts、clocks
+// 等属性。path 非空时只输出该节点及其子节点
+func HandleExplain(spec, path string) error {
+	items, err := input.Load(spec)
+	if err != nil {
+		return err
+	}
+
+	for i, item := range items {
+		if len(items) > 1 {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("== %s ==\n", item.Name)
+		}
+
+		root := item.Tree.Root
+		if path != "" {
+			if root = item.Tree.Lookup(path); root == nil {
+				if len(items) > 1 {
+					fmt.Printf("节点 %s 不存在\n", path)
+					continue
+				}
+				return fmt.Errorf("节点 %s 不存在", path)
+			}
+		}
+
+		d := decode.New(item.Tree)
+		count := 0
+		root.Walk(func(n *fdt.Node) bool {
+			var lines []string
+			for _, p := range n.Properties {
+				if text, ok := d.Explain(n, p); ok {
+					lines = append(lines, fmt.Sprintf("    %s: %s", p.Name, text))
+				}
+			}
+			if len(lines) == 0 {
+				return true
+			}
+			fmt.Println(n.Path())
+			if n.Property("interrupts") != nil {
+				if parent := d.InterruptParent(n); parent != nil {
+					lines = append(lines, "    interrupt-parent: "+d.Name(parent))
+				}
+			}
+			for _, line := range lines {
+				fmt.Println(line)
+			}
+			count++
+			return true
+		})
+		if count == 0 {
+			fmt.Println("没有可解释的属性")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package fdt
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kiy7086/dtbotool/cmd/compression"
+)
+
+const (
+	Magic = 0xD00DFEED
+
+	tokenBeginNode = 0x1
+	tokenEndNode   = 0x2
+	tokenProp      = 0x3
+	tokenNop       = 0x4
+	tokenEnd       = 0x9
+
+	headerSizeV16 = 36
+	headerSizeV17 = 40
+
+	// DefaultVersion 写出时默认使用的FDT版本
+	DefaultVersion = 17
+	// LastCompVersion 兼容的最低版本
+	LastCompVersion = 16
+)
+
+// Header FDT 头部
+type Header struct {
+	Magic           uint32
+	TotalSize       uint32
+	OffDtStruct     uint32
+	OffDtStrings    uint32
+	OffMemRsvmap    uint32
+	Version         uint32
+	LastCompVersion uint32
+	BootCpuidPhys   uint32
+	SizeDtStrings   uint32
+	SizeDtStruct    uint32 // 仅 v17 及以上
+}
+
+// ReserveEntry 内存保留区条目
+type ReserveEntry struct {
+	Address uint64
+	Size    uint64
+}
+
+// Tree 解析后的设备树
+type Tree struct {
+	Version       uint32
+	BootCpuidPhys uint32
+	Reserve       []ReserveEntry
+	Root          *Node
+	Padding       uint32 // 字符串块之后的填充字节数
+}
+
+// NewTree 创建只包含根节点的空设备树
+func NewTree() *Tree {
+	return &Tree{
+		Version: DefaultVersion,
+		Root:    &Node{Name: ""},
+	}
+}
+
+// ReadFile 读取并解析DTB文件，支持压缩输入
+func ReadFile(path string) (*Tree, error) {
+	data, err := compression.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取DTB文件失败: %v", err)
+	}
+	return Parse(data)
+}
+
+// WriteFile 将设备树序列化并写入文件
+func WriteFile(path string, t *Tree) error {
+	data, err := t.Bytes()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("写入DTB文件失败: %v", err)
+	}
+	return nil
+}
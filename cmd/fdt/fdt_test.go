@@ -0,0 +1,180 @@
+package fdt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// testTree 包含内存保留区、嵌套节点、需要对齐的属性值和共享后缀的属性名
+func testTree() *Tree {
+	t := NewTree()
+	t.BootCpuidPhys = 1
+	t.Reserve = []ReserveEntry{{Address: 0x80000000, Size: 0x100000}, {Address: 0x1000, Size: 0x10}}
+	t.Root.SetProperty("model", StringValue("test board"))
+	t.Root.SetProperty("#address-cells", U32Value(1))
+	cpu := t.Root.AddChild("cpus").AddChild("cpu@0")
+	cpu.SetProperty("reg", U32Value(0))
+	uart := t.Root.AddChild("serial@2000")
+	uart.SetProperty("compatible", StringValue("vendor,uart", "ns16550a"))
+	uart.SetProperty("clock-names", StringValue("core"))
+	uart.SetProperty("names", StringValue("x"))
+	uart.SetProperty("odd", []byte{1, 2, 3})
+	uart.SetProperty("one", []byte{1})
+	uart.SetProperty("wide", U64Value(0x123456789))
+	uart.SetProperty("empty", nil)
+	return t
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, version := range []uint32{16, 17} {
+		for _, padding := range []uint32{0, 64} {
+			tree := testTree()
+			tree.Version = version
+			tree.Padding = padding
+			data, err := tree.Bytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			back, err := Parse(data)
+			if err != nil {
+				t.Fatalf("v%d: %v", version, err)
+			}
+			if back.Version != version || back.BootCpuidPhys != 1 || back.Padding != padding || len(back.Reserve) != 2 {
+				t.Errorf("v%d: 头部字段 = %+v", version, back)
+			}
+			uart := back.Lookup("/serial@2000")
+			if uart == nil || !bytes.Equal(uart.Property("odd").Value, []byte{1, 2, 3}) ||
+				uart.Property("wide").U64() != 0x123456789 || uart.Property("empty") == nil {
+				t.Errorf("v%d: 属性没有原样读回", version)
+			}
+			if got := back.Lookup("/cpus/cpu@0"); got == nil || got.Parent.Name != "cpus" {
+				t.Errorf("v%d: 嵌套节点没有读回", version)
+			}
+
+			again, err := back.Bytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(again, data) {
+				t.Errorf("v%d: 重新序列化的结果不同", version)
+			}
+		}
+	}
+}
+
+// TestStringReuse 属性名复用字符串块中已有名称的后缀，与 dtc 相同
+func TestStringReuse(t *testing.T) {
+	data, err := testTree().Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := ParseHeader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strs := string(data[h.OffDtStrings : h.OffDtStrings+h.SizeDtStrings])
+	if strings.Count(strs, "names\x00") != 1 {
+		t.Errorf("names 没有复用 clock-names 的后缀: %q", strs)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	be := binary.BigEndian
+	tests := []struct {
+		name string
+		edit func(d []byte, h *Header) []byte
+		want string
+	}{
+		{"数据过短", func(d []byte, h *Header) []byte { return d[:20] }, "数据过短"},
+		{"魔数无效", func(d []byte, h *Header) []byte { d[0] = 0; return d }, "FDT魔数无效"},
+		{"版本过低", func(d []byte, h *Header) []byte { be.PutUint32(d[20:], 15); return d }, "不支持的FDT版本"},
+		{
+			"总大小超出数据",
+			func(d []byte, h *Header) []byte { be.PutUint32(d[4:], uint32(len(d)+1)); return d },
+			"FDT总大小无效",
+		},
+		{
+			"内存保留区未对齐",
+			func(d []byte, h *Header) []byte { be.PutUint32(d[16:], h.OffMemRsvmap+4); return d },
+			"内存保留区偏移无效",
+		},
+		{
+			"结构块未对齐",
+			func(d []byte, h *Header) []byte { be.PutUint32(d[8:], h.OffDtStruct+2); return d },
+			"结构块偏移无效",
+		},
+		{
+			"结构块大小超出",
+			func(d []byte, h *Header) []byte { be.PutUint32(d[36:], h.TotalSize); return d },
+			"结构块超出FDT范围",
+		},
+		{
+			"字符串块偏移超出",
+			func(d []byte, h *Header) []byte { be.PutUint32(d[12:], h.TotalSize); return d },
+			"字符串块超出FDT范围",
+		},
+		{
+			"字符串块大小溢出",
+			func(d []byte, h *Header) []byte { be.PutUint32(d[32:], 0xffffffff); return d },
+			"字符串块超出FDT范围",
+		},
+		{
+			"结构块被截断",
+			func(d []byte, h *Header) []byte { be.PutUint32(d[36:], h.SizeDtStruct-4); return d },
+			"被截断",
+		},
+		{
+			"不以根节点开始",
+			func(d []byte, h *Header) []byte { be.PutUint32(d[h.OffDtStruct:], tokenProp); return d },
+			"结构块必须以根节点开始",
+		},
+		{
+			"根节点有名称",
+			func(d []byte, h *Header) []byte { d[h.OffDtStruct+4] = 'x'; return d },
+			"根节点名称必须为空",
+		},
+		{
+			"未知标记",
+			func(d []byte, h *Header) []byte { be.PutUint32(d[h.OffDtStruct+8:], 0x5); return d },
+			"未知的结构块标记 0x5",
+		},
+		{
+			// 属性长度与实际值不符时，后续标记不再对齐
+			"标记错位",
+			func(d []byte, h *Header) []byte { be.PutUint32(d[h.OffDtStruct+12:], 13); return d },
+			"未知的结构块标记",
+		},
+		{
+			"属性名偏移无效",
+			func(d []byte, h *Header) []byte { be.PutUint32(d[h.OffDtStruct+16:], h.SizeDtStrings); return d },
+			"属性名偏移无效",
+		},
+		{
+			"缺少结束标记",
+			func(d []byte, h *Header) []byte {
+				be.PutUint32(d[h.OffDtStruct+h.SizeDtStruct-4:], tokenNop)
+				return d
+			},
+			"被截断",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := testTree().Bytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			h, err := ParseHeader(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = Parse(tt.edit(data, h))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("错误 = %v, 期望包含 %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package fdt
+
+import (
+	"strings"
+)
+
+// Node 设备树节点
+type Node struct {
+	Name       string
+	Labels     []string
+	Properties []*Property
+	Children   []*Node
+	Parent     *Node
+}
+
+// Property 设备树属性
+type Property struct {
+	Name   string
+	Labels []string
+	Value  []byte
+}
+
+// Path 返回节点的完整路径
+func (n *Node) Path() string {
+	if n.Parent == nil {
+		return "/"
+	}
+	parent := n.Parent.Path()
+	if parent == "/" {
+		return "/" + n.Name
+	}
+	return parent + "/" + n.Name
+}
+
+// BaseName 返回去掉单元地址的节点名
+func (n *Node) BaseName() string {
+	name, _, _ := strings.Cut(n.Name, "@")
+	return name
+}
+
+// UnitAddress 返回节点名中的单元地址
+func (n *Node) UnitAddress() string {
+	_, addr, _ := strings.Cut(n.Name, "@")
+	return addr
+}
+
+// Property 按名称查找属性
+func (n *Node) Property(name string) *Property {
+	for _, p := range n.Properties {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// SetProperty 设置属性值，不存在时追加到末尾
+func (n *Node) SetProperty(name string, value []byte) *Property {
+	if p := n.Property(name); p != nil {
+		p.Value = value
+		return p
+	}
+	p := &Property{Name: name, Value: value}
+	n.Properties = append(n.Properties, p)
+	return p
+}
+
+// RemoveProperty 删除属性，返回是否存在
+func (n *Node) RemoveProperty(name string) bool {
+	for i, p := range n.Properties {
+		if p.Name == name {
+			n.Properties = append(n.Properties[:i], n.Properties[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Child 按名称查找子节点。名称不含单元地址时，也匹配唯一的同名带地址节点
+func (n *Node) Child(name string) *Node {
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	if strings.Contains(name, "@") {
+		return nil
+	}
+	var found *Node
+	for _, c := range n.Children {
+		if c.BaseName() == name {
+			if found != nil {
+				return nil
+			}
+			found = c
+		}
+	}
+	return found
+}
+
+// AddChild 添加子节点，同名节点已存在时返回已有节点
+func (n *Node) AddChild(name string) *Node {
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	c := &Node{Name: name, Parent: n}
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// RemoveChild 删除子节点
+func (n *Node) RemoveChild(child *Node) bool {
+	for i, c := range n.Children {
+		if c == child {
+			n.Children = append(n.Children[:i], n.Children[i+1:]...)
+			c.Parent = nil
+			return true
+		}
+	}
+	return false
+}
+
+// Walk 深度优先遍历节点，fn 返回 false 时跳过子节点
+func (n *Node) Walk(fn func(*Node) bool) {
+	if !fn(n) {
+		return
+	}
+	for _, c := range n.Children {
+		c.Walk(fn)
+	}
+}
+
+// Phandle 返回节点的 phandle，不存在时返回0
+func (n *Node) Phandle() uint32 {
+	for _, name := range []string{"phandle", "linux,phandle"} {
+		if p := n.Property(name); p != nil && len(p.Value) == 4 {
+			return p.U32()
+		}
+	}
+	return 0
+}
+
+// HasLabel 检查节点是否带有指定标签
+func (n *Node) HasLabel(label string) bool {
+	for _, l := range n.Labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup 按路径查找节点，路径也可以是 __aliases__ 中的别名开头
+func (t *Tree) Lookup(path string) *Node {
+	if path == "" {
+		return nil
+	}
+	n := t.Root
+	if !strings.HasPrefix(path, "/") {
+		alias, rest, _ := strings.Cut(path, "/")
+		aliases := t.Root.Child("aliases")
+		if aliases == nil {
+			return nil
+		}
+		p := aliases.Property(alias)
+		if p == nil {
+			return nil
+		}
+		n = t.Lookup(p.String())
+		if n == nil || rest == "" {
+			return n
+		}
+		path = rest
+	}
+
+	for _, part := range strings.Split(path, "/") {
+		if part == "" {
+			continue
+		}
+		if n = n.Child(part); n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// FindPhandle 按 phandle 查找节点
+func (t *Tree) FindPhandle(phandle uint32) *Node {
+	var found *Node
+	t.Root.Walk(func(n *Node) bool {
+		if found == nil && n.Phandle() == phandle {
+			found = n
+		}
+		return found == nil
+	})
+	return found
+}
+
+// FindLabel 按标签查找节点
+func (t *Tree) FindLabel(label string) *Node {
+	var found *Node
+	t.Root.Walk(func(n *Node) bool {
+		if found == nil && n.HasLabel(label) {
+			found = n
+		}
+		return found == nil
+	})
+	return found
+}
+
+// MaxPhandle 返回树中最大的 phandle 值
+func (t *Tree) MaxPhandle() uint32 {
+	var maxPhandle uint32
+	t.Root.Walk(func(n *Node) bool {
+		maxPhandle = max(maxPhandle, n.Phandle())
+		return true
+	})
+	return maxPhandle
+}
+
+// IsOverlay 判断设备树是否为 overlay
+func (t *Tree) IsOverlay() bool {
+	if t.Root.Child("__fixups__") != nil || t.Root.Child("__local_fixups__") != nil {
+		return true
+	}
+	for _, c := range t.Root.Children {
+		if strings.HasPrefix(c.Name, "fragment") && c.Child("__overlay__") != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Clone 深拷贝节点
+func (n *Node) Clone() *Node {
+	c := &Node{Name: n.Name, Labels: append([]string(nil), n.Labels...)}
+	for _, p := range n.Properties {
+		c.Properties = append(c.Properties, p.Clone())
+	}
+	for _, child := range n.Children {
+		cc := child.Clone()
+		cc.Parent = c
+		c.Children = append(c.Children, cc)
+	}
+	return c
+}
+
+// Clone 深拷贝设备树
+func (t *Tree) Clone() *Tree {
+	c := *t
+	c.Reserve = append([]ReserveEntry(nil), t.Reserve...)
+	c.Root = t.Root.Clone()
+	return &c
+}
+
+// Clone 深拷贝属性
+func (p *Property) Clone() *Property {
+	return &Property{
+		Name:   p.Name,
+		Labels: append([]string(nil), p.Labels...),
+		Value:  append([]byte(nil), p.Value...),
+	}
+}
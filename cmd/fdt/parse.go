@@ -0,0 +1,229 @@
+package fdt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// ParseHeader 解析并校验FDT头部
+func ParseHeader(data []byte) (*Header, error) {
+	if len(data) < headerSizeV16 {
+		return nil, fmt.Errorf("数据过短，无法包含FDT头部")
+	}
+
+	be := binary.BigEndian
+	h := &Header{
+		Magic:           be.Uint32(data[0:]),
+		TotalSize:       be.Uint32(data[4:]),
+		OffDtStruct:     be.Uint32(data[8:]),
+		OffDtStrings:    be.Uint32(data[12:]),
+		OffMemRsvmap:    be.Uint32(data[16:]),
+		Version:         be.Uint32(data[20:]),
+		LastCompVersion: be.Uint32(data[24:]),
+		BootCpuidPhys:   be.Uint32(data[28:]),
+		SizeDtStrings:   be.Uint32(data[32:]),
+	}
+
+	if h.Magic != Magic {
+		return nil, fmt.Errorf("FDT魔数无效: 0x%08X", h.Magic)
+	}
+	if h.Version < 16 || h.LastCompVersion > 17 {
+		return nil, fmt.Errorf("不支持的FDT版本: %d (兼容版本 %d)", h.Version, h.LastCompVersion)
+	}
+
+	hdrSize := uint32(headerSizeV16)
+	if h.Version >= 17 {
+		if len(data) < headerSizeV17 {
+			return nil, fmt.Errorf("数据过短，无法包含FDT头部")
+		}
+		h.SizeDtStruct = be.Uint32(data[36:])
+		hdrSize = headerSizeV17
+	}
+
+	if h.TotalSize < hdrSize || h.TotalSize > uint32(len(data)) {
+		return nil, fmt.Errorf("FDT总大小无效: %d (数据长度 %d)", h.TotalSize, len(data))
+	}
+	if h.OffMemRsvmap < hdrSize || h.OffMemRsvmap%8 != 0 || h.OffMemRsvmap >= h.TotalSize {
+		return nil, fmt.Errorf("内存保留区偏移无效: 0x%X", h.OffMemRsvmap)
+	}
+	if h.OffDtStruct < hdrSize || h.OffDtStruct%4 != 0 || h.OffDtStruct >= h.TotalSize {
+		return nil, fmt.Errorf("结构块偏移无效: 0x%X", h.OffDtStruct)
+	}
+	if h.Version >= 17 && uint64(h.OffDtStruct)+uint64(h.SizeDtStruct) > uint64(h.TotalSize) {
+		return nil, fmt.Errorf("结构块超出FDT范围")
+	}
+	if h.OffDtStrings < hdrSize || uint64(h.OffDtStrings)+uint64(h.SizeDtStrings) > uint64(h.TotalSize) {
+		return nil, fmt.Errorf("字符串块超出FDT范围")
+	}
+	return h, nil
+}
+
+// Parse 解析FDT数据为设备树
+func Parse(data []byte) (*Tree, error) {
+	h, err := ParseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	data = data[:h.TotalSize]
+
+	t := &Tree{
+		Version:       h.Version,
+		BootCpuidPhys: h.BootCpuidPhys,
+	}
+
+	if t.Reserve, err = parseReserve(data, h); err != nil {
+		return nil, err
+	}
+
+	structEnd := h.TotalSize
+	if h.Version >= 17 {
+		structEnd = h.OffDtStruct + h.SizeDtStruct
+	}
+	strs := data[h.OffDtStrings : h.OffDtStrings+h.SizeDtStrings]
+
+	p := &structParser{data: data[:structEnd], pos: int(h.OffDtStruct), strings: strs}
+	if t.Root, err = p.parse(); err != nil {
+		return nil, err
+	}
+
+	// 标准布局下记录字符串块之后的填充，以便原样写回
+	if h.OffMemRsvmap < h.OffDtStruct && h.OffDtStruct < h.OffDtStrings {
+		t.Padding = h.TotalSize - (h.OffDtStrings + h.SizeDtStrings)
+	}
+	return t, nil
+}
+
+func parseReserve(data []byte, h *Header) ([]ReserveEntry, error) {
+	var entries []ReserveEntry
+	be := binary.BigEndian
+	for pos := int(h.OffMemRsvmap); ; pos += 16 {
+		if pos+16 > len(data) {
+			return nil, fmt.Errorf("内存保留区未正确结束")
+		}
+		e := ReserveEntry{Address: be.Uint64(data[pos:]), Size: be.Uint64(data[pos+8:])}
+		if e.Address == 0 && e.Size == 0 {
+			return entries, nil
+		}
+		entries = append(entries, e)
+	}
+}
+
+type structParser struct {
+	data    []byte
+	pos     int
+	strings []byte
+}
+
+func (p *structParser) token() (uint32, error) {
+	if p.pos+4 > len(p.data) {
+		return 0, fmt.Errorf("结构块在偏移 0x%X 处被截断", p.pos)
+	}
+	tok := binary.BigEndian.Uint32(p.data[p.pos:])
+	p.pos += 4
+	return tok, nil
+}
+
+func (p *structParser) align() {
+	p.pos = (p.pos + 3) &^ 3
+}
+
+func (p *structParser) parse() (*Node, error) {
+	tok, err := p.nextToken()
+	if err != nil {
+		return nil, err
+	}
+	if tok != tokenBeginNode {
+		return nil, fmt.Errorf("结构块必须以根节点开始")
+	}
+
+	root, err := p.parseNode(nil)
+	if err != nil {
+		return nil, err
+	}
+	if root.Name != "" {
+		return nil, fmt.Errorf("根节点名称必须为空: %q", root.Name)
+	}
+
+	if tok, err = p.nextToken(); err != nil {
+		return nil, err
+	}
+	if tok != tokenEnd {
+		return nil, fmt.Errorf("根节点之后缺少结束标记 (0x%X)", tok)
+	}
+	return root, nil
+}
+
+// nextToken 读取下一个非NOP标记
+func (p *structParser) nextToken() (uint32, error) {
+	for {
+		tok, err := p.token()
+		if err != nil || tok != tokenNop {
+			return tok, err
+		}
+	}
+}
+
+// parseNode 在读取 FDT_BEGIN_NODE 之后解析节点
+func (p *structParser) parseNode(parent *Node) (*Node, error) {
+	nameEnd := bytes.IndexByte(p.data[p.pos:], 0)
+	if nameEnd < 0 {
+		return nil, fmt.Errorf("节点名称未结束 (偏移 0x%X)", p.pos)
+	}
+	n := &Node{Name: string(p.data[p.pos : p.pos+nameEnd]), Parent: parent}
+	p.pos += nameEnd + 1
+	p.align()
+
+	for {
+		tok, err := p.nextToken()
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok {
+		case tokenProp:
+			if p.pos+8 > len(p.data) {
+				return nil, fmt.Errorf("属性头部被截断 (偏移 0x%X)", p.pos)
+			}
+			length := int(binary.BigEndian.Uint32(p.data[p.pos:]))
+			nameOff := int(binary.BigEndian.Uint32(p.data[p.pos+4:]))
+			p.pos += 8
+			if length < 0 || p.pos+length > len(p.data) {
+				return nil, fmt.Errorf("属性值超出结构块 (偏移 0x%X)", p.pos)
+			}
+			name, err := p.stringAt(nameOff)
+			if err != nil {
+				return nil, err
+			}
+			value := make([]byte, length)
+			copy(value, p.data[p.pos:p.pos+length])
+			p.pos += length
+			p.align()
+			n.Properties = append(n.Properties, &Property{Name: name, Value: value})
+
+		case tokenBeginNode:
+			child, err := p.parseNode(n)
+			if err != nil {
+				return nil, err
+			}
+			n.Children = append(n.Children, child)
+
+		case tokenEndNode:
+			return n, nil
+
+		default:
+			return nil, fmt.Errorf("未知的结构块标记 0x%X (偏移 0x%X)", tok, p.pos-4)
+		}
+	}
+}
+
+func (p *structParser) stringAt(off int) (string, error) {
+	if off < 0 || off >= len(p.strings) {
+		return "", fmt.Errorf("属性名偏移无效: %d", off)
+	}
+	end := bytes.IndexByte(p.strings[off:], 0)
+	if end < 0 {
+		return "", fmt.Errorf("属性名未结束 (偏移 %d)", off)
+	}
+	return string(p.strings[off : off+end]), nil
+}
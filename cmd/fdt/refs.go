@@ -0,0 +1,323 @@
+package fdt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PhandleRef 属性值中的一个 phandle 引用
+type PhandleRef struct {
+	Offset int    // 在属性值中的字节偏移
+	Target *Node  // 引用的节点，未解析时为 nil
+	Label  string // 来自 __fixups__ 的外部标签
+}
+
+// 值全部为 phandle 的属性
+var phandleListProps = map[string]bool{
+	"interrupt-parent":    true,
+	"memory-region":       true,
+	"next-level-cache":    true,
+	"operating-points-v2": true,
+	"cpu-idle-states":     true,
+	"nvmem-cells":         true,
+	"remote-endpoint":     true,
+	"phy-handle":          true,
+	"cpu":                 true,
+	"cpus":                true,
+	"power-domain":        true,
+}
+
+// 由 "phandle + 参数单元" 组成的属性及其单元数属性
+var specifierProps = map[string]string{
+	"clocks":                 "#clock-cells",
+	"assigned-clocks":        "#clock-cells",
+	"assigned-clock-parents": "#clock-cells",
+	"resets":                 "#reset-cells",
+	"power-domains":          "#power-domain-cells",
+	"dmas":                   "#dma-cells",
+	"iommus":                 "#iommu-cells",
+	"mboxes":                 "#mbox-cells",
+	"phys":                   "#phy-cells",
+	"interconnects":          "#interconnect-cells",
+	"io-channels":            "#io-channel-cells",
+	"pwms":                   "#pwm-cells",
+	"thermal-sensors":        "#thermal-sensor-cells",
+	"cooling-device":         "#cooling-cells",
+	"hwlocks":                "#hwlock-cells",
+	"sound-dai":              "#sound-dai-cells",
+	"interrupts-extended":    "#interrupt-cells",
+	"msi-parent":             "#msi-cells",
+	"gpios":                  "#gpio-cells",
+	"gpio":                   "#gpio-cells",
+}
+
+// Refs 设备树中的 phandle 引用解析器
+type Refs struct {
+	tree     *Tree
+	phandles map[uint32]*Node
+	overlay  bool
+	fixups   map[string][]PhandleRef // "路径:属性" -> 外部引用
+	local    map[string][]int        // "路径:属性" -> 内部引用偏移
+}
+
+// NewRefs 为设备树建立 phandle 索引。overlay 使用 __fixups__ 和
+// __local_fixups__ 精确定位引用，其他设备树按常见绑定推断
+func NewRefs(t *Tree) *Refs {
+	r := &Refs{
+		tree:     t,
+		phandles: make(map[uint32]*Node),
+		fixups:   make(map[string][]PhandleRef),
+		local:    make(map[string][]int),
+	}
+	t.Root.Walk(func(n *Node) bool {
+		if ph := n.Phandle(); ph != 0 {
+			r.phandles[ph] = n
+		}
+		return true
+	})
+
+	if fixups := t.Root.Child("__fixups__"); fixups != nil {
+		r.overlay = true
+		for _, p := range fixups.Properties {
+			for _, entry := range p.Strings() {
+				path, prop, off, err := ParseFixup(entry)
+				if err == nil {
+					key := path + ":" + prop
+					r.fixups[key] = append(r.fixups[key], PhandleRef{Offset: off, Label: p.Name})
+				}
+			}
+		}
+	}
+	if local := t.Root.Child("__local_fixups__"); local != nil {
+		r.overlay = true
+		r.collectLocal(local, "")
+	}
+	return r
+}
+
+func (r *Refs) collectLocal(n *Node, path string) {
+	for _, p := range n.Properties {
+		key := path + ":" + p.Name
+		if path == "" {
+			key = "/:" + p.Name
+		}
+		for _, off := range p.U32s() {
+			r.local[key] = append(r.local[key], int(off))
+		}
+	}
+	for _, c := range n.Children {
+		r.collectLocal(c, path+"/"+c.Name)
+	}
+}
+
+// ParseFixup 解析 "路径:属性:偏移" 格式的 __fixups__ 条目。属性名可以包含冒号，
+// 路径取第一个冒号之前的部分，偏移取最后一个冒号之后的部分
+func ParseFixup(entry string) (path, prop string, offset int, err error) {
+	i := strings.LastIndexByte(entry, ':')
+	if i < 0 {
+		return "", "", 0, fmt.Errorf("无效的修正条目 %q", entry)
+	}
+	path, prop, ok := strings.Cut(entry[:i], ":")
+	if !ok || path == "" || prop == "" {
+		return "", "", 0, fmt.Errorf("无效的修正条目 %q", entry)
+	}
+	offset, err = strconv.Atoi(entry[i+1:])
+	if err != nil || offset < 0 {
+		return "", "", 0, fmt.Errorf("无效的修正偏移 %q", entry)
+	}
+	return path, prop, offset, nil
+}
+
+// Node 按 phandle 查找节点
+func (r *Refs) Node(phandle uint32) *Node {
+	return r.phandles[phandle]
+}
+
+// IsOverlay 返回引用信息是否来自 overlay 的修正表
+func (r *Refs) IsOverlay() bool {
+	return r.overlay
+}
+
+// Find 返回属性中的所有 phandle 引用，按偏移排序
+func (r *Refs) Find(n *Node, p *Property) []PhandleRef {
+	if r.overlay {
+		return r.findOverlay(n, p)
+	}
+
+	cells := p.U32s()
+	if len(p.Value)%4 != 0 || len(cells) == 0 {
+		return nil
+	}
+
+	switch {
+	case phandleListProps[p.Name] || isPhandleListName(p.Name):
+		var refs []PhandleRef
+		for i, c := range cells {
+			target := r.phandles[c]
+			if target == nil {
+				return nil
+			}
+			refs = append(refs, PhandleRef{Offset: i * 4, Target: target})
+		}
+		return refs
+
+	case specifierProps[p.Name] != "":
+		return r.findSpecifiers(cells, specifierProps[p.Name])
+
+	case strings.HasSuffix(p.Name, "-gpios") || strings.HasSuffix(p.Name, "-gpio"):
+		return r.findSpecifiers(cells, "#gpio-cells")
+	}
+	return nil
+}
+
+func isPhandleListName(name string) bool {
+	if rest, ok := strings.CutPrefix(name, "pinctrl-"); ok {
+		_, err := strconv.Atoi(rest)
+		return err == nil
+	}
+	return strings.HasSuffix(name, "-supply")
+}
+
+// findSpecifiers 解析 <&provider args...> 列表，无法完整解析时返回 nil
+func (r *Refs) findSpecifiers(cells []uint32, cellsProp string) []PhandleRef {
+	var refs []PhandleRef
+	for i := 0; i < len(cells); {
+		// 0 表示占位的空条目
+		if cells[i] == 0 {
+			i++
+			continue
+		}
+		target := r.phandles[cells[i]]
+		if target == nil {
+			return nil
+		}
+		n := 0
+		if cp := target.Property(cellsProp); cp != nil {
+			n = int(cp.U32())
+		} else if cellsProp != "#msi-cells" {
+			return nil
+		}
+		refs = append(refs, PhandleRef{Offset: i * 4, Target: target})
+		i += 1 + n
+		if i > len(cells) {
+			return nil
+		}
+	}
+	return refs
+}
+
+func (r *Refs) findOverlay(n *Node, p *Property) []PhandleRef {
+	key := n.Path() + ":" + p.Name
+	var refs []PhandleRef
+	for _, ref := range r.fixups[key] {
+		if ref.Offset+4 <= len(p.Value) {
+			refs = append(refs, ref)
+		}
+	}
+	for _, off := range r.local[key] {
+		if off+4 > len(p.Value) {
+			continue
+		}
+		ph := binary.BigEndian.Uint32(p.Value[off:])
+		refs = append(refs, PhandleRef{Offset: off, Target: r.phandles[ph]})
+	}
+
+	sort.SliceStable(refs, func(i, j int) bool {
+		return refs[i].Offset < refs[j].Offset
+	})
+	return refs
+}
+
+// Dangling 返回属性中指向不存在节点的 phandle 的偏移。overlay 只检查
+// __local_fixups__ 记录的内部引用，外部引用在应用时才能解析
+func (r *Refs) Dangling(n *Node, p *Property) []int {
+	if r.overlay {
+		var offsets []int
+		for _, off := range r.local[n.Path()+":"+p.Name] {
+			if off+4 > len(p.Value) || r.phandles[binary.BigEndian.Uint32(p.Value[off:])] == nil {
+				offsets = append(offsets, off)
+			}
+		}
+		return offsets
+	}
+
+	cells := p.U32s()
+	if len(p.Value)%4 != 0 || len(cells) == 0 {
+		return nil
+	}
+
+	cellsProp := specifierProps[p.Name]
+	if strings.HasSuffix(p.Name, "-gpios") || strings.HasSuffix(p.Name, "-gpio") {
+		cellsProp = "#gpio-cells"
+	}
+	switch {
+	case phandleListProps[p.Name] || isPhandleListName(p.Name):
+		var offsets []int
+		for i, c := range cells {
+			if c != 0 && r.phandles[c] == nil {
+				offsets = append(offsets, i*4)
+			}
+		}
+		return offsets
+
+	case cellsProp != "":
+		for i := 0; i < len(cells); {
+			if cells[i] == 0 {
+				i++
+				continue
+			}
+			target := r.phandles[cells[i]]
+			if target == nil {
+				// 无法确定参数单元数，只报告第一个无效引用
+				return []int{i * 4}
+			}
+			cp := target.Property(cellsProp)
+			if cp == nil {
+				return nil
+			}
+			i += 1 + int(cp.U32())
+		}
+	}
+	return nil
+}
+
+// 按绑定确定不含 phandle 的数值属性，不作为可能的引用报告
+var plainCellProps = map[string]bool{
+	"phandle":         true,
+	"linux,phandle":   true,
+	"reg":             true,
+	"ranges":          true,
+	"dma-ranges":      true,
+	"bus-range":       true,
+	"interrupts":      true,
+	"clock-frequency": true,
+	"cell-index":      true,
+	"bus-width":       true,
+	"reg-shift":       true,
+	"reg-io-width":    true,
+}
+
+// Possible 返回未被识别为引用的属性中数值等于某个已有 phandle 的单元，
+// 这些单元可能是自定义属性中的引用，也可能只是恰好相等的数值。
+// overlay 的修正表是精确的，不报告可能的引用
+func (r *Refs) Possible(n *Node, p *Property) []PhandleRef {
+	if r.overlay || plainCellProps[p.Name] || strings.HasPrefix(p.Name, "#") {
+		return nil
+	}
+	if len(p.Value) == 0 || len(p.Value)%4 != 0 || p.IsStringList() {
+		return nil
+	}
+	if len(r.Find(n, p)) > 0 {
+		return nil
+	}
+	var refs []PhandleRef
+	for i, c := range p.U32s() {
+		if target := r.phandles[c]; target != nil && c != 0xffffffff {
+			refs = append(refs, PhandleRef{Offset: i * 4, Target: target})
+		}
+	}
+	return refs
+}
@@ -0,0 +1,112 @@
+package fdt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+)
+
+// U32 返回属性的第一个32位值
+func (p *Property) U32() uint32 {
+	if len(p.Value) < 4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(p.Value)
+}
+
+// U64 返回属性的64位值
+func (p *Property) U64() uint64 {
+	if len(p.Value) < 8 {
+		return uint64(p.U32())
+	}
+	return binary.BigEndian.Uint64(p.Value)
+}
+
+// U32s 将属性解析为32位单元数组
+func (p *Property) U32s() []uint32 {
+	cells := make([]uint32, len(p.Value)/4)
+	for i := range cells {
+		cells[i] = binary.BigEndian.Uint32(p.Value[i*4:])
+	}
+	return cells
+}
+
+// String 返回属性的第一个字符串
+func (p *Property) String() string {
+	s, _, _ := strings.Cut(string(p.Value), "\x00")
+	return s
+}
+
+// Strings 将属性解析为字符串列表
+func (p *Property) Strings() []string {
+	v := bytes.TrimSuffix(p.Value, []byte{0})
+	if len(v) == 0 && len(p.Value) == 0 {
+		return nil
+	}
+	return strings.Split(string(v), "\x00")
+}
+
+// IsStringList 判断属性值是否为可打印的字符串列表
+func (p *Property) IsStringList() bool {
+	return IsStringList(p.Value)
+}
+
+// IsStringList 判断数据是否为以NUL结尾的可打印字符串列表
+func IsStringList(v []byte) bool {
+	if len(v) == 0 || v[len(v)-1] != 0 {
+		return false
+	}
+	start := 0
+	for i, c := range v {
+		if c == 0 {
+			// 不允许空字符串
+			if i == start {
+				return false
+			}
+			start = i + 1
+			continue
+		}
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' || c >= 0x7F {
+			return false
+		}
+	}
+	return true
+}
+
+// U32Value 编码单个32位值
+func U32Value(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+// U64Value 编码单个64位值
+func U64Value(v uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, v)
+}
+
+// CellsValue 编码32位单元数组
+func CellsValue(cells ...uint32) []byte {
+	out := make([]byte, 0, len(cells)*4)
+	for _, c := range cells {
+		out = binary.BigEndian.AppendUint32(out, c)
+	}
+	return out
+}
+
+// StringValue 编码字符串列表
+func StringValue(strs ...string) []byte {
+	var out []byte
+	for _, s := range strs {
+		out = append(out, s...)
+		out = append(out, 0)
+	}
+	return out
+}
+
+// ReadCells 从单元数组中读取 n 个单元组成的数值
+func ReadCells(cells []uint32, n int) uint64 {
+	var v uint64
+	for i := 0; i < n && i < len(cells); i++ {
+		v = v<<32 | uint64(cells[i])
+	}
+	return v
+}
@@ -0,0 +1,69 @@
+package fdt
+
+import (
+	"fmt"
+)
+
+// block FDT 中的一个数据块
+type block struct {
+	name       string
+	start, end uint32
+}
+
+// CheckLayout 校验FDT头部与各数据块的一致性。头部或结构块无法解析时
+// 返回错误，不影响使用但不规范的布局作为警告返回
+func CheckLayout(data []byte) ([]string, error) {
+	h, err := ParseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+	if extra := len(data) - int(h.TotalSize); extra > 0 {
+		warnings = append(warnings, fmt.Sprintf("FDT之后有 %d 字节多余数据", extra))
+	}
+
+	reserve, err := parseReserve(data[:h.TotalSize], h)
+	if err != nil {
+		return nil, err
+	}
+	rsvEnd := h.OffMemRsvmap + uint32(len(reserve)+1)*16
+
+	// 解析结构块，得到实际使用的长度
+	structEnd := h.TotalSize
+	if h.Version >= 17 {
+		structEnd = h.OffDtStruct + h.SizeDtStruct
+	}
+	strs := data[h.OffDtStrings : h.OffDtStrings+h.SizeDtStrings]
+	p := &structParser{data: data[:structEnd], pos: int(h.OffDtStruct), strings: strs}
+	if _, err := p.parse(); err != nil {
+		return nil, err
+	}
+	used := uint32(p.pos)
+	if h.Version >= 17 && used != structEnd {
+		warnings = append(warnings, fmt.Sprintf("结构块大小 %d 与实际使用的 %d 字节不一致", h.SizeDtStruct, used-h.OffDtStruct))
+	}
+
+	blocks := []block{
+		{"头部", 0, headerSizeV16},
+		{"内存保留区", h.OffMemRsvmap, rsvEnd},
+		{"结构块", h.OffDtStruct, used},
+		{"字符串块", h.OffDtStrings, h.OffDtStrings + h.SizeDtStrings},
+	}
+	if h.Version >= 17 {
+		blocks[0].end = headerSizeV17
+	}
+	for i := range blocks {
+		for j := i + 1; j < len(blocks); j++ {
+			a, b := blocks[i], blocks[j]
+			if a.start < b.end && b.start < a.end {
+				return nil, fmt.Errorf("%s (0x%X-0x%X) 与%s (0x%X-0x%X) 重叠", a.name, a.start, a.end, b.name, b.start, b.end)
+			}
+		}
+	}
+
+	if h.SizeDtStrings > 0 && strs[len(strs)-1] != 0 {
+		warnings = append(warnings, "字符串块没有以 NUL 结束")
+	}
+	return warnings, nil
+}
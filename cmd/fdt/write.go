@@ -0,0 +1,147 @@
+package fdt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Bytes 将设备树序列化为FDT数据，布局与 dtc 输出一致
+func (t *Tree) Bytes() ([]byte, error) {
+	return t.serialize(&structWriter{}, t.Padding)
+}
+
+// CompactBytes 将设备树序列化为尽量小的FDT数据: 属性名按长度从长到短预先
+// 写入字符串块，使较短的名称复用较长名称的后缀，并且不保留填充
+func (t *Tree) CompactBytes() ([]byte, error) {
+	if t.Root == nil {
+		return nil, fmt.Errorf("设备树缺少根节点")
+	}
+	seen := make(map[string]bool)
+	var names []string
+	t.Root.Walk(func(n *Node) bool {
+		for _, p := range n.Properties {
+			if !seen[p.Name] {
+				seen[p.Name] = true
+				names = append(names, p.Name)
+			}
+		}
+		return true
+	})
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) > len(names[j])
+		}
+		return names[i] < names[j]
+	})
+
+	w := &structWriter{}
+	for _, name := range names {
+		w.stringOffset(name)
+	}
+	return t.serialize(w, 0)
+}
+
+func (t *Tree) serialize(w *structWriter, padding uint32) ([]byte, error) {
+	if t.Root == nil {
+		return nil, fmt.Errorf("设备树缺少根节点")
+	}
+
+	version := t.Version
+	if version == 0 {
+		version = DefaultVersion
+	}
+	if version != 16 && version != 17 {
+		return nil, fmt.Errorf("不支持写出FDT版本 %d", version)
+	}
+
+	w.writeNode(t.Root)
+	w.u32(tokenEnd)
+
+	hdrSize := uint32(headerSizeV17)
+	if version < 17 {
+		hdrSize = headerSizeV16
+	}
+
+	rsvOff := (hdrSize + 7) &^ 7
+	rsvSize := uint32(len(t.Reserve)+1) * 16
+	structOff := rsvOff + rsvSize
+	structSize := uint32(w.structs.Len())
+	stringsOff := structOff + structSize
+	stringsSize := uint32(w.strings.Len())
+	totalSize := stringsOff + stringsSize + padding
+
+	out := make([]byte, 0, totalSize)
+	be := binary.BigEndian
+	out = be.AppendUint32(out, Magic)
+	out = be.AppendUint32(out, totalSize)
+	out = be.AppendUint32(out, structOff)
+	out = be.AppendUint32(out, stringsOff)
+	out = be.AppendUint32(out, rsvOff)
+	out = be.AppendUint32(out, version)
+	out = be.AppendUint32(out, LastCompVersion)
+	out = be.AppendUint32(out, t.BootCpuidPhys)
+	out = be.AppendUint32(out, stringsSize)
+	if version >= 17 {
+		out = be.AppendUint32(out, structSize)
+	}
+	out = append(out, make([]byte, rsvOff-hdrSize)...)
+
+	for _, e := range t.Reserve {
+		out = be.AppendUint64(out, e.Address)
+		out = be.AppendUint64(out, e.Size)
+	}
+	out = append(out, make([]byte, 16)...)
+
+	out = append(out, w.structs.Bytes()...)
+	out = append(out, w.strings.Bytes()...)
+	out = append(out, make([]byte, padding)...)
+	return out, nil
+}
+
+type structWriter struct {
+	structs bytes.Buffer
+	strings bytes.Buffer
+}
+
+func (w *structWriter) u32(v uint32) {
+	w.structs.Write(binary.BigEndian.AppendUint32(nil, v))
+}
+
+func (w *structWriter) pad() {
+	for w.structs.Len()%4 != 0 {
+		w.structs.WriteByte(0)
+	}
+}
+
+func (w *structWriter) writeNode(n *Node) {
+	w.u32(tokenBeginNode)
+	w.structs.WriteString(n.Name)
+	w.structs.WriteByte(0)
+	w.pad()
+
+	for _, p := range n.Properties {
+		w.u32(tokenProp)
+		w.u32(uint32(len(p.Value)))
+		w.u32(w.stringOffset(p.Name))
+		w.structs.Write(p.Value)
+		w.pad()
+	}
+
+	for _, c := range n.Children {
+		w.writeNode(c)
+	}
+	w.u32(tokenEndNode)
+}
+
+// stringOffset 与 dtc 相同，在已有字符串(包括其后缀)中查找可复用的位置
+func (w *structWriter) stringOffset(name string) uint32 {
+	needle := append([]byte(name), 0)
+	if i := bytes.Index(w.strings.Bytes(), needle); i >= 0 {
+		return uint32(i)
+	}
+	off := w.strings.Len()
+	w.strings.Write(needle)
+	return uint32(off)
+}
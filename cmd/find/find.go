@@ -0,0 +1,102 @@
+package find
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/dts"
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+	"github.com/kiy7086/dtbotool/cmd/input"
+	"github.com/kiy7086/dtbotool/cmd/prop"
+	"github.com/kiy7086/dtbotool/cmd/query"
+)
+
+// Result 一个匹配的节点
+type Result struct {
+	Entry      string         `json:"entry"`
+	Index      int            `json:"index"`
+	Path       string         `json:"path"`
+	Properties map[string]any `json:"properties,omitempty"`
+}
+
+// HandleFind 在所有输入文件的每个设备树中查找匹配选择器的节点
+func HandleFind(selector string, specs []string, jsonOutput bool) error {
+	sel, err := query.Parse(selector)
+	if err != nil {
+		return fmt.Errorf("选择器无效: %v", err)
+	}
+
+	results := []Result{}
+	for _, spec := range specs {
+		items, err := input.Load(spec)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			for _, n := range sel.Match(item.Tree) {
+				results = append(results, newResult(&item, n, sel.Props()))
+			}
+		}
+	}
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+
+	for _, r := range results {
+		fmt.Printf("%s  %s\n", r.Entry, r.Path)
+		for _, name := range sel.Props() {
+			if v, ok := r.Properties[name]; ok {
+				fmt.Printf("    %s = %s\n", name, formatText(v))
+			}
+		}
+	}
+	fmt.Printf("共找到 %d 个节点\n", len(results))
+	return nil
+}
+
+func newResult(item *input.Item, n *fdt.Node, props []string) Result {
+	r := Result{Entry: item.Name, Index: item.Index, Path: n.Path()}
+	for _, name := range props {
+		p := n.Property(name)
+		if p == nil {
+			continue
+		}
+		if r.Properties == nil {
+			r.Properties = make(map[string]any)
+		}
+		r.Properties[name] = value(p)
+	}
+	return r
+}
+
+// value 字符串列表返回 []string，其他类型返回格式化后的文本
+func value(p *fdt.Property) any {
+	if p.IsStringList() {
+		return p.Strings()
+	}
+	text, err := prop.Format(p, prop.Auto)
+	if err != nil {
+		text, _ = prop.Format(p, prop.Bytes)
+	}
+	return text
+}
+
+func formatText(v any) string {
+	strs, ok := v.([]string)
+	if !ok {
+		if v.(string) == "" {
+			return "(空)"
+		}
+		return v.(string)
+	}
+	quoted := make([]string, len(strs))
+	for i, s := range strs {
+		quoted[i] = dts.QuoteString(append([]byte(s), 0))
+	}
+	return strings.Join(quoted, ", ")
+}
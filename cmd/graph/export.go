@@ -0,0 +1,172 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// Options 导出选项
+type Options struct {
+	Name      string // 图的名称，通常为输入文件名
+	Hierarchy bool   // 同时导出节点的父子关系
+}
+
+// nodes 返回需要导出的节点: 导出层级时为所有节点，否则为引用关系中出现的
+// 节点和所有带 phandle 的节点
+func (g *Graph) nodes(hierarchy bool) []*fdt.Node {
+	used := make(map[*fdt.Node]bool)
+	for _, e := range g.Edges {
+		used[e.From] = true
+	}
+	var nodes []*fdt.Node
+	walk(g.Tree, func(n *fdt.Node) {
+		if hierarchy || used[n] || n.Phandle() != 0 {
+			nodes = append(nodes, n)
+		}
+	})
+	return nodes
+}
+
+// nodeID 节点在导出结果中的标识，外部标签使用 &label
+func nodeID(e Edge) string {
+	if e.To == nil {
+		return "&" + e.Label
+	}
+	return e.To.Path()
+}
+
+// WriteDot 以 Graphviz DOT 格式输出引用关系图。箭头从引用方指向被引用的
+// 节点，可能的引用以点线表示，未被引用的 phandle 节点以红色填充，
+// overlay 的外部标签以虚线椭圆表示
+func WriteDot(w io.Writer, g *Graph, opts Options) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(opts.Name))
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tnode [shape=box, fontname=\"monospace\"];\n")
+
+	nodes := g.nodes(opts.Hierarchy)
+	for _, n := range nodes {
+		label := n.Path()
+		if l := g.Label(n); l != "" {
+			label += "\n&" + l
+		}
+		attrs := "label=" + dotQuote(label)
+		if g.Unreferenced(n) {
+			attrs += ", style=filled, fillcolor=\"#f4cccc\""
+		}
+		fmt.Fprintf(&b, "\t%s [%s];\n", dotQuote(n.Path()), attrs)
+	}
+	for _, label := range g.ExternalLabels() {
+		fmt.Fprintf(&b, "\t%s [shape=ellipse, style=dashed];\n", dotQuote("&"+label))
+	}
+
+	if opts.Hierarchy {
+		for _, n := range nodes {
+			if n.Parent != nil {
+				fmt.Fprintf(&b, "\t%s -> %s [style=dashed, color=gray, arrowhead=none];\n",
+					dotQuote(n.Parent.Path()), dotQuote(n.Path()))
+			}
+		}
+	}
+
+	// 同一属性对同一节点的多次引用只画一条边
+	seen := make(map[string]bool)
+	for _, e := range g.Edges {
+		from, to := e.From.Path(), nodeID(e)
+		key := from + "\x00" + to + "\x00" + e.Property
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if e.Possible {
+			fmt.Fprintf(&b, "\t%s -> %s [label=%s, style=dotted];\n", dotQuote(from), dotQuote(to), dotQuote(e.Property+"?"))
+		} else {
+			fmt.Fprintf(&b, "\t%s -> %s [label=%s];\n", dotQuote(from), dotQuote(to), dotQuote(e.Property))
+		}
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+// JSONNode 导出的节点
+type JSONNode struct {
+	Path         string `json:"path"`
+	Label        string `json:"label,omitempty"`
+	Phandle      uint32 `json:"phandle,omitempty"`
+	References   int    `json:"references"`
+	Possible     int    `json:"possible_references,omitempty"`
+	Unreferenced bool   `json:"unreferenced,omitempty"`
+	External     bool   `json:"external,omitempty"`
+}
+
+// JSONEdge 导出的一个 phandle 引用
+type JSONEdge struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Property string `json:"property"`
+	Offset   int    `json:"offset"`
+	Possible bool   `json:"possible,omitempty"`
+}
+
+// JSONLink 导出的父子关系
+type JSONLink struct {
+	Parent string `json:"parent"`
+	Child  string `json:"child"`
+}
+
+// JSONGraph 导出的引用关系图
+type JSONGraph struct {
+	Name      string     `json:"name"`
+	Nodes     []JSONNode `json:"nodes"`
+	Edges     []JSONEdge `json:"edges"`
+	Hierarchy []JSONLink `json:"hierarchy,omitempty"`
+}
+
+// WriteJSON 以 JSON 格式输出引用关系图
+func WriteJSON(w io.Writer, g *Graph, opts Options) error {
+	doc := JSONGraph{Name: opts.Name, Nodes: []JSONNode{}, Edges: []JSONEdge{}}
+
+	nodes := g.nodes(opts.Hierarchy)
+	for _, n := range nodes {
+		doc.Nodes = append(doc.Nodes, JSONNode{
+			Path:         n.Path(),
+			Label:        g.Label(n),
+			Phandle:      n.Phandle(),
+			References:   len(g.Referrers(n)),
+			Possible:     len(g.PossibleReferrers(n)),
+			Unreferenced: g.Unreferenced(n),
+		})
+		if opts.Hierarchy && n.Parent != nil {
+			doc.Hierarchy = append(doc.Hierarchy, JSONLink{Parent: n.Parent.Path(), Child: n.Path()})
+		}
+	}
+	for _, label := range g.ExternalLabels() {
+		doc.Nodes = append(doc.Nodes, JSONNode{
+			Path:       "&" + label,
+			Label:      label,
+			References: len(g.External(label)),
+			External:   true,
+		})
+	}
+	for _, e := range g.Edges {
+		doc.Edges = append(doc.Edges, JSONEdge{From: e.From.Path(), To: nodeID(e), Property: e.Property, Offset: e.Offset, Possible: e.Possible})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(doc)
+}
@@ -0,0 +1,153 @@
+// Package graph 建立设备树中的 phandle 引用关系图，用于查询节点被哪些
+// 属性引用，以及导出为 Graphviz DOT 或 JSON
+package graph
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/decode"
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// Edge 属性中的一个 phandle 引用
+type Edge struct {
+	From     *fdt.Node
+	Property string
+	Offset   int       // 在属性值中的字节偏移
+	To       *fdt.Node // overlay 的外部引用为 nil
+	Label    string    // 外部引用的标签，来自 __fixups__
+	Possible bool      // 无法识别的属性中等于 phandle 的数值，可能是引用
+}
+
+// Graph 设备树的引用关系图
+type Graph struct {
+	Tree  *fdt.Tree
+	Edges []Edge
+
+	decoder  *decode.Decoder
+	incoming map[*fdt.Node][]Edge
+	possible map[*fdt.Node][]Edge
+	external map[string][]Edge
+}
+
+// Build 收集设备树中所有可以识别的 phandle 引用，__symbols__ 等特殊节点除外。
+// 无法识别的属性中等于某个 phandle 的数值作为可能的引用收集
+func Build(t *fdt.Tree) *Graph {
+	g := &Graph{
+		Tree:     t,
+		decoder:  decode.New(t),
+		incoming: make(map[*fdt.Node][]Edge),
+		possible: make(map[*fdt.Node][]Edge),
+		external: make(map[string][]Edge),
+	}
+	refs := fdt.NewRefs(t)
+	walk(t, func(n *fdt.Node) {
+		for _, p := range n.Properties {
+			for _, ref := range refs.Find(n, p) {
+				if ref.Target == nil && ref.Label == "" {
+					continue
+				}
+				e := Edge{From: n, Property: p.Name, Offset: ref.Offset, To: ref.Target, Label: ref.Label}
+				g.Edges = append(g.Edges, e)
+				if e.To != nil {
+					g.incoming[e.To] = append(g.incoming[e.To], e)
+				} else {
+					g.external[e.Label] = append(g.external[e.Label], e)
+				}
+			}
+			for _, ref := range refs.Possible(n, p) {
+				e := Edge{From: n, Property: p.Name, Offset: ref.Offset, To: ref.Target, Possible: true}
+				g.Edges = append(g.Edges, e)
+				g.possible[e.To] = append(g.possible[e.To], e)
+			}
+		}
+	})
+	return g
+}
+
+// 根节点下由编译器生成的节点，不属于设备树的内容
+var specialNodes = map[string]bool{
+	"__symbols__":      true,
+	"__fixups__":       true,
+	"__local_fixups__": true,
+}
+
+// walk 按树的顺序遍历节点，跳过根节点下的 __symbols__、__fixups__ 和 __local_fixups__
+func walk(t *fdt.Tree, fn func(n *fdt.Node)) {
+	t.Root.Walk(func(n *fdt.Node) bool {
+		if n.Parent != nil && n.Parent.Parent == nil && specialNodes[n.Name] {
+			return false
+		}
+		fn(n)
+		return true
+	})
+}
+
+// Referrers 返回引用节点的所有属性
+func (g *Graph) Referrers(n *fdt.Node) []Edge {
+	return g.incoming[n]
+}
+
+// PossibleReferrers 返回无法识别、但其中的数值等于节点 phandle 的属性
+func (g *Graph) PossibleReferrers(n *fdt.Node) []Edge {
+	return g.possible[n]
+}
+
+// External 返回 overlay 中引用外部标签的所有属性
+func (g *Graph) External(label string) []Edge {
+	return g.external[label]
+}
+
+// ExternalLabels 返回 overlay 引用的所有外部标签，按名称排序
+func (g *Graph) ExternalLabels() []string {
+	labels := make([]string, 0, len(g.external))
+	for label := range g.external {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// Targets 返回所有带 phandle 的节点，按树的顺序排列
+func (g *Graph) Targets() []*fdt.Node {
+	var nodes []*fdt.Node
+	walk(g.Tree, func(n *fdt.Node) {
+		if n.Phandle() != 0 {
+			nodes = append(nodes, n)
+		}
+	})
+	return nodes
+}
+
+// Unreferenced 判断带 phandle 的节点是否没有被树中的任何属性引用，
+// 存在可能的引用时不认为未被引用
+func (g *Graph) Unreferenced(n *fdt.Node) bool {
+	return n.Phandle() != 0 && len(g.incoming[n]) == 0 && len(g.possible[n]) == 0
+}
+
+// Label 返回节点的标签，没有标签时返回空字符串
+func (g *Graph) Label(n *fdt.Node) string {
+	return g.decoder.Label(n)
+}
+
+// Lookup 按路径或标签查找节点。标签可以写为 label、&label，路径可以写为
+// /path 或 &{/path}
+func Lookup(t *fdt.Tree, spec string) *fdt.Node {
+	if path, ok := strings.CutPrefix(spec, "&{"); ok {
+		return t.Lookup(strings.TrimSuffix(path, "}"))
+	}
+	if strings.HasPrefix(spec, "/") {
+		return t.Lookup(spec)
+	}
+	label := strings.TrimPrefix(spec, "&")
+	if n := t.FindLabel(label); n != nil {
+		return n
+	}
+	if symbols := t.Root.Child("__symbols__"); symbols != nil {
+		if p := symbols.Property(label); p != nil {
+			return t.Lookup(p.String())
+		}
+	}
+	return nil
+}
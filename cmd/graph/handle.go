@@ -0,0 +1,138 @@
+package graph
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+	"github.com/kiy7086/dtbotool/cmd/input"
+)
+
+// HandleRefs 列出输入文件的每个设备树中引用指定节点的所有属性。
+// target 可以是节点路径或标签，overlay 中还可以是 __fixups__ 的外部标签
+func HandleRefs(spec, target string) error {
+	items, err := input.Load(spec)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for i, item := range items {
+		if len(items) > 1 {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("== %s ==\n", item.Name)
+		}
+
+		g := Build(item.Tree)
+		var edges, possible []Edge
+		if n := Lookup(item.Tree, target); n != nil {
+			fmt.Println(describe(g, n))
+			edges = g.Referrers(n)
+			possible = g.PossibleReferrers(n)
+		} else if label := trimLabel(target); len(g.External(label)) > 0 {
+			fmt.Printf("&%s (外部标签)\n", label)
+			edges = g.External(label)
+		} else {
+			if len(items) == 1 {
+				return fmt.Errorf("节点 %s 不存在", target)
+			}
+			fmt.Printf("节点 %s 不存在\n", target)
+			continue
+		}
+		found = true
+
+		for _, e := range edges {
+			fmt.Printf("    %s: %s (偏移 %d)\n", e.From.Path(), e.Property, e.Offset)
+		}
+		for _, e := range possible {
+			fmt.Printf("    %s: %s (偏移 %d，可能的引用)\n", e.From.Path(), e.Property, e.Offset)
+		}
+		switch {
+		case len(edges) == 0 && len(possible) == 0:
+			fmt.Println("    没有被引用")
+		case len(possible) == 0:
+			fmt.Printf("共 %d 处引用\n", len(edges))
+		default:
+			fmt.Printf("共 %d 处引用，%d 处可能的引用 (属性无法识别，数值等于该节点的 phandle)\n", len(edges), len(possible))
+		}
+	}
+	if !found {
+		return fmt.Errorf("节点 %s 不存在", target)
+	}
+	return nil
+}
+
+// describe 返回节点路径、标签和 phandle
+func describe(g *Graph, n *fdt.Node) string {
+	text := n.Path()
+	if label := g.Label(n); label != "" {
+		text += " &" + label
+	}
+	if ph := n.Phandle(); ph != 0 {
+		text += fmt.Sprintf(" (phandle 0x%x)", ph)
+	} else {
+		text += " (没有 phandle)"
+	}
+	return text
+}
+
+func trimLabel(spec string) string {
+	return strings.TrimPrefix(spec, "&")
+}
+
+// HandleGraph 导出设备树的引用关系图。format 为 dot (默认) 或 json，
+// output 为空时输出到标准输出
+func HandleGraph(spec, format string, hierarchy bool, output string) error {
+	item, err := input.LoadOne(spec)
+	if err != nil {
+		return err
+	}
+
+	var write func(io.Writer, *Graph, Options) error
+	switch format {
+	case "", "dot":
+		write = WriteDot
+	case "json":
+		write = WriteJSON
+	default:
+		return fmt.Errorf("未知的输出格式: %s (可选 dot/json)", format)
+	}
+
+	g := Build(item.Tree)
+	opts := Options{Name: item.Name, Hierarchy: hierarchy}
+	if output == "" {
+		return write(os.Stdout, g, opts)
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("创建输出文件失败: %v", err)
+	}
+	if err := write(f, g, opts); err != nil {
+		f.Close()
+		return fmt.Errorf("写入输出文件失败: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("写入输出文件失败: %v", err)
+	}
+
+	unreferenced := 0
+	for _, n := range g.Targets() {
+		if g.Unreferenced(n) {
+			unreferenced++
+		}
+	}
+	possible := 0
+	for _, e := range g.Edges {
+		if e.Possible {
+			possible++
+		}
+	}
+	fmt.Printf("已生成引用关系图: %s (%d 处引用，%d 处可能的引用，%d 个带 phandle 的节点未被引用)\n",
+		output, len(g.Edges)-possible, possible, unreferenced)
+	return nil
+}
@@ -0,0 +1,38 @@
+package info
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kiy7086/dtbotool/cmd/compression"
+	"github.com/kiy7086/dtbotool/cmd/detect"
+)
+
+// HandleInfo 显示文件的检测结果
+func HandleInfo(input string) error {
+	if _, err := os.Stat(input); os.IsNotExist(err) {
+		return fmt.Errorf("'%s' 不存在", input)
+	}
+
+	result, err := detect.DetectFile(input)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("文件: %s\n", input)
+	fmt.Printf("  格式: %s (%s)\n", result.Format.Description(), result.Format)
+	if result.Format == detect.Directory {
+		return nil
+	}
+	if result.Compression != compression.None {
+		fmt.Printf("  压缩: %s\n", result.Compression)
+	}
+	if result.Sparse {
+		fmt.Printf("  Sparse镜像: 是\n")
+	}
+	fmt.Printf("  数据大小: %d 字节\n", result.Size)
+	for _, detail := range result.Details {
+		fmt.Printf("  %s\n", detail)
+	}
+	return nil
+}
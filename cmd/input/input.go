@@ -0,0 +1,226 @@
+package input
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/compression"
+	"github.com/kiy7086/dtbotool/cmd/detect"
+	"github.com/kiy7086/dtbotool/cmd/dtbo"
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// Item 输入文件中的一个设备树
+type Item struct {
+	Path  string // 文件路径，不含条目选择器
+	Index int    // 在镜像中的序号，单个DTB为0
+	Name  string // 用于显示的名称，如 dtbo.img[2]
+	Data  []byte // 原始设备树数据
+	Tree  *fdt.Tree
+}
+
+// Load 读取设备树文件，支持单个DTB、DTBO镜像、QCDT和附加设备树。
+// spec 可以带条目选择器，如 dtbo.img:0,2 或 dtbo.img:1-3
+func Load(spec string) ([]Item, error) {
+	path, selector := splitSelector(spec)
+
+	data, result, err := detect.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var blobs [][]byte
+	switch result.Format {
+	case detect.Fdt:
+		blobs = [][]byte{data}
+	case detect.DtTable:
+		entries, err := dtbo.ReadEntries(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			blobs = append(blobs, e.Data)
+		}
+	case detect.Qcdt:
+		if blobs, err = detect.SplitQcdt(data); err != nil {
+			return nil, err
+		}
+	case detect.BootImage, detect.VendorBoot, detect.AppendedFdt:
+		blobs = detect.ScanFdts(data)
+	default:
+		return nil, fmt.Errorf("%s 不是设备树或设备树镜像", path)
+	}
+	if len(blobs) == 0 {
+		return nil, fmt.Errorf("%s 中未找到设备树", path)
+	}
+
+	indexes, err := parseSelector(selector, len(blobs))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", spec, err)
+	}
+
+	var items []Item
+	for _, i := range indexes {
+		tree, err := fdt.Parse(blobs[i])
+		if err != nil {
+			return nil, fmt.Errorf("解析 %s 的设备树 %d 失败: %v", path, i, err)
+		}
+		name := path
+		if len(blobs) > 1 || selector != "" {
+			name = fmt.Sprintf("%s[%d]", path, i)
+		}
+		items = append(items, Item{Path: path, Index: i, Name: name, Data: blobs[i], Tree: tree})
+	}
+	return items, nil
+}
+
+// LoadOne 读取输入并要求恰好选中一个设备树
+func LoadOne(spec string) (*Item, error) {
+	items, err := Load(spec)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) != 1 {
+		return nil, fmt.Errorf("%s 包含 %d 个设备树，请用 %s:<序号> 选择其中一个", spec, len(items), spec)
+	}
+	return &items[0], nil
+}
+
+// splitSelector 拆分文件路径和条目选择器。路径本身存在时不拆分，
+// 以免误判 Windows 盘符或文件名中的冒号
+func splitSelector(spec string) (string, string) {
+	if _, err := os.Stat(spec); err == nil {
+		return spec, ""
+	}
+	i := strings.LastIndexByte(spec, ':')
+	if i <= 0 {
+		return spec, ""
+	}
+	if _, err := parseSelector(spec[i+1:], -1); err != nil {
+		return spec, ""
+	}
+	return spec[:i], spec[i+1:]
+}
+
+// parseSelector 解析逗号分隔的序号和范围。count 小于0时只检查语法
+func parseSelector(selector string, count int) ([]int, error) {
+	if selector == "" {
+		indexes := make([]int, count)
+		for i := range indexes {
+			indexes[i] = i
+		}
+		return indexes, nil
+	}
+
+	var indexes []int
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(selector, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		lo, err := strconv.Atoi(strings.TrimSpace(first))
+		if err != nil {
+			return nil, fmt.Errorf("无效的条目序号: %q", part)
+		}
+		hi := lo
+		if isRange {
+			if hi, err = strconv.Atoi(strings.TrimSpace(last)); err != nil || hi < lo {
+				return nil, fmt.Errorf("无效的条目范围: %q", part)
+			}
+		}
+		for i := lo; i <= hi; i++ {
+			if count >= 0 && (i < 0 || i >= count) {
+				return nil, fmt.Errorf("条目序号 %d 超出范围 (共 %d 个)", i, count)
+			}
+			if !seen[i] {
+				seen[i] = true
+				indexes = append(indexes, i)
+			}
+		}
+	}
+	return indexes, nil
+}
+
+// Save 将修改后的设备树写回。output 为空时覆盖原文件；原文件是 DTBO 镜像时
+// 只替换对应条目，压缩的文件按原格式重新压缩
+func Save(item *Item, output string) error {
+	dtb, err := item.Tree.Bytes()
+	if err != nil {
+		return err
+	}
+	if err := Write(item.Path, map[int][]byte{item.Index: dtb}, output); err != nil {
+		return err
+	}
+	item.Data = dtb
+	return nil
+}
+
+// Write 将新的设备树数据写回文件，dtbs 以条目序号为键。原文件是 DTBO 镜像时
+// 只替换对应的条目，压缩的文件按原格式重新压缩，output 为空时覆盖原文件
+func Write(path string, dtbs map[int][]byte, output string) error {
+	data, result, err := detect.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := writable(path, result); err != nil {
+		return err
+	}
+
+	switch result.Format {
+	case detect.Fdt:
+		if len(dtbs) != 1 || dtbs[0] == nil {
+			return fmt.Errorf("%s 只包含一个设备树", path)
+		}
+		data = dtbs[0]
+	case detect.DtTable:
+		indexes := make([]int, 0, len(dtbs))
+		for i := range dtbs {
+			indexes = append(indexes, i)
+		}
+		sort.Ints(indexes)
+		for _, i := range indexes {
+			if data, err = dtbo.ReplaceEntry(data, i, dtbs[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if result.Compression != compression.None {
+		if data, err = compression.Compress(data, result.Compression); err != nil {
+			return err
+		}
+	}
+
+	if output == "" {
+		output = path
+	}
+	if err := os.WriteFile(output, data, 0644); err != nil {
+		return fmt.Errorf("写入文件失败: %v", err)
+	}
+	return nil
+}
+
+// CheckWritable 检查文件能否由 Write 写回，应在修改设备树之前调用，
+// 避免完成所有处理后才发现无法写回
+func CheckWritable(path string) error {
+	_, result, err := detect.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return writable(path, result)
+}
+
+// writable 检查检测结果对应的格式和压缩方式是否支持写回
+func writable(path string, result *detect.Result) error {
+	if result.Sparse {
+		return fmt.Errorf("不支持写回sparse镜像: %s", path)
+	}
+	if result.Format != detect.Fdt && result.Format != detect.DtTable {
+		return fmt.Errorf("不支持写回 %s 格式的文件", result.Format.Description())
+	}
+	if !compression.CanCompress(result.Compression) {
+		return fmt.Errorf("不支持写回 %s 压缩的文件: %s", result.Compression, path)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Package dtstest 为各个包的测试提供共用的DTS源码和编译辅助函数
+package dtstest
+
+import (
+	"testing"
+
+	"github.com/kiy7086/dtbotool/cmd/diag"
+	"github.com/kiy7086/dtbotool/cmd/dts"
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// Base 普通设备树，包含 /memreserve/、各种类型的属性值、标签、
+// phandle 引用和路径引用。words 中的字符串在 YAML 中需要加引号
+const Base = `/dts-v1/;
+/memreserve/ 0x80000000 0x100000;
+/ {
+	#address-cells = <1>;
+	#size-cells = <1>;
+	model = "test: board # 1";
+	compatible = "vendor,board", "vendor,soc";
+
+	cpus {
+		#address-cells = <1>;
+		#size-cells = <0>;
+		cpu@0 { device_type = "cpu"; reg = <0>; };
+	};
+
+	intc: interrupt-controller@1000 {
+		reg = <0x1000 0x100>;
+		interrupt-controller;
+		#interrupt-cells = <2>;
+	};
+
+	clk: clock { #clock-cells = <0>; clock-frequency = <24000000>; };
+
+	uart: serial@2000 {
+		compatible = "vendor,uart";
+		reg = <0x2000 0x100>;
+		interrupt-parent = <&intc>;
+		interrupts = <5 4>;
+		clocks = <&clk>;
+		mac = [00 11 22 33 44 55];
+		odd = [01 02 03];
+		wide = /bits/ 64 <0x123456789>;
+		words = "true", "null", "0x10", "- x", " lead", "quote\"s";
+		status = "disabled";
+	};
+
+	aliases { serial0 = &uart; };
+	chosen { stdout-path = &uart; };
+};
+`
+
+// Overlay 引用 Base 中标签的 overlay，同时包含外部引用和内部引用
+const Overlay = `/dts-v1/;
+/plugin/;
+&uart {
+	status = "okay";
+	dev: device { reg = <1>; };
+};
+&{/chosen} {
+	user { dev = <&dev>; clocks = <&clk>; interrupt-parent = <&intc>; };
+};
+`
+
+// Compile 编译DTS源码并生成 __symbols__，编译失败或产生警告时测试失败
+func Compile(t testing.TB, src string) *fdt.Tree {
+	t.Helper()
+	tree, err := dts.CompileSource("t.dts", []byte(src), dts.Options{Symbols: true, Report: func(d diag.Diagnostic) {
+		t.Errorf("意外的警告: %s", d)
+	}})
+	if err != nil {
+		t.Fatalf("编译失败: %v\n%s", err, src)
+	}
+	return tree
+}
+
+// DTB 编译DTS源码并序列化为DTB
+func DTB(t testing.TB, src string) []byte {
+	t.Helper()
+	data, err := Compile(t, src).Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,114 @@
+package lint
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConfigFile 项目配置文件名，从当前目录向上查找
+const ConfigFile = ".dtblint"
+
+// Config 规则的启用状态和级别
+type Config struct {
+	levels map[string]Level
+}
+
+// NewConfig 返回使用默认级别的配置
+func NewConfig() *Config {
+	return &Config{levels: make(map[string]Level)}
+}
+
+// Level 返回规则配置的级别
+func (c *Config) Level(r *Rule) Level {
+	if level, ok := c.levels[r.ID]; ok {
+		return level
+	}
+	return r.Level
+}
+
+// Set 设置规则的级别，all 表示所有规则
+func (c *Config) Set(id string, level Level) error {
+	if id == "all" {
+		for _, r := range Rules {
+			c.levels[r.ID] = level
+		}
+		return nil
+	}
+	if Lookup(id) == nil {
+		return fmt.Errorf("未知的规则: %s", id)
+	}
+	c.levels[id] = level
+	return nil
+}
+
+// Enable 以默认级别启用规则
+func (c *Config) Enable(id string) error {
+	if id == "all" {
+		for _, r := range Rules {
+			c.Enable(r.ID)
+		}
+		return nil
+	}
+	if r := Lookup(id); r != nil && r.Level != Off {
+		return c.Set(id, r.Level)
+	}
+	return c.Set(id, Warning)
+}
+
+// Load 读取配置文件并应用到当前配置。每行格式为 "规则ID: 级别"，
+// 级别为 off、warning 或 error，# 开始注释
+func (c *Config) Load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for num := 1; scanner.Scan(); num++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		id, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return fmt.Errorf("%s:%d: 需要 \"规则ID: 级别\"", path, num)
+		}
+		level, err := ParseLevel(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, num, err)
+		}
+		if err := c.Set(strings.TrimSpace(id), level); err != nil {
+			return fmt.Errorf("%s:%d: %v", path, num, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// FindConfig 从 dir 开始向上查找项目配置文件，找不到时返回空字符串
+func FindConfig(dir string) string {
+	return FindFile(dir, ConfigFile)
+}
+
+// FindFile 从 dir 开始向上查找指定名称的文件，找不到时返回空字符串
+func FindFile(dir, name string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
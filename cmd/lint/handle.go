@@ -0,0 +1,84 @@
+package lint
+
+import (
+	"fmt"
+
+	"github.com/kiy7086/dtbotool/cmd/input"
+)
+
+// Options lint 命令的选项
+type Options struct {
+	Config  string   // 配置文件，为空时从当前目录向上查找 .dtblint
+	Enable  []string // 额外启用的规则
+	Disable []string // 关闭的规则
+}
+
+// LoadConfig 按配置文件和命令行选项生成配置
+func LoadConfig(opts Options) (*Config, error) {
+	cfg := NewConfig()
+	path := opts.Config
+	if path == "" {
+		path = FindConfig(".")
+	}
+	if path != "" {
+		if err := cfg.Load(path); err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range opts.Enable {
+		if err := cfg.Enable(id); err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range opts.Disable {
+		if err := cfg.Set(id, Off); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// HandleLint 检查所有输入文件中的设备树，以编译器风格输出诊断信息。
+// 存在错误级别的诊断时返回错误
+func HandleLint(specs []string, opts Options) error {
+	cfg, err := LoadConfig(opts)
+	if err != nil {
+		return err
+	}
+
+	errors, warnings := 0, 0
+	for _, spec := range specs {
+		items, err := input.Load(spec)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			for _, d := range Run(item.Tree, cfg) {
+				fmt.Printf("%s:%s: %s: %s [%s]\n", item.Name, d.Path, d.Level, d.Message, d.Rule)
+				if d.Level == Error {
+					errors++
+				} else {
+					warnings++
+				}
+			}
+		}
+	}
+
+	if errors > 0 {
+		return fmt.Errorf("共 %d 个错误，%d 个警告", errors, warnings)
+	}
+	fmt.Printf("共 %d 个错误，%d 个警告\n", errors, warnings)
+	return nil
+}
+
+// ListRules 列出所有规则及其在当前配置下的级别
+func ListRules(opts Options) error {
+	cfg, err := LoadConfig(opts)
+	if err != nil {
+		return err
+	}
+	for _, r := range Rules {
+		fmt.Printf("%-20s %-4s %s\n", r.ID, cfg.Level(r), r.Description)
+	}
+	return nil
+}
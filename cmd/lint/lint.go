@@ -0,0 +1,118 @@
+// Package lint 实现可配置的设备树检查规则。每条规则有唯一的 ID，
+// 可以在项目的 .dtblint 配置文件或命令行中单独开启、关闭或调整级别
+package lint
+
+import (
+	"fmt"
+
+	"github.com/kiy7086/dtbotool/cmd/decode"
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// Level 诊断级别，Off 表示规则被关闭
+type Level int
+
+const (
+	Off Level = iota
+	Warning
+	Error
+)
+
+func (l Level) String() string {
+	switch l {
+	case Warning:
+		return "警告"
+	case Error:
+		return "错误"
+	}
+	return "关闭"
+}
+
+// ParseLevel 解析配置中的级别名称
+func ParseLevel(s string) (Level, error) {
+	switch s {
+	case "off", "disable", "disabled":
+		return Off, nil
+	case "warning", "warn", "on", "enable", "enabled":
+		return Warning, nil
+	case "error":
+		return Error, nil
+	}
+	return Off, fmt.Errorf("未知的级别: %s (可选 off/warning/error)", s)
+}
+
+// Rule 一条检查规则
+type Rule struct {
+	ID          string
+	Level       Level // 默认级别
+	Description string
+	Check       func(c *Context)
+}
+
+// Diagnostic 一条诊断信息
+type Diagnostic struct {
+	Path    string // 节点路径
+	Rule    string
+	Level   Level
+	Message string
+}
+
+// Context 规则检查时使用的设备树和辅助信息
+type Context struct {
+	Tree    *fdt.Tree
+	Refs    *fdt.Refs
+	Decoder *decode.Decoder
+
+	rule  *Rule
+	level Level
+	diags []Diagnostic
+}
+
+// Report 报告当前规则在节点上发现的问题
+func (c *Context) Report(n *fdt.Node, format string, args ...any) {
+	c.diags = append(c.diags, Diagnostic{
+		Path:    n.Path(),
+		Rule:    c.rule.ID,
+		Level:   c.level,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Walk 遍历除 __symbols__ 等特殊节点以外的所有节点
+func (c *Context) Walk(fn func(n *fdt.Node)) {
+	c.Tree.Root.Walk(func(n *fdt.Node) bool {
+		if n.Parent != nil && n.Parent.Parent == nil && isSpecial(n.Name) {
+			return false
+		}
+		fn(n)
+		return true
+	})
+}
+
+func isSpecial(name string) bool {
+	return name == "__symbols__" || name == "__fixups__" || name == "__local_fixups__"
+}
+
+// Run 使用配置中启用的规则检查设备树
+func Run(t *fdt.Tree, cfg *Config) []Diagnostic {
+	c := &Context{Tree: t, Refs: fdt.NewRefs(t), Decoder: decode.New(t)}
+	for _, rule := range Rules {
+		level := cfg.Level(rule)
+		if level == Off {
+			continue
+		}
+		c.rule, c.level = rule, level
+		rule.Check(c)
+	}
+	return c.diags
+}
+
+// Lookup 按 ID 查找规则
+func Lookup(id string) *Rule {
+	for _, r := range Rules {
+		if r.ID == id {
+			return r
+		}
+	}
+	return nil
+}
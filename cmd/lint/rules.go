@@ -0,0 +1,272 @@
+package lint
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// Rules 所有检查规则，按输出顺序排列
+var Rules = []*Rule{
+	{
+		ID:          "unit-address-reg",
+		Level:       Warning,
+		Description: "节点名的单元地址与 reg 的第一个地址不一致",
+		Check:       checkUnitAddress,
+	},
+	{
+		ID:          "missing-reg",
+		Level:       Warning,
+		Description: "带单元地址的节点缺少 reg 或 ranges",
+		Check:       checkMissingReg,
+	},
+	{
+		ID:          "duplicate-phandle",
+		Level:       Error,
+		Description: "多个节点使用同一个 phandle",
+		Check:       checkDuplicatePhandles,
+	},
+	{
+		ID:          "dangling-phandle",
+		Level:       Error,
+		Description: "引用了不存在的 phandle 或 __symbols__ 指向不存在的节点",
+		Check:       checkDanglingPhandles,
+	},
+	{
+		ID:          "invalid-status",
+		Level:       Error,
+		Description: "status 不是 okay、disabled、reserved、fail 或 fail-sss",
+		Check:       checkStatus,
+	},
+	{
+		ID:          "node-name-chars",
+		Level:       Error,
+		Description: "节点名包含非法字符、多个 @ 或超过 31 个字符",
+		Check:       checkNodeNames,
+	},
+	{
+		ID:          "duplicate-label",
+		Level:       Error,
+		Description: "同一个标签定义在多个节点上",
+		Check:       checkDuplicateLabels,
+	},
+	{
+		ID:          "empty-overlay",
+		Level:       Warning,
+		Description: "overlay 没有片段或片段不修改任何内容",
+		Check:       checkEmptyOverlay,
+	},
+}
+
+// isOverlayNode 判断节点是否为 overlay 的片段或 __overlay__ 节点
+func isOverlayNode(n *fdt.Node) bool {
+	if n.Name == "__overlay__" {
+		return true
+	}
+	return n.Parent != nil && n.Parent.Parent == nil && n.Child("__overlay__") != nil
+}
+
+func checkUnitAddress(c *Context) {
+	c.Walk(func(n *fdt.Node) {
+		if n.Parent == nil || isOverlayNode(n) || n.Property("reg") == nil {
+			return
+		}
+		unit := n.UnitAddress()
+		if unit == "" {
+			c.Report(n, "节点有 reg 属性但节点名没有单元地址")
+			return
+		}
+		regions, ok := c.Decoder.Reg(n)
+		// PCI、I2C 复用地址等使用逗号分隔的单元地址有各自的格式
+		if !ok || strings.Contains(unit, ",") {
+			return
+		}
+		addr, err := strconv.ParseUint(unit, 16, 64)
+		switch {
+		case err != nil:
+			c.Report(n, "单元地址 %s 不是十六进制数", unit)
+		case addr != regions[0].Address:
+			c.Report(n, "单元地址 %s 与 reg 的第一个地址 0x%x 不一致", unit, regions[0].Address)
+		case unit != strconv.FormatUint(addr, 16):
+			c.Report(n, "单元地址 %s 应写为 %x (小写、无前导零)", unit, addr)
+		}
+	})
+}
+
+func checkMissingReg(c *Context) {
+	c.Walk(func(n *fdt.Node) {
+		if n.Parent == nil || isOverlayNode(n) || n.UnitAddress() == "" {
+			return
+		}
+		if n.Property("reg") == nil && n.Property("ranges") == nil {
+			c.Report(n, "节点名有单元地址 %s 但没有 reg 或 ranges 属性", n.UnitAddress())
+		}
+	})
+}
+
+func checkDuplicatePhandles(c *Context) {
+	owners := make(map[uint32]*fdt.Node)
+	c.Walk(func(n *fdt.Node) {
+		ph := n.Phandle()
+		if ph == 0 {
+			return
+		}
+		if p, lp := n.Property("phandle"), n.Property("linux,phandle"); p != nil && lp != nil && p.U32() != lp.U32() {
+			c.Report(n, "phandle 0x%x 与 linux,phandle 0x%x 不一致", p.U32(), lp.U32())
+		}
+		if ph == 0xffffffff {
+			c.Report(n, "phandle 0xffffffff 无效")
+			return
+		}
+		if prev, ok := owners[ph]; ok {
+			c.Report(n, "phandle 0x%x 已被 %s 使用", ph, prev.Path())
+			return
+		}
+		owners[ph] = n
+	})
+}
+
+func checkDanglingPhandles(c *Context) {
+	c.Walk(func(n *fdt.Node) {
+		for _, p := range n.Properties {
+			for _, off := range c.Refs.Dangling(n, p) {
+				ph := uint32(0)
+				if off+4 <= len(p.Value) {
+					ph = binary.BigEndian.Uint32(p.Value[off:])
+				}
+				c.Report(n, "%s 引用了不存在的 phandle 0x%x (偏移 %d)", p.Name, ph, off)
+			}
+		}
+	})
+
+	if symbols := c.Tree.Root.Child("__symbols__"); symbols != nil {
+		for _, p := range symbols.Properties {
+			path := p.String()
+			// overlay 的符号指向尚未应用的片段内容
+			if strings.Contains(path, "/__overlay__") {
+				continue
+			}
+			if c.Tree.Lookup(path) == nil {
+				c.Report(symbols, "标签 %s 指向不存在的节点 %s", p.Name, path)
+			}
+		}
+	}
+}
+
+// 规范定义的 status 取值
+var statusValues = map[string]bool{
+	"okay":     true,
+	"disabled": true,
+	"reserved": true,
+	"fail":     true,
+}
+
+func checkStatus(c *Context) {
+	c.Walk(func(n *fdt.Node) {
+		p := n.Property("status")
+		if p == nil {
+			return
+		}
+		if !p.IsStringList() || len(p.Strings()) != 1 {
+			c.Report(n, "status 应为单个字符串")
+			return
+		}
+		s := p.String()
+		if !statusValues[s] && !strings.HasPrefix(s, "fail-") {
+			c.Report(n, "status 的值 \"%s\" 无效", s)
+		}
+	})
+}
+
+func isNameChar(ch byte) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' ||
+		strings.IndexByte(",._+-", ch) >= 0
+}
+
+func checkNodeNames(c *Context) {
+	c.Walk(func(n *fdt.Node) {
+		if n.Parent == nil {
+			return
+		}
+		if strings.Count(n.Name, "@") > 1 {
+			c.Report(n, "节点名 %s 包含多个 @", n.Name)
+			return
+		}
+		base := n.BaseName()
+		if base == "" {
+			c.Report(n, "节点名 %s 缺少基本名称", n.Name)
+			return
+		}
+		for i := 0; i < len(n.Name); i++ {
+			if ch := n.Name[i]; ch != '@' && !isNameChar(ch) {
+				c.Report(n, "节点名 %s 包含非法字符 '%c'", n.Name, ch)
+				return
+			}
+		}
+		if len(base) > 31 {
+			c.Report(n, "节点名 %s 超过 31 个字符", base)
+		}
+	})
+}
+
+func checkDuplicateLabels(c *Context) {
+	owners := make(map[string]*fdt.Node)
+	c.Walk(func(n *fdt.Node) {
+		for _, l := range n.Labels {
+			if prev, ok := owners[l]; ok && prev != n {
+				c.Report(n, "标签 %s 已定义于 %s", l, prev.Path())
+				continue
+			}
+			owners[l] = n
+		}
+	})
+
+	symbols := c.Tree.Root.Child("__symbols__")
+	if symbols == nil {
+		return
+	}
+	seen := make(map[string]string)
+	for _, p := range symbols.Properties {
+		path := p.String()
+		if prev, ok := seen[p.Name]; ok && prev != path {
+			c.Report(symbols, "标签 %s 同时指向 %s 和 %s", p.Name, prev, path)
+			continue
+		}
+		seen[p.Name] = path
+		// 节点上的标签与 __symbols__ 中的同名标签指向不同节点
+		if owner, ok := owners[p.Name]; ok && owner.Path() != path {
+			c.Report(symbols, "标签 %s 指向 %s，但节点 %s 也定义了该标签", p.Name, path, owner.Path())
+		}
+	}
+}
+
+func checkEmptyOverlay(c *Context) {
+	root := c.Tree.Root
+	if len(root.Properties) == 0 && len(root.Children) == 0 {
+		c.Report(root, "设备树为空")
+		return
+	}
+	if !c.Tree.IsOverlay() {
+		return
+	}
+
+	fragments := 0
+	for _, n := range root.Children {
+		if isSpecial(n.Name) {
+			continue
+		}
+		ov := n.Child("__overlay__")
+		if ov == nil {
+			continue
+		}
+		fragments++
+		if len(ov.Properties) == 0 && len(ov.Children) == 0 {
+			c.Report(n, "片段 %s 的 __overlay__ 为空", n.Name)
+		}
+	}
+	if fragments == 0 {
+		c.Report(root, "overlay 没有任何片段")
+	}
+}
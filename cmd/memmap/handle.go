@@ -0,0 +1,134 @@
+package memmap
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/input"
+	"github.com/kiy7086/dtbotool/cmd/overlay"
+)
+
+// HandleMemmap 输出基础设备树的内存布局。指定 overlay 时先依次应用，
+// 再检查合并后的结果。存在错误时返回 error
+func HandleMemmap(base string, overlays []string) error {
+	baseItem, err := input.LoadOne(base)
+	if err != nil {
+		return err
+	}
+	if baseItem.Tree.IsOverlay() {
+		return fmt.Errorf("%s 是 overlay，请指定基础设备树", baseItem.Name)
+	}
+	tree := baseItem.Tree.Clone()
+
+	for _, spec := range overlays {
+		items, err := input.Load(spec)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if !item.Tree.IsOverlay() {
+				return fmt.Errorf("%s 不是 overlay", item.Name)
+			}
+			if err := overlay.Apply(tree, item.Tree); err != nil {
+				return fmt.Errorf("应用 %s 失败: %v", item.Name, err)
+			}
+			fmt.Printf("已应用 overlay: %s\n", item.Name)
+		}
+	}
+
+	m := Build(tree)
+	printMap(m)
+
+	errors, warnings := 0, 0
+	if len(m.Issues) > 0 {
+		fmt.Println("\n问题:")
+	}
+	for _, issue := range m.Issues {
+		if issue.Error {
+			fmt.Printf("    错误: %s\n", issue.Message)
+			errors++
+		} else {
+			fmt.Printf("    警告: %s\n", issue.Message)
+			warnings++
+		}
+	}
+	if errors > 0 {
+		return fmt.Errorf("内存布局存在 %d 个错误，%d 个警告", errors, warnings)
+	}
+	if warnings > 0 {
+		fmt.Printf("\n共 %d 个警告\n", warnings)
+	}
+	return nil
+}
+
+func printMap(m *Map) {
+	if len(m.Regions) == 0 && len(m.Dynamic) == 0 {
+		fmt.Println("设备树中没有内存或保留区域")
+		return
+	}
+
+	// 地址宽度按最大地址统一，至少 8 位十六进制数
+	width := 8
+	for _, r := range m.Regions {
+		width = max(width, len(fmt.Sprintf("%x", r.End()-1)))
+	}
+	for _, r := range m.Regions {
+		fmt.Printf("0x%0*x-0x%0*x  %10s  %s%s\n", width, r.Address, width, r.End()-1,
+			FormatSize(r.Size), r.Name, flags(r))
+	}
+
+	if len(m.Dynamic) > 0 {
+		fmt.Println("\n动态分配的区域:")
+	}
+	for _, r := range m.Dynamic {
+		text := fmt.Sprintf("大小 0x%x (%s)", r.Size, FormatSize(r.Size))
+		if r.Alignment != 0 {
+			text += fmt.Sprintf("，对齐 0x%x", r.Alignment)
+		}
+		if len(r.AllocRanges) > 0 {
+			var ranges []string
+			for _, a := range r.AllocRanges {
+				ranges = append(ranges, fmt.Sprintf("0x%x-0x%x", a.Address, end(a.Address, a.Size)-1))
+			}
+			text += "，范围 " + strings.Join(ranges, ", ")
+		}
+		fmt.Printf("    %s: %s%s\n", r.Name, text, flags(r))
+	}
+}
+
+// flags 返回区域类型和属性的说明
+func flags(r Region) string {
+	var parts []string
+	if r.Kind != Dynamic {
+		parts = append(parts, r.Kind.String())
+	}
+	if r.NoMap {
+		parts = append(parts, "no-map")
+	}
+	if r.Reusable {
+		parts = append(parts, "reusable")
+	}
+	if r.Disabled {
+		parts = append(parts, "已禁用")
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(parts, ", ") + "]"
+}
+
+// FormatSize 以 KiB、MiB、GiB 为单位格式化大小
+func FormatSize(size uint64) string {
+	units := []string{"GiB", "MiB", "KiB"}
+	for i, unit := range units {
+		n := uint64(1) << (30 - 10*i)
+		if size < n {
+			continue
+		}
+		if size%n == 0 {
+			return fmt.Sprintf("%d %s", size/n, unit)
+		}
+		return fmt.Sprintf("%.1f %s", float64(size)/float64(n), unit)
+	}
+	return fmt.Sprintf("%d B", size)
+}
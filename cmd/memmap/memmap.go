@@ -0,0 +1,389 @@
+// Package memmap 汇总 /memory 节点、/reserved-memory 的子节点和内存保留区
+// 条目，生成按地址排序的内存布局，并检查重叠和超出内存范围的区域
+package memmap
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/kiy7086/dtbotool/cmd/decode"
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// Kind 区域的来源
+type Kind int
+
+const (
+	Memory     Kind = iota // /memory 节点描述的内存
+	Reserved               // /reserved-memory 中固定地址的区域
+	MemReserve             // FDT 内存保留区条目 (/memreserve/)
+	Dynamic                // /reserved-memory 中按大小动态分配的区域
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Memory:
+		return "内存"
+	case Reserved:
+		return "保留"
+	case MemReserve:
+		return "memreserve"
+	}
+	return "动态分配"
+}
+
+// Region 内存布局中的一个区域
+type Region struct {
+	Kind     Kind
+	Name     string // 节点路径，内存保留区条目为 memreserve[序号]
+	Address  uint64
+	Size     uint64
+	NoMap    bool
+	Reusable bool
+	Disabled bool
+
+	// 动态分配的区域
+	Alignment   uint64
+	AllocRanges []decode.Region
+}
+
+// End 返回区域结束后的第一个地址，溢出时截断为最大地址
+func (r Region) End() uint64 {
+	return end(r.Address, r.Size)
+}
+
+func end(addr, size uint64) uint64 {
+	if size > math.MaxUint64-addr {
+		return math.MaxUint64
+	}
+	return addr + size
+}
+
+// Issue 检查发现的问题
+type Issue struct {
+	Error   bool
+	Message string
+}
+
+// Map 设备树描述的内存布局
+type Map struct {
+	Regions []Region // 固定地址的区域，按地址排序
+	Dynamic []Region // 动态分配的区域，按设备树中的顺序
+	Issues  []Issue
+}
+
+func (m *Map) errorf(format string, args ...any) {
+	m.Issues = append(m.Issues, Issue{Error: true, Message: fmt.Sprintf(format, args...)})
+}
+
+func (m *Map) warnf(format string, args ...any) {
+	m.Issues = append(m.Issues, Issue{Message: fmt.Sprintf(format, args...)})
+}
+
+// Build 收集设备树中的内存和保留区域并进行检查
+func Build(t *fdt.Tree) *Map {
+	m := &Map{}
+	d := decode.New(t)
+
+	for _, n := range t.Root.Children {
+		if n.BaseName() != "memory" && stringProp(n, "device_type") != "memory" {
+			continue
+		}
+		regions, ok := d.Reg(n)
+		if !ok {
+			if n.Property("reg") != nil {
+				m.warnf("%s: 无法解析 reg 属性", n.Path())
+			}
+			continue
+		}
+		for _, r := range regions {
+			if r.Size > 0 {
+				m.Regions = append(m.Regions, Region{Kind: Memory, Name: n.Path(), Address: r.Address, Size: r.Size, Disabled: disabled(n)})
+			}
+		}
+	}
+
+	if rm := t.Root.Child("reserved-memory"); rm != nil {
+		m.collectReserved(d, t, rm)
+	}
+
+	for i, e := range t.Reserve {
+		if e.Size > 0 {
+			m.Regions = append(m.Regions, Region{Kind: MemReserve, Name: fmt.Sprintf("memreserve[%d]", i), Address: e.Address, Size: e.Size})
+		}
+	}
+
+	sort.SliceStable(m.Regions, func(i, j int) bool {
+		a, b := m.Regions[i], m.Regions[j]
+		if a.Address != b.Address {
+			return a.Address < b.Address
+		}
+		return a.Kind < b.Kind
+	})
+
+	m.check()
+	return m
+}
+
+func (m *Map) collectReserved(d *decode.Decoder, t *fdt.Tree, rm *fdt.Node) {
+	// 规范要求 /reserved-memory 与根节点的单元数相同，并使用空 ranges
+	rac, _ := d.AddressCells(rm)
+	rsc, _ := d.SizeCells(rm)
+	ac, _ := d.AddressCells(t.Root)
+	sc, _ := d.SizeCells(t.Root)
+	if rac != ac || rsc != sc {
+		m.warnf("%s: #address-cells/#size-cells (%d/%d) 与根节点 (%d/%d) 不同", rm.Path(), rac, rsc, ac, sc)
+	}
+	if p := rm.Property("ranges"); p == nil {
+		m.warnf("%s: 缺少 ranges 属性", rm.Path())
+	} else if len(p.Value) != 0 {
+		m.warnf("%s: ranges 应为空属性", rm.Path())
+	}
+
+	for _, n := range rm.Children {
+		r := Region{
+			Name:     n.Path(),
+			NoMap:    n.Property("no-map") != nil,
+			Reusable: n.Property("reusable") != nil,
+			Disabled: disabled(n),
+		}
+		if r.NoMap && r.Reusable {
+			m.warnf("%s: no-map 和 reusable 不能同时使用", n.Path())
+		}
+
+		if n.Property("reg") != nil {
+			regions, ok := d.Reg(n)
+			if !ok {
+				m.warnf("%s: 无法解析 reg 属性", n.Path())
+				continue
+			}
+			for _, reg := range regions {
+				r.Kind, r.Address, r.Size = Reserved, reg.Address, reg.Size
+				if r.Size == 0 {
+					m.warnf("%s: 保留区域大小为 0", n.Path())
+					continue
+				}
+				m.Regions = append(m.Regions, r)
+			}
+			continue
+		}
+
+		if n.Property("size") == nil {
+			m.warnf("%s: 既没有 reg 也没有 size 属性", n.Path())
+			continue
+		}
+		r.Kind = Dynamic
+		var ok bool
+		if r.Size, ok = sizeProp(d, n, "size"); !ok {
+			m.warnf("%s: 无法解析 size 属性", n.Path())
+			continue
+		}
+		if n.Property("alignment") != nil {
+			if r.Alignment, ok = sizeProp(d, n, "alignment"); !ok {
+				m.warnf("%s: 无法解析 alignment 属性", n.Path())
+				continue
+			}
+		}
+		if n.Property("alloc-ranges") != nil {
+			if r.AllocRanges, ok = d.Regions(n, "alloc-ranges"); !ok {
+				m.warnf("%s: 无法解析 alloc-ranges 属性", n.Path())
+				continue
+			}
+		}
+		m.Dynamic = append(m.Dynamic, r)
+	}
+}
+
+// sizeProp 按父节点的 #size-cells 读取 size、alignment 等属性
+func sizeProp(d *decode.Decoder, n *fdt.Node, name string) (uint64, bool) {
+	sc, ok := d.SizeCells(n.Parent)
+	p := n.Property(name)
+	if !ok || sc < 1 || sc > 2 || len(p.Value) != sc*4 {
+		return 0, false
+	}
+	return fdt.ReadCells(p.U32s(), sc), true
+}
+
+func stringProp(n *fdt.Node, name string) string {
+	if p := n.Property(name); p != nil {
+		return p.String()
+	}
+	return ""
+}
+
+// disabled 判断节点是否被禁用，缺少 status 时视为启用
+func disabled(n *fdt.Node) bool {
+	status := stringProp(n, "status")
+	return status != "" && status != "okay" && status != "ok"
+}
+
+// check 检查重叠、超出内存范围的区域以及无法分配的动态区域
+func (m *Map) check() {
+	var ram, reserved []Region
+	for _, r := range m.Regions {
+		switch {
+		case r.Disabled:
+		case r.Kind == Memory:
+			ram = append(ram, r)
+		default:
+			reserved = append(reserved, r)
+		}
+	}
+
+	m.checkOverlaps(ram)
+	m.checkOverlaps(reserved)
+
+	// 内存节点通常由引导程序填写，设备树中没有时无法判断
+	usable := merge(ram)
+	if len(usable) == 0 {
+		m.warnf("没有可用的 /memory 区域 (可能由引导程序填写)，跳过内存范围检查")
+		return
+	}
+	for _, r := range reserved {
+		if !contains(usable, r.Address, r.End()) {
+			m.errorf("%s (0x%x-0x%x) 超出内存范围", r.Name, r.Address, r.End()-1)
+		}
+	}
+
+	// 依次分配动态区域: 从内存中扣除所有固定的保留区域，按内核的方式从高地址开始分配
+	free := usable
+	for _, r := range reserved {
+		free = subtract(free, r.Address, r.End())
+	}
+	for _, r := range m.Dynamic {
+		if r.Disabled {
+			continue
+		}
+		if r.Size == 0 {
+			m.errorf("%s: 动态区域大小为 0", r.Name)
+			continue
+		}
+		align := r.Alignment
+		if align == 0 {
+			align = 1
+		}
+		if align&(align-1) != 0 {
+			m.errorf("%s: 对齐 0x%x 不是 2 的幂", r.Name, r.Alignment)
+			continue
+		}
+
+		windows := free
+		if len(r.AllocRanges) > 0 {
+			windows = nil
+			for _, a := range r.AllocRanges {
+				if !overlapsAny(usable, a.Address, end(a.Address, a.Size)) {
+					m.warnf("%s: alloc-ranges 0x%x-0x%x 不在内存范围内", r.Name, a.Address, end(a.Address, a.Size)-1)
+				}
+				windows = append(windows, intersect(free, a.Address, end(a.Address, a.Size))...)
+			}
+		}
+		addr, ok := allocate(windows, r.Size, align)
+		if !ok {
+			if r.Alignment > 1 {
+				m.errorf("%s: 无法在可用内存中分配 0x%x 字节 (对齐 0x%x)", r.Name, r.Size, r.Alignment)
+			} else {
+				m.errorf("%s: 无法在可用内存中分配 0x%x 字节", r.Name, r.Size)
+			}
+			continue
+		}
+		free = subtract(free, addr, end(addr, r.Size))
+	}
+}
+
+// checkOverlaps 检查按地址排序的区域之间的重叠
+func (m *Map) checkOverlaps(regions []Region) {
+	for i, a := range regions {
+		for _, b := range regions[i+1:] {
+			if b.Address >= a.End() {
+				break
+			}
+			m.errorf("%s (0x%x-0x%x) 与 %s (0x%x-0x%x) 重叠", a.Name, a.Address, a.End()-1, b.Name, b.Address, b.End()-1)
+		}
+	}
+}
+
+// span 半开区间 [start, end)
+type span struct {
+	start, end uint64
+}
+
+// merge 合并按地址排序的区域，返回不相交的区间
+func merge(regions []Region) []span {
+	var spans []span
+	for _, r := range regions {
+		if n := len(spans); n > 0 && r.Address <= spans[n-1].end {
+			spans[n-1].end = max(spans[n-1].end, r.End())
+			continue
+		}
+		spans = append(spans, span{r.Address, r.End()})
+	}
+	return spans
+}
+
+func contains(spans []span, start, end uint64) bool {
+	for _, s := range spans {
+		if start >= s.start && end <= s.end {
+			return true
+		}
+	}
+	return false
+}
+
+func overlapsAny(spans []span, start, end uint64) bool {
+	for _, s := range spans {
+		if start < s.end && s.start < end {
+			return true
+		}
+	}
+	return false
+}
+
+// subtract 从区间列表中扣除 [start, end)
+func subtract(spans []span, start, end uint64) []span {
+	var out []span
+	for _, s := range spans {
+		if end <= s.start || start >= s.end {
+			out = append(out, s)
+			continue
+		}
+		if s.start < start {
+			out = append(out, span{s.start, start})
+		}
+		if end < s.end {
+			out = append(out, span{end, s.end})
+		}
+	}
+	return out
+}
+
+// intersect 返回区间列表与 [start, end) 的交集
+func intersect(spans []span, start, end uint64) []span {
+	var out []span
+	for _, s := range spans {
+		lo, hi := max(s.start, start), min(s.end, end)
+		if lo < hi {
+			out = append(out, span{lo, hi})
+		}
+	}
+	return out
+}
+
+// allocate 在区间中从高地址开始查找满足大小和对齐的位置
+func allocate(spans []span, size, align uint64) (uint64, bool) {
+	var best uint64
+	found := false
+	for _, s := range spans {
+		if s.end-s.start < size {
+			continue
+		}
+		addr := (s.end - size) &^ (align - 1)
+		if addr < s.start {
+			continue
+		}
+		if !found || addr > best {
+			best, found = addr, true
+		}
+	}
+	return best, found
+}
@@ -0,0 +1,58 @@
+package mkoverlay
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/compression"
+	"github.com/kiy7086/dtbotool/cmd/dts"
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+	"github.com/kiy7086/dtbotool/cmd/input"
+	"github.com/kiy7086/dtbotool/cmd/overlay"
+)
+
+// HandleMkoverlay 比较基础DTB和修改后的DTB，生成对应的 overlay。
+// 输出文件以 .dts 结尾时写出 overlay 源码，否则写出 DTBO
+func HandleMkoverlay(base, modified, output string) error {
+	baseItem, err := input.LoadOne(base)
+	if err != nil {
+		return err
+	}
+	modItem, err := input.LoadOne(modified)
+	if err != nil {
+		return err
+	}
+
+	ov, warnings, err := overlay.Create(baseItem.Tree, modItem.Tree)
+	for _, w := range warnings {
+		fmt.Printf("警告: %s\n", w)
+	}
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		name := compression.TrimExt(modified)
+		output = strings.TrimSuffix(name, filepath.Ext(name)) + ".dtbo"
+	}
+
+	if strings.HasSuffix(output, ".dts") {
+		src := dts.Decompile(ov, dts.DecompileOptions{Symbols: true})
+		if err := os.WriteFile(output, src, 0644); err != nil {
+			return fmt.Errorf("写入文件失败: %v", err)
+		}
+	} else if err := fdt.WriteFile(output, ov); err != nil {
+		return err
+	}
+
+	fragments := 0
+	for _, n := range ov.Root.Children {
+		if n.Child("__overlay__") != nil {
+			fragments++
+		}
+	}
+	fmt.Printf("已生成包含 %d 个片段的 overlay: %s\n", fragments, output)
+	return nil
+}
@@ -0,0 +1,52 @@
+package normalize
+
+import (
+	"fmt"
+
+	"github.com/kiy7086/dtbotool/cmd/backup"
+	"github.com/kiy7086/dtbotool/cmd/input"
+)
+
+// HandleNormalize 规范化单个DTB或DTBO镜像中选中的条目并写回。
+// output 为空时覆盖原文件并先创建备份
+func HandleNormalize(spec string, opts Options, output string) error {
+	items, err := input.Load(spec)
+	if err != nil {
+		return err
+	}
+	path := items[0].Path
+	if err := input.CheckWritable(path); err != nil {
+		return err
+	}
+
+	dtbs := make(map[int][]byte)
+	for _, item := range items {
+		data, r, err := Bytes(item.Tree, opts)
+		if err != nil {
+			return fmt.Errorf("规范化 %s 失败: %v", item.Name, err)
+		}
+		dtbs[item.Index] = data
+
+		for _, w := range r.Warnings {
+			fmt.Printf("警告: %s: %s\n", item.Name, w)
+		}
+		if opts.KeepPhandles {
+			fmt.Printf("%s: %d -> %d 字节\n", item.Name, len(item.Data), len(data))
+		} else {
+			fmt.Printf("%s: %d -> %d 字节，%d 个 phandle 中 %d 个重新编号，改写 %d 处引用\n",
+				item.Name, len(item.Data), len(data), r.Phandles, r.Renumbered, r.References)
+		}
+	}
+
+	if output == "" {
+		output = path
+		if _, err := backup.CreateBackup(path); err != nil {
+			fmt.Printf("警告: 备份失败: %v\n", err)
+		}
+	}
+	if err := input.Write(path, dtbs, output); err != nil {
+		return err
+	}
+	fmt.Printf("已规范化 %d 个设备树，输出: %s\n", len(dtbs), output)
+	return nil
+}
@@ -0,0 +1,220 @@
+// Package normalize 将设备树转换为规范形式: 属性和子节点按名称排序，
+// phandle 按规范顺序重新编号，字符串块使用固定的布局。语义相同的设备树
+// 规范化后逐字节相同，可以直接比较
+package normalize
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// Options 规范化选项
+type Options struct {
+	KeepPhandles bool // 不重新编号 phandle
+}
+
+// Result 规范化的结果
+type Result struct {
+	Phandles   int // 带 phandle 的节点数
+	Renumbered int // 编号发生变化的节点数
+	References int // 改写的引用数
+	Kept       int // 可能被引用而保留原编号的节点数
+
+	// Warnings 无法识别的属性中等于已有 phandle 的数值，对应的节点保留原编号
+	Warnings []string
+}
+
+// Normalize 原地规范化设备树。phandle 引用按 overlay 的修正表或常见绑定识别，
+// 无法识别的属性中有数值等于某个 phandle 时，该 phandle 所属的节点保留原编号，
+// 其余节点绕开这些编号重新编号，并在结果中给出警告
+func Normalize(t *fdt.Tree, opts Options) (*Result, error) {
+	r := &Result{}
+	var kept map[*fdt.Node]bool
+	if !opts.KeepPhandles {
+		kept = findAmbiguous(t, r)
+	}
+
+	sortNode(t.Root)
+	if fixups := t.Root.Child("__fixups__"); fixups != nil {
+		for _, p := range fixups.Properties {
+			sortStrings(p)
+		}
+	}
+	sort.SliceStable(t.Reserve, func(i, j int) bool {
+		a, b := t.Reserve[i], t.Reserve[j]
+		if a.Address != b.Address {
+			return a.Address < b.Address
+		}
+		return a.Size < b.Size
+	})
+	t.Version = fdt.DefaultVersion
+	t.Padding = 0
+
+	if !opts.KeepPhandles {
+		renumber(t, r, kept)
+	}
+	return r, nil
+}
+
+// Bytes 规范化设备树的副本并返回其FDT数据
+func Bytes(t *fdt.Tree, opts Options) ([]byte, *Result, error) {
+	t = t.Clone()
+	r, err := Normalize(t, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := t.CompactBytes()
+	return data, r, err
+}
+
+// findAmbiguous 找出无法识别的属性中可能是 phandle 的单元，为每个单元记录警告，
+// 返回可能被引用的节点
+func findAmbiguous(t *fdt.Tree, r *Result) map[*fdt.Node]bool {
+	refs := fdt.NewRefs(t)
+	kept := make(map[*fdt.Node]bool)
+	t.Root.Walk(func(n *fdt.Node) bool {
+		if isSpecial(t, n) {
+			return false
+		}
+		for _, p := range n.Properties {
+			for _, ref := range refs.Possible(n, p) {
+				kept[ref.Target] = true
+				r.Warnings = append(r.Warnings, fmt.Sprintf("%s:%s[%d] = 0x%x 可能引用 %s，保留其 phandle",
+					n.Path(), p.Name, ref.Offset/4, binary.BigEndian.Uint32(p.Value[ref.Offset:]), ref.Target.Path()))
+			}
+		}
+		return true
+	})
+	r.Kept = len(kept)
+	return kept
+}
+
+// isSpecial 判断节点是否为 __symbols__ 等 overlay 相关的特殊节点
+func isSpecial(t *fdt.Tree, n *fdt.Node) bool {
+	return n.Parent == t.Root && (n.Name == "__symbols__" || n.Name == "__fixups__" || n.Name == "__local_fixups__")
+}
+
+func sortNode(n *fdt.Node) {
+	sort.SliceStable(n.Properties, func(i, j int) bool {
+		return n.Properties[i].Name < n.Properties[j].Name
+	})
+	sort.SliceStable(n.Children, func(i, j int) bool {
+		return lessName(n.Children[i].Name, n.Children[j].Name)
+	})
+	for _, c := range n.Children {
+		sortNode(c)
+	}
+}
+
+// lessName 先比较节点的基本名称，再按数值比较十六进制的单元地址，
+// 使 uart@2000 排在 uart@10000 之前
+func lessName(a, b string) bool {
+	baseA, unitA, _ := strings.Cut(a, "@")
+	baseB, unitB, _ := strings.Cut(b, "@")
+	if baseA != baseB {
+		return baseA < baseB
+	}
+	x, errA := strconv.ParseUint(unitA, 16, 64)
+	y, errB := strconv.ParseUint(unitB, 16, 64)
+	if errA == nil && errB == nil && x != y {
+		return x < y
+	}
+	return a < b
+}
+
+// sortStrings 对字符串列表属性中的字符串排序
+func sortStrings(p *fdt.Property) {
+	if !p.IsStringList() {
+		return
+	}
+	strs := p.Strings()
+	sort.Strings(strs)
+	p.Value = []byte(strings.Join(strs, "\x00") + "\x00")
+}
+
+// reference 属性值中一个需要改写的 phandle
+type reference struct {
+	prop   *fdt.Property
+	offset int
+	target *fdt.Node
+}
+
+// renumber 按排序后的树的顺序从 1 开始重新分配 phandle，并改写所有识别出的引用。
+// kept 中的节点保留原编号，其余节点跳过这些编号
+func renumber(t *fdt.Tree, r *Result, kept map[*fdt.Node]bool) {
+	refs := fdt.NewRefs(t)
+	var found []reference
+	var nodes []*fdt.Node
+	t.Root.Walk(func(n *fdt.Node) bool {
+		if isSpecial(t, n) {
+			return false
+		}
+		if ph := n.Phandle(); ph != 0 && ph != 0xffffffff {
+			nodes = append(nodes, n)
+		}
+		for _, p := range n.Properties {
+			for _, ref := range refs.Find(n, p) {
+				if ref.Target != nil {
+					found = append(found, reference{p, ref.Offset, ref.Target})
+				}
+			}
+		}
+		return true
+	})
+
+	phandles := make(map[*fdt.Node]uint32, len(nodes))
+	used := make(map[uint32]bool)
+	for n := range kept {
+		phandles[n] = n.Phandle()
+		used[n.Phandle()] = true
+	}
+	next := uint32(1)
+	for _, n := range nodes {
+		if kept[n] {
+			continue
+		}
+		for used[next] {
+			next++
+		}
+		phandles[n] = next
+		next++
+	}
+
+	// 属性值可能与原始数据共享底层数组，改写前先复制
+	copied := make(map[*fdt.Property]bool)
+	put := func(p *fdt.Property, off int, v uint32) {
+		if !copied[p] {
+			p.Value = append([]byte(nil), p.Value...)
+			copied[p] = true
+		}
+		binary.BigEndian.PutUint32(p.Value[off:], v)
+	}
+
+	for _, ref := range found {
+		ph, ok := phandles[ref.target]
+		if !ok {
+			continue
+		}
+		if binary.BigEndian.Uint32(ref.prop.Value[ref.offset:]) != ph {
+			put(ref.prop, ref.offset, ph)
+			r.References++
+		}
+	}
+	for _, n := range nodes {
+		ph := phandles[n]
+		if n.Phandle() != ph {
+			r.Renumbered++
+		}
+		for _, name := range []string{"phandle", "linux,phandle"} {
+			if p := n.Property(name); p != nil && len(p.Value) == 4 {
+				put(p, 0, ph)
+			}
+		}
+	}
+	r.Phandles = len(nodes)
+}
@@ -0,0 +1,135 @@
+package normalize
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+	"github.com/kiy7086/dtbotool/cmd/internal/dtstest"
+)
+
+// 同一设备树的两种写法: 节点、属性和 /memreserve/ 的顺序不同，phandle 编号不同
+const (
+	orderedSource = `/dts-v1/;
+/memreserve/ 0x1000 0x100;
+/memreserve/ 0x2000 0x100;
+/ {
+	#address-cells = <1>;
+	#size-cells = <1>;
+	compatible = "vendor,board";
+	clk: clock { #clock-cells = <0>; phandle = <1>; };
+	intc: intc@100 { interrupt-controller; #interrupt-cells = <1>; reg = <0x100 0x10>; phandle = <2>; };
+	uart@200 {
+		reg = <0x200 0x10>;
+		clocks = <&clk>;
+		interrupt-parent = <&intc>;
+		interrupts = <3>;
+	};
+	spi@300 { reg = <0x300 0x10>; clocks = <&clk>; };
+};
+`
+	shuffledSource = `/dts-v1/;
+/memreserve/ 0x2000 0x100;
+/memreserve/ 0x1000 0x100;
+/ {
+	#size-cells = <1>;
+	compatible = "vendor,board";
+	#address-cells = <1>;
+	spi@300 { clocks = <&clk>; reg = <0x300 0x10>; };
+	uart@200 {
+		interrupts = <3>;
+		interrupt-parent = <&intc>;
+		clocks = <&clk>;
+		reg = <0x200 0x10>;
+	};
+	intc: intc@100 { phandle = <0x20>; reg = <0x100 0x10>; #interrupt-cells = <1>; interrupt-controller; };
+	clk: clock { phandle = <0x10>; #clock-cells = <0>; };
+};
+`
+)
+
+func TestNormalizeEqual(t *testing.T) {
+	a, ra, err := Bytes(dtstest.Compile(t, orderedSource), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, rb, err := Bytes(dtstest.Compile(t, shuffledSource), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a, b) {
+		t.Fatalf("规范化后的数据不同 (%d / %d 字节)", len(a), len(b))
+	}
+	if ra.Phandles != 2 || rb.Phandles != 2 || rb.Renumbered != 2 || rb.References != 3 {
+		t.Errorf("结果 = %+v / %+v", ra, rb)
+	}
+
+	// 规范化是幂等的
+	tree, err := fdt.Parse(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, r, err := Bytes(tree, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, a) || r.Renumbered != 0 {
+		t.Errorf("再次规范化后数据发生变化 (%+v)", r)
+	}
+}
+
+func TestNormalizeKeepPhandles(t *testing.T) {
+	a, _, err := Bytes(dtstest.Compile(t, orderedSource), Options{KeepPhandles: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _, err := Bytes(dtstest.Compile(t, shuffledSource), Options{KeepPhandles: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(a, b) {
+		t.Error("保留 phandle 时编号不同的设备树不应相同")
+	}
+
+	tree, err := fdt.Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := tree.Lookup("/clock"); n == nil || n.Phandle() != 0x10 {
+		t.Error("phandle 被重新编号")
+	}
+}
+
+// TestNormalizeAmbiguous 可能被无法识别的属性引用的节点保留原编号，其余节点绕开它重新编号
+func TestNormalizeAmbiguous(t *testing.T) {
+	src := `/dts-v1/;
+/ {
+	a { phandle = <3>; };
+	clk: clock { #clock-cells = <0>; phandle = <1>; };
+	dev { clocks = <&clk>; vendor,link = <1>; };
+};
+`
+	data, r, err := Bytes(dtstest.Compile(t, src), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Warnings) != 1 || !strings.Contains(r.Warnings[0], "/dev:vendor,link[0] = 0x1") || r.Kept != 1 {
+		t.Fatalf("结果 = %+v, 期望对 vendor,link 给出警告", r)
+	}
+
+	tree, err := fdt.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tree.Lookup("/clock").Phandle(); got != 1 {
+		t.Errorf("/clock 的 phandle = %d, 期望保留 1", got)
+	}
+	if got := tree.Lookup("/a").Phandle(); got != 2 {
+		t.Errorf("/a 的 phandle = %d, 期望 2", got)
+	}
+	if got := tree.Lookup("/dev").Property("vendor,link").U32s(); !reflect.DeepEqual(got, []uint32{1}) {
+		t.Errorf("vendor,link = %v, 不应被改写", got)
+	}
+}
@@ -0,0 +1,124 @@
+package optimize
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/backup"
+	"github.com/kiy7086/dtbotool/cmd/dtb"
+	"github.com/kiy7086/dtbotool/cmd/input"
+)
+
+// HandleOptimize 优化单个DTB或DTBO镜像中选中的条目并写回，输出每个条目
+// 节省的字节数。删除 __symbols__ 条目时，overlays 和输入文件中所有 overlay
+// 的 __fixups__ 引用的标签会被保留。output 为空时覆盖原文件并先创建备份
+func HandleOptimize(spec string, overlays []string, opts Options, output string, dryRun bool) error {
+	items, err := input.Load(spec)
+	if err != nil {
+		return err
+	}
+	path := items[0].Path
+	if !dryRun {
+		if err := input.CheckWritable(path); err != nil {
+			return err
+		}
+	}
+
+	if opts.StripSymbols {
+		if opts.UsedLabels, err = usedLabels(path, overlays); err != nil {
+			return err
+		}
+	}
+
+	dtbs := make(map[int][]byte)
+	total := 0
+	for _, item := range items {
+		out, r, err := Optimize(item.Data, opts)
+		if err != nil {
+			return fmt.Errorf("优化 %s 失败: %v", item.Name, err)
+		}
+		if err := dtb.Verify(out).Err(); err != nil {
+			return fmt.Errorf("优化 %s 后的数据无效: %v", item.Name, err)
+		}
+
+		var details []string
+		if r.Symbols > 0 {
+			details = append(details, fmt.Sprintf("删除 %d 个符号", r.Symbols))
+		}
+		if r.LocalFixups {
+			details = append(details, "删除 __local_fixups__")
+		}
+		line := fmt.Sprintf("%s: %d -> %d 字节，节省 %d 字节", item.Name, r.Before, r.After, r.Saved())
+		if len(details) > 0 {
+			line += " (" + strings.Join(details, "，") + ")"
+		}
+		fmt.Println(line)
+		for _, note := range r.Notes {
+			fmt.Printf("    注意: %s\n", note)
+		}
+
+		if r.Saved() > 0 || r.Symbols > 0 || r.LocalFixups {
+			dtbs[item.Index] = out
+			total += r.Saved()
+		}
+	}
+
+	if len(dtbs) == 0 {
+		fmt.Println("已经是最小的布局，无需优化")
+		return nil
+	}
+	if dryRun {
+		fmt.Printf("共可节省 %d 字节 (未写入文件)\n", total)
+		return nil
+	}
+
+	before, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("读取文件信息失败: %v", err)
+	}
+	if output == "" {
+		output = path
+		if _, err := backup.CreateBackup(path); err != nil {
+			fmt.Printf("警告: 备份失败: %v\n", err)
+		}
+	}
+	if err := input.Write(path, dtbs, output); err != nil {
+		return err
+	}
+	after, err := os.Stat(output)
+	if err != nil {
+		return fmt.Errorf("读取文件信息失败: %v", err)
+	}
+	fmt.Printf("共节省 %d 字节，文件大小 %d -> %d 字节，输出: %s\n", total, before.Size(), after.Size(), output)
+	return nil
+}
+
+// usedLabels 收集输入文件中所有 overlay 以及额外指定的 overlay 引用的标签
+func usedLabels(path string, overlays []string) (map[string]bool, error) {
+	used := make(map[string]bool)
+	found := false
+	for i, spec := range append([]string{path}, overlays...) {
+		items, err := input.Load(spec)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			if !item.Tree.IsOverlay() {
+				// 输入文件可以是基础设备树，额外指定的文件必须是 overlay
+				if i > 0 {
+					return nil, fmt.Errorf("%s 不是 overlay", item.Name)
+				}
+				continue
+			}
+			found = true
+			for _, label := range FixupLabels(item.Tree) {
+				used[label] = true
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("删除 __symbols__ 条目需要用 --overlay 指定会应用到该设备树的 overlay")
+	}
+	return used, nil
+}
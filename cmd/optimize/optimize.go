@@ -0,0 +1,120 @@
+// Package optimize 缩小设备树的体积: 重新生成紧凑的字符串块、去掉填充，
+// 并可选地删除没有被使用的 __symbols__ 条目和可以安全删除的 __local_fixups__
+package optimize
+
+import (
+	"fmt"
+
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// Options 优化选项
+type Options struct {
+	StripSymbols     bool            // 删除没有被 overlay 引用的 __symbols__ 条目
+	UsedLabels       map[string]bool // overlay 通过 __fixups__ 引用的标签
+	StripLocalFixups bool            // 在安全时删除 __local_fixups__
+}
+
+// Result 单个设备树的优化结果
+type Result struct {
+	Before      int
+	After       int
+	Symbols     int  // 删除的 __symbols__ 条目数
+	LocalFixups bool // 是否删除了 __local_fixups__
+	Notes       []string
+}
+
+// Saved 返回节省的字节数
+func (r *Result) Saved() int {
+	return r.Before - r.After
+}
+
+// Optimize 优化一个FDT，返回新的数据。结果不比原数据小且没有删除任何内容时
+// 返回原数据
+func Optimize(data []byte, opts Options) ([]byte, *Result, error) {
+	tree, err := fdt.Parse(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := &Result{Before: len(data)}
+
+	if opts.StripSymbols {
+		r.Symbols = stripSymbols(tree, opts.UsedLabels)
+	}
+	if opts.StripLocalFixups && tree.Root.Child("__local_fixups__") != nil {
+		if reason := localFixupsNeeded(tree); reason != "" {
+			r.Notes = append(r.Notes, "保留 __local_fixups__: "+reason)
+		} else {
+			tree.Root.RemoveChild(tree.Root.Child("__local_fixups__"))
+			r.LocalFixups = true
+		}
+	}
+
+	out, err := tree.CompactBytes()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(out) >= len(data) && r.Symbols == 0 && !r.LocalFixups {
+		out = data
+	}
+	r.After = len(out)
+	return out, r, nil
+}
+
+// FixupLabels 返回 overlay 的 __fixups__ 中引用的所有标签
+func FixupLabels(t *fdt.Tree) []string {
+	fixups := t.Root.Child("__fixups__")
+	if fixups == nil {
+		return nil
+	}
+	labels := make([]string, 0, len(fixups.Properties))
+	for _, p := range fixups.Properties {
+		labels = append(labels, p.Name)
+	}
+	return labels
+}
+
+// stripSymbols 删除没有被使用的符号，全部删除时连同 __symbols__ 节点一起删除
+func stripSymbols(t *fdt.Tree, used map[string]bool) int {
+	symbols := t.Root.Child("__symbols__")
+	if symbols == nil {
+		return 0
+	}
+	var kept []*fdt.Property
+	for _, p := range symbols.Properties {
+		if used[p.Name] {
+			kept = append(kept, p)
+		}
+	}
+	removed := len(symbols.Properties) - len(kept)
+	symbols.Properties = kept
+	if len(kept) == 0 {
+		t.Root.RemoveChild(symbols)
+	}
+	return removed
+}
+
+// localFixupsNeeded 返回不能删除 __local_fixups__ 的原因。应用 overlay 时需要
+// 根据它重新编号内部的 phandle 引用，只有不含片段的设备树或没有记录任何
+// 引用时才可以删除
+func localFixupsNeeded(t *fdt.Tree) string {
+	fragments := 0
+	for _, c := range t.Root.Children {
+		if c.Child("__overlay__") != nil {
+			fragments++
+		}
+	}
+	if fragments == 0 {
+		return ""
+	}
+
+	refs := 0
+	t.Root.Child("__local_fixups__").Walk(func(n *fdt.Node) bool {
+		refs += len(n.Properties)
+		return true
+	})
+	if refs > 0 {
+		return fmt.Sprintf("overlay 有 %d 个属性包含内部 phandle 引用，应用时需要重新编号", refs)
+	}
+	return ""
+}
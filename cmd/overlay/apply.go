@@ -0,0 +1,287 @@
+package overlay
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// Fragment overlay 中的一个片段及其在基础设备树中的目标
+type Fragment struct {
+	Node    *fdt.Node // fragment@N 节点
+	Overlay *fdt.Node // __overlay__ 节点
+	Target  *fdt.Node // 基础设备树中的目标节点
+}
+
+// Apply 将 overlay 合并到基础设备树，语义与 libufdt 的 ufdt_apply_overlay 一致:
+// 先按基础设备树的最大 phandle 重新编号 overlay 内的 phandle 并修正 __local_fixups__
+// 记录的引用，再通过基础设备树的 __symbols__ 解析 __fixups__，最后合并各片段。
+// overlay 本身不会被修改
+func Apply(base, ov *fdt.Tree) error {
+	ov = ov.Clone()
+
+	if err := renumberPhandles(ov, base.MaxPhandle()); err != nil {
+		return err
+	}
+	if err := resolveFixups(base, ov); err != nil {
+		return err
+	}
+
+	fragments, err := Fragments(base, ov)
+	if err != nil {
+		return err
+	}
+	for _, f := range fragments {
+		merge(f.Target, f.Overlay)
+	}
+
+	updateSymbols(base, ov, fragments)
+	return nil
+}
+
+// renumberPhandles 将 overlay 中的 phandle 整体偏移 delta，
+// 并按 __local_fixups__ 更新属性中对这些 phandle 的引用
+func renumberPhandles(ov *fdt.Tree, delta uint32) error {
+	if delta == 0 {
+		return nil
+	}
+
+	var err error
+	ov.Root.Walk(func(n *fdt.Node) bool {
+		for _, name := range []string{"phandle", "linux,phandle"} {
+			p := n.Property(name)
+			if p == nil || len(p.Value) != 4 {
+				continue
+			}
+			ph := p.U32()
+			if ph == 0 || ph == 0xFFFFFFFF {
+				continue
+			}
+			if ph+delta < ph || ph+delta == 0xFFFFFFFF {
+				err = fmt.Errorf("%s: phandle 重新编号后溢出", n.Path())
+				return false
+			}
+			p.Value = fdt.U32Value(ph + delta)
+		}
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if local := ov.Root.Child("__local_fixups__"); local != nil {
+		return adjustLocalFixups(local, ov.Root, delta)
+	}
+	return nil
+}
+
+// adjustLocalFixups 递归处理 __local_fixups__，其结构与 overlay 树一一对应
+func adjustLocalFixups(fixups, n *fdt.Node, delta uint32) error {
+	for _, fp := range fixups.Properties {
+		p := n.Property(fp.Name)
+		if p == nil {
+			return fmt.Errorf("__local_fixups__ 引用了不存在的属性 %s:%s", n.Path(), fp.Name)
+		}
+		for _, off := range fp.U32s() {
+			if int(off)+4 > len(p.Value) {
+				return fmt.Errorf("__local_fixups__ 偏移越界 %s:%s:%d", n.Path(), p.Name, off)
+			}
+			ph := binary.BigEndian.Uint32(p.Value[off:])
+			binary.BigEndian.PutUint32(p.Value[off:], ph+delta)
+		}
+	}
+	for _, fc := range fixups.Children {
+		c := child(n, fc.Name)
+		if c == nil {
+			return fmt.Errorf("__local_fixups__ 引用了不存在的节点 %s", joinPath(n.Path(), fc.Name))
+		}
+		if err := adjustLocalFixups(fc, c, delta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveFixups 用基础设备树 __symbols__ 中的标签解析 overlay 的外部引用
+func resolveFixups(base, ov *fdt.Tree) error {
+	fixups := ov.Root.Child("__fixups__")
+	if fixups == nil || len(fixups.Properties) == 0 {
+		return nil
+	}
+
+	for _, fp := range fixups.Properties {
+		target, err := Symbol(base, fp.Name)
+		if err != nil {
+			return err
+		}
+		ph := target.Phandle()
+		if ph == 0 {
+			return fmt.Errorf("标签 %s 指向的节点 %s 没有 phandle", fp.Name, target.Path())
+		}
+
+		for _, entry := range fp.Strings() {
+			p, off, err := fixupLocation(ov, entry)
+			if err != nil {
+				return fmt.Errorf("__fixups__/%s: %v", fp.Name, err)
+			}
+			binary.BigEndian.PutUint32(p.Value[off:], ph)
+		}
+	}
+	return nil
+}
+
+// Symbol 在基础设备树的 __symbols__ 中查找标签对应的节点
+func Symbol(base *fdt.Tree, label string) (*fdt.Node, error) {
+	symbols := base.Root.Child("__symbols__")
+	if symbols == nil {
+		return nil, fmt.Errorf("基础设备树缺少 __symbols__ 节点，无法解析标签 %s (编译时需要 -@)", label)
+	}
+	sp := symbols.Property(label)
+	if sp == nil {
+		return nil, fmt.Errorf("基础设备树中不存在标签 %s", label)
+	}
+	target := base.Lookup(sp.String())
+	if target == nil {
+		return nil, fmt.Errorf("标签 %s 指向的路径 %s 不存在", label, sp.String())
+	}
+	return target, nil
+}
+
+// fixupLocation 解析 "路径:属性:偏移" 并返回 overlay 中对应的属性和偏移
+func fixupLocation(ov *fdt.Tree, entry string) (*fdt.Property, int, error) {
+	nodePath, propName, off, err := fdt.ParseFixup(entry)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	n := lookup(ov.Root, nodePath)
+	if n == nil {
+		return nil, 0, fmt.Errorf("节点 %s 不存在", nodePath)
+	}
+	p := n.Property(propName)
+	if p == nil {
+		return nil, 0, fmt.Errorf("属性 %s:%s 不存在", nodePath, propName)
+	}
+	if off+4 > len(p.Value) {
+		return nil, 0, fmt.Errorf("偏移 %d 超出属性 %s:%s 的范围", off, nodePath, propName)
+	}
+	return p, off, nil
+}
+
+// Fragments 返回 overlay 中的所有片段，并在基础设备树中定位其目标节点。
+// 没有 __overlay__ 子节点的顶层节点不是片段，会被忽略
+func Fragments(base, ov *fdt.Tree) ([]Fragment, error) {
+	var fragments []Fragment
+	for _, n := range ov.Root.Children {
+		o := child(n, "__overlay__")
+		if o == nil {
+			continue
+		}
+		target, err := fragmentTarget(base, n)
+		if err != nil {
+			return nil, err
+		}
+		fragments = append(fragments, Fragment{Node: n, Overlay: o, Target: target})
+	}
+	return fragments, nil
+}
+
+// fragmentTarget 根据 target 或 target-path 查找片段的目标节点
+func fragmentTarget(base *fdt.Tree, frag *fdt.Node) (*fdt.Node, error) {
+	if p := frag.Property("target"); p != nil {
+		if len(p.Value) != 4 {
+			return nil, fmt.Errorf("%s: target 属性长度无效", frag.Name)
+		}
+		ph := p.U32()
+		if ph == 0 || ph == 0xFFFFFFFF {
+			return nil, fmt.Errorf("%s: target 引用未解析", frag.Name)
+		}
+		target := base.FindPhandle(ph)
+		if target == nil {
+			return nil, fmt.Errorf("%s: 基础设备树中不存在 phandle 0x%x", frag.Name, ph)
+		}
+		return target, nil
+	}
+
+	if p := frag.Property("target-path"); p != nil {
+		target := base.Lookup(p.String())
+		if target == nil {
+			return nil, fmt.Errorf("%s: 目标路径 %s 不存在", frag.Name, p.String())
+		}
+		return target, nil
+	}
+	return nil, fmt.Errorf("%s: 缺少 target 或 target-path 属性", frag.Name)
+}
+
+// merge 将 overlay 节点的属性和子节点合并到目标节点。同名属性被覆盖，
+// 新属性和新子节点追加到末尾
+func merge(target, o *fdt.Node) {
+	for _, p := range o.Properties {
+		target.SetProperty(p.Name, append([]byte(nil), p.Value...))
+	}
+	for _, oc := range o.Children {
+		tc := child(target, oc.Name)
+		if tc == nil {
+			tc = target.AddChild(oc.Name)
+		}
+		merge(tc, oc)
+	}
+}
+
+// updateSymbols 把 overlay 的 __symbols__ 改写为合并后的路径并加入基础设备树，
+// 以便后续 overlay 引用本 overlay 定义的标签
+func updateSymbols(base, ov *fdt.Tree, fragments []Fragment) {
+	ovSymbols := ov.Root.Child("__symbols__")
+	baseSymbols := base.Root.Child("__symbols__")
+	if ovSymbols == nil || baseSymbols == nil {
+		return
+	}
+
+	for _, p := range ovSymbols.Properties {
+		parts := strings.SplitN(strings.TrimPrefix(p.String(), "/"), "/", 3)
+		if len(parts) < 2 || parts[1] != "__overlay__" {
+			continue
+		}
+		for _, f := range fragments {
+			if f.Node.Name != parts[0] {
+				continue
+			}
+			newPath := f.Target.Path()
+			if len(parts) == 3 {
+				newPath = joinPath(newPath, parts[2])
+			}
+			baseSymbols.SetProperty(p.Name, fdt.StringValue(newPath))
+		}
+	}
+}
+
+// child 按完整名称查找子节点，overlay 合并不做单元地址的模糊匹配
+func child(n *fdt.Node, name string) *fdt.Node {
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// lookup 按完整路径精确查找节点
+func lookup(root *fdt.Node, p string) *fdt.Node {
+	n := root
+	for _, part := range strings.Split(p, "/") {
+		if part == "" {
+			continue
+		}
+		if n = child(n, part); n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// joinPath 拼接父节点路径和子节点名
+func joinPath(parent, name string) string {
+	return strings.TrimSuffix(parent, "/") + "/" + name
+}
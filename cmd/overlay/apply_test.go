@@ -0,0 +1,176 @@
+package overlay
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+	"github.com/kiy7086/dtbotool/cmd/internal/dtstest"
+)
+
+// 基础设备树的 phandle 为 1 到 4，overlay 内部的 phandle 从 1 开始
+const baseSource = `/dts-v1/;
+/ {
+	clk: clock { #clock-cells = <1>; phandle = <1>; };
+	intc: intc { interrupt-controller; phandle = <3>; };
+	uart: serial@2000 { status = "disabled"; clocks = <&clk 0>; phandle = <4>; };
+	gpio: gpio { gpio-controller; phandle = <2>; };
+};
+`
+
+const overlaySource = `/dts-v1/;
+/plugin/;
+&uart {
+	status = "okay";
+	dev: device { #clock-cells = <0>; };
+	pin: pin { };
+	user {
+		local = <&dev 7 &pin>;
+		mixed = <&clk 5 &dev>;
+		parent = <&intc>;
+	};
+};
+`
+
+func TestApply(t *testing.T) {
+	base := dtstest.Compile(t, baseSource)
+	ov := dtstest.Compile(t, overlaySource)
+	before, err := ov.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Apply(base, ov); err != nil {
+		t.Fatal(err)
+	}
+
+	dev := base.Lookup("/serial@2000/device")
+	pin := base.Lookup("/serial@2000/pin")
+	user := base.Lookup("/serial@2000/user")
+	if dev == nil || pin == nil || user == nil {
+		t.Fatal("overlay 的节点没有合并到目标节点")
+	}
+
+	// overlay 内的 phandle 按基础设备树的最大 phandle 偏移
+	if dev.Phandle() != 5 || pin.Phandle() != 6 {
+		t.Errorf("phandle = %d, %d, 期望 5, 6", dev.Phandle(), pin.Phandle())
+	}
+
+	tests := []struct {
+		prop string
+		want []uint32
+	}{
+		{"local", []uint32{5, 7, 6}}, // __local_fixups__ 记录的引用随之偏移，其他单元不变
+		{"mixed", []uint32{1, 5, 5}}, // __fixups__ 和 __local_fixups__ 在同一属性中
+		{"parent", []uint32{3}},      // __fixups__ 解析为基础设备树中的 phandle
+	}
+	for _, tt := range tests {
+		p := user.Property(tt.prop)
+		if p == nil || !equalCells(p.U32s(), tt.want) {
+			t.Errorf("%s = %v, 期望 %v", tt.prop, p.U32s(), tt.want)
+		}
+	}
+
+	if got := base.Lookup("/serial@2000").Property("status").String(); got != "okay" {
+		t.Errorf("status = %q", got)
+	}
+	if got := base.Lookup("/__symbols__").Property("dev"); got == nil || got.String() != "/serial@2000/device" {
+		t.Error("overlay 的标签没有加入基础设备树的 __symbols__")
+	}
+
+	after, err := ov.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("Apply 修改了 overlay")
+	}
+}
+
+// TestApplyStacked 后应用的 overlay 可以引用先前 overlay 定义的标签，phandle 不冲突
+func TestApplyStacked(t *testing.T) {
+	base := dtstest.Compile(t, baseSource)
+	if err := Apply(base, dtstest.Compile(t, overlaySource)); err != nil {
+		t.Fatal(err)
+	}
+	second := dtstest.Compile(t, "/dts-v1/;\n/plugin/;\n&dev { link = <&more &pin>; more: more { }; };\n")
+	if err := Apply(base, second); err != nil {
+		t.Fatal(err)
+	}
+
+	more := base.Lookup("/serial@2000/device/more")
+	if more == nil || more.Phandle() != 7 {
+		t.Fatalf("第二个 overlay 的 phandle 没有在前一个之后编号")
+	}
+	link := base.Lookup("/serial@2000/device").Property("link")
+	if link == nil || !equalCells(link.U32s(), []uint32{7, 6}) {
+		t.Errorf("link = %v, 期望 [7 6]", link.U32s())
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		noSymbols bool // 删除基础设备树的 __symbols__
+		ov        string
+		edit      func(ov *fdt.Tree)
+		want      string
+	}{
+		{
+			name: "未知标签",
+			ov:   "/dts-v1/;\n/plugin/;\n&nope { x; };\n",
+			want: "不存在标签 nope",
+		},
+		{
+			name:      "基础设备树缺少 __symbols__",
+			noSymbols: true,
+			ov:        overlaySource,
+			want:      "缺少 __symbols__",
+		},
+		{
+			name: "__local_fixups__ 偏移越界",
+			ov:   overlaySource,
+			edit: func(ov *fdt.Tree) {
+				ov.Lookup("/__local_fixups__/fragment@0/__overlay__/user").SetProperty("local", fdt.CellsValue(12))
+			},
+			want: "偏移越界",
+		},
+		{
+			name: "__fixups__ 指向不存在的属性",
+			ov:   overlaySource,
+			edit: func(ov *fdt.Tree) {
+				ov.Lookup("/__fixups__").SetProperty("clk", fdt.StringValue("/fragment@0/__overlay__/user:none:0"))
+			},
+			want: "属性 /fragment@0/__overlay__/user:none 不存在",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := dtstest.Compile(t, baseSource)
+			if tt.noSymbols {
+				base.Root.RemoveChild(base.Root.Child("__symbols__"))
+			}
+			ov := dtstest.Compile(t, tt.ov)
+			if tt.edit != nil {
+				tt.edit(ov)
+			}
+			err := Apply(base, ov)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("错误 = %v, 期望包含 %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func equalCells(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+package overlay
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// Change 应用 overlay 后基础设备树中一个节点的变化
+type Change struct {
+	Path     string
+	Added    bool     // 节点由 overlay 新建
+	Modified []string // 被覆盖为不同值的已有属性
+	New      []string // 新增的属性
+}
+
+// Target 片段与其目标节点
+type Target struct {
+	Fragment string
+	Path     string
+	Label    string // 通过 __fixups__ 引用的标签，使用 target-path 时为空
+}
+
+// Report overlay 相对基础设备树的检查结果
+type Report struct {
+	Targets  []Target
+	Changes  []Change
+	Errors   []string
+	Warnings []string
+}
+
+func (r *Report) errorf(format string, args ...any) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+}
+
+// Check 检查 overlay 能否应用到基础设备树: 片段目标、__fixups__ 标签和
+// target-path 是否存在，phandle 是否冲突，并列出会被修改的基础设备树节点
+func Check(base, ov *fdt.Tree) *Report {
+	r := &Report{}
+	ov = ov.Clone()
+
+	if err := renumberPhandles(ov, base.MaxPhandle()); err != nil {
+		r.errorf("%v", err)
+	}
+
+	// 逐个解析外部引用，记录片段 target 使用的标签
+	targetLabels := make(map[string]string)
+	unresolved := make(map[string]bool)
+	if fixups := ov.Root.Child("__fixups__"); fixups != nil {
+		for _, fp := range fixups.Properties {
+			var ph uint32
+			target, err := Symbol(base, fp.Name)
+			if err != nil {
+				r.errorf("%v", err)
+				unresolved[fp.Name] = true
+			} else if ph = target.Phandle(); ph == 0 {
+				r.errorf("标签 %s 指向的节点 %s 没有 phandle", fp.Name, target.Path())
+				unresolved[fp.Name] = true
+			}
+
+			for _, entry := range fp.Strings() {
+				p, off, err := fixupLocation(ov, entry)
+				if err != nil {
+					r.errorf("__fixups__/%s: %v", fp.Name, err)
+					continue
+				}
+				if loc, ok := strings.CutSuffix(entry, ":target:0"); ok {
+					targetLabels[strings.TrimPrefix(loc, "/")] = fp.Name
+				}
+				if ph != 0 {
+					binary.BigEndian.PutUint32(p.Value[off:], ph)
+				}
+			}
+		}
+	}
+
+	merged := base.Clone()
+	fragments := 0
+	for _, n := range ov.Root.Children {
+		o := child(n, "__overlay__")
+		if o == nil {
+			continue
+		}
+		fragments++
+
+		label := targetLabels[n.Name]
+		target, err := fragmentTarget(base, n)
+		if err != nil {
+			// 标签无法解析时错误已在上面报告
+			if !unresolved[label] {
+				r.errorf("%v", err)
+			}
+			continue
+		}
+		r.Targets = append(r.Targets, Target{Fragment: n.Name, Path: target.Path(), Label: label})
+
+		r.checkPhandle(target, o)
+		r.collectChanges(target, o, target.Path())
+		merge(merged.Lookup(target.Path()), o)
+	}
+
+	if fragments == 0 {
+		r.Warnings = append(r.Warnings, "overlay 不包含任何片段")
+	}
+	r.checkDuplicatePhandles(merged)
+	return r
+}
+
+// checkPhandle 检查 overlay 是否会覆盖已有节点的 phandle
+func (r *Report) checkPhandle(target, o *fdt.Node) {
+	for _, name := range []string{"phandle", "linux,phandle"} {
+		op := o.Property(name)
+		bp := target.Property(name)
+		if op != nil && bp != nil && !bytes.Equal(op.Value, bp.Value) {
+			r.errorf("overlay 会将 %s 的 %s 从 0x%x 改为 0x%x", target.Path(), name, bp.U32(), op.U32())
+		}
+	}
+	for _, oc := range o.Children {
+		if tc := child(target, oc.Name); tc != nil {
+			r.checkPhandle(tc, oc)
+		}
+	}
+}
+
+// collectChanges 递归比较 overlay 节点与目标节点，记录变化
+func (r *Report) collectChanges(target, o *fdt.Node, path string) {
+	c := Change{Path: path, Added: target == nil}
+	for _, p := range o.Properties {
+		switch {
+		case target == nil:
+		case target.Property(p.Name) == nil:
+			c.New = append(c.New, p.Name)
+		case !bytes.Equal(target.Property(p.Name).Value, p.Value):
+			c.Modified = append(c.Modified, p.Name)
+		}
+	}
+	if c.Added || len(c.New) > 0 || len(c.Modified) > 0 {
+		r.Changes = append(r.Changes, c)
+	}
+
+	for _, oc := range o.Children {
+		var tc *fdt.Node
+		if target != nil {
+			tc = child(target, oc.Name)
+		}
+		r.collectChanges(tc, oc, joinPath(path, oc.Name))
+	}
+}
+
+// checkDuplicatePhandles 检查合并后的设备树中是否有重复的 phandle
+func (r *Report) checkDuplicatePhandles(t *fdt.Tree) {
+	paths := make(map[uint32][]string)
+	t.Root.Walk(func(n *fdt.Node) bool {
+		if ph := n.Phandle(); ph != 0 {
+			paths[ph] = append(paths[ph], n.Path())
+		}
+		return true
+	})
+
+	var dups []uint32
+	for ph, p := range paths {
+		if len(p) > 1 {
+			dups = append(dups, ph)
+		}
+	}
+	sort.Slice(dups, func(i, j int) bool { return dups[i] < dups[j] })
+	for _, ph := range dups {
+		r.errorf("应用后 phandle 0x%x 重复: %v", ph, paths[ph])
+	}
+}
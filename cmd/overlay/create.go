@@ -0,0 +1,311 @@
+package overlay
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// 生成 overlay 时不参与比较的特殊节点
+var generatedNodes = map[string]bool{
+	"__symbols__":      true,
+	"__fixups__":       true,
+	"__local_fixups__": true,
+}
+
+// copiedProp 复制到 overlay 中的属性及其在修改后设备树中的来源
+type copiedProp struct {
+	src     *fdt.Node
+	srcProp *fdt.Property
+	dst     *fdt.Node
+	dstProp *fdt.Property
+}
+
+// creator 比较基础设备树和修改后的设备树，生成 overlay
+type creator struct {
+	base, mod *fdt.Tree
+	refs      *fdt.Refs
+	labels    map[string]string // 基础设备树节点路径 -> __symbols__ 标签
+
+	ov        *fdt.Tree
+	fragments int
+	props     []copiedProp
+	newNodes  []*fdt.Node             // 修改后设备树中新增的节点，按复制顺序
+	copies    map[*fdt.Node]*fdt.Node // 新增节点 -> overlay 中的副本
+	phandles  map[*fdt.Node]uint32    // 新增节点 -> overlay 内的 phandle
+	fixups    *fdt.Node
+	local     *fdt.Node
+	warnings  []string
+}
+
+// Create 比较基础设备树和修改后的设备树，生成把前者变为后者的最小 overlay。
+// 每个被修改的已有节点对应一个片段，基础设备树 __symbols__ 中有标签时用
+// target 引用标签，否则使用 target-path。overlay 无法删除节点或属性，
+// 这类差异以警告返回
+func Create(base, modified *fdt.Tree) (*fdt.Tree, []string, error) {
+	c := &creator{
+		base:     base,
+		mod:      modified,
+		refs:     fdt.NewRefs(modified),
+		labels:   make(map[string]string),
+		ov:       fdt.NewTree(),
+		copies:   make(map[*fdt.Node]*fdt.Node),
+		phandles: make(map[*fdt.Node]uint32),
+		fixups:   &fdt.Node{Name: "__fixups__"},
+		local:    &fdt.Node{Name: "__local_fixups__"},
+	}
+	if symbols := base.Root.Child("__symbols__"); symbols != nil {
+		for _, p := range symbols.Properties {
+			if _, ok := c.labels[p.String()]; !ok {
+				c.labels[p.String()] = p.Name
+			}
+		}
+	}
+
+	if !slices.Equal(base.Reserve, modified.Reserve) {
+		c.warnf("overlay 无法修改 /memreserve/ 条目，已忽略")
+	}
+
+	c.diff(base.Root, modified.Root)
+	if c.fragments == 0 {
+		return nil, c.warnings, fmt.Errorf("两个设备树没有可以用 overlay 表示的差异")
+	}
+
+	c.assignPhandles()
+	if err := c.resolveRefs(); err != nil {
+		return nil, c.warnings, err
+	}
+	c.addSymbols()
+	for _, n := range []*fdt.Node{c.fixups, c.local} {
+		if len(n.Properties) > 0 || len(n.Children) > 0 {
+			n.Parent = c.ov.Root
+			c.ov.Root.Children = append(c.ov.Root.Children, n)
+		}
+	}
+	return c.ov, c.warnings, nil
+}
+
+func (c *creator) warnf(format string, args ...any) {
+	c.warnings = append(c.warnings, fmt.Sprintf(format, args...))
+}
+
+// diff 比较一对同路径节点，有变化时生成片段，然后递归比较共有的子节点
+func (c *creator) diff(b, m *fdt.Node) {
+	var changed []*fdt.Property
+	for _, p := range m.Properties {
+		if p.Name == "phandle" || p.Name == "linux,phandle" {
+			continue
+		}
+		bp := b.Property(p.Name)
+		if bp == nil || !bytes.Equal(bp.Value, c.translate(m, p)) {
+			changed = append(changed, p)
+		}
+	}
+	for _, bp := range b.Properties {
+		if m.Property(bp.Name) == nil {
+			c.warnf("overlay 无法删除属性 %s:%s，已忽略", b.Path(), bp.Name)
+		}
+	}
+
+	var added, common []*fdt.Node
+	for _, mc := range m.Children {
+		if b.Parent == nil && generatedNodes[mc.Name] {
+			continue
+		}
+		if child(b, mc.Name) == nil {
+			added = append(added, mc)
+		} else {
+			common = append(common, mc)
+		}
+	}
+	for _, bc := range b.Children {
+		if b.Parent == nil && generatedNodes[bc.Name] {
+			continue
+		}
+		if child(m, bc.Name) == nil {
+			c.warnf("overlay 无法删除节点 %s，已忽略", bc.Path())
+		}
+	}
+
+	if len(changed) > 0 || len(added) > 0 {
+		o := c.fragment(b)
+		for _, p := range changed {
+			c.copyProp(m, p, o)
+		}
+		for _, mc := range added {
+			c.copyNode(mc, o)
+		}
+	}
+
+	for _, mc := range common {
+		c.diff(child(b, mc.Name), mc)
+	}
+}
+
+// translate 将属性中指向已有节点的 phandle 换成基础设备树中的值，
+// 避免两个设备树 phandle 编号不同造成误报
+func (c *creator) translate(m *fdt.Node, p *fdt.Property) []byte {
+	refs := c.refs.Find(m, p)
+	if len(refs) == 0 {
+		return p.Value
+	}
+	v := append([]byte(nil), p.Value...)
+	for _, ref := range refs {
+		if ref.Target == nil {
+			continue
+		}
+		if bt := lookup(c.base.Root, ref.Target.Path()); bt != nil && bt.Phandle() != 0 {
+			binary.BigEndian.PutUint32(v[ref.Offset:], bt.Phandle())
+		}
+	}
+	return v
+}
+
+// fragment 新建指向基础设备树节点的片段，返回其 __overlay__ 节点
+func (c *creator) fragment(target *fdt.Node) *fdt.Node {
+	frag := c.ov.Root.AddChild(fmt.Sprintf("fragment@%d", c.fragments))
+	c.fragments++
+
+	if label, ok := c.labels[target.Path()]; ok && target.Phandle() != 0 {
+		frag.SetProperty("target", fdt.U32Value(0xFFFFFFFF))
+		c.addFixup(label, frag.Path(), "target", 0)
+	} else {
+		frag.SetProperty("target-path", fdt.StringValue(target.Path()))
+	}
+	return frag.AddChild("__overlay__")
+}
+
+func (c *creator) copyProp(src *fdt.Node, p *fdt.Property, dst *fdt.Node) {
+	dp := dst.SetProperty(p.Name, append([]byte(nil), p.Value...))
+	c.props = append(c.props, copiedProp{src: src, srcProp: p, dst: dst, dstProp: dp})
+}
+
+// copyNode 把新增的节点及其子树复制到 overlay
+func (c *creator) copyNode(src, parent *fdt.Node) {
+	dst := parent.AddChild(src.Name)
+	c.newNodes = append(c.newNodes, src)
+	c.copies[src] = dst
+	for _, p := range src.Properties {
+		c.copyProp(src, p, dst)
+	}
+	for _, sc := range src.Children {
+		c.copyNode(sc, dst)
+	}
+}
+
+// assignPhandles 为新增节点从1开始重新分配 phandle，应用时再整体偏移
+func (c *creator) assignPhandles() {
+	var next uint32
+	for _, src := range c.newNodes {
+		if src.Phandle() == 0 {
+			continue
+		}
+		next++
+		c.phandles[src] = next
+		dst := c.copies[src]
+		for _, name := range []string{"phandle", "linux,phandle"} {
+			if p := dst.Property(name); p != nil {
+				p.Value = fdt.U32Value(next)
+			}
+		}
+	}
+}
+
+// resolveRefs 改写复制属性中的 phandle 引用: 指向新增节点的记录到
+// __local_fixups__，指向带标签的已有节点的记录到 __fixups__，其他已有节点
+// 的 phandle 应用后不变，直接使用基础设备树中的值。无法识别的属性原样复制，
+// 其中可能是引用且应用后会指向其他节点的数值以警告报告
+func (c *creator) resolveRefs() error {
+	for _, cp := range c.props {
+		c.checkPossible(cp)
+		for _, ref := range c.refs.Find(cp.src, cp.srcProp) {
+			if ref.Target == nil {
+				continue
+			}
+			if ph, ok := c.phandles[ref.Target]; ok {
+				binary.BigEndian.PutUint32(cp.dstProp.Value[ref.Offset:], ph)
+				c.addLocalFixup(cp.dst.Path(), cp.dstProp.Name, ref.Offset)
+				continue
+			}
+
+			bt := lookup(c.base.Root, ref.Target.Path())
+			if bt == nil {
+				return fmt.Errorf("%s:%s 引用的节点 %s 不在 overlay 中", cp.src.Path(), cp.srcProp.Name, ref.Target.Path())
+			}
+			if bt.Phandle() == 0 {
+				return fmt.Errorf("%s:%s 引用的节点 %s 在基础设备树中没有 phandle", cp.src.Path(), cp.srcProp.Name, bt.Path())
+			}
+			if label, ok := c.labels[bt.Path()]; ok {
+				binary.BigEndian.PutUint32(cp.dstProp.Value[ref.Offset:], 0xFFFFFFFF)
+				c.addFixup(label, cp.dst.Path(), cp.dstProp.Name, ref.Offset)
+			} else {
+				binary.BigEndian.PutUint32(cp.dstProp.Value[ref.Offset:], bt.Phandle())
+			}
+		}
+	}
+	return nil
+}
+
+// checkPossible 检查无法识别的属性中等于 phandle 的数值。指向新增节点或
+// phandle 与基础设备树不同的节点时，原样复制的数值应用后会指向错误的节点
+func (c *creator) checkPossible(cp copiedProp) {
+	for _, ref := range c.refs.Possible(cp.src, cp.srcProp) {
+		_, added := c.phandles[ref.Target]
+		if !added {
+			if bt := lookup(c.base.Root, ref.Target.Path()); bt != nil && bt.Phandle() == ref.Target.Phandle() {
+				continue
+			}
+		}
+		c.warnf("%s:%s 无法识别，偏移 %d 处的 0x%x 等于 %s 的 phandle，如果是引用，应用后将指向错误的节点，"+
+			"请确认或在 overlay 源码中改用 &标签",
+			cp.src.Path(), cp.srcProp.Name, ref.Offset, ref.Target.Phandle(), ref.Target.Path())
+	}
+}
+
+func (c *creator) addFixup(label, path, prop string, off int) {
+	entry := fmt.Sprintf("%s:%s:%d", path, prop, off)
+	p := c.fixups.Property(label)
+	if p == nil {
+		c.fixups.SetProperty(label, fdt.StringValue(entry))
+		return
+	}
+	p.Value = fdt.StringValue(append(p.Strings(), entry)...)
+}
+
+func (c *creator) addLocalFixup(path, prop string, off int) {
+	n := c.local
+	for _, part := range strings.Split(path, "/") {
+		if part != "" {
+			n = n.AddChild(part)
+		}
+	}
+	p := n.Property(prop)
+	if p == nil {
+		p = n.SetProperty(prop, nil)
+	}
+	p.Value = binary.BigEndian.AppendUint32(p.Value, uint32(off))
+}
+
+// addSymbols 为新增节点上的标签生成 overlay 的 __symbols__
+func (c *creator) addSymbols() {
+	symbols := c.mod.Root.Child("__symbols__")
+	if symbols == nil {
+		return
+	}
+	var out *fdt.Node
+	for _, p := range symbols.Properties {
+		n := lookup(c.mod.Root, p.String())
+		dst, ok := c.copies[n]
+		if n == nil || !ok {
+			continue
+		}
+		if out == nil {
+			out = c.ov.Root.AddChild("__symbols__")
+		}
+		out.SetProperty(p.Name, fdt.StringValue(dst.Path()))
+	}
+}
@@ -0,0 +1,53 @@
+// Package parallel 以固定数量的工作协程并发处理一组文件。每个任务的输出先写入
+// 各自的缓冲区，再按任务顺序输出，并发执行时的输出与顺序执行相同
+package parallel
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"runtime"
+)
+
+// Jobs 返回实际使用的并发数，n 不大于 0 时使用CPU数量
+func Jobs(n int) int {
+	if n <= 0 {
+		return runtime.NumCPU()
+	}
+	return n
+}
+
+// Run 以 jobs 个工作协程对序号 0..count-1 执行 fn，fn 的输出写入 w。
+// 任务的输出按序号写到标准输出，前面的任务都完成后立即输出。
+// 返回每个任务的错误，下标与序号对应
+func Run(jobs, count int, fn func(i int, w io.Writer) error) []error {
+	errs := make([]error, count)
+	bufs := make([]bytes.Buffer, count)
+	done := make([]chan struct{}, count)
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	next := make(chan int)
+	go func() {
+		for i := range count {
+			next <- i
+		}
+		close(next)
+	}()
+	for range min(Jobs(jobs), count) {
+		go func() {
+			for i := range next {
+				errs[i] = fn(i, &bufs[i])
+				close(done[i])
+			}
+		}()
+	}
+
+	for i := range count {
+		<-done[i]
+		os.Stdout.Write(bufs[i].Bytes())
+		bufs[i] = bytes.Buffer{}
+	}
+	return errs
+}
@@ -0,0 +1,99 @@
+package prop
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/backup"
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+	"github.com/kiy7086/dtbotool/cmd/input"
+)
+
+// HandleGet 读取节点的属性值。未指定属性时列出节点的所有属性和子节点
+func HandleGet(spec, path, name string, t Type) error {
+	item, err := input.LoadOne(spec)
+	if err != nil {
+		return err
+	}
+	n, err := lookup(item.Tree, path)
+	if err != nil {
+		return err
+	}
+
+	if name == "" {
+		for _, p := range n.Properties {
+			value, err := Format(p, Auto)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s = %s\n", p.Name, strings.ReplaceAll(value, "\n", ", "))
+		}
+		for _, c := range n.Children {
+			fmt.Printf("%s/\n", c.Name)
+		}
+		return nil
+	}
+
+	p := n.Property(name)
+	if p == nil {
+		return fmt.Errorf("节点 %s 没有属性 %s", n.Path(), name)
+	}
+	value, err := Format(p, t)
+	if err != nil {
+		return fmt.Errorf("%s:%s: %v", n.Path(), name, err)
+	}
+	fmt.Println(value)
+	return nil
+}
+
+// HandleSet 设置节点的属性值并写回文件，属性不存在时创建。
+// create 为 true 时自动创建不存在的节点，output 为空时覆盖原文件并先创建备份
+func HandleSet(spec, path, name string, args []string, t Type, create bool, output string) error {
+	item, err := input.LoadOne(spec)
+	if err != nil {
+		return err
+	}
+	if err := input.CheckWritable(item.Path); err != nil {
+		return err
+	}
+
+	value, err := Parse(t, args)
+	if err != nil {
+		return err
+	}
+
+	n := item.Tree.Lookup(path)
+	if n == nil && create && strings.HasPrefix(path, "/") {
+		n = item.Tree.Root
+		for _, part := range strings.Split(path, "/") {
+			if part != "" {
+				n = n.AddChild(part)
+			}
+		}
+	}
+	if n == nil {
+		return fmt.Errorf("节点 %s 不存在", path)
+	}
+
+	n.SetProperty(name, value)
+	if output == "" {
+		output = item.Path
+		if _, err := backup.CreateBackup(item.Path); err != nil {
+			fmt.Printf("警告: 备份失败: %v\n", err)
+		}
+	}
+	if err := input.Save(item, output); err != nil {
+		return err
+	}
+	fmt.Printf("已设置 %s:%s (%d 字节)，输出: %s\n", n.Path(), name, len(value), output)
+	return nil
+}
+
+// lookup 按路径或别名查找节点
+func lookup(t *fdt.Tree, path string) (*fdt.Node, error) {
+	n := t.Lookup(path)
+	if n == nil {
+		return nil, fmt.Errorf("节点 %s 不存在", path)
+	}
+	return n, nil
+}
@@ -0,0 +1,145 @@
+package prop
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// Type 属性值的类型
+type Type int
+
+const (
+	Auto Type = iota
+	String
+	U32
+	U64
+	Bytes
+)
+
+// ParseType 解析命令行中的类型名
+func ParseType(name string) (Type, error) {
+	switch strings.ToLower(name) {
+	case "", "auto":
+		return Auto, nil
+	case "s", "str", "string":
+		return String, nil
+	case "u", "u32", "cells":
+		return U32, nil
+	case "u64":
+		return U64, nil
+	case "b", "bytes":
+		return Bytes, nil
+	}
+	return Auto, fmt.Errorf("未知的值类型: %s (可选 string/u32/u64/bytes)", name)
+}
+
+// Format 按类型将属性值格式化为文本，字符串列表每行一个
+func Format(p *fdt.Property, t Type) (string, error) {
+	if t == Auto {
+		t = guess(p.Value)
+	}
+
+	switch t {
+	case String:
+		if len(p.Value) == 0 {
+			return "", nil
+		}
+		return strings.Join(p.Strings(), "\n"), nil
+	case U32:
+		if len(p.Value)%4 != 0 {
+			return "", fmt.Errorf("属性长度 %d 不是4的倍数", len(p.Value))
+		}
+		var parts []string
+		for _, c := range p.U32s() {
+			parts = append(parts, fmt.Sprintf("0x%x", c))
+		}
+		return strings.Join(parts, " "), nil
+	case U64:
+		if len(p.Value)%8 != 0 {
+			return "", fmt.Errorf("属性长度 %d 不是8的倍数", len(p.Value))
+		}
+		var parts []string
+		for i := 0; i < len(p.Value); i += 8 {
+			parts = append(parts, fmt.Sprintf("0x%x", (&fdt.Property{Value: p.Value[i:]}).U64()))
+		}
+		return strings.Join(parts, " "), nil
+	default:
+		var parts []string
+		for _, b := range p.Value {
+			parts = append(parts, fmt.Sprintf("%02x", b))
+		}
+		return strings.Join(parts, " "), nil
+	}
+}
+
+// guess 推测属性值的类型
+func guess(v []byte) Type {
+	switch {
+	case fdt.IsStringList(v):
+		return String
+	case len(v) > 0 && len(v)%4 == 0:
+		return U32
+	}
+	return Bytes
+}
+
+// Parse 按类型将命令行参数编码为属性值。自动类型下参数全部是整数时
+// 编码为32位单元，否则编码为字符串列表
+func Parse(t Type, args []string) ([]byte, error) {
+	if t == Auto {
+		t = U32
+		for _, a := range args {
+			if _, err := parseUint(a, 32); err != nil {
+				t = String
+				break
+			}
+		}
+	}
+
+	switch t {
+	case String:
+		return fdt.StringValue(args...), nil
+	case U32:
+		var cells []uint32
+		for _, a := range args {
+			v, err := parseUint(a, 32)
+			if err != nil {
+				return nil, err
+			}
+			cells = append(cells, uint32(v))
+		}
+		return fdt.CellsValue(cells...), nil
+	case U64:
+		var out []byte
+		for _, a := range args {
+			v, err := parseUint(a, 64)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, fdt.U64Value(v)...)
+		}
+		return out, nil
+	default:
+		data, err := hex.DecodeString(strings.Join(strings.Fields(strings.Join(args, " ")), ""))
+		if err != nil {
+			return nil, fmt.Errorf("无效的十六进制字节: %v", err)
+		}
+		return data, nil
+	}
+}
+
+// parseUint 解析整数，支持 0x 前缀和负数的补码形式
+func parseUint(s string, bits int) (uint64, error) {
+	if v, err := strconv.ParseUint(s, 0, bits); err == nil {
+		return v, nil
+	}
+	v, err := strconv.ParseInt(s, 0, bits)
+	if err != nil {
+		return 0, fmt.Errorf("无效的整数: %s", s)
+	}
+	return uint64(v) & (1<<bits - 1), nil
+}
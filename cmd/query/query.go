@@ -0,0 +1,329 @@
+package query
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// Selector 解析后的节点选择器，语法:
+//
+//	[&标签][/路径/模式][谓词...]
+//
+// 路径段支持 * ? 通配，** 匹配任意层级；不含单元地址的段也匹配带地址的节点。
+// [ 总是开始一个谓词，因此路径段不支持 [] 字符类。
+// 谓词形如 [prop]、[!prop]、[prop=值]、[prop!=值]、[prop~=子串]、[prop^=前缀]、
+// [prop$=后缀]，多个谓词需要同时满足。省略路径时匹配所有节点
+type Selector struct {
+	label    string
+	segments []string
+	preds    []predicate
+}
+
+type predicate struct {
+	prop   string
+	op     string // 为空时只检查属性是否存在
+	value  string
+	negate bool
+}
+
+// 谓词运算符，较长的放在前面
+var operators = []string{"~=", "^=", "$=", "!=", "="}
+
+// Parse 解析选择器
+func Parse(selector string) (*Selector, error) {
+	s := &Selector{}
+	rest := strings.TrimSpace(selector)
+
+	if strings.HasPrefix(rest, "&") {
+		end := strings.IndexAny(rest, "/[")
+		if end < 0 {
+			end = len(rest)
+		}
+		s.label = rest[1:end]
+		if s.label == "" {
+			return nil, fmt.Errorf("& 之后需要标签名")
+		}
+		rest = rest[end:]
+	}
+
+	end := strings.IndexByte(rest, '[')
+	if end < 0 {
+		end = len(rest)
+	}
+	pathPart := rest[:end]
+	rest = rest[end:]
+
+	switch {
+	case pathPart == "" && s.label == "":
+		s.segments = []string{"**"}
+	case pathPart != "":
+		if !strings.HasPrefix(pathPart, "/") {
+			return nil, fmt.Errorf("路径必须以 / 开头: %s", pathPart)
+		}
+		for _, seg := range strings.Split(pathPart, "/") {
+			if seg == "" {
+				continue
+			}
+			if _, err := path.Match(seg, ""); err != nil {
+				return nil, fmt.Errorf("无效的路径模式: %s", seg)
+			}
+			s.segments = append(s.segments, seg)
+		}
+	}
+
+	for rest != "" {
+		pred, n, err := parsePredicate(rest)
+		if err != nil {
+			return nil, err
+		}
+		s.preds = append(s.preds, pred)
+		rest = strings.TrimSpace(rest[n:])
+	}
+	return s, nil
+}
+
+// parsePredicate 解析一个 [...] 谓词，返回消耗的长度
+func parsePredicate(s string) (predicate, int, error) {
+	var p predicate
+	if s[0] != '[' {
+		return p, 0, fmt.Errorf("需要 '[': %s", s)
+	}
+	i := 1
+	if i < len(s) && s[i] == '!' {
+		p.negate = true
+		i++
+	}
+
+	start := i
+	for i < len(s) && s[i] != ']' && !strings.ContainsRune("=~^$!", rune(s[i])) {
+		i++
+	}
+	p.prop = strings.TrimSpace(s[start:i])
+	if p.prop == "" {
+		return p, 0, fmt.Errorf("谓词缺少属性名: %s", s)
+	}
+	if i >= len(s) {
+		return p, 0, fmt.Errorf("谓词缺少 ']': %s", s)
+	}
+	if s[i] == ']' {
+		return p, i + 1, nil
+	}
+
+	if p.negate {
+		return p, 0, fmt.Errorf("[!属性] 不能带比较: %s", s)
+	}
+	for _, op := range operators {
+		if strings.HasPrefix(s[i:], op) {
+			p.op = op
+			i += len(op)
+			break
+		}
+	}
+	if p.op == "" {
+		return p, 0, fmt.Errorf("无效的运算符: %s", s[i:])
+	}
+
+	// 值可以加引号以包含 ] 或空格
+	for i < len(s) && s[i] == ' ' {
+		i++
+	}
+	if i < len(s) && s[i] == '"' {
+		end := i + 1
+		for end < len(s) && s[end] != '"' {
+			if s[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(s) {
+			return p, 0, fmt.Errorf("引号未结束: %s", s[i:])
+		}
+		v, err := strconv.Unquote(s[i : end+1])
+		if err != nil {
+			return p, 0, fmt.Errorf("无效的字符串 %s", s[i:end+1])
+		}
+		p.value = v
+		i = end + 1
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		if i >= len(s) || s[i] != ']' {
+			return p, 0, fmt.Errorf("谓词缺少 ']': %s", s)
+		}
+		return p, i + 1, nil
+	}
+
+	end := strings.IndexByte(s[i:], ']')
+	if end < 0 {
+		return p, 0, fmt.Errorf("谓词缺少 ']': %s", s)
+	}
+	p.value = strings.TrimSpace(s[i : i+end])
+	return p, i + end + 1, nil
+}
+
+// Props 返回谓词中涉及的属性名，按出现顺序去重
+func (s *Selector) Props() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, p := range s.preds {
+		if !p.negate && !seen[p.prop] {
+			seen[p.prop] = true
+			names = append(names, p.prop)
+		}
+	}
+	return names
+}
+
+// Match 返回设备树中匹配选择器的节点，按树的遍历顺序排列
+func (s *Selector) Match(t *fdt.Tree) []*fdt.Node {
+	var starts []*fdt.Node
+	if s.label == "" {
+		starts = []*fdt.Node{t.Root}
+	} else {
+		starts = labelTargets(t, s.label)
+	}
+
+	found := make(map[*fdt.Node]bool)
+	for _, n := range starts {
+		matchSegments(n, s.segments, found)
+	}
+
+	var nodes []*fdt.Node
+	t.Root.Walk(func(n *fdt.Node) bool {
+		if found[n] && s.matchPredicates(n) {
+			nodes = append(nodes, n)
+		}
+		return true
+	})
+	return nodes
+}
+
+// labelTargets 查找标签对应的节点。overlay 中还包括以该标签为目标的片段的 __overlay__ 节点
+func labelTargets(t *fdt.Tree, label string) []*fdt.Node {
+	var nodes []*fdt.Node
+	if n := t.FindLabel(label); n != nil {
+		nodes = append(nodes, n)
+	} else if symbols := t.Root.Child("__symbols__"); symbols != nil {
+		if p := symbols.Property(label); p != nil {
+			if n := t.Lookup(p.String()); n != nil {
+				nodes = append(nodes, n)
+			}
+		}
+	}
+
+	if fixups := t.Root.Child("__fixups__"); fixups != nil {
+		if p := fixups.Property(label); p != nil {
+			for _, entry := range p.Strings() {
+				frag, ok := strings.CutSuffix(entry, ":target:0")
+				if !ok {
+					continue
+				}
+				if n := t.Lookup(frag + "/__overlay__"); n != nil {
+					nodes = append(nodes, n)
+				}
+			}
+		}
+	}
+	return nodes
+}
+
+// matchSegments 从节点 n 开始匹配剩余的路径段
+func matchSegments(n *fdt.Node, segs []string, found map[*fdt.Node]bool) {
+	if len(segs) == 0 {
+		found[n] = true
+		return
+	}
+	if segs[0] == "**" {
+		// ** 匹配零层或多层
+		matchSegments(n, segs[1:], found)
+		for _, c := range n.Children {
+			matchSegments(c, segs, found)
+		}
+		return
+	}
+	for _, c := range n.Children {
+		if matchName(segs[0], c) {
+			matchSegments(c, segs[1:], found)
+		}
+	}
+}
+
+// matchName 匹配节点名，不含 @ 的模式也可以匹配去掉单元地址的节点名
+func matchName(pattern string, n *fdt.Node) bool {
+	if ok, _ := path.Match(pattern, n.Name); ok {
+		return true
+	}
+	if strings.Contains(pattern, "@") {
+		return false
+	}
+	ok, _ := path.Match(pattern, n.BaseName())
+	return ok
+}
+
+func (s *Selector) matchPredicates(n *fdt.Node) bool {
+	for _, pred := range s.preds {
+		p := n.Property(pred.prop)
+		if pred.negate {
+			if p != nil {
+				return false
+			}
+			continue
+		}
+		if p == nil || pred.op != "" && !pred.match(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// match 比较属性值。字符串列表逐项比较，其他值按整数单元比较
+func (pred *predicate) match(p *fdt.Property) bool {
+	if pred.op == "!=" {
+		eq := *pred
+		eq.op = "="
+		return !eq.match(p)
+	}
+
+	if p.IsStringList() {
+		for _, s := range p.Strings() {
+			if pred.matchString(s) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if pred.op == "=" && len(p.Value)%4 == 0 {
+		fields := strings.Fields(pred.value)
+		cells := p.U32s()
+		if len(fields) != len(cells) {
+			return false
+		}
+		for i, f := range fields {
+			v, err := strconv.ParseUint(f, 0, 32)
+			if err != nil || uint32(v) != cells[i] {
+				return false
+			}
+		}
+		return true
+	}
+	return pred.matchString(string(p.Value))
+}
+
+func (pred *predicate) matchString(s string) bool {
+	switch pred.op {
+	case "=":
+		return s == pred.value
+	case "~=":
+		return strings.Contains(s, pred.value)
+	case "^=":
+		return strings.HasPrefix(s, pred.value)
+	case "$=":
+		return strings.HasSuffix(s, pred.value)
+	}
+	return false
+}
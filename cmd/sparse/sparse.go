@@ -0,0 +1,111 @@
+package sparse
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	Magic = 0xED26FF3A
+
+	chunkRaw      = 0xCAC1
+	chunkFill     = 0xCAC2
+	chunkDontCare = 0xCAC3
+	chunkCrc32    = 0xCAC4
+)
+
+// Header Android sparse 镜像头部
+type Header struct {
+	Magic         uint32
+	MajorVersion  uint16
+	MinorVersion  uint16
+	FileHeaderSz  uint16
+	ChunkHeaderSz uint16
+	BlockSize     uint32
+	TotalBlocks   uint32
+	TotalChunks   uint32
+	ImageChecksum uint32
+}
+
+// IsSparse 检查数据是否为sparse镜像
+func IsSparse(data []byte) bool {
+	return len(data) >= 28 && binary.LittleEndian.Uint32(data) == Magic
+}
+
+// ParseHeader 解析sparse镜像头部
+func ParseHeader(data []byte) (*Header, error) {
+	if !IsSparse(data) {
+		return nil, fmt.Errorf("不是sparse镜像")
+	}
+
+	le := binary.LittleEndian
+	h := &Header{
+		Magic:         le.Uint32(data[0:]),
+		MajorVersion:  le.Uint16(data[4:]),
+		MinorVersion:  le.Uint16(data[6:]),
+		FileHeaderSz:  le.Uint16(data[8:]),
+		ChunkHeaderSz: le.Uint16(data[10:]),
+		BlockSize:     le.Uint32(data[12:]),
+		TotalBlocks:   le.Uint32(data[16:]),
+		TotalChunks:   le.Uint32(data[20:]),
+		ImageChecksum: le.Uint32(data[24:]),
+	}
+	if h.MajorVersion != 1 {
+		return nil, fmt.Errorf("不支持的sparse版本: %d", h.MajorVersion)
+	}
+	if h.FileHeaderSz < 28 || h.ChunkHeaderSz < 12 || h.BlockSize == 0 {
+		return nil, fmt.Errorf("sparse头部无效")
+	}
+	return h, nil
+}
+
+// Unsparse 将sparse镜像还原为原始镜像
+func Unsparse(data []byte) ([]byte, error) {
+	h, err := ParseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	le := binary.LittleEndian
+	out := make([]byte, 0, uint64(h.TotalBlocks)*uint64(h.BlockSize))
+	pos := int(h.FileHeaderSz)
+
+	for i := uint32(0); i < h.TotalChunks; i++ {
+		if pos+int(h.ChunkHeaderSz) > len(data) {
+			return nil, fmt.Errorf("数据块 %d 被截断", i)
+		}
+		chunkType := le.Uint16(data[pos:])
+		chunkBlocks := le.Uint32(data[pos+4:])
+		totalSz := le.Uint32(data[pos+8:])
+		if totalSz < uint32(h.ChunkHeaderSz) || pos+int(totalSz) > len(data) {
+			return nil, fmt.Errorf("数据块 %d 大小无效", i)
+		}
+		body := data[pos+int(h.ChunkHeaderSz) : pos+int(totalSz)]
+		outSize := int(chunkBlocks) * int(h.BlockSize)
+
+		switch chunkType {
+		case chunkRaw:
+			if len(body) != outSize {
+				return nil, fmt.Errorf("数据块 %d 大小不匹配", i)
+			}
+			out = append(out, body...)
+		case chunkFill:
+			if len(body) < 4 {
+				return nil, fmt.Errorf("填充块 %d 无效", i)
+			}
+			for n := 0; n < outSize; n += 4 {
+				out = append(out, body[:4]...)
+			}
+		case chunkDontCare:
+			out = append(out, make([]byte, outSize)...)
+		case chunkCrc32:
+			// 校验块不产生数据
+		default:
+			return nil, fmt.Errorf("未知的数据块类型: 0x%04X", chunkType)
+		}
+
+		pos += int(totalSz)
+	}
+
+	return out, nil
+}
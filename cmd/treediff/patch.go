@@ -0,0 +1,72 @@
+package treediff
+
+import (
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// PatchOp 一个 RFC 6902 JSON Patch 操作
+type PatchOp struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value,omitempty"`
+}
+
+// Patch 将差异转换为 RFC 6902 JSON Patch。补丁作用的文档以节点路径为键，
+// 值为该节点的属性名到 DTS 语法属性值的对象，/memreserve/ 条目记录在
+// "/memreserve/" 的 entries 中，例如:
+//
+//	{"/": {"model": "\"board\""}, "/soc/uart@1000": {"status": "\"okay\""}}
+//
+// 修改和删除属性前先用 test 操作给出原来的值，新增或删除节点时对子树中的
+// 每个节点各生成一个操作
+func Patch(changes []Change) []PatchOp {
+	ops := []PatchOp{}
+	for _, c := range changes {
+		if c.IsNode() {
+			c.node.Walk(func(n *fdt.Node) bool {
+				if c.Op == Add {
+					ops = append(ops, PatchOp{Op: "add", Path: pointer(n.Path()), Value: nodeValue(c.refs, n)})
+				} else {
+					ops = append(ops, PatchOp{Op: "remove", Path: pointer(n.Path())})
+				}
+				return true
+			})
+			continue
+		}
+
+		path := pointer(c.Path, c.Prop)
+		switch c.Op {
+		case Add:
+			ops = append(ops, PatchOp{Op: "add", Path: path, Value: c.New})
+		case Remove:
+			ops = append(ops, PatchOp{Op: "test", Path: path, Value: c.Old}, PatchOp{Op: "remove", Path: path})
+		case Replace:
+			ops = append(ops, PatchOp{Op: "test", Path: path, Value: c.Old}, PatchOp{Op: "replace", Path: path, Value: c.New})
+		}
+	}
+	return ops
+}
+
+// nodeValue 节点自身的属性，不含子节点
+func nodeValue(refs *fdt.Refs, n *fdt.Node) map[string]string {
+	props := make(map[string]string)
+	for _, p := range n.Properties {
+		if !isPhandleProp(p.Name) {
+			props[p.Name] = formatValue(refs, n, p)
+		}
+	}
+	return props
+}
+
+// pointer 由各级键生成 JSON Pointer (RFC 6901)
+func pointer(keys ...string) string {
+	var b strings.Builder
+	escaper := strings.NewReplacer("~", "~0", "/", "~1")
+	for _, k := range keys {
+		b.WriteByte('/')
+		b.WriteString(escaper.Replace(k))
+	}
+	return b.String()
+}
@@ -0,0 +1,120 @@
+package treediff
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// WriteUnified 以类似统一diff的格式输出差异，按节点分组
+func WriteUnified(w io.Writer, nameA, nameB string, changes []Change) {
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", nameA, nameB)
+	current := ""
+	for _, c := range changes {
+		if c.IsNode() {
+			fmt.Fprintf(w, "@@ %s @@\n", c.Path)
+			current = ""
+			prefix, text := "+", c.New
+			if c.Op == Remove {
+				prefix, text = "-", c.Old
+			}
+			for _, line := range strings.Split(text, "\n") {
+				fmt.Fprintf(w, "%s%s\n", prefix, line)
+			}
+			continue
+		}
+
+		if c.Path != current {
+			fmt.Fprintf(w, "@@ %s @@\n", c.Path)
+			current = c.Path
+		}
+		if c.Op != Add {
+			fmt.Fprintf(w, "-\t%s\n", propLine(c.Prop, c.Old))
+		}
+		if c.Op != Remove {
+			fmt.Fprintf(w, "+\t%s\n", propLine(c.Prop, c.New))
+		}
+	}
+}
+
+func propLine(name, value string) string {
+	if value == "" {
+		return name + ";"
+	}
+	return name + " = " + value + ";"
+}
+
+// Summary 某个子树中的变化统计
+type Summary struct {
+	Path          string `json:"path"`
+	NodesAdded    int    `json:"nodes_added"`
+	NodesRemoved  int    `json:"nodes_removed"`
+	PropsAdded    int    `json:"props_added"`
+	PropsRemoved  int    `json:"props_removed"`
+	PropsModified int    `json:"props_modified"`
+}
+
+// Summarize 按子树统计变化，depth 为子树根所在的层级(1 表示根节点的直接子节点)
+func Summarize(changes []Change, depth int) []Summary {
+	byPath := make(map[string]*Summary)
+	var order []string
+	for _, c := range changes {
+		key := subtree(c.Path, depth)
+		s := byPath[key]
+		if s == nil {
+			s = &Summary{Path: key}
+			byPath[key] = s
+			order = append(order, key)
+		}
+		switch {
+		case c.IsNode() && c.Op == Add:
+			s.NodesAdded++
+		case c.IsNode():
+			s.NodesRemoved++
+		case c.Op == Add:
+			s.PropsAdded++
+		case c.Op == Remove:
+			s.PropsRemoved++
+		default:
+			s.PropsModified++
+		}
+	}
+
+	sort.Strings(order)
+	summaries := make([]Summary, len(order))
+	for i, key := range order {
+		summaries[i] = *byPath[key]
+	}
+	return summaries
+}
+
+// subtree 截取路径的前 depth 层
+func subtree(path string, depth int) string {
+	if path == "/memreserve/" {
+		return path
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if parts[0] == "" {
+		return "/"
+	}
+	if len(parts) > depth {
+		parts = parts[:depth]
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// WriteSummary 以表格形式输出统计，路径放在最后一列以便对齐
+func WriteSummary(w io.Writer, summaries []Summary) {
+	fmt.Fprintf(w, "%6s %6s %6s %6s %6s  %s\n", "+node", "-node", "+prop", "-prop", "~prop", "子树")
+	var total Summary
+	for _, s := range summaries {
+		fmt.Fprintf(w, "%6d %6d %6d %6d %6d  %s\n", s.NodesAdded, s.NodesRemoved, s.PropsAdded, s.PropsRemoved, s.PropsModified, s.Path)
+		total.NodesAdded += s.NodesAdded
+		total.NodesRemoved += s.NodesRemoved
+		total.PropsAdded += s.PropsAdded
+		total.PropsRemoved += s.PropsRemoved
+		total.PropsModified += s.PropsModified
+	}
+	fmt.Fprintf(w, "%6d %6d %6d %6d %6d  %s\n", total.NodesAdded, total.NodesRemoved, total.PropsAdded, total.PropsRemoved, total.PropsModified, "总计")
+}
@@ -0,0 +1,206 @@
+package treediff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/dts"
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// Op 变化类型
+type Op string
+
+const (
+	Add     Op = "add"
+	Remove  Op = "remove"
+	Replace Op = "replace"
+)
+
+// Change 两个设备树之间的一处差异。Prop 为空时表示整个节点被添加或删除
+type Change struct {
+	Op   Op
+	Path string
+	Prop string
+	Old  string
+	New  string
+
+	node *fdt.Node // 新增或删除的节点
+	refs *fdt.Refs // 节点所在设备树的引用信息
+}
+
+// IsNode 判断变化是否针对整个节点
+func (c *Change) IsNode() bool {
+	return c.Prop == ""
+}
+
+// Compare 按路径匹配节点并比较两个设备树。phandle 引用先解析为目标节点路径再比较，
+// 因此仅 phandle 编号不同不算差异，phandle 属性本身也不参与比较。
+// 无法识别的属性中等于某个 phandle 的数值写为 &{/路径}?，同样按目标路径比较
+func Compare(a, b *fdt.Tree) []Change {
+	d := &differ{refsA: fdt.NewRefs(a), refsB: fdt.NewRefs(b)}
+
+	if !equalReserve(a.Reserve, b.Reserve) {
+		d.changes = append(d.changes, Change{
+			Op:   Replace,
+			Path: "/memreserve/",
+			Prop: "entries",
+			Old:  formatReserve(a.Reserve),
+			New:  formatReserve(b.Reserve),
+		})
+	}
+	d.node(a.Root, b.Root)
+	return d.changes
+}
+
+type differ struct {
+	refsA, refsB *fdt.Refs
+	changes      []Change
+}
+
+func (d *differ) node(a, b *fdt.Node) {
+	path := a.Path()
+	for _, pa := range a.Properties {
+		if isPhandleProp(pa.Name) {
+			continue
+		}
+		pb := b.Property(pa.Name)
+		va := formatValue(d.refsA, a, pa)
+		if pb == nil {
+			d.changes = append(d.changes, Change{Op: Remove, Path: path, Prop: pa.Name, Old: va})
+			continue
+		}
+		if vb := formatValue(d.refsB, b, pb); va != vb {
+			d.changes = append(d.changes, Change{Op: Replace, Path: path, Prop: pa.Name, Old: va, New: vb})
+		}
+	}
+	for _, pb := range b.Properties {
+		if !isPhandleProp(pb.Name) && a.Property(pb.Name) == nil {
+			d.changes = append(d.changes, Change{Op: Add, Path: path, Prop: pb.Name, New: formatValue(d.refsB, b, pb)})
+		}
+	}
+
+	for _, ca := range a.Children {
+		if cb := child(b, ca.Name); cb != nil {
+			d.node(ca, cb)
+		} else {
+			d.changes = append(d.changes, Change{Op: Remove, Path: ca.Path(), Old: formatNode(d.refsA, ca), node: ca, refs: d.refsA})
+		}
+	}
+	for _, cb := range b.Children {
+		if child(a, cb.Name) == nil {
+			d.changes = append(d.changes, Change{Op: Add, Path: cb.Path(), New: formatNode(d.refsB, cb), node: cb, refs: d.refsB})
+		}
+	}
+}
+
+func isPhandleProp(name string) bool {
+	return name == "phandle" || name == "linux,phandle"
+}
+
+// child 按完整名称查找子节点
+func child(n *fdt.Node, name string) *fdt.Node {
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// formatValue 按 DTS 语法格式化属性值，phandle 引用写为 &{/路径}，
+// 无法确认的可能引用写为 &{/路径}?
+func formatValue(refs *fdt.Refs, n *fdt.Node, p *fdt.Property) string {
+	switch {
+	case len(p.Value) == 0:
+		return ""
+	case p.IsStringList():
+		return quoteStrings(p.Strings())
+	case len(p.Value)%4 == 0:
+		found := refs.Find(n, p)
+		possible := len(found) == 0
+		if possible {
+			found = refs.Possible(n, p)
+		}
+		parts := make([]string, 0, len(p.Value)/4)
+		for off := 0; off < len(p.Value); off += 4 {
+			if len(found) > 0 && found[0].Offset == off {
+				ref := found[0]
+				found = found[1:]
+				switch {
+				case ref.Target != nil && possible:
+					parts = append(parts, "&{"+ref.Target.Path()+"}?")
+					continue
+				case ref.Target != nil:
+					parts = append(parts, "&{"+ref.Target.Path()+"}")
+					continue
+				case ref.Label != "":
+					parts = append(parts, "&"+ref.Label)
+					continue
+				}
+			}
+			parts = append(parts, fmt.Sprintf("0x%02x", binary.BigEndian.Uint32(p.Value[off:])))
+		}
+		return "<" + strings.Join(parts, " ") + ">"
+	}
+	parts := make([]string, len(p.Value))
+	for i, b := range p.Value {
+		parts[i] = fmt.Sprintf("%02x", b)
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+func quoteStrings(strs []string) string {
+	quoted := make([]string, len(strs))
+	for i, s := range strs {
+		quoted[i] = dts.QuoteString(append([]byte(s), 0))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// formatNode 以 DTS 语法格式化整个节点，用于描述新增和删除的节点
+func formatNode(refs *fdt.Refs, n *fdt.Node) string {
+	var b strings.Builder
+	writeNode(&b, refs, n, 0)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func writeNode(b *strings.Builder, refs *fdt.Refs, n *fdt.Node, level int) {
+	indent := strings.Repeat("\t", level)
+	fmt.Fprintf(b, "%s%s {\n", indent, n.Name)
+	for _, p := range n.Properties {
+		if isPhandleProp(p.Name) {
+			continue
+		}
+		if v := formatValue(refs, n, p); v != "" {
+			fmt.Fprintf(b, "%s\t%s = %s;\n", indent, p.Name, v)
+		} else {
+			fmt.Fprintf(b, "%s\t%s;\n", indent, p.Name)
+		}
+	}
+	for _, c := range n.Children {
+		writeNode(b, refs, c, level+1)
+	}
+	fmt.Fprintf(b, "%s};\n", indent)
+}
+
+func equalReserve(a, b []fdt.ReserveEntry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func formatReserve(entries []fdt.ReserveEntry) string {
+	var parts []string
+	for _, e := range entries {
+		parts = append(parts, fmt.Sprintf("0x%x 0x%x", e.Address, e.Size))
+	}
+	return strings.Join(parts, ", ")
+}
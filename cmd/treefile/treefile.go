@@ -0,0 +1,370 @@
+// Package treefile 在设备树和 JSON/YAML 文档之间无损转换。
+//
+// 文档结构如下，YAML 与 JSON 使用相同的字段:
+//
+//	{
+//	  "version": 17,                  // FDT 版本
+//	  "boot_cpuid_phys": 0,           // 启动 CPU 的物理 ID
+//	  "padding": 0,                   // 字符串块之后的填充字节数，可省略
+//	  "memreserve": [                 // /memreserve/ 条目，可省略
+//	    {"address": "0x10000000", "size": "0x4000"}
+//	  ],
+//	  "root": {                       // 根节点，名称为空
+//	    "name": "",
+//	    "labels": ["soc"],            // 由 __symbols__ 恢复的标签，仅供阅读
+//	    "properties": [               // 按原始顺序排列
+//	      {"name": "compatible", "strings": ["vendor,board", "vendor,soc"]},
+//	      {"name": "reg", "cells": ["0x1000", "0x100"]},
+//	      {"name": "mac", "bytes": "001122334455"},
+//	      {"name": "ranges"}          // 空属性不带值字段
+//	    ],
+//	    "children": [ ... ]           // 子节点，结构同上
+//	  }
+//	}
+//
+// 属性值只能使用 strings、cells、bytes 中的一种。cells 中的单元可以写成
+// 十六进制字符串或整数。导出时以NUL结尾的可打印字符串列表写为 strings，
+// 长度为4的倍数的值写为 cells，其余写为 bytes，因此标准布局的 DTB 经过
+// 导出和导入后得到完全相同的数据
+package treefile
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+)
+
+// Format 设备树的文本格式
+type Format int
+
+const (
+	Auto Format = iota // 根据扩展名决定，默认为 DTS
+	DTS
+	JSON
+	YAML
+)
+
+func (f Format) String() string {
+	switch f {
+	case JSON:
+		return "json"
+	case YAML:
+		return "yaml"
+	}
+	return "dts"
+}
+
+// Ext 返回格式对应的文件扩展名
+func (f Format) Ext() string {
+	return "." + f.String()
+}
+
+// ParseFormat 解析格式名称，空字符串表示自动
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "":
+		return Auto, nil
+	case "dts":
+		return DTS, nil
+	case "json":
+		return JSON, nil
+	case "yaml", "yml":
+		return YAML, nil
+	}
+	return Auto, fmt.Errorf("未知的文本格式: %s (可选 dts/json/yaml)", name)
+}
+
+// FromExt 根据文件扩展名判断格式，无法识别时返回 Auto
+func FromExt(name string) Format {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".dts":
+		return DTS
+	case ".json":
+		return JSON
+	case ".yaml", ".yml":
+		return YAML
+	}
+	return Auto
+}
+
+// IsSource 判断文件是否为可编译的设备树源文件
+func IsSource(name string) bool {
+	return FromExt(name) != Auto
+}
+
+// Document 设备树文档
+type Document struct {
+	Version       uint32    `json:"version"`
+	BootCpuidPhys uint32    `json:"boot_cpuid_phys"`
+	Padding       uint32    `json:"padding,omitempty"`
+	Memreserve    []Reserve `json:"memreserve,omitempty"`
+	Root          *Node     `json:"root"`
+}
+
+// Reserve 内存保留区条目，数值以十六进制字符串表示以免丢失64位精度
+type Reserve struct {
+	Address string `json:"address"`
+	Size    string `json:"size"`
+}
+
+// Node 设备树节点
+type Node struct {
+	Name       string     `json:"name"`
+	Labels     []string   `json:"labels,omitempty"`
+	Properties []Property `json:"properties,omitempty"`
+	Children   []*Node    `json:"children,omitempty"`
+}
+
+// Property 设备树属性
+type Property struct {
+	Name    string   `json:"name"`
+	Labels  []string `json:"labels,omitempty"`
+	Strings []string `json:"strings,omitempty"`
+	Cells   []Cell   `json:"cells,omitempty"`
+	Bytes   string   `json:"bytes,omitempty"`
+}
+
+// Cell 32位单元，导出为十六进制字符串，导入时也接受整数
+type Cell uint32
+
+func (c Cell) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("0x%x", uint32(c)))
+}
+
+func (c *Cell) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if s, err := strconv.Unquote(text); err == nil {
+		text = s
+	}
+	v, err := strconv.ParseUint(strings.TrimSpace(text), 0, 32)
+	if err != nil {
+		return fmt.Errorf("无效的单元值 %s", data)
+	}
+	*c = Cell(v)
+	return nil
+}
+
+// FromTree 将设备树转换为文档，标签由 __symbols__ 恢复
+func FromTree(t *fdt.Tree) *Document {
+	doc := &Document{
+		Version:       t.Version,
+		BootCpuidPhys: t.BootCpuidPhys,
+		Padding:       t.Padding,
+	}
+	for _, r := range t.Reserve {
+		doc.Memreserve = append(doc.Memreserve, Reserve{
+			Address: fmt.Sprintf("0x%x", r.Address),
+			Size:    fmt.Sprintf("0x%x", r.Size),
+		})
+	}
+
+	labels := make(map[string][]string)
+	if symbols := t.Root.Child("__symbols__"); symbols != nil {
+		for _, p := range symbols.Properties {
+			labels[p.String()] = append(labels[p.String()], p.Name)
+		}
+	}
+	doc.Root = fromNode(t.Root, labels)
+	return doc
+}
+
+func fromNode(n *fdt.Node, labels map[string][]string) *Node {
+	out := &Node{Name: n.Name, Labels: n.Labels}
+	if len(out.Labels) == 0 {
+		out.Labels = labels[n.Path()]
+	}
+	for _, p := range n.Properties {
+		prop := Property{Name: p.Name, Labels: p.Labels}
+		switch {
+		case len(p.Value) == 0:
+		case p.IsStringList():
+			prop.Strings = p.Strings()
+		case len(p.Value)%4 == 0:
+			for _, c := range p.U32s() {
+				prop.Cells = append(prop.Cells, Cell(c))
+			}
+		default:
+			prop.Bytes = hex.EncodeToString(p.Value)
+		}
+		out.Properties = append(out.Properties, prop)
+	}
+	for _, c := range n.Children {
+		out.Children = append(out.Children, fromNode(c, labels))
+	}
+	return out
+}
+
+// Tree 将文档转换为设备树
+func (d *Document) Tree() (*fdt.Tree, error) {
+	if d.Root == nil {
+		return nil, fmt.Errorf("文档缺少 root 节点")
+	}
+	if d.Root.Name != "" {
+		return nil, fmt.Errorf("根节点名称必须为空: %q", d.Root.Name)
+	}
+
+	t := &fdt.Tree{
+		Version:       d.Version,
+		BootCpuidPhys: d.BootCpuidPhys,
+		Padding:       d.Padding,
+	}
+	if t.Version == 0 {
+		t.Version = fdt.DefaultVersion
+	}
+	for i, r := range d.Memreserve {
+		addr, err := strconv.ParseUint(r.Address, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("memreserve[%d]: 无效的地址 %q", i, r.Address)
+		}
+		size, err := strconv.ParseUint(r.Size, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("memreserve[%d]: 无效的大小 %q", i, r.Size)
+		}
+		t.Reserve = append(t.Reserve, fdt.ReserveEntry{Address: addr, Size: size})
+	}
+
+	root, err := d.Root.toNode(nil)
+	if err != nil {
+		return nil, err
+	}
+	t.Root = root
+	return t, nil
+}
+
+func (n *Node) toNode(parent *fdt.Node) (*fdt.Node, error) {
+	out := &fdt.Node{Name: n.Name, Labels: n.Labels, Parent: parent}
+	if parent != nil && n.Name == "" {
+		return nil, fmt.Errorf("%s 下有名称为空的子节点", parent.Path())
+	}
+
+	for _, p := range n.Properties {
+		if p.Name == "" {
+			return nil, fmt.Errorf("%s 下有名称为空的属性", out.Path())
+		}
+		if out.Property(p.Name) != nil {
+			return nil, fmt.Errorf("%s: 属性 %s 重复", out.Path(), p.Name)
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, fmt.Errorf("%s: 属性 %s: %v", out.Path(), p.Name, err)
+		}
+		out.Properties = append(out.Properties, &fdt.Property{Name: p.Name, Labels: p.Labels, Value: value})
+	}
+	for _, c := range n.Children {
+		if c == nil {
+			return nil, fmt.Errorf("%s 下有空的子节点", out.Path())
+		}
+		if child := out.Child(c.Name); child != nil && child.Name == c.Name {
+			return nil, fmt.Errorf("%s: 子节点 %s 重复", out.Path(), c.Name)
+		}
+		child, err := c.toNode(out)
+		if err != nil {
+			return nil, err
+		}
+		out.Children = append(out.Children, child)
+	}
+	return out, nil
+}
+
+func (p *Property) value() ([]byte, error) {
+	kinds := 0
+	for _, set := range []bool{p.Strings != nil, p.Cells != nil, p.Bytes != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds > 1 {
+		return nil, fmt.Errorf("只能使用 strings、cells、bytes 中的一种")
+	}
+
+	switch {
+	case p.Strings != nil:
+		return fdt.StringValue(p.Strings...), nil
+	case p.Cells != nil:
+		cells := make([]uint32, len(p.Cells))
+		for i, c := range p.Cells {
+			cells[i] = uint32(c)
+		}
+		return fdt.CellsValue(cells...), nil
+	case p.Bytes != "":
+		v, err := hex.DecodeString(strings.Join(strings.Fields(p.Bytes), ""))
+		if err != nil {
+			return nil, fmt.Errorf("无效的十六进制字节: %v", err)
+		}
+		return v, nil
+	}
+	return nil, nil
+}
+
+// Marshal 将设备树编码为 JSON 或 YAML 文档
+func Marshal(t *fdt.Tree, f Format) ([]byte, error) {
+	data, err := json.MarshalIndent(FromTree(t), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	switch f {
+	case JSON:
+		return append(data, '\n'), nil
+	case YAML:
+		return jsonToYAML(data)
+	}
+	return nil, fmt.Errorf("不支持的文档格式: %s", f)
+}
+
+// Unmarshal 解析 JSON 或 YAML 文档为设备树
+func Unmarshal(data []byte, f Format) (*fdt.Tree, error) {
+	if f == YAML {
+		var err error
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, err
+		}
+	} else if f != JSON {
+		return nil, fmt.Errorf("不支持的文档格式: %s", f)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var doc Document
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("解析%s文档失败: %v", strings.ToUpper(f.String()), err)
+	}
+	return doc.Tree()
+}
+
+// ReadFile 读取 JSON 或 YAML 文件，f 为 Auto 时按扩展名判断
+func ReadFile(path string, f Format) (*fdt.Tree, error) {
+	if f == Auto {
+		f = FromExt(path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件失败: %v", err)
+	}
+	t, err := Unmarshal(data, f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return t, nil
+}
+
+// WriteFile 将设备树写为 JSON 或 YAML 文件，f 为 Auto 时按扩展名判断
+func WriteFile(path string, t *fdt.Tree, f Format) error {
+	if f == Auto {
+		f = FromExt(path)
+	}
+	data, err := Marshal(t, f)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("写入文件失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package treefile
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kiy7086/dtbotool/cmd/fdt"
+	"github.com/kiy7086/dtbotool/cmd/internal/dtstest"
+)
+
+// TestRoundTrip 标准布局的 DTB 导出为 JSON/YAML 再导入后应当逐字节相同
+func TestRoundTrip(t *testing.T) {
+	for name, src := range map[string]string{"base": dtstest.Base, "overlay": dtstest.Overlay} {
+		dtb := dtstest.DTB(t, src)
+
+		for _, f := range []Format{JSON, YAML} {
+			t.Run(name+"/"+f.String(), func(t *testing.T) {
+				tree, err := fdt.Parse(dtb)
+				if err != nil {
+					t.Fatal(err)
+				}
+				doc, err := Marshal(tree, f)
+				if err != nil {
+					t.Fatal(err)
+				}
+				back, err := Unmarshal(doc, f)
+				if err != nil {
+					t.Fatalf("%v\n%s", err, doc)
+				}
+				got, err := back.Bytes()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, dtb) {
+					t.Errorf("导入后的 DTB 不同 (%d / %d 字节)\n%s", len(got), len(dtb), doc)
+				}
+
+				// 再次导出的文档也应当相同
+				again, err := Marshal(back, f)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(again, doc) {
+					t.Errorf("再次导出的文档不同:\n%s\n----\n%s", doc, again)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package treefile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kiy7086/dtbotool/cmd/yaml"
+)
+
+// 导出时只使用块映射、块序列、单行的流序列，以及普通和双引号标量。
+// 可能被当作其他类型读取的字符串一律加引号。导入由 yaml 包完成
+
+// field 保持键顺序的映射项
+type field struct {
+	key   string
+	value any
+}
+
+// jsonToYAML 将 JSON 文档转换为 YAML，保持键的顺序
+func jsonToYAML(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	v, err := decodeOrdered(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	switch v := v.(type) {
+	case []field:
+		writeMapping(&b, v, 0, false)
+	default:
+		b.WriteString(yamlScalar(v) + "\n")
+	}
+	return []byte(b.String()), nil
+}
+
+// decodeOrdered 把 JSON 解码为 []field、[]any 和标量
+func decodeOrdered(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		fields := []field{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, field{key.(string), v})
+		}
+		_, err := dec.Token()
+		return fields, err
+	case json.Delim('['):
+		items := []any{}
+		for dec.More() {
+			v, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		_, err := dec.Token()
+		return items, err
+	}
+	return tok, nil
+}
+
+func writeMapping(b *strings.Builder, fields []field, indent int, inline bool) {
+	for i, f := range fields {
+		if i > 0 || !inline {
+			b.WriteString(strings.Repeat(" ", indent))
+		}
+		b.WriteString(yamlScalar(f.key) + ":")
+		writeValue(b, f.value, indent)
+	}
+}
+
+// writeValue 写出映射值，标量和只含标量的序列写在同一行
+func writeValue(b *strings.Builder, v any, indent int) {
+	switch v := v.(type) {
+	case []field:
+		if len(v) == 0 {
+			b.WriteString(" {}\n")
+			return
+		}
+		b.WriteString("\n")
+		writeMapping(b, v, indent+2, false)
+	case []any:
+		if isFlat(v) {
+			parts := make([]string, len(v))
+			for i, item := range v {
+				parts[i] = yamlScalar(item)
+			}
+			b.WriteString(" [" + strings.Join(parts, ", ") + "]\n")
+			return
+		}
+		b.WriteString("\n")
+		writeSequence(b, v, indent+2)
+	default:
+		b.WriteString(" " + yamlScalar(v) + "\n")
+	}
+}
+
+func writeSequence(b *strings.Builder, items []any, indent int) {
+	for _, item := range items {
+		b.WriteString(strings.Repeat(" ", indent) + "-")
+		switch item := item.(type) {
+		case []field:
+			if len(item) == 0 {
+				b.WriteString(" {}\n")
+				continue
+			}
+			b.WriteString(" ")
+			writeMapping(b, item, indent+2, true)
+		case []any:
+			writeValue(b, item, indent)
+		default:
+			b.WriteString(" " + yamlScalar(item) + "\n")
+		}
+	}
+}
+
+func isFlat(items []any) bool {
+	for _, item := range items {
+		switch item.(type) {
+		case []field, []any:
+			return false
+		}
+	}
+	return true
+}
+
+var plainRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_./@+-]*$`)
+
+// yamlScalar 格式化标量，可能被误解析的字符串使用双引号
+func yamlScalar(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	case string:
+		if plainRe.MatchString(v) && !isReserved(v) {
+			return v
+		}
+		quoted, _ := json.Marshal(v)
+		return string(quoted)
+	}
+	return fmt.Sprint(v)
+}
+
+func isReserved(s string) bool {
+	switch strings.ToLower(s) {
+	case "true", "false", "null", "yes", "no", "on", "off", "y", "n":
+		return true
+	}
+	return false
+}
+
+// yamlToJSON 解析 YAML 文档并转换为 JSON
+func yamlToJSON(data []byte) ([]byte, error) {
+	v, err := yaml.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
@@ -10,28 +10,64 @@ import (
 	"time"
 
 	"github.com/kiy7086/dtbotool/cmd/backup"
+	"github.com/kiy7086/dtbotool/cmd/compression"
+	"github.com/kiy7086/dtbotool/cmd/detect"
 	"github.com/kiy7086/dtbotool/cmd/dtb"
 	"github.com/kiy7086/dtbotool/cmd/dtbo"
+	"github.com/kiy7086/dtbotool/cmd/treefile"
 )
 
+// Options 解包选项
+type Options struct {
+	Raw      bool            // 提取为原始dtb文件
+	Format   detect.Format   // 强制指定输入格式，Unknown 表示自动检测
+	Output   treefile.Format // 反编译输出的文本格式，默认DTS
+	Annotate bool            // 在DTS中以注释解释 reg、interrupts、clocks 等属性
+	Jobs     int             // 批量反编译的并发数，不大于 0 时使用CPU数量
+}
+
+// decompileOptions 返回反编译DTB使用的选项
+func (o Options) decompileOptions() dtb.DecompileOptions {
+	return dtb.DecompileOptions{Format: o.Output, Annotate: o.Annotate, Jobs: o.Jobs}
+}
+
 // HandleUnpack 处理解包操作
-func HandleUnpack(input, output string, rawOutput bool) error {
+func HandleUnpack(input, output string, opts Options) error {
 	// 检查输入文件/目录是否存在
 	if _, err := os.Stat(input); os.IsNotExist(err) {
 		return fmt.Errorf("'%s' 不存在", input)
 	}
 
-	switch {
-	case strings.HasSuffix(input, ".dtbo"), strings.HasSuffix(input, ".img"):
-		return handleDtboUnpack(input, output, rawOutput)
-	case strings.HasSuffix(input, ".dtb"):
-		return handleDtbUnpack(input, output)
+	format := opts.Format
+	if format == detect.Unknown {
+		result, err := detect.DetectFile(input)
+		if err != nil {
+			return err
+		}
+		format = result.Format
+		if format != detect.Directory {
+			fmt.Printf("检测到格式: %s\n", format.Description())
+		}
+	}
+
+	switch format {
+	case detect.DtTable:
+		return handleDtboUnpack(input, output, opts, dtbo.UnpackDtbo)
+	case detect.Fdt:
+		return handleDtbUnpack(input, output, opts.decompileOptions())
+	case detect.Qcdt, detect.BootImage, detect.VendorBoot, detect.AppendedFdt:
+		extract := func(input, outDir string) error {
+			return extractDtbs(input, outDir, format)
+		}
+		return handleDtboUnpack(input, output, opts, extract)
+	case detect.Directory:
+		return handleDirUnpack(input, opts.decompileOptions())
 	default:
-		return handleDirUnpack(input)
+		return fmt.Errorf("无法识别 '%s' 的格式，请使用 --format 指定", input)
 	}
 }
 
-func handleDtboUnpack(input, output string, rawOutput bool) error {
+func handleDtboUnpack(input, output string, opts Options, extract func(input, outDir string) error) error {
 	_, err := backup.CreateBackup(input)
 	if err != nil {
 		fmt.Printf("警告: 备份失败: %v\n", err)
@@ -50,13 +86,48 @@ func handleDtboUnpack(input, output string, rawOutput bool) error {
 	}
 	defer os.RemoveAll(tmpDir)
 
-	if rawOutput {
-		return handleRawDtboUnpack(input, output)
+	if opts.Raw {
+		return handleRawDtboUnpack(input, output, extract)
+	}
+	return handleDtsDtboUnpack(input, output, tmpDir, opts.decompileOptions(), extract)
+}
+
+// extractDtbs 从 QCDT、boot 镜像或附加了设备树的内核中提取所有DTB
+func extractDtbs(input, outDir string, format detect.Format) error {
+	data, _, err := detect.ReadFile(input)
+	if err != nil {
+		return err
+	}
+
+	var dtbs [][]byte
+	if format == detect.Qcdt {
+		if dtbs, err = detect.SplitQcdt(data); err != nil {
+			return err
+		}
+	} else {
+		dtbs = detect.ScanFdts(data)
+	}
+	if len(dtbs) == 0 {
+		return fmt.Errorf("未找到设备树")
+	}
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return fmt.Errorf("创建输出目录失败: %v", err)
 	}
-	return handleDtsDtboUnpack(input, output, tmpDir)
+
+	for i, dtbData := range dtbs {
+		outFile := filepath.Join(outDir, fmt.Sprintf("dtb_%d.dtb", i))
+		if err := os.WriteFile(outFile, dtbData, 0644); err != nil {
+			return fmt.Errorf("保存设备树文件失败: %v", err)
+		}
+		fmt.Printf("已提取设备树 %d: %d 字节 -> %s\n", i, len(dtbData), outFile)
+	}
+
+	fmt.Printf("完成！已提取 %d 个设备树到目录: %s\n", len(dtbs), outDir)
+	return nil
 }
 
-func handleRawDtboUnpack(input, output string) error {
+func handleRawDtboUnpack(input, output string, extract func(input, outDir string) error) error {
 	outDir := output
 	if outDir == "" {
 		inputData, err := os.ReadFile(input)
@@ -68,12 +139,12 @@ func handleRawDtboUnpack(input, output string) error {
 		hashStr := hex.EncodeToString(hash[:])[:8]
 		outDir = fmt.Sprintf("dtbo_extracted_%s_%s", timestamp, hashStr)
 	}
-	return dtbo.UnpackDtbo(input, outDir)
+	return extract(input, outDir)
 }
 
-func handleDtsDtboUnpack(input, output string, tmpDir string) error {
+func handleDtsDtboUnpack(input, output string, tmpDir string, opts dtb.DecompileOptions, extract func(input, outDir string) error) error {
 	fmt.Printf("正在解析DTBO文件...\n")
-	if err := dtbo.UnpackDtbo(input, tmpDir); err != nil {
+	if err := extract(input, tmpDir); err != nil {
 		return fmt.Errorf("解析DTBO失败: %v", err)
 	}
 
@@ -94,7 +165,7 @@ func handleDtsDtboUnpack(input, output string, tmpDir string) error {
 	}
 
 	fmt.Printf("\n开始反编译...\n")
-	if err := decompileDtbFiles(tmpDir, outDir); err != nil {
+	if err := decompileDtbFiles(tmpDir, outDir, opts); err != nil {
 		return err
 	}
 
@@ -102,36 +173,32 @@ func handleDtsDtboUnpack(input, output string, tmpDir string) error {
 	return nil
 }
 
-func decompileDtbFiles(tmpDir, outDir string) error {
+func decompileDtbFiles(tmpDir, outDir string, opts dtb.DecompileOptions) error {
 	files, err := os.ReadDir(tmpDir)
 	if err != nil {
 		return fmt.Errorf("读取临时目录失败: %v", err)
 	}
 
+	var dtbFiles []string
 	for _, file := range files {
 		if !file.IsDir() && strings.HasSuffix(file.Name(), ".dtb") {
-			dtbPath := filepath.Join(tmpDir, file.Name())
-			dtsPath := filepath.Join(outDir, strings.TrimSuffix(file.Name(), ".dtb")+".dts")
-
-			fmt.Printf("正在处理: %s\n", file.Name())
-			if err := dtb.DecompileDtb(dtbPath, dtsPath); err != nil {
-				fmt.Printf("警告: 反编译 %s 失败: %v\n", file.Name(), err)
-			}
+			dtbFiles = append(dtbFiles, filepath.Join(tmpDir, file.Name()))
 		}
 	}
-	return nil
+	return dtb.DecompileFiles(dtbFiles, outDir, opts)
 }
 
-func handleDtbUnpack(input, output string) error {
+func handleDtbUnpack(input, output string, opts dtb.DecompileOptions) error {
 	outFile := output
 	if outFile == "" {
-		outFile = strings.TrimSuffix(input, ".dtb") + ".dts"
+		base := compression.TrimExt(input)
+		outFile = strings.TrimSuffix(base, filepath.Ext(base)) + opts.Format.Ext()
 	}
-	return dtb.DecompileDtb(input, outFile)
+	return dtb.DecompileDtb(input, outFile, opts)
 }
 
-func handleDirUnpack(input string) error {
-	return dtb.DecompileAllDtbInDir(input)
+func handleDirUnpack(input string, opts dtb.DecompileOptions) error {
+	return dtb.DecompileAllDtbInDir(input, opts)
 }
 
 func printUnpackSuccess(outDir string) {
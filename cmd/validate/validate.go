@@ -0,0 +1,47 @@
+package validate
+
+import (
+	"fmt"
+
+	"github.com/kiy7086/dtbotool/cmd/binding"
+	"github.com/kiy7086/dtbotool/cmd/input"
+)
+
+// HandleValidate 使用绑定目录中的 dt-schema 绑定校验所有输入文件中的设备树
+func HandleValidate(bindings string, specs []string, verbose bool) error {
+	set, warnings, err := binding.Load(bindings)
+	for _, w := range warnings {
+		fmt.Printf("警告: 跳过绑定 %s\n", w)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("已加载 %d 个绑定\n", len(set.Schemas))
+
+	checked, issues := 0, 0
+	for _, spec := range specs {
+		items, err := input.Load(spec)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			report := set.Validate(item.Tree)
+			for _, is := range report.Issues {
+				fmt.Printf("%s: %s: %s [%s]\n", item.Name, is.Path, is.Message, is.Schema)
+			}
+			if verbose {
+				for _, path := range report.Unmatched {
+					fmt.Printf("%s: %s: 没有匹配的绑定\n", item.Name, path)
+				}
+			}
+			checked += report.Checked
+			issues += len(report.Issues)
+		}
+	}
+
+	if issues > 0 {
+		return fmt.Errorf("校验了 %d 个节点，发现 %d 个问题", checked, issues)
+	}
+	fmt.Printf("校验了 %d 个节点，没有发现问题\n", checked)
+	return nil
+}
@@ -0,0 +1,534 @@
+// Package yaml 读取 treefile 导出的文档和设备树绑定文件使用的 YAML 子集:
+// 块映射和块序列、多行的普通标量、块标量 (| 和 >)、跨行的流序列和流映射，
+// 以及引号字符串和十进制、十六进制整数。锚点被忽略，别名解析为 null，
+// 多个文档时只读取第一个
+package yaml
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type yamlLine struct {
+	num     int
+	indent  int
+	content string // 去掉缩进后的内容，空行为 ""
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// Parse 将 YAML 文档解析为 map[string]any、[]any 和标量。标量为 string、
+// int64 (超出范围时为 uint64)、float64、bool 或 nil
+func Parse(data []byte) (any, error) {
+	p := &yamlParser{}
+	started := false
+	for i, raw := range strings.Split(string(data), "\n") {
+		raw = strings.TrimRight(raw, " \t\r")
+		content := strings.TrimLeft(raw, " ")
+		if strings.HasPrefix(raw, "%") {
+			continue
+		}
+		if raw == "---" || strings.HasPrefix(raw, "--- ") {
+			// 只解析第一个文档
+			if started {
+				break
+			}
+			started = true
+			continue
+		}
+		if raw == "..." {
+			break
+		}
+		p.lines = append(p.lines, yamlLine{num: i + 1, indent: len(raw) - len(content), content: content})
+	}
+
+	p.skipBlank()
+	if p.pos >= len(p.lines) {
+		return nil, fmt.Errorf("YAML 文档为空")
+	}
+	v, err := p.parseBlock(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.skipBlank(); p.pos < len(p.lines) {
+		return nil, p.errorf("缩进错误")
+	}
+	return v, nil
+}
+
+func (p *yamlParser) errorf(format string, args ...any) error {
+	line := 0
+	if p.pos < len(p.lines) {
+		line = p.lines[p.pos].num
+	} else if len(p.lines) > 0 {
+		line = p.lines[len(p.lines)-1].num
+	}
+	return fmt.Errorf("YAML 第 %d 行: %s", line, fmt.Sprintf(format, args...))
+}
+
+// skipBlank 跳过空行和注释行
+func (p *yamlParser) skipBlank() {
+	for p.pos < len(p.lines) {
+		c := p.lines[p.pos].content
+		if c != "" && !strings.HasPrefix(c, "#") {
+			return
+		}
+		p.pos++
+	}
+}
+
+// peek 返回下一个有内容的行
+func (p *yamlParser) peek() (yamlLine, bool) {
+	p.skipBlank()
+	if p.pos >= len(p.lines) {
+		return yamlLine{}, false
+	}
+	return p.lines[p.pos], true
+}
+
+func isSeqItem(content string) bool {
+	return content == "-" || strings.HasPrefix(content, "- ")
+}
+
+// parseBlock 解析缩进不小于 minIndent 的块
+func (p *yamlParser) parseBlock(minIndent int) (any, error) {
+	line, ok := p.peek()
+	if !ok || line.indent < minIndent {
+		return nil, nil
+	}
+	if strings.HasPrefix(line.content, "\t") {
+		return nil, p.errorf("不允许使用制表符缩进")
+	}
+	if isSeqItem(line.content) {
+		return p.parseSequence(line.indent)
+	}
+	if _, _, ok := splitKey(line.content); ok {
+		return p.parseMapping(line.indent)
+	}
+	p.pos++
+	return p.parseValue(line.content, line.indent-1)
+}
+
+func (p *yamlParser) parseSequence(indent int) (any, error) {
+	items := []any{}
+	for {
+		line, ok := p.peek()
+		if !ok || line.indent != indent || !isSeqItem(line.content) {
+			return items, nil
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(line.content, "-"), " ")
+		inner := line.indent + len(line.content) - len(rest)
+
+		var item any
+		var err error
+		switch _, _, isKey := splitKey(rest); {
+		case rest == "" || strings.HasPrefix(rest, "#"):
+			p.pos++
+			item, err = p.parseBlock(indent + 1)
+		case isKey || isSeqItem(rest):
+			// "- key: value" 或 "- - item" 在同一行开始嵌套的块
+			p.lines[p.pos] = yamlLine{num: line.num, indent: inner, content: rest}
+			item, err = p.parseBlock(inner)
+		default:
+			p.pos++
+			item, err = p.parseValue(rest, indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+}
+
+func (p *yamlParser) parseMapping(indent int) (any, error) {
+	m := make(map[string]any)
+	for {
+		line, ok := p.peek()
+		if !ok || line.indent < indent {
+			return m, nil
+		}
+		if line.indent > indent {
+			return nil, p.errorf("缩进错误")
+		}
+		if strings.HasPrefix(line.content, "\t") {
+			return nil, p.errorf("不允许使用制表符缩进")
+		}
+		if isSeqItem(line.content) {
+			return m, nil
+		}
+		keyText, rest, ok := splitKey(line.content)
+		if !ok {
+			return nil, p.errorf("需要 \"键: 值\"")
+		}
+		key, err := parseFlow(keyText)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		k := fmt.Sprint(key)
+		if _, dup := m[k]; dup {
+			return nil, p.errorf("键 %s 重复", k)
+		}
+		p.pos++
+
+		var v any
+		if rest == "" || strings.HasPrefix(rest, "#") {
+			next, ok := p.peek()
+			switch {
+			case ok && next.indent > indent:
+				v, err = p.parseBlock(next.indent)
+			case ok && next.indent == indent && isSeqItem(next.content):
+				// 序列可以与键对齐
+				v, err = p.parseSequence(indent)
+			}
+		} else {
+			v, err = p.parseValue(rest, indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[k] = v
+	}
+}
+
+// parseValue 解析键或序列项之后的值，后续缩进大于 indent 的行属于同一个值
+func (p *yamlParser) parseValue(s string, indent int) (any, error) {
+	s = stripAnchor(stripComment(s))
+	if strings.HasPrefix(s, "*") {
+		return nil, nil
+	}
+	if strings.HasPrefix(s, "|") || strings.HasPrefix(s, ">") {
+		return p.blockScalar(s[0] == '>', indent), nil
+	}
+
+	// 跨行的流集合、引号字符串和普通标量
+	for p.pos < len(p.lines) && !complete(s) {
+		next := p.lines[p.pos]
+		if next.content != "" && next.indent <= indent && !strings.HasPrefix(s, "[") && !strings.HasPrefix(s, "{") {
+			break
+		}
+		s += " " + stripComment(next.content)
+		p.pos++
+	}
+	if !strings.HasPrefix(s, "[") && !strings.HasPrefix(s, "{") && !strings.HasPrefix(s, "\"") && !strings.HasPrefix(s, "'") {
+		for {
+			next, ok := p.peek()
+			if !ok || next.indent <= indent {
+				break
+			}
+			s += " " + stripComment(next.content)
+			p.pos++
+		}
+	}
+
+	v, err := parseFlow(s)
+	if err != nil {
+		return nil, p.errorf("%v", err)
+	}
+	return v, nil
+}
+
+// blockScalar 读取缩进大于 indent 的所有行作为块标量
+func (p *yamlParser) blockScalar(folded bool, indent int) string {
+	var lines []string
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.content != "" && line.indent <= indent {
+			break
+		}
+		lines = append(lines, line.content)
+		p.pos++
+	}
+	sep := "\n"
+	if folded {
+		sep = " "
+	}
+	return strings.TrimSpace(strings.Join(lines, sep))
+}
+
+// complete 判断流集合的括号和引号是否已经闭合
+func complete(s string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			// 只有出现在值开头或流集合中的引号才是字符串
+			if i == 0 || depth > 0 {
+				quote = c
+			}
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return depth <= 0 && quote == 0
+}
+
+// splitKey 在引号和流集合之外查找 "键:" 分隔符
+func splitKey(s string) (string, string, bool) {
+	if strings.HasPrefix(s, "[") || strings.HasPrefix(s, "{") {
+		return "", "", false
+	}
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && i == 0:
+			quote = c
+		case c == ':' && (i+1 == len(s) || s[i+1] == ' '):
+			return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:]), true
+		case c == '#' && i > 0 && s[i-1] == ' ':
+			return "", "", false
+		}
+	}
+	return "", "", false
+}
+
+// stripComment 去掉引号之外的行尾注释
+func stripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.ContainsRune(" [{,", rune(s[i-1])) {
+				quote = c
+			}
+		case c == '#' && (i == 0 || s[i-1] == ' '):
+			return strings.TrimSpace(s[:i])
+		}
+	}
+	return strings.TrimSpace(s)
+}
+
+// stripAnchor 去掉值前面的 &锚点
+func stripAnchor(s string) string {
+	if !strings.HasPrefix(s, "&") {
+		return s
+	}
+	if i := strings.IndexByte(s, ' '); i > 0 {
+		return strings.TrimSpace(s[i:])
+	}
+	return ""
+}
+
+// parseFlow 解析标量或流集合
+func parseFlow(s string) (any, error) {
+	f := &flowParser{s: strings.TrimSpace(s)}
+	v, err := f.value()
+	if err != nil {
+		return nil, err
+	}
+	if f.skipSpace(); f.pos < len(f.s) {
+		return nil, fmt.Errorf("多余的内容: %s", f.s[f.pos:])
+	}
+	return v, nil
+}
+
+type flowParser struct {
+	s   string
+	pos int
+}
+
+func (f *flowParser) skipSpace() {
+	for f.pos < len(f.s) && (f.s[f.pos] == ' ' || f.s[f.pos] == '\t') {
+		f.pos++
+	}
+}
+
+func (f *flowParser) value() (any, error) {
+	f.skipSpace()
+	if f.pos >= len(f.s) {
+		return nil, nil
+	}
+	switch f.s[f.pos] {
+	case '[':
+		return f.sequence()
+	case '{':
+		return f.mapping()
+	case '"', '\'':
+		return f.quoted()
+	}
+	return scalar(f.plain(false)), nil
+}
+
+func (f *flowParser) sequence() (any, error) {
+	f.pos++
+	items := []any{}
+	for {
+		f.skipSpace()
+		if f.pos >= len(f.s) {
+			return nil, fmt.Errorf("流序列未结束")
+		}
+		if f.s[f.pos] == ']' {
+			f.pos++
+			return items, nil
+		}
+		v, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+		if err := f.separator(']'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (f *flowParser) mapping() (any, error) {
+	f.pos++
+	m := make(map[string]any)
+	for {
+		f.skipSpace()
+		if f.pos >= len(f.s) {
+			return nil, fmt.Errorf("流映射未结束")
+		}
+		if f.s[f.pos] == '}' {
+			f.pos++
+			return m, nil
+		}
+
+		var key any
+		var err error
+		if c := f.s[f.pos]; c == '"' || c == '\'' {
+			key, err = f.quoted()
+		} else {
+			key = scalar(f.plain(true))
+		}
+		if err != nil {
+			return nil, err
+		}
+		f.skipSpace()
+		var v any
+		if f.pos < len(f.s) && f.s[f.pos] == ':' {
+			f.pos++
+			if v, err = f.value(); err != nil {
+				return nil, err
+			}
+		}
+		m[fmt.Sprint(key)] = v
+		if err := f.separator('}'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// separator 跳过集合元素之间的逗号
+func (f *flowParser) separator(end byte) error {
+	f.skipSpace()
+	if f.pos < len(f.s) && f.s[f.pos] == ',' {
+		f.pos++
+		return nil
+	}
+	if f.pos < len(f.s) && f.s[f.pos] == end {
+		return nil
+	}
+	return fmt.Errorf("需要 ',' 或 '%c'", end)
+}
+
+func (f *flowParser) quoted() (any, error) {
+	q := f.s[f.pos]
+	var b strings.Builder
+	for i := f.pos + 1; i < len(f.s); i++ {
+		c := f.s[i]
+		switch {
+		case c == q && q == '\'' && i+1 < len(f.s) && f.s[i+1] == '\'':
+			b.WriteByte('\'')
+			i++
+		case c == q:
+			f.pos = i + 1
+			return b.String(), nil
+		case c == '\\' && q == '"' && i+1 < len(f.s):
+			i++
+			switch f.s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(f.s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return nil, fmt.Errorf("字符串未结束: %s", f.s[f.pos:])
+}
+
+// plain 读取普通标量，在流集合中遇到 , ] } 结束，key 为 true 时遇到 ": " 结束
+func (f *flowParser) plain(key bool) string {
+	start := f.pos
+	inFlow := strings.HasPrefix(f.s, "[") || strings.HasPrefix(f.s, "{")
+	for f.pos < len(f.s) {
+		c := f.s[f.pos]
+		if inFlow && (c == ',' || c == ']' || c == '}') {
+			break
+		}
+		if key && c == ':' && (f.pos+1 == len(f.s) || f.s[f.pos+1] == ' ') {
+			break
+		}
+		f.pos++
+	}
+	return strings.TrimSpace(f.s[start:f.pos])
+}
+
+var (
+	intRe   = regexp.MustCompile(`^[-+]?(0x[0-9a-fA-F]+|0o[0-7]+|[0-9]+)$`)
+	floatRe = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+)
+
+// scalar 按 YAML 1.2 的核心规则转换普通标量的类型，前导 0 的十进制数不是八进制
+func scalar(s string) any {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if intRe.MatchString(s) {
+		digits := strings.TrimLeft(s, "+-")
+		base := 10
+		if strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0o") {
+			base = 0
+		}
+		if v, err := strconv.ParseInt(s, base, 64); err == nil {
+			return v
+		}
+		if v, err := strconv.ParseUint(strings.TrimPrefix(s, "+"), base, 64); err == nil {
+			return v
+		}
+		return s
+	}
+	if floatRe.MatchString(s) {
+		v, _ := strconv.ParseFloat(s, 64)
+		return v
+	}
+	return s
+}
@@ -0,0 +1,93 @@
+package yaml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want any
+	}{
+		{
+			name: "块映射和块序列",
+			doc:  "a: 1\nb:\n  c: x\n  d:\n    - 1\n    - two\ne:\n- k: v\n  l: w\n- - 1\n",
+			want: map[string]any{
+				"a": int64(1),
+				"b": map[string]any{"c": "x", "d": []any{int64(1), "two"}},
+				"e": []any{map[string]any{"k": "v", "l": "w"}, []any{int64(1)}},
+			},
+		},
+		{
+			name: "标量类型",
+			doc: "hex: 0x10\noct: 0o17\ndec: 010\nneg: -3\nbig: 0xffffffffffffffff\nf: 1.5\n" +
+				"t: true\nn: ~\ns: inf\nv: 1.2.3\nq: \"0x10\"\n",
+			want: map[string]any{
+				"hex": int64(16), "oct": int64(15), "dec": int64(10), "neg": int64(-3),
+				"big": uint64(0xffffffffffffffff), "f": 1.5, "t": true, "n": nil,
+				"s": "inf", "v": "1.2.3", "q": "0x10",
+			},
+		},
+		{
+			name: "引号字符串和注释",
+			doc:  "# 注释\na: \"x # y\\n\" # 注释\nb: 'it''s'\nc: d#e\n'k: 1': 2\n",
+			want: map[string]any{"a": "x # y\n", "b": "it's", "c": "d#e", "k: 1": int64(2)},
+		},
+		{
+			name: "流集合",
+			doc:  "a: [1, \"b,c\", [d]]\nb: {x: 1, 'y': [2]}\nc: [\n  1,\n  2 ]\nd: []\ne: {}\n",
+			want: map[string]any{
+				"a": []any{int64(1), "b,c", []any{"d"}},
+				"b": map[string]any{"x": int64(1), "y": []any{int64(2)}},
+				"c": []any{int64(1), int64(2)},
+				"d": []any{},
+				"e": map[string]any{},
+			},
+		},
+		{
+			name: "多行标量",
+			doc:  "a: |\n  line1\n  line2\nb: >\n  one\n  two\nc: plain\n  continued\nd: x\n",
+			want: map[string]any{"a": "line1\nline2", "b": "one two", "c": "plain continued", "d": "x"},
+		},
+		{
+			name: "锚点和多个文档",
+			doc:  "%YAML 1.2\n---\na: &x 1\nb: *x\n---\nc: 2\n",
+			want: map[string]any{"a": int64(1), "b": nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("结果 = %#v\n期望 %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		doc  string
+		want string
+	}{
+		{"", "YAML 文档为空"},
+		{"# 只有注释\n", "YAML 文档为空"},
+		{"a: 1\na: 2\n", "第 2 行: 键 a 重复"},
+		{"a:\n\tb: 1\n", "第 2 行: 不允许使用制表符缩进"},
+		{"a:\n    b: 1\n  c: 2\n", "第 3 行: 缩进错误"},
+		{"a: [1, 2\n", "需要 ',' 或 ']'"},
+		{"a: \"x\n", "字符串未结束"},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.doc))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: 错误 = %v, 期望包含 %q", tt.doc, err, tt.want)
+		}
+	}
+}
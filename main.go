@@ -4,15 +4,89 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 
+	"github.com/kiy7086/dtbotool/cmd/apply"
+	"github.com/kiy7086/dtbotool/cmd/check"
 	"github.com/kiy7086/dtbotool/cmd/compile"
+	"github.com/kiy7086/dtbotool/cmd/compression"
+	"github.com/kiy7086/dtbotool/cmd/detect"
+	"github.com/kiy7086/dtbotool/cmd/diag"
+	"github.com/kiy7086/dtbotool/cmd/diff"
+	"github.com/kiy7086/dtbotool/cmd/dtb"
+	"github.com/kiy7086/dtbotool/cmd/explain"
+	"github.com/kiy7086/dtbotool/cmd/find"
+	"github.com/kiy7086/dtbotool/cmd/graph"
+	"github.com/kiy7086/dtbotool/cmd/info"
+	"github.com/kiy7086/dtbotool/cmd/lint"
+	"github.com/kiy7086/dtbotool/cmd/memmap"
+	"github.com/kiy7086/dtbotool/cmd/mkoverlay"
+	"github.com/kiy7086/dtbotool/cmd/normalize"
+	"github.com/kiy7086/dtbotool/cmd/optimize"
+	"github.com/kiy7086/dtbotool/cmd/prop"
 	"github.com/kiy7086/dtbotool/cmd/recovery"
+	"github.com/kiy7086/dtbotool/cmd/treefile"
 	"github.com/kiy7086/dtbotool/cmd/unpack"
+	"github.com/kiy7086/dtbotool/cmd/validate"
 )
 
 const VERSION = "0.1.0"
 
+// stringList 可重复指定的字符串参数
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// compile 命令中对应编译配置项的参数，命令行参数覆盖配置文件
+var dtcFlags = map[string]string{
+	"@":      "symbols",
+	"I":      "include",
+	"p":      "padding",
+	"S":      "size",
+	"R":      "reserve",
+	"b":      "boot-cpu",
+	"checks": "checks",
+	"W":      "suppress",
+}
+
+// parseArgs 解析参数并返回位置参数，允许选项出现在位置参数之后。
+// "--" 之后的参数全部作为位置参数，用于传入负数等以 - 开头的值
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		if consumed := len(args) - fs.NArg(); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, fs.Args()...)
+		}
+		if fs.NArg() == 0 {
+			return positional
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// splitList 拆分逗号分隔的参数列表
+func splitList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, item)
+			}
+		}
+	}
+	return out
+}
+
 func main() {
 	if len(os.Args) < 2 {
 		interactiveMode()
@@ -22,9 +96,85 @@ func main() {
 	unpackCmd := flag.NewFlagSet("unpack", flag.ExitOnError)
 	rawOutput := unpackCmd.Bool("raw", false, "提取为原始dtb文件")
 	output := unpackCmd.String("o", "", "指定输出文件/目录")
+	unpackFormat := unpackCmd.String("format", "", "强制指定输入格式 (dtbo/dtb/qcdt/boot/vendor_boot/appended/dir)")
+	unpackTo := unpackCmd.String("to", "", "反编译的输出格式 (dts/json/yaml)，默认为DTS")
+	unpackAnnotate := unpackCmd.Bool("annotate", false, "在DTS中以注释解释 reg/interrupts/clocks/ranges")
+	unpackJobs := unpackCmd.Int("j", 0, "并发数，默认为CPU数量")
 
 	compileCmd := flag.NewFlagSet("compile", flag.ExitOnError)
 	compileOutput := compileCmd.String("o", "", "指定输出文件/目录")
+	compileCompress := compileCmd.String("z", "", "压缩DTBO镜像输出 (gzip/lz4/lz4-legacy)")
+	compileFormat := compileCmd.String("format", "", "源文件格式 (dts/json/yaml)，默认按扩展名判断")
+	compileProfile := compileCmd.String("profile", "", "编译配置文件，默认从当前目录向上查找 "+dtb.ProfileFile)
+	var includeDirs, compileSuppress stringList
+	compileCmd.Var(&includeDirs, "I", "添加头文件搜索路径 (可重复)")
+	compileCmd.Bool("@", false, "生成 __symbols__ 节点")
+	compileCmd.Uint("p", 0, "在设备树末尾填充的字节数")
+	compileCmd.Uint("S", 0, "输出的最小总大小，不足时填充")
+	compileCmd.Uint("R", 0, "额外的空内存保留区条目数")
+	compileCmd.String("b", "", "启动CPU的物理ID，默认取 /cpus 下第一个CPU")
+	compileCmd.Bool("checks", false, "编译后按 lint 规则检查")
+	compileCmd.Var(&compileSuppress, "W", "不显示的警告，如 no-duplicate-symbol (可重复)")
+	compileJobs := compileCmd.Int("j", 0, "并发数，默认为CPU数量")
+	compileForce := compileCmd.Bool("force", false, "忽略增量编译缓存，重新编译所有文件")
+	compileDiagnostics := compileCmd.String("diagnostics", "text", "诊断信息格式 (text/json)，json 在结束时输出到标准错误")
+
+	applyCmd := flag.NewFlagSet("apply", flag.ExitOnError)
+	applyOutput := applyCmd.String("o", "", "指定合并后的DTB输出文件")
+
+	checkCmd := flag.NewFlagSet("check", flag.ExitOnError)
+
+	mkoverlayCmd := flag.NewFlagSet("mkoverlay", flag.ExitOnError)
+	mkoverlayOutput := mkoverlayCmd.String("o", "", "指定输出的overlay文件 (.dtbo 或 .dts)")
+
+	getCmd := flag.NewFlagSet("get", flag.ExitOnError)
+	getType := getCmd.String("t", "auto", "值类型 (auto/string/u32/u64/bytes)")
+
+	setCmd := flag.NewFlagSet("set", flag.ExitOnError)
+	setType := setCmd.String("t", "auto", "值类型 (auto/string/u32/u64/bytes)")
+	setCreate := setCmd.Bool("c", false, "自动创建不存在的节点")
+	setOutput := setCmd.String("o", "", "写入到其他文件而不是覆盖输入文件")
+
+	findCmd := flag.NewFlagSet("find", flag.ExitOnError)
+	findJSON := findCmd.Bool("json", false, "以JSON格式输出结果")
+
+	diffCmd := flag.NewFlagSet("diff", flag.ExitOnError)
+	diffFormat := diffCmd.String("format", "unified", "输出格式 (unified/json/summary)")
+	diffDepth := diffCmd.Int("depth", 1, "summary 统计的子树层级")
+
+	explainCmd := flag.NewFlagSet("explain", flag.ExitOnError)
+
+	refsCmd := flag.NewFlagSet("refs", flag.ExitOnError)
+
+	graphCmd := flag.NewFlagSet("graph", flag.ExitOnError)
+	graphFormat := graphCmd.String("format", "dot", "输出格式 (dot/json)")
+	graphHierarchy := graphCmd.Bool("hierarchy", false, "同时导出节点的父子关系")
+	graphOutput := graphCmd.String("o", "", "输出文件，默认输出到标准输出")
+
+	memmapCmd := flag.NewFlagSet("memmap", flag.ExitOnError)
+
+	optimizeCmd := flag.NewFlagSet("optimize", flag.ExitOnError)
+	optimizeSymbols := optimizeCmd.Bool("strip-symbols", false, "删除没有被 overlay 引用的 __symbols__ 条目")
+	optimizeLocalFixups := optimizeCmd.Bool("strip-local-fixups", false, "在安全时删除 __local_fixups__")
+	optimizeDryRun := optimizeCmd.Bool("dry-run", false, "只统计可以节省的字节数，不写入文件")
+	optimizeOutput := optimizeCmd.String("o", "", "写入到其他文件而不是覆盖输入文件")
+	var optimizeOverlays stringList
+	optimizeCmd.Var(&optimizeOverlays, "overlay", "会应用到该设备树的 overlay，其引用的符号会被保留 (可重复)")
+
+	normalizeCmd := flag.NewFlagSet("normalize", flag.ExitOnError)
+	normalizeKeep := normalizeCmd.Bool("keep-phandles", false, "不重新编号 phandle")
+	normalizeOutput := normalizeCmd.String("o", "", "写入到其他文件而不是覆盖输入文件")
+
+	validateCmd := flag.NewFlagSet("validate", flag.ExitOnError)
+	validateBindings := validateCmd.String("bindings", "", "dt-schema 绑定目录 (如内核的 Documentation/devicetree/bindings)")
+	validateVerbose := validateCmd.Bool("verbose", false, "同时列出没有匹配绑定的节点")
+
+	lintCmd := flag.NewFlagSet("lint", flag.ExitOnError)
+	lintConfig := lintCmd.String("config", "", "规则配置文件，默认从当前目录向上查找 "+lint.ConfigFile)
+	lintList := lintCmd.Bool("list", false, "列出所有规则及其级别")
+	var lintEnable, lintDisable stringList
+	lintCmd.Var(&lintEnable, "enable", "启用规则，多个规则用逗号分隔 (可重复)")
+	lintCmd.Var(&lintDisable, "disable", "关闭规则，多个规则用逗号分隔 (可重复)")
 
 	recCmd := flag.NewFlagSet("rec", flag.ExitOnError)
 	purgeBackups := recCmd.Bool("purge", false, "删除所有备份文件")
@@ -37,7 +187,17 @@ func main() {
 			printUsage()
 			return
 		}
-		if err := unpack.HandleUnpack(unpackCmd.Arg(0), *output, *rawOutput); err != nil {
+		opts := unpack.Options{Raw: *rawOutput, Annotate: *unpackAnnotate, Jobs: *unpackJobs}
+		var err error
+		if opts.Format, err = detect.ParseFormat(*unpackFormat); err != nil {
+			fmt.Printf("错误: %v\n", err)
+			return
+		}
+		if opts.Output, err = treefile.ParseFormat(*unpackTo); err != nil {
+			fmt.Printf("错误: %v\n", err)
+			return
+		}
+		if err := unpack.HandleUnpack(unpackCmd.Arg(0), *output, opts); err != nil {
 			fmt.Printf("错误: %v\n", err)
 		}
 
@@ -47,8 +207,257 @@ func main() {
 			printUsage()
 			return
 		}
-		if err := compile.HandleCompile(compileCmd.Arg(0), *compileOutput); err != nil {
+		ctype, err := compression.ParseOutputType(*compileCompress)
+		if err != nil {
+			fmt.Printf("错误: %v\n", err)
+			return
+		}
+		format, err := treefile.ParseFormat(*compileFormat)
+		if err != nil {
+			fmt.Printf("错误: %v\n", err)
+			return
+		}
+		dtcOpts, err := dtb.LoadDtcOptions(*compileProfile)
+		if err != nil {
+			fmt.Printf("错误: %v\n", err)
+			return
+		}
+		compileCmd.Visit(func(f *flag.Flag) {
+			if key, ok := dtcFlags[f.Name]; ok && err == nil {
+				err = dtcOpts.Set(key, f.Value.String())
+			}
+		})
+		if err == nil {
+			err = dtcOpts.Validate()
+		}
+		if err != nil {
+			fmt.Printf("错误: %v\n", err)
+			return
+		}
+		opts := compile.Options{Compression: ctype, Dtc: dtcOpts, Format: format, Force: *compileForce, Jobs: *compileJobs}
+		switch *compileDiagnostics {
+		case "text":
+			err = compile.HandleCompile(compileCmd.Arg(0), *compileOutput, opts)
+		case "json":
+			err = compileWithDiagnostics(compileCmd.Arg(0), *compileOutput, opts)
+		default:
+			err = fmt.Errorf("不支持的诊断格式: %s", *compileDiagnostics)
+		}
+		if err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "info":
+		if len(os.Args) < 3 {
+			printUsage()
+			return
+		}
+		if err := info.HandleInfo(os.Args[2]); err != nil {
+			fmt.Printf("错误: %v\n", err)
+		}
+
+	case "apply":
+		args := parseArgs(applyCmd, os.Args[2:])
+		if len(args) < 2 {
+			printUsage()
+			return
+		}
+		if err := apply.HandleApply(args[0], args[1:], *applyOutput); err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "check":
+		args := parseArgs(checkCmd, os.Args[2:])
+		if len(args) < 2 {
+			printUsage()
+			return
+		}
+		if err := check.HandleCheck(args[0], args[1:]); err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "mkoverlay":
+		args := parseArgs(mkoverlayCmd, os.Args[2:])
+		if len(args) != 2 {
+			printUsage()
+			return
+		}
+		if err := mkoverlay.HandleMkoverlay(args[0], args[1], *mkoverlayOutput); err != nil {
 			fmt.Printf("错误: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "get":
+		args := parseArgs(getCmd, os.Args[2:])
+		if len(args) < 2 || len(args) > 3 {
+			printUsage()
+			return
+		}
+		t, err := prop.ParseType(*getType)
+		if err != nil {
+			fmt.Printf("错误: %v\n", err)
+			return
+		}
+		name := ""
+		if len(args) == 3 {
+			name = args[2]
+		}
+		if err := prop.HandleGet(args[0], args[1], name, t); err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "set":
+		args := parseArgs(setCmd, os.Args[2:])
+		if len(args) < 3 {
+			printUsage()
+			return
+		}
+		t, err := prop.ParseType(*setType)
+		if err != nil {
+			fmt.Printf("错误: %v\n", err)
+			return
+		}
+		if err := prop.HandleSet(args[0], args[1], args[2], args[3:], t, *setCreate, *setOutput); err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "find":
+		args := parseArgs(findCmd, os.Args[2:])
+		if len(args) < 2 {
+			printUsage()
+			return
+		}
+		if err := find.HandleFind(args[0], args[1:], *findJSON); err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "diff":
+		args := parseArgs(diffCmd, os.Args[2:])
+		if len(args) != 2 {
+			printUsage()
+			return
+		}
+		differ, err := diff.HandleDiff(args[0], args[1], *diffFormat, *diffDepth)
+		if err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(2)
+		}
+		if differ {
+			os.Exit(1)
+		}
+
+	case "explain":
+		args := parseArgs(explainCmd, os.Args[2:])
+		if len(args) < 1 || len(args) > 2 {
+			printUsage()
+			return
+		}
+		path := ""
+		if len(args) == 2 {
+			path = args[1]
+		}
+		if err := explain.HandleExplain(args[0], path); err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "refs":
+		args := parseArgs(refsCmd, os.Args[2:])
+		if len(args) != 2 {
+			printUsage()
+			return
+		}
+		if err := graph.HandleRefs(args[0], args[1]); err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "graph":
+		args := parseArgs(graphCmd, os.Args[2:])
+		if len(args) != 1 {
+			printUsage()
+			return
+		}
+		if err := graph.HandleGraph(args[0], *graphFormat, *graphHierarchy, *graphOutput); err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "memmap":
+		args := parseArgs(memmapCmd, os.Args[2:])
+		if len(args) == 0 {
+			printUsage()
+			return
+		}
+		if err := memmap.HandleMemmap(args[0], args[1:]); err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "optimize":
+		args := parseArgs(optimizeCmd, os.Args[2:])
+		if len(args) != 1 {
+			printUsage()
+			return
+		}
+		opts := optimize.Options{
+			StripSymbols:     *optimizeSymbols,
+			StripLocalFixups: *optimizeLocalFixups,
+		}
+		if err := optimize.HandleOptimize(args[0], optimizeOverlays, opts, *optimizeOutput, *optimizeDryRun); err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "normalize":
+		args := parseArgs(normalizeCmd, os.Args[2:])
+		if len(args) != 1 {
+			printUsage()
+			return
+		}
+		opts := normalize.Options{KeepPhandles: *normalizeKeep}
+		if err := normalize.HandleNormalize(args[0], opts, *normalizeOutput); err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "validate":
+		args := parseArgs(validateCmd, os.Args[2:])
+		if len(args) == 0 || *validateBindings == "" {
+			printUsage()
+			return
+		}
+		if err := validate.HandleValidate(*validateBindings, args, *validateVerbose); err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "lint":
+		args := parseArgs(lintCmd, os.Args[2:])
+		opts := lint.Options{
+			Config:  *lintConfig,
+			Enable:  splitList(lintEnable),
+			Disable: splitList(lintDisable),
+		}
+		if *lintList {
+			if err := lint.ListRules(opts); err != nil {
+				fmt.Printf("错误: %v\n", err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			printUsage()
+			return
+		}
+		if err := lint.HandleLint(args, opts); err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(1)
 		}
 
 	case "-v", "--version":
@@ -73,6 +482,22 @@ func printUsage() {
     dtbotool                              # 进入交互式模式
     dtbotool unpack <输入文件> [输出文件/目录]
     dtbotool compile <输入文件/目录> [输出文件]
+    dtbotool info <输入文件>                 # 显示检测到的文件格式
+    dtbotool apply <基础DTB> <overlay>... [-o 输出文件]
+    dtbotool check <基础DTB> <overlay>...  # 检查overlay能否应用到基础DTB
+    dtbotool mkoverlay <基础DTB> <修改后的DTB> [-o 输出文件]
+    dtbotool get <文件> <节点路径> [属性]     # 读取属性值
+    dtbotool set <文件> <节点路径> <属性> [值...]  # 设置属性值
+    dtbotool find <选择器> <文件>...          # 按选择器查找节点
+    dtbotool diff <文件A> <文件B>             # 比较两个设备树的结构差异
+    dtbotool explain <文件> [节点路径]        # 解释 reg/interrupts/clocks/ranges 的取值
+    dtbotool refs <文件> <节点路径|标签>      # 列出引用该节点的所有属性
+    dtbotool graph <文件> [-o 输出文件]       # 导出 phandle 引用关系图
+    dtbotool memmap <基础DTB> [overlay...]   # 显示内存和保留区域的布局
+    dtbotool optimize <文件> [-o 输出文件]    # 压缩字符串块、去掉填充以减小体积
+    dtbotool normalize <文件> [-o 输出文件]   # 规范化排序和 phandle 编号
+    dtbotool validate --bindings <目录> <文件>...  # 按 dt-schema 绑定校验设备树
+    dtbotool lint <文件>...                  # 按规则检查设备树的常见问题
     dtbotool rec [选项]                    # 备份管理
 
 示例:
@@ -81,20 +506,103 @@ func printUsage() {
     dtbotool unpack dtbo.img --raw        # 将DTBO镜像提取为DTB文件
     dtbotool unpack device.dtb            # 将DTB转换为DTS
     dtbotool unpack dtb_dir/              # 批量转换目录中的DTB文件
+    dtbotool unpack Image.gz-dtb          # 提取内核末尾附加的DTB
+    dtbotool unpack --format dtbo dtbo    # 强制按DTBO镜像格式解包
+    dtbotool unpack --to json device.dtb  # 将DTB导出为JSON文档
+    dtbotool unpack --to yaml dtbo.img    # 将DTBO镜像的所有条目导出为YAML
+    dtbotool unpack --format qcdt --to json dt.img  # 强制按QCDT格式解包并导出为JSON
+    dtbotool info dtbo.img                # 查看文件格式信息
     dtbotool compile device.dts           # 将DTS编译为DTB
     dtbotool compile dts_dir/             # 批量编译目录中的DTS文件
     dtbotool compile dtb_dir/ dtbo.img    # 将多个DTB打包为DTBO镜像
+    dtbotool compile -z lz4 dtb_dir/      # 打包并使用LZ4压缩DTBO镜像
+    dtbotool compile -I include board.dts # 指定 #include 头文件搜索路径
+    dtbotool compile device.json          # 将JSON/YAML文档编译为DTB
+    dtbotool compile -@ -p 4096 board.dts # 生成 __symbols__ 并预留 4096 字节供引导程序修改
+    dtbotool compile -j 8 --force dts_dir/  # 以8个并发重新编译目录中的所有文件
+    dtbotool compile --diagnostics json board.dts 2> diag.json  # 以JSON输出诊断信息
+    dtbotool apply base.dtb ov.dtbo -o merged.dtb   # 将overlay应用到基础DTB
+    dtbotool apply base.dtb dtbo.img:0,2  # 应用DTBO镜像中的第0和第2个条目
+    dtbotool check base.dtb dtbo.img      # 检查DTBO镜像中所有条目的目标和引用
+    dtbotool mkoverlay base.dtb new.dtb -o diff.dts  # 根据两个DTB的差异生成overlay
+    dtbotool get device.dtb /soc/uart@1000 status    # 读取属性
+    dtbotool get -t u64 device.dtb /memory reg       # 按64位整数读取属性
+    dtbotool set dtbo.img:2 /fragment@0/__overlay__ status okay  # 修改DTBO镜像第2个条目
+    dtbotool set -t u32 device.dtb /cpus/cpu@0 clock-frequency 1800000000
+    dtbotool set -t bytes device.dtb /chosen data "de ad be ef"
+    dtbotool find '[compatible~=qcom,mdss-dsi][status=okay]' dtbo.img  # 查找所有启用的DSI节点
+    dtbotool find '/soc/**/i2c*[!status]' device.dtb  # 路径通配并要求没有status属性
+    dtbotool find --json '&uart0' dtbo.img           # 查找标签为uart0的节点并输出JSON
+    dtbotool diff old.dtb new.dtb         # 以统一diff格式显示差异
+    dtbotool diff --format summary --depth 2 dtbo.img:0 dtbo.img:1  # 按子树统计差异
+    dtbotool explain device.dtb /soc      # 按单元数属性解释 /soc 下的地址、中断和时钟
+    dtbotool unpack --annotate device.dtb # 反编译时在属性后添加解释注释
+    dtbotool refs device.dtb &gcc         # 删除或禁用节点前查看哪些属性引用了它
+    dtbotool refs dtbo.img /soc/i2c@a80000  # 在DTBO镜像的每个条目中查找引用
+    dtbotool graph device.dtb | dot -Tsvg -o refs.svg  # 导出引用关系图并用 Graphviz 绘制
+    dtbotool graph --format json --hierarchy -o refs.json device.dtb
+    dtbotool memmap device.dtb            # 检查保留区域的重叠和是否超出内存
+    dtbotool memmap device.dtb dtbo.img:3 # 应用overlay后再检查内存布局
+    dtbotool optimize --dry-run dtbo.img  # 统计每个条目可以节省的字节数
+    dtbotool optimize --strip-symbols --overlay dtbo.img base.dtb  # 只保留 overlay 用到的符号
+    dtbotool optimize --strip-local-fixups dtbo.img:2 -o small.img
+    dtbotool normalize a.dtb -o a.norm.dtb  # 规范化后语义相同的设备树逐字节相同
+    dtbotool validate --bindings linux/Documentation/devicetree/bindings dtbo.img
+    dtbotool lint --disable missing-reg,empty-overlay dtbo.img  # 关闭部分规则后检查
+    dtbotool lint --list                  # 列出所有规则及当前级别
     dtbotool rec                          # 恢复最近的备份
     dtbotool rec --list                   # 列出所有备份
     dtbotool rec --purge                  # 清理所有备份
 
 选项:
     --raw    提取为DTB文件而不是转换为DTS
+    --to     unpack 反编译的输出格式 dts/json/yaml，默认为DTS
+    --annotate  unpack 时以注释解释 reg/interrupts/clocks/ranges 的取值
+    --format unpack: 强制指定输入格式，默认根据文件内容自动检测
+             compile: 指定源文件格式 (dts/json/yaml)，默认按扩展名判断
+             diff: 输出格式 unified/json/summary，json 为 RFC 6902 JSON Patch
+             graph: 输出格式 dot/json，未被引用的 phandle 节点会被标出
     -o       指定输出文件/目录(可选)
+    -z       压缩打包输出的DTBO镜像 (gzip/lz4/lz4-legacy，bzip2 只能读取)
+    -I       添加 #include 头文件搜索路径，可重复指定
+    -@ -p -S -R -b  compile 时生成 __symbols__、末尾填充字节数、最小总大小、
+             额外的空保留区条目数、启动CPU的物理ID，与 dtc 的同名参数相同
+    -W       compile 时不显示的警告 (编译警告或 lint 规则，可写为 no-<规则>)
+    --checks    compile 后按 lint 规则检查，发现错误时编译失败
+    -j       unpack/compile 批量反编译、编译和校验DTBO条目时的并发数，默认为CPU数量；
+             每个文件的输出按顺序显示，失败的文件在最后汇总
+    --force  compile 目录时忽略增量编译缓存，重新编译所有文件。缓存清单 .dtbcache.json
+             保存在输出目录中，源文件、包含文件和编译选项都未变化的文件会被跳过
+    --diagnostics  compile 的诊断格式: text 按 "文件:行:列: 级别: 消息" 输出；
+                json 在结束时将所有警告和错误以JSON数组输出到标准错误，供编辑器使用
+    --profile   compile 配置文件，每行 "选项: 值"，默认从当前目录向上查找 .dtcprofile；
+                选项为 symbols/include/padding/size/reserve/boot-cpu/checks/suppress，
+                命令行参数覆盖配置文件
+    -t       get/set 的值类型: string(可多个值组成列表)/u32/u64/bytes，默认自动推断
+    -c       set 时自动创建不存在的节点
+    --json   find 以JSON格式输出结果
+    --depth  diff --format summary 统计的子树层级，默认1
+    --strip-symbols       optimize 时删除没有被 overlay 引用的 __symbols__ 条目，
+                          需要用 --overlay 指定会应用的 overlay (输入本身是 overlay 时除外)
+    --strip-local-fixups  optimize 时删除不含内部 phandle 引用的 __local_fixups__
+    --dry-run   optimize 只统计不写入
+    --keep-phandles  normalize 时只排序，不重新编号 phandle。无法识别的属性中有数值
+                     等于已有的 phandle 时，normalize 保留这些 phandle 的编号并给出警告
+    --hierarchy graph 时同时导出节点的父子关系
+    --bindings  validate 使用的绑定目录，离线加载其中所有 .yaml 文件
+    --verbose   validate 时同时列出没有匹配绑定的节点
+    --enable/--disable  lint 启用或关闭规则 (逗号分隔，all 表示全部)
+    --config    lint 规则配置文件，每行 "规则ID: off|warning|error"，
+                默认从当前目录向上查找 .dtblint
     -v       显示版本信息
     -h       显示帮助信息
     --list   列出所有备份文件
     --purge  删除所有备份文件
+
+选择器语法:
+    [&标签][/路径模式][谓词...]
+    路径段支持 * ? 通配，** 匹配任意层级，省略路径时匹配所有节点
+    谓词: [prop] [!prop] [prop=值] [prop!=值] [prop~=子串] [prop^=前缀] [prop$=后缀]
 `, VERSION)
 }
 
@@ -152,7 +660,7 @@ func interactiveMode() {
 			fmt.Print("是否提取为原始DTB文件? [y/N]: ")
 			var raw string
 			fmt.Scanln(&raw)
-			if err := unpack.HandleUnpack(input, "", strings.ToLower(raw) == "y"); err != nil {
+			if err := unpack.HandleUnpack(input, "", unpack.Options{Raw: strings.ToLower(raw) == "y"}); err != nil {
 				fmt.Printf("错误: %v\n", err)
 			}
 
@@ -160,7 +668,12 @@ func interactiveMode() {
 			fmt.Print("\n请输入要编译的文件/目录路径: ")
 			var input string
 			fmt.Scanln(&input)
-			if err := compile.HandleCompile(input, ""); err != nil {
+			dtcOpts, err := dtb.LoadDtcOptions("")
+			if err != nil {
+				fmt.Printf("错误: %v\n", err)
+				continue
+			}
+			if err := compile.HandleCompile(input, "", compile.Options{Dtc: dtcOpts}); err != nil {
 				fmt.Printf("错误: %v\n", err)
 			}
 
@@ -179,3 +692,20 @@ func interactiveMode() {
 		}
 	}
 }
+
+// compileWithDiagnostics 编译并收集所有诊断，结束时以JSON输出到标准错误。
+// 没有诊断对应的失败 (如输入不存在) 作为输入文件的错误加入
+func compileWithDiagnostics(input, output string, opts compile.Options) error {
+	var diags []diag.Diagnostic
+	opts.Report = func(d diag.Diagnostic) {
+		diags = append(diags, d)
+	}
+	err := compile.HandleCompile(input, output, opts)
+	if err != nil && !slices.ContainsFunc(diags, func(d diag.Diagnostic) bool { return d.Severity == diag.Error }) {
+		diags = append(diags, diag.FromError(input, err))
+	}
+	if werr := diag.WriteJSON(os.Stderr, diags); werr != nil && err == nil {
+		err = werr
+	}
+	return err
+}